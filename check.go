@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"graphql-comments/config"
+	"graphql-comments/migrations"
+	"graphql-comments/storage"
+)
+
+var errCheckFailed = errors.New("check failed")
+
+// Проверяет, что с текущей конфигурацией сервер сможет стартовать: схема бд актуальна и хранилище отвечает.
+// В отличие от serve миграции не накатываются
+func runCheck(cfg *config.Config, args []string) error {
+	if err := parseFlags(flag.NewFlagSet("check", flag.ContinueOnError), args); err != nil {
+		return err
+	}
+	fmt.Printf("ok   config: storage %s\n", cfg.StorageType)
+
+	failed := false
+	report := func(name string, err error, details string) {
+		if err != nil {
+			failed = true
+			fmt.Printf("FAIL %s: %v\n", name, err)
+			return
+		}
+		fmt.Printf("ok   %s: %s\n", name, details)
+	}
+
+	if cfg.StorageType != storage.StorageTypeInmemory {
+		status, err := schemaStatus(cfg)
+		report("schema", err, fmt.Sprintf("version %d", status.Version))
+	}
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		report("storage", err, "")
+		return errCheckFailed
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HealthCheckTimeout)
+	defer cancel()
+	report("storage", store.Ping(ctx), "ping")
+
+	if failed {
+		return errCheckFailed
+	}
+	return nil
+}
+
+func schemaStatus(cfg *config.Config) (migrations.Status, error) {
+	var m *migrations.Migrator
+	var err error
+	if cfg.StorageType == storage.StorageTypePostgres {
+		m, err = migrations.OpenPostgres(cfg)
+	} else {
+		m, err = migrations.OpenSQLite(cfg)
+	}
+	if err != nil {
+		return migrations.Status{}, err
+	}
+	defer m.Close()
+
+	status, err := m.Status()
+	if err != nil {
+		return status, err
+	}
+	if status.Dirty {
+		return status, fmt.Errorf("migration %d did not finish, fix the schema and run migrate force", status.Version)
+	}
+	if len(status.Pending) > 0 {
+		return status, fmt.Errorf("version %d, pending migrations %v", status.Version, status.Pending)
+	}
+	return status, nil
+}
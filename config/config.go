@@ -1,19 +1,56 @@
 package config
 
 import (
-	"time"
 	"github.com/kelseyhightower/envconfig"
+	"time"
 )
 
 // структура содержит все необходимые конфигурации сервиса
 type Config struct {
 	ServerPort      string        `default:"8080" split_words:"true"`
 	DatabaseURL     string        `default:"" split_words:"true"`
-	StorageType     string        `default:"inmemory" split_words:"true"` // "inmemory" или "postgres"
+	StorageType     string        `default:"inmemory" split_words:"true"` // "inmemory", "postgres" или "sqlite"
 	PostgresMaxConn int           `default:"10" split_words:"true"`
 	ReadTimeout     time.Duration `default:"5s" split_words:"true"`
 	WriteTimeout    time.Duration `default:"5s" split_words:"true"`
-	MigrationsPath  string        `default:"pg_setup.up.sql" split_words:"true"`
+	MigrationsPath  string        `default:"" split_words:"true"`            // каталог миграций Postgres, пустой путь использует вшитые в бинарник
+	SqlitePath      string        `default:"comments.db" split_words:"true"` // файл базы для STORAGE_TYPE=sqlite
+
+	// транспорты GraphQL
+	AllowedOrigins        []string      `default:"*" split_words:"true"`    // список разрешенных Origin через запятую, "*" разрешает все
+	WebsocketKeepAlive    time.Duration `default:"10s" split_words:"true"`  // keepalive для протокола graphql-ws
+	WebsocketPingInterval time.Duration `default:"10s" split_words:"true"`  // ping/pong для протокола graphql-transport-ws
+	SSEEnabled            bool          `default:"true" split_words:"true"` // транспорт Server-Sent Events для подписок
+
+	TenantsPath string `default:"" split_words:"true"` // JSON файл с сайтами, пустой путь оставляет один сайт default
+
+	// снапшоты inmemory хранилища
+	SnapshotPath     string        `default:"" split_words:"true"`   // файл снапшота, пустой путь отключает сохранение на диск
+	SnapshotInterval time.Duration `default:"1m" split_words:"true"` // период снапшотов, 0 оставляет только снапшот при остановке
+	WALPath          string        `default:"" split_words:"true"`   // журнал упреждающей записи, требует SnapshotPath, пустой путь отключает журнал
+
+	MetricsEnabled bool `default:"true" split_words:"true"` // метрики Prometheus на /metrics
+
+	// пробы /healthz и /readyz и остановка
+	HealthCheckTimeout time.Duration `default:"2s" split_words:"true"` // сколько ждать ответа хранилища в /readyz
+	ShutdownDelay      time.Duration `default:"5s" split_words:"true"` // сколько /readyz отказывает до остановки сервера, чтобы балансировщик успел убрать под
+
+	LogLevel string `default:"info" split_words:"true"` // debug, info, warn или error
+
+	// трейсинг OpenTelemetry
+	ServiceName        string  `default:"graphql-comments" split_words:"true"`
+	TracingExporter    string  `default:"none" split_words:"true"`    // "none", "stdout" или "otlp"
+	TracingSampleRatio float64 `default:"1" split_words:"true"`       // доля трейсов, которые начинаются в сервисе
+	OTLPEndpoint       string  `default:"" envconfig:"OTLP_ENDPOINT"` // host:port коллектора, по умолчанию из OTEL_EXPORTER_OTLP_ENDPOINT
+	OTLPInsecure       bool    `default:"false" envconfig:"OTLP_INSECURE"`
+
+	// кеш чтений поверх любого хранилища
+	CacheEnabled bool          `default:"false" split_words:"true"`
+	CacheSize    int           `default:"1000" split_words:"true"` // максимальное число закешированных запросов
+	CacheTTL     time.Duration `default:"30s" split_words:"true"`  // время жизни записи в кеше
+
+	IdempotencyKeyTTL time.Duration `default:"24h" split_words:"true"` // сколько ключ идемпотентности мутаций защищает от повторов
+	PublishInterval   time.Duration `default:"30s" split_words:"true"` // как часто публиковать запланированные посты, 0 отключает планировщик
 }
 
 // подгружает конфигурации из перменных окружения
@@ -20,7 +20,30 @@ func TestLoadConfigDefaults(t *testing.T) {
 	assert.Equal(t, 10, config.PostgresMaxConn)
 	assert.Equal(t, 5*time.Second, config.ReadTimeout)
 	assert.Equal(t, 5*time.Second, config.WriteTimeout)
-	assert.Equal(t, "pg_setup.up.sql", config.MigrationsPath)
+	assert.Equal(t, "", config.MigrationsPath)
+	assert.Equal(t, "comments.db", config.SqlitePath)
+	assert.Equal(t, []string{"*"}, config.AllowedOrigins)
+	assert.Equal(t, 10*time.Second, config.WebsocketKeepAlive)
+	assert.Equal(t, 10*time.Second, config.WebsocketPingInterval)
+	assert.True(t, config.SSEEnabled)
+	assert.Equal(t, "", config.SnapshotPath)
+	assert.Equal(t, time.Minute, config.SnapshotInterval)
+	assert.Equal(t, "", config.WALPath)
+	assert.Equal(t, "", config.TenantsPath)
+	assert.True(t, config.MetricsEnabled)
+	assert.False(t, config.CacheEnabled)
+	assert.Equal(t, 1000, config.CacheSize)
+	assert.Equal(t, 30*time.Second, config.CacheTTL)
+	assert.Equal(t, 24*time.Hour, config.IdempotencyKeyTTL)
+	assert.Equal(t, 30*time.Second, config.PublishInterval)
+	assert.Equal(t, 2*time.Second, config.HealthCheckTimeout)
+	assert.Equal(t, 5*time.Second, config.ShutdownDelay)
+	assert.Equal(t, "info", config.LogLevel)
+	assert.Equal(t, "graphql-comments", config.ServiceName)
+	assert.Equal(t, "none", config.TracingExporter)
+	assert.Equal(t, 1.0, config.TracingSampleRatio)
+	assert.Equal(t, "", config.OTLPEndpoint)
+	assert.False(t, config.OTLPInsecure)
 }
 
 func TestLoadConfigFromEnv(t *testing.T) {
@@ -32,6 +55,27 @@ func TestLoadConfigFromEnv(t *testing.T) {
 	os.Setenv("READ_TIMEOUT", "10s")
 	os.Setenv("WRITE_TIMEOUT", "10s")
 	os.Setenv("MIGRATIONS_PATH", "migrations.sql")
+	os.Setenv("SQLITE_PATH", "/var/lib/comments/comments.db")
+	os.Setenv("ALLOWED_ORIGINS", "https://example.com,https://blog.example.com")
+	os.Setenv("WEBSOCKET_KEEP_ALIVE", "30s")
+	os.Setenv("WEBSOCKET_PING_INTERVAL", "15s")
+	os.Setenv("SSE_ENABLED", "false")
+	os.Setenv("TENANTS_PATH", "/etc/comments/tenants.json")
+	os.Setenv("SNAPSHOT_PATH", "/var/lib/comments/snapshot.json")
+	os.Setenv("SNAPSHOT_INTERVAL", "30s")
+	os.Setenv("WAL_PATH", "/var/lib/comments/wal.jsonl")
+	os.Setenv("METRICS_ENABLED", "false")
+	os.Setenv("CACHE_ENABLED", "true")
+	os.Setenv("CACHE_SIZE", "500")
+	os.Setenv("CACHE_TTL", "1m")
+	os.Setenv("HEALTH_CHECK_TIMEOUT", "1s")
+	os.Setenv("SHUTDOWN_DELAY", "0s")
+	os.Setenv("LOG_LEVEL", "debug")
+	os.Setenv("SERVICE_NAME", "comments-eu")
+	os.Setenv("TRACING_EXPORTER", "otlp")
+	os.Setenv("TRACING_SAMPLE_RATIO", "0.25")
+	os.Setenv("OTLP_ENDPOINT", "collector:4318")
+	os.Setenv("OTLP_INSECURE", "true")
 
 	config, err := LoadConfig()
 	assert.NoError(t, err)
@@ -42,4 +86,25 @@ func TestLoadConfigFromEnv(t *testing.T) {
 	assert.Equal(t, 10*time.Second, config.ReadTimeout)
 	assert.Equal(t, 10*time.Second, config.WriteTimeout)
 	assert.Equal(t, "migrations.sql", config.MigrationsPath)
+	assert.Equal(t, "/var/lib/comments/comments.db", config.SqlitePath)
+	assert.Equal(t, []string{"https://example.com", "https://blog.example.com"}, config.AllowedOrigins)
+	assert.Equal(t, 30*time.Second, config.WebsocketKeepAlive)
+	assert.Equal(t, 15*time.Second, config.WebsocketPingInterval)
+	assert.False(t, config.SSEEnabled)
+	assert.Equal(t, "/etc/comments/tenants.json", config.TenantsPath)
+	assert.Equal(t, "/var/lib/comments/snapshot.json", config.SnapshotPath)
+	assert.Equal(t, 30*time.Second, config.SnapshotInterval)
+	assert.Equal(t, "/var/lib/comments/wal.jsonl", config.WALPath)
+	assert.False(t, config.MetricsEnabled)
+	assert.True(t, config.CacheEnabled)
+	assert.Equal(t, 500, config.CacheSize)
+	assert.Equal(t, time.Minute, config.CacheTTL)
+	assert.Equal(t, time.Second, config.HealthCheckTimeout)
+	assert.Equal(t, time.Duration(0), config.ShutdownDelay)
+	assert.Equal(t, "debug", config.LogLevel)
+	assert.Equal(t, "comments-eu", config.ServiceName)
+	assert.Equal(t, "otlp", config.TracingExporter)
+	assert.Equal(t, 0.25, config.TracingSampleRatio)
+	assert.Equal(t, "collector:4318", config.OTLPEndpoint)
+	assert.True(t, config.OTLPInsecure)
 }
@@ -0,0 +1,109 @@
+package diff
+
+import "strings"
+
+// Операция над строкой при переходе от старого текста к новому
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// Строка построчного диффа
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Больше стольких клеток таблица LCS не строится, тексты такого размера
+// показываются как удаление старого и вставка нового целиком
+const maxCells = 4_000_000
+
+// Построчный дифф между a и b. Общие строки находятся через наибольшую общую подпоследовательность,
+// в каждом измененном месте удаления идут раньше вставок
+func Lines(a, b string) []Line {
+	return diff(split(a), split(b))
+}
+
+func split(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+func diff(a, b []string) []Line {
+	// общие начало и конец не участвуют в таблице, обычно правка затрагивает небольшой кусок текста
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]Line, 0, len(a)+len(b)-prefix-suffix)
+	for _, text := range a[:prefix] {
+		lines = append(lines, Line{Op: Equal, Text: text})
+	}
+	lines = append(lines, middle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, Line{Op: Equal, Text: text})
+	}
+	return lines
+}
+
+func middle(a, b []string) []Line {
+	var lines []Line
+	if (len(a)+1)*(len(b)+1) > maxCells {
+		for _, text := range a {
+			lines = append(lines, Line{Op: Delete, Text: text})
+		}
+		for _, text := range b {
+			lines = append(lines, Line{Op: Insert, Text: text})
+		}
+		return lines
+	}
+
+	// lcs[i][j] длина наибольшей общей подпоследовательности a[i:] и b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, Line{Op: Equal, Text: a[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, Line{Op: Delete, Text: a[i]})
+			i++
+		default:
+			lines = append(lines, Line{Op: Insert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, Line{Op: Delete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, Line{Op: Insert, Text: b[j]})
+	}
+	return lines
+}
@@ -0,0 +1,29 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{"equal", "a\nb", "a\nb", []Line{{Equal, "a"}, {Equal, "b"}}},
+		{"empty to text", "", "a", []Line{{Insert, "a"}}},
+		{"text to empty", "a\n", "", []Line{{Delete, "a"}}},
+		{"replace middle", "a\nb\nc", "a\nx\nc", []Line{{Equal, "a"}, {Delete, "b"}, {Insert, "x"}, {Equal, "c"}}},
+		{"insert and delete", "a\nb\nc\nd", "b\nc\ne\nd", []Line{
+			{Delete, "a"}, {Equal, "b"}, {Equal, "c"}, {Insert, "e"}, {Equal, "d"},
+		}},
+		{"trailing newline ignored", "a\n", "a", []Line{{Equal, "a"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Lines(tt.a, tt.b))
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package graph
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"graphql-comments/models"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// сколько ключ идемпотентности защищает от повторов, если в Resolver не задано другое
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// как в схеме бд
+const maxIdempotencyKeyLength = 255
+
+// сколько ждать хранилище при фиксации ключа, запрос клиента к этому моменту может быть уже отменен
+const idempotencyCleanupTimeout = 5 * time.Second
+
+// коды ошибок в extensions.code
+const (
+	codeInvalidIdempotencyKey    = "INVALID_IDEMPOTENCY_KEY"
+	codeIdempotencyKeyReused     = "IDEMPOTENCY_KEY_REUSED"
+	codeIdempotencyKeyInProgress = "IDEMPOTENCY_KEY_IN_PROGRESS"
+)
+
+func codedError(code, message string) error {
+	err := gqlerror.Errorf("%s", message)
+	err.Extensions = map[string]interface{}{"code": code}
+	return err
+}
+
+// Выполняет create не больше одного раза на ключ. Без ключа create вызывается как обычно.
+// Для повтора с тем же input возвращает id записи из первого запроса и replay=true,
+// тот же ключ с другим input отклоняется
+func (r *Resolver) idempotent(ctx context.Context, scope string, key *string, input interface{}, create func() (int, error)) (id int, replay bool, err error) {
+	if key == nil {
+		id, err = create()
+		return id, false, err
+	}
+	if *key == "" || len(*key) > maxIdempotencyKeyLength {
+		return 0, false, codedError(codeInvalidIdempotencyKey, "idempotency key must be 1 to 255 bytes long")
+	}
+
+	hash, err := requestHash(input)
+	if err != nil {
+		return 0, false, err
+	}
+	existing, err := r.DB.ReserveIdempotencyKey(ctx, models.IdempotencyKey{
+		Scope:       scope,
+		Key:         *key,
+		RequestHash: hash,
+		ExpiresAt:   time.Now().Add(r.IdempotencyTTL),
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	if existing != nil {
+		switch {
+		case existing.RequestHash != hash:
+			return 0, false, codedError(codeIdempotencyKeyReused, "idempotency key was already used with a different input")
+		case existing.ResultID == 0:
+			return 0, false, codedError(codeIdempotencyKeyInProgress, "a request with this idempotency key is still in progress")
+		}
+		return existing.ResultID, true, nil
+	}
+
+	id, err = create()
+
+	// отмена запроса не должна оставить ключ занятым, но ключ принадлежит сайту запроса
+	cleanupCtx, cancel := context.WithTimeout(models.WithTenant(context.Background(), models.TenantFromContext(ctx)), idempotencyCleanupTimeout)
+	defer cancel()
+	if err != nil {
+		// запись не создана, клиент должен иметь возможность повторить запрос с тем же ключом
+		if releaseErr := r.DB.ReleaseIdempotencyKey(cleanupCtx, scope, *key); releaseErr != nil {
+			zerolog.Ctx(ctx).Error().Err(releaseErr).Str("scope", scope).Msg("failed to release idempotency key")
+		}
+		return 0, false, err
+	}
+	// запись уже создана, поэтому без результата у ключа повторы до его истечения получат IN_PROGRESS
+	if completeErr := r.DB.CompleteIdempotencyKey(cleanupCtx, scope, *key, id); completeErr != nil {
+		zerolog.Ctx(ctx).Error().Err(completeErr).Str("scope", scope).Int("result_id", id).Msg("failed to complete idempotency key")
+	}
+	return id, false, nil
+}
+
+// Хеш input мутации. Поля структур сериализуются в порядке объявления, поэтому одинаковый input дает одинаковый хеш
+func requestHash(input interface{}) (string, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,126 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"graphql-comments/graph/model"
+	"graphql-comments/models"
+	"graphql-comments/storage/inmemory"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func errorCode(t *testing.T, err error) string {
+	var gqlErr *gqlerror.Error
+	require.True(t, errors.As(err, &gqlErr), err)
+	code, _ := gqlErr.Extensions["code"].(string)
+	return code
+}
+
+func TestCreateCommentIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+
+	key := "retry-1"
+	post, err := resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Тест", AllowComments: true}, &key)
+	require.NoError(t, err)
+	repeated, err := resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Тест", AllowComments: true}, &key)
+	require.NoError(t, err)
+	assert.Equal(t, post.ID, repeated.ID)
+
+	// у createComment свои ключи, тот же ключ не пересекается с createPost
+	input := model.NewComment{PostID: post.ID, Text: "@masha привет", Author: "Вася"}
+	comment, err := resolver.Mutation().CreateComment(ctx, input, &key)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		again, err := resolver.Mutation().CreateComment(ctx, input, &key)
+		require.NoError(t, err)
+		assert.Equal(t, comment.ID, again.ID)
+		assert.True(t, comment.CreatedAt.Equal(again.CreatedAt))
+	}
+	comments, err := store.GetComments(ctx, post.ID, nil, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, comments, 1)
+
+	// упоминание пришло один раз, повторы не рассылают уведомления заново
+	inbox, err := store.GetNotifications(ctx, "masha", 10, 0, false)
+	require.NoError(t, err)
+	assert.Len(t, inbox, 1)
+
+	input.Text = "другой текст"
+	_, err = resolver.Mutation().CreateComment(ctx, input, &key)
+	assert.Equal(t, codeIdempotencyKeyReused, errorCode(t, err))
+
+	empty := ""
+	_, err = resolver.Mutation().CreateComment(ctx, input, &empty)
+	assert.Equal(t, codeInvalidIdempotencyKey, errorCode(t, err))
+}
+
+func TestIdempotencyKeyReleasedOnFailure(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+
+	key := "after-failure"
+	input := model.NewComment{PostID: 1, Text: "рано", Author: "Вася"}
+	_, err = resolver.Mutation().CreateComment(ctx, input, &key)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+
+	// пост появился, повтор с тем же ключом выполняется, а не получает IN_PROGRESS
+	_, err = store.CreatePost(ctx, models.Post{Title: "Тест", AllowComments: true})
+	require.NoError(t, err)
+	comment, err := resolver.Mutation().CreateComment(ctx, input, &key)
+	require.NoError(t, err)
+	assert.Equal(t, 1, comment.PostID)
+}
+
+func TestIdempotencyKeyInProgress(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+
+	key := "slow"
+	input := model.NewPost{Title: "Тест"}
+	_, _, err = resolver.idempotent(ctx, models.IdempotencyScopeCreatePost, &key, input, func() (int, error) {
+		// повтор приходит, пока первый запрос еще выполняется
+		_, err := resolver.Mutation().CreatePost(ctx, input, &key)
+		assert.Equal(t, codeIdempotencyKeyInProgress, errorCode(t, err))
+		return 1, nil
+	})
+	require.NoError(t, err)
+}
+
+func TestIdempotencyKeyUnderTenant(t *testing.T) {
+	ctx := models.WithTenant(context.Background(), "shop")
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+
+	// повтор на сайте не по умолчанию получает исходный пост, а не IN_PROGRESS
+	key := "shop-retry"
+	post, err := resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Тест", AllowComments: true}, &key)
+	require.NoError(t, err)
+	repeated, err := resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Тест", AllowComments: true}, &key)
+	require.NoError(t, err)
+	assert.Equal(t, post.ID, repeated.ID)
+
+	// неудачный запрос освобождает ключ своего сайта
+	failed := "shop-failure"
+	input := model.NewComment{PostID: post.ID + 1, Text: "рано", Author: "Вася"}
+	_, err = resolver.Mutation().CreateComment(ctx, input, &failed)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	next, err := store.CreatePost(ctx, models.Post{Title: "Второй", AllowComments: true})
+	require.NoError(t, err)
+	require.Equal(t, input.PostID, next.ID)
+	comment, err := resolver.Mutation().CreateComment(ctx, input, &failed)
+	require.NoError(t, err)
+	assert.Equal(t, next.ID, comment.PostID)
+}
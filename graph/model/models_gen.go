@@ -2,21 +2,63 @@
 
 package model
 
+import (
+	"fmt"
+	"graphql-comments/models"
+	"io"
+	"strconv"
+	"time"
+)
+
+type DiffLine struct {
+	Op   DiffOp `json:"op"`
+	Text string `json:"text"`
+}
+
+// idempotencyKey защищает от дублей при повторной отправке: повтор с тем же ключом и тем же input
+// возвращает уже созданную запись, а тот же ключ с другим input отклоняется с кодом IDEMPOTENCY_KEY_REUSED.
+// Ключ хранится ограниченное время, после него считается новым
 type Mutation struct {
 }
 
 type NewComment struct {
-	PostID   int    `json:"postId"`
-	ParentID *int   `json:"parentId,omitempty"`
-	Text     string `json:"text"`
-	Author   string `json:"author"`
+	PostID   int               `json:"postId"`
+	ParentID *int              `json:"parentId,omitempty"`
+	Text     string            `json:"text"`
+	Author   string            `json:"author"`
+	Format   models.TextFormat `json:"format"`
 }
 
+// status SCHEDULED требует publishAt в будущем, для других статусов publishAt не задается
 type NewPost struct {
-	Title         string `json:"title"`
-	Content       string `json:"content"`
-	Author        string `json:"author"`
-	AllowComments bool   `json:"allowComments"`
+	Title         string            `json:"title"`
+	Content       string            `json:"content"`
+	Author        string            `json:"author"`
+	AllowComments bool              `json:"allowComments"`
+	Format        models.TextFormat `json:"format"`
+	Status        models.PostStatus `json:"status"`
+	PublishAt     *time.Time        `json:"publishAt,omitempty"`
+	Tags          []string          `json:"tags,omitempty"`
+	Category      *string           `json:"category,omitempty"`
+}
+
+// Комментарий к внешнему ресурсу, первый комментарий создает его тред
+type NewThreadComment struct {
+	Namespace string            `json:"namespace"`
+	Key       string            `json:"key"`
+	ParentID  *int              `json:"parentId,omitempty"`
+	Text      string            `json:"text"`
+	Author    string            `json:"author"`
+	Format    models.TextFormat `json:"format"`
+}
+
+// Построчная разница между версиями from и to одного поста
+type PostDiff struct {
+	PostID  int         `json:"postId"`
+	From    int         `json:"from"`
+	To      int         `json:"to"`
+	Title   []*DiffLine `json:"title"`
+	Content []*DiffLine `json:"content"`
 }
 
 type Query struct {
@@ -24,3 +66,61 @@ type Query struct {
 
 type Subscription struct {
 }
+
+// Правка поста. Незаданные поля остаются прежними. expectedVersion это версия, с которой начиналось
+// редактирование: если пост с тех пор изменили, мутация вернет ошибку с кодом CONFLICT
+// и текущей версией в extensions.currentVersion
+type UpdatePost struct {
+	ID              int                `json:"id"`
+	ExpectedVersion int                `json:"expectedVersion"`
+	Title           *string            `json:"title,omitempty"`
+	Content         *string            `json:"content,omitempty"`
+	Format          *models.TextFormat `json:"format,omitempty"`
+	AllowComments   *bool              `json:"allowComments,omitempty"`
+	// хендл модератора, который правит чужой пост: автор получит уведомление MODERATION с причиной reason
+	Moderator *string `json:"moderator,omitempty"`
+	Reason    *string `json:"reason,omitempty"`
+}
+
+type DiffOp string
+
+const (
+	DiffOpEqual  DiffOp = "EQUAL"
+	DiffOpInsert DiffOp = "INSERT"
+	DiffOpDelete DiffOp = "DELETE"
+)
+
+var AllDiffOp = []DiffOp{
+	DiffOpEqual,
+	DiffOpInsert,
+	DiffOpDelete,
+}
+
+func (e DiffOp) IsValid() bool {
+	switch e {
+	case DiffOpEqual, DiffOpInsert, DiffOpDelete:
+		return true
+	}
+	return false
+}
+
+func (e DiffOp) String() string {
+	return string(e)
+}
+
+func (e *DiffOp) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = DiffOp(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid DiffOp", str)
+	}
+	return nil
+}
+
+func (e DiffOp) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -0,0 +1,60 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"graphql-comments/models"
+	"time"
+)
+
+var (
+	errScheduleInPast     = errors.New("scheduled post requires publishAt in the future")
+	errPublishAtNotNeeded = errors.New("publishAt can only be set for a scheduled post")
+)
+
+// Проверяет статус и время публикации нового поста
+func validatePublishing(status models.PostStatus, publishAt *time.Time, now time.Time) error {
+	if status == models.PostStatusScheduled {
+		if publishAt == nil || !publishAt.After(now) {
+			return errScheduleInPast
+		}
+		return nil
+	}
+	if publishAt != nil {
+		return errPublishAtNotNeeded
+	}
+	return nil
+}
+
+// Время в будущем планирует публикацию, без времени или с прошедшим временем пост публикуется сразу.
+// Уже опубликованный пост остается как есть, чтобы повторный вызов не сдвигал время публикации
+func (r *mutationResolver) publishPost(ctx context.Context, id int, publishAt *time.Time, now time.Time) (*models.Post, error) {
+	if publishAt != nil && publishAt.After(now) {
+		post, err := r.DB.SetPostStatus(ctx, id, models.PostStatusScheduled, publishAt)
+		if err != nil {
+			return nil, err
+		}
+		return &post, nil
+	}
+
+	current, err := r.DB.GetPost(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if current.Status == models.PostStatusPublished {
+		return current, nil
+	}
+
+	post, err := r.DB.SetPostStatus(ctx, id, models.PostStatusPublished, &now)
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
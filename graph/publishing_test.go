@@ -0,0 +1,195 @@
+package graph
+
+import (
+	"context"
+	"graphql-comments/graph/model"
+	"graphql-comments/models"
+	"graphql-comments/storage/inmemory"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDraftVisibility(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+
+	draft, err := resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Черновик", Author: "Вася", AllowComments: true, Status: models.PostStatusDraft}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.PostStatusDraft, draft.Status)
+
+	posts, err := resolver.Query().Posts(ctx, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, posts)
+	author := "Вася"
+	posts, err = resolver.Query().Posts(ctx, &author, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, posts, 1)
+
+	// чужой черновик не отличить от несуществующего поста
+	_, err = resolver.Query().Post(ctx, draft.ID, nil)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = resolver.fetchNode(ctx, models.NodeTypePost, draft.ID)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	got, err := resolver.Query().Post(ctx, draft.ID, &author)
+	require.NoError(t, err)
+	assert.Equal(t, draft.ID, got.ID)
+
+	_, err = resolver.Mutation().CreateComment(ctx, model.NewComment{PostID: draft.ID, Text: "Рано", Author: "Гость"}, nil)
+	assert.ErrorIs(t, err, models.ErrCommentsAreNotAllowed)
+}
+
+func TestUnpublishedPostHidesComments(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+
+	post, err := resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Пост", Author: "Вася", AllowComments: true}, nil)
+	require.NoError(t, err)
+	comment, err := resolver.Mutation().CreateComment(ctx, model.NewComment{PostID: post.ID, Text: "@masha смотри", Author: "Гость"}, nil)
+	require.NoError(t, err)
+	draft, err := resolver.Mutation().UnpublishPost(ctx, post.ID, nil, nil)
+	require.NoError(t, err)
+
+	// комментарии снятого с публикации поста видны только автору
+	_, err = resolver.Query().Comments(ctx, post.ID, nil, 10, nil, nil)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = resolver.Post().Replies(ctx, draft, 10, nil, nil)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = resolver.fetchNode(ctx, models.NodeTypeComment, comment.ID)
+	assert.ErrorIs(t, err, models.ErrCommentNotFound)
+	mentions, err := resolver.Query().Mentions(ctx, "masha", 10, nil)
+	require.NoError(t, err)
+	assert.Empty(t, mentions)
+
+	author := "Вася"
+	comments, err := resolver.Query().Comments(ctx, post.ID, nil, 10, nil, &author)
+	require.NoError(t, err)
+	assert.Len(t, comments, 1)
+	replies, err := resolver.Post().Replies(ctx, draft, 10, nil, &author)
+	require.NoError(t, err)
+	assert.Len(t, replies, 1)
+}
+
+func TestDraftRevisionsHidden(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+
+	draft, err := resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Черновик", Author: "Вася", Content: "секрет", AllowComments: true, Status: models.PostStatusDraft}, nil)
+	require.NoError(t, err)
+	content := "новый секрет"
+	_, err = resolver.Mutation().UpdatePost(ctx, model.UpdatePost{ID: draft.ID, ExpectedVersion: 1, Content: &content})
+	require.NoError(t, err)
+
+	// история черновика видна только автору
+	_, err = resolver.Query().Revisions(ctx, draft.ID, nil)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	stranger := "Петя"
+	_, err = resolver.Query().PostDiff(ctx, draft.ID, 1, 2, &stranger)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+
+	author := "Вася"
+	revisions, err := resolver.Query().Revisions(ctx, draft.ID, &author)
+	require.NoError(t, err)
+	assert.Len(t, revisions, 2)
+	_, err = resolver.Query().PostDiff(ctx, draft.ID, 1, 2, &author)
+	assert.NoError(t, err)
+}
+
+func TestCreatePostPublishingValidation(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	_, err = resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Тест", Status: models.PostStatusScheduled}, nil)
+	assert.ErrorIs(t, err, errScheduleInPast)
+	_, err = resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Тест", Status: models.PostStatusScheduled, PublishAt: &past}, nil)
+	assert.ErrorIs(t, err, errScheduleInPast)
+	_, err = resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Тест", Status: models.PostStatusPublished, PublishAt: &future}, nil)
+	assert.ErrorIs(t, err, errPublishAtNotNeeded)
+
+	scheduled, err := resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Тест", Status: models.PostStatusScheduled, PublishAt: &future}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.PostStatusScheduled, scheduled.Status)
+	assert.True(t, future.Equal(*scheduled.PublishAt))
+}
+
+func TestPublishPost(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+
+	post, err := resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Тест", Author: "Вася", Status: models.PostStatusDraft}, nil)
+	require.NoError(t, err)
+
+	future := time.Now().Add(time.Hour)
+	scheduled, err := resolver.Mutation().PublishPost(ctx, post.ID, &future)
+	require.NoError(t, err)
+	assert.Equal(t, models.PostStatusScheduled, scheduled.Status)
+	assert.True(t, future.Equal(*scheduled.PublishAt))
+
+	published, err := resolver.Mutation().PublishPost(ctx, post.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.PostStatusPublished, published.Status)
+	require.NotNil(t, published.PublishAt)
+	assert.WithinDuration(t, time.Now(), *published.PublishAt, time.Second)
+
+	// повторная публикация не сдвигает время
+	again, err := resolver.Mutation().PublishPost(ctx, post.ID, nil)
+	require.NoError(t, err)
+	assert.True(t, published.PublishAt.Equal(*again.PublishAt))
+
+	draft, err := resolver.Mutation().UnpublishPost(ctx, post.ID, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.PostStatusDraft, draft.Status)
+	assert.Nil(t, draft.PublishAt)
+
+	_, err = resolver.Mutation().PublishPost(ctx, 1337, nil)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = resolver.Mutation().UnpublishPost(ctx, 1337, nil, nil)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+}
+
+func TestModerationNotifications(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+
+	post, err := resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Тест", Author: "Вася", Content: "текст", AllowComments: true}, nil)
+	require.NoError(t, err)
+
+	// автор, правящий свой пост, уведомления не получает
+	self, title := "@вася", "Правка"
+	_, err = resolver.Mutation().UpdatePost(ctx, model.UpdatePost{ID: post.ID, ExpectedVersion: 1, Title: &title, Moderator: &self})
+	require.NoError(t, err)
+	inbox, err := resolver.Query().Notifications(ctx, "вася", 10, nil, false)
+	require.NoError(t, err)
+	assert.Empty(t, inbox)
+
+	moderator, reason := "модератор", "спам"
+	_, err = resolver.Mutation().UpdatePost(ctx, model.UpdatePost{ID: post.ID, ExpectedVersion: 2, Title: &title, Moderator: &moderator})
+	require.NoError(t, err)
+	_, err = resolver.Mutation().UnpublishPost(ctx, post.ID, &moderator, &reason)
+	require.NoError(t, err)
+
+	inbox, err = resolver.Query().Notifications(ctx, "вася", 10, nil, false)
+	require.NoError(t, err)
+	require.Len(t, inbox, 2)
+	for _, n := range inbox {
+		assert.Equal(t, models.NotificationTypeModeration, n.Type)
+		assert.Equal(t, "модератор", n.Actor)
+		assert.Equal(t, post.ID, n.PostID)
+	}
+	assert.Equal(t, "спам", inbox[0].Message)
+}
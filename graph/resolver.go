@@ -6,68 +6,251 @@ package graph
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"graphql-comments/graph/model"
+	"graphql-comments/markup"
+	"graphql-comments/metrics"
 	"graphql-comments/models"
+	"graphql-comments/notifications"
 	"graphql-comments/storage"
+	"graphql-comments/tenant"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/rs/zerolog"
 )
 
 // структура, которая будет содержать наше хранилище и канал для подписок на комменты
 type Resolver struct {
 	DB               storage.Storager
 	CommentObservers map[int][]chan *models.Comment
+	MentionObservers map[MentionKey][]chan *models.Comment // подписчики на упоминания
+	Notifications    *notifications.Service
+	IdempotencyTTL   time.Duration // сколько хранится ключ идемпотентности мутаций
 	mu               sync.Mutex
 }
 
+// Пользователь, на упоминания которого подписаны: одинаковые хендлы на разных сайтах это разные пользователи
+type MentionKey struct {
+	Tenant string
+	Handle string
+}
+
 // Конструктор ресолвера
 func NewResolver(db storage.Storager) *Resolver {
 	return &Resolver{
 		DB:               db,
 		CommentObservers: make(map[int][]chan *models.Comment),
+		MentionObservers: make(map[MentionKey][]chan *models.Comment),
+		Notifications:    notifications.NewService(db),
+		IdempotencyTTL:   DefaultIdempotencyTTL,
 	}
 }
 
-func (r *mutationResolver) CreatePost(ctx context.Context, input model.NewPost) (*models.Post, error) {
+func (r *mutationResolver) CreatePost(ctx context.Context, input model.NewPost, idempotencyKey *string) (*models.Post, error) {
 	post := &models.Post{
 		Title:         input.Title,
 		Author:        input.Author,
 		Content:       input.Content,
 		AllowComments: input.AllowComments,
+		Format:        input.Format,
+		Status:        input.Status,
+		PublishAt:     input.PublishAt,
+		Tags:          input.Tags,
+		Category:      stringOrEmpty(input.Category),
+	}
+	if err := validatePublishing(post.Status, post.PublishAt, time.Now()); err != nil {
+		return nil, err
 	}
 
-	createdPost, err := r.DB.CreatePost(ctx, *post)
+	contentHTML, err := markup.Render(post.Content, post.Format)
 	if err != nil {
 		return nil, err
 	}
+	post.ContentHTML = contentHTML
+
+	var createdPost models.Post
+	id, replay, err := r.idempotent(ctx, models.IdempotencyScopeCreatePost, idempotencyKey, input, func() (int, error) {
+		createdPost, err = r.DB.CreatePost(ctx, *post)
+		return createdPost.ID, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if replay {
+		return r.DB.GetPost(ctx, id)
+	}
 	return &createdPost, nil
 }
 
+// Правка накладывается на ревизию expectedVersion, с которой начинал редактор, а не на текущий пост,
+// поэтому незаданные поля берутся из той версии, которую он видел. Саму проверку версии делает хранилище
+func (r *mutationResolver) UpdatePost(ctx context.Context, input model.UpdatePost) (*models.Post, error) {
+	revisions, err := r.DB.GetPostRevisions(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	base := findRevision(revisions, input.ExpectedVersion)
+	if base == nil {
+		return nil, conflictError(revisions[len(revisions)-1].Version)
+	}
+
+	post := models.Post{
+		ID:            input.ID,
+		Title:         base.Title,
+		Content:       base.Content,
+		Format:        base.Format,
+		AllowComments: base.AllowComments,
+	}
+	if input.Title != nil {
+		post.Title = *input.Title
+	}
+	if input.Content != nil {
+		post.Content = *input.Content
+	}
+	if input.Format != nil {
+		post.Format = *input.Format
+	}
+	if input.AllowComments != nil {
+		post.AllowComments = *input.AllowComments
+	}
+
+	post.ContentHTML, err = markup.Render(post.Content, post.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := r.DB.UpdatePost(ctx, post, input.ExpectedVersion)
+	if errors.Is(err, models.ErrVersionConflict) {
+		return nil, conflictError(updated.Version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.notifyModerated(ctx, &updated, input.Moderator, input.Reason)
+	return &updated, nil
+}
+
+// PublishPost is the resolver for the publishPost field.
+func (r *mutationResolver) PublishPost(ctx context.Context, id int, publishAt *time.Time) (*models.Post, error) {
+	return r.publishPost(ctx, id, publishAt, time.Now())
+}
+
+// UnpublishPost is the resolver for the unpublishPost field.
+func (r *mutationResolver) UnpublishPost(ctx context.Context, id int, moderator *string, reason *string) (*models.Post, error) {
+	post, err := r.DB.SetPostStatus(ctx, id, models.PostStatusDraft, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.notifyModerated(ctx, &post, moderator, reason)
+	return &post, nil
+}
+
+// Сообщает автору, что его пост изменил или снял с публикации модератор. Автор, меняющий свой пост,
+// уведомления не получает. Пост уже изменен, поэтому ошибка уведомления не ломает мутацию
+func (r *mutationResolver) notifyModerated(ctx context.Context, post *models.Post, moderator, reason *string) {
+	actor := stringOrEmpty(moderator)
+	if models.NormalizeHandle(actor) == "" || models.NormalizeHandle(actor) == models.NormalizeHandle(post.Author) {
+		return
+	}
+	if _, err := r.Notifications.Moderated(ctx, post.Author, actor, post.ID, nil, stringOrEmpty(reason)); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Int("post_id", post.ID).Msg("failed to create moderation notification")
+	}
+}
+
 // CreateComment is the resolver for the createComment field.
-func (r *mutationResolver) CreateComment(ctx context.Context, input model.NewComment) (*models.Comment, error) {
+func (r *mutationResolver) CreateComment(ctx context.Context, input model.NewComment, idempotencyKey *string) (*models.Comment, error) {
 
 	comment := &models.Comment{
 		PostID:   input.PostID,
 		Author:   input.Author,
 		ParentID: input.ParentID,
 		Text:     input.Text,
+		Mentions: models.ParseMentions(input.Text),
+		Format:   input.Format,
 	}
 
-	createdComment, err := r.DB.CreateComment(ctx, *comment, comment.ParentID)
+	return r.createComment(ctx, comment, models.IdempotencyScopeCreateComment, idempotencyKey, input, nil)
+}
+
+// Сохраняет комментарий и рассылает уведомления. resolvePost, если задан, выбирает пост комментария
+// внутри защищенного ключом идемпотентности вызова, повтор запроса его не вызывает
+func (r *mutationResolver) createComment(ctx context.Context, comment *models.Comment, scope string, idempotencyKey *string, input interface{},
+	resolvePost func() (int, error)) (*models.Comment, error) {
+
+	if err := tenant.FromContext(ctx).CheckCommentLength(comment.Text); err != nil {
+		return nil, err
+	}
+
+	html, err := markup.Render(comment.Text, comment.Format)
 	if err != nil {
 		return nil, err
 	}
+	comment.HTML = html
+
+	var createdComment models.Comment
+	id, replay, err := r.idempotent(ctx, scope, idempotencyKey, input, func() (int, error) {
+		if resolvePost != nil {
+			postID, err := resolvePost()
+			if err != nil {
+				return 0, err
+			}
+			comment.PostID = postID
+		}
+		createdComment, err = r.DB.CreateComment(ctx, *comment, comment.ParentID)
+		return createdComment.ID, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// подписчики и получатели уведомлений уже узнали о комментарии при первом запросе
+	if replay {
+		return r.DB.GetComment(ctx, id)
+	}
 
 	// Уведомляем подписчиков
 	for _, observer := range r.CommentObservers[createdComment.PostID] {
 		observer <- &createdComment
 	}
+	r.notifyMentioned(&createdComment)
+
+	// комментарий уже сохранен, поэтому ошибка уведомлений не должна ломать мутацию
+	if _, err := r.Notifications.CommentCreated(ctx, &createdComment); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Int("comment_id", createdComment.ID).Msg("failed to create notifications")
+	}
 
 	return &createdComment, nil
 }
 
-func (r *postResolver) Replies(ctx context.Context, obj *models.Post, limit int, afterID int) ([]*models.Comment, error) {
+func (r *mutationResolver) MarkNotificationsRead(ctx context.Context, user string, ids []int) (int, error) {
+	return r.DB.MarkNotificationsRead(ctx, user, ids)
+}
+
+// HTML комментария, для записей без закешированного HTML рендерится на лету
+func (r *commentResolver) HTML(ctx context.Context, obj *models.Comment) (string, error) {
+	if obj.HTML != "" || obj.Text == "" {
+		return obj.HTML, nil
+	}
+	return markup.Render(obj.Text, obj.Format)
+}
+
+// HTML поста, для записей без закешированного HTML рендерится на лету
+func (r *postResolver) ContentHTML(ctx context.Context, obj *models.Post) (string, error) {
+	if obj.ContentHTML != "" || obj.Content == "" {
+		return obj.ContentHTML, nil
+	}
+	return markup.Render(obj.Content, obj.Format)
+}
 
-	replies, err := r.DB.GetComments(ctx, obj.ID, nil, limit, afterID)
+func (r *postResolver) Replies(ctx context.Context, obj *models.Post, limit int, afterID *int, viewer *string) ([]*models.Comment, error) {
+	if !obj.VisibleTo(stringOrEmpty(viewer)) {
+		return nil, models.ErrPostNotFound
+	}
+
+	replies, err := r.DB.GetComments(ctx, obj.ID, nil, tenant.FromContext(ctx).PageSize(limit), intOrZero(afterID))
 	if err != nil {
 		return nil, err
 	}
@@ -75,8 +258,51 @@ func (r *postResolver) Replies(ctx context.Context, obj *models.Post, limit int,
 	return replies, nil
 }
 
-func (r *queryResolver) Posts(ctx context.Context) ([]*models.Post, error) {
-	posts, err := r.DB.GetPosts(ctx)
+func (r *postResolver) Revisions(ctx context.Context, obj *models.Post) ([]*models.PostRevision, error) {
+	return r.DB.GetPostRevisions(ctx, obj.ID)
+}
+
+func (r *queryResolver) Node(ctx context.Context, id int) (models.Node, error) {
+	nodeType, _, err := models.DecodeGlobalID(rawArgument(ctx, "id"))
+	if err != nil {
+		return nil, err
+	}
+
+	return r.fetchNode(ctx, nodeType, id)
+}
+
+// Узлы возвращаются в порядке запрошенных идентификаторов, на месте ненайденных будет null
+func (r *queryResolver) Nodes(ctx context.Context, ids []int) ([]models.Node, error) {
+	rawIDs, _ := graphql.GetFieldContext(ctx).Field.ArgumentMap(graphql.GetOperationContext(ctx).Variables)["ids"].([]interface{})
+	if len(rawIDs) != len(ids) {
+		return nil, models.ErrInvalidID
+	}
+
+	nodes := make([]models.Node, len(ids))
+	for i, raw := range rawIDs {
+		globalID, _ := raw.(string)
+		nodeType, _, err := models.DecodeGlobalID(globalID)
+		if err != nil {
+			return nil, err
+		}
+
+		node, err := r.fetchNode(ctx, nodeType, ids[i])
+		if err != nil {
+			graphql.AddError(ctx, err)
+			continue
+		}
+		nodes[i] = node
+	}
+
+	return nodes, nil
+}
+
+func (r *queryResolver) Posts(ctx context.Context, viewer *string, tags []string, category *string) ([]*models.Post, error) {
+	filter, err := postFilter(viewer, tags, category)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := r.DB.GetPosts(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -84,16 +310,23 @@ func (r *queryResolver) Posts(ctx context.Context) ([]*models.Post, error) {
 	return posts, nil
 }
 
-func (r *queryResolver) Post(ctx context.Context, id int) (*models.Post, error) {
+// Чужой неопубликованный пост выглядит так же, как несуществующий
+func (r *queryResolver) Post(ctx context.Context, id int, viewer *string) (*models.Post, error) {
 	post, err := r.DB.GetPost(ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	if !post.VisibleTo(stringOrEmpty(viewer)) {
+		return nil, models.ErrPostNotFound
+	}
 	return post, nil
 }
 
-func (r *queryResolver) Comments(ctx context.Context, postID int, parentID *int, limit int, afterID int) ([]*models.Comment, error) {
-	replies, err := r.DB.GetComments(ctx, postID, parentID, limit, afterID)
+func (r *queryResolver) Comments(ctx context.Context, postID int, parentID *int, limit int, afterID *int, viewer *string) ([]*models.Comment, error) {
+	if _, err := r.Post(ctx, postID, viewer); err != nil {
+		return nil, err
+	}
+	replies, err := r.DB.GetComments(ctx, postID, parentID, tenant.FromContext(ctx).PageSize(limit), intOrZero(afterID))
 	if err != nil {
 		return nil, err
 	}
@@ -101,8 +334,68 @@ func (r *queryResolver) Comments(ctx context.Context, postID int, parentID *int,
 	return replies, nil
 }
 
-// подписка на новые комментарии
+func (r *queryResolver) Mentions(ctx context.Context, user string, limit int, afterID *int) ([]*models.Comment, error) {
+	mentions, err := r.DB.GetMentions(ctx, user, tenant.FromContext(ctx).PageSize(limit), intOrZero(afterID))
+	if err != nil {
+		return nil, err
+	}
+
+	return mentions, nil
+}
+
+// курсор afterID не задан на первой странице
+func intOrZero(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+// верхняя граница размера выдачи поиска
+const maxSearchLimit = 100
+
+func (r *queryResolver) Search(ctx context.Context, query string, scope models.SearchScope, postID *int, limit int) ([]*models.SearchResult, error) {
+	if strings.TrimSpace(query) == "" {
+		return []*models.SearchResult{}, nil
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	limit = tenant.FromContext(ctx).PageSize(limit)
+
+	results, err := r.DB.Search(ctx, models.SearchQuery{
+		Text:   query,
+		Scope:  scope,
+		PostID: postID,
+		Limit:  limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (r *queryResolver) Notifications(ctx context.Context, user string, first int, after *int, unreadOnly bool) ([]*models.Notification, error) {
+	beforeID := 0
+	if after != nil {
+		beforeID = *after
+	}
+
+	notifications, err := r.DB.GetNotifications(ctx, user, tenant.FromContext(ctx).PageSize(first), beforeID, unreadOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// подписка на новые комментарии. id постов общие для всех сайтов, поэтому сначала проверяется,
+// что пост принадлежит сайту подписчика
 func (r *subscriptionResolver) NewComment(ctx context.Context, postId int) (<-chan *models.Comment, error) {
+	if _, err := r.DB.GetPost(ctx, postId); err != nil {
+		return nil, err
+	}
 	commentChan := make(chan *models.Comment)
 
 	r.mu.Lock()
@@ -111,9 +404,11 @@ func (r *subscriptionResolver) NewComment(ctx context.Context, postId int) (<-ch
 	}
 	r.CommentObservers[postId] = append(r.CommentObservers[postId], commentChan)
 	r.mu.Unlock()
+	untrack := metrics.TrackSubscription(postId)
 
 	go func() {
 		<-ctx.Done()
+		untrack()
 		r.removeSubscriber(postId, commentChan)
 		close(commentChan)
 	}()
@@ -134,6 +429,135 @@ func (r *Resolver) removeSubscriber(postId int, observer chan *models.Comment) {
 	}
 }
 
+// подписка на комментарии, в которых упомянут пользователь
+func (r *subscriptionResolver) MentionedIn(ctx context.Context, user string) (<-chan *models.Comment, error) {
+	handle := MentionKey{Tenant: models.TenantFromContext(ctx), Handle: models.NormalizeHandle(user)}
+	// буфер нужен, чтобы медленный подписчик не блокировал создание комментариев
+	mentionChan := make(chan *models.Comment, mentionBufferSize)
+
+	r.mu.Lock()
+	r.MentionObservers[handle] = append(r.MentionObservers[handle], mentionChan)
+	r.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		subscribers := r.MentionObservers[handle]
+		for i, sub := range subscribers {
+			if sub == mentionChan {
+				r.MentionObservers[handle] = append(subscribers[:i], subscribers[i+1:]...)
+				break
+			}
+		}
+		if len(r.MentionObservers[handle]) == 0 {
+			delete(r.MentionObservers, handle)
+		}
+		close(mentionChan)
+	}()
+
+	return mentionChan, nil
+}
+
+// подписка на новые уведомления пользователя
+func (r *subscriptionResolver) NotificationAdded(ctx context.Context, user string) (<-chan *models.Notification, error) {
+	return r.Notifications.Subscribe(ctx, user), nil
+}
+
+// Находит объект по типу из глобального идентификатора
+func (r *Resolver) fetchNode(ctx context.Context, nodeType string, id int) (models.Node, error) {
+	switch nodeType {
+	case models.NodeTypePost:
+		// у node нет аргумента viewer, поэтому через него видны только опубликованные посты
+		post, err := r.DB.GetPost(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !post.VisibleTo("") {
+			return nil, models.ErrPostNotFound
+		}
+		return post, nil
+	case models.NodeTypeComment:
+		// комментарий виден вместе со своим постом
+		comment, err := r.DB.GetComment(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := r.fetchNode(ctx, models.NodeTypePost, comment.PostID); err != nil {
+			return nil, models.ErrCommentNotFound
+		}
+		return comment, nil
+	case "":
+		return nil, fmt.Errorf("node requires a global id, got legacy id %d", id)
+	default:
+		return nil, fmt.Errorf("unsupported node type %s", nodeType)
+	}
+}
+
+// Достает аргумент текущего поля в том виде, в котором его прислал клиент.
+// Нужен node, которому кроме числового id важен тип из глобального идентификатора
+func rawArgument(ctx context.Context, name string) string {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil {
+		return ""
+	}
+	raw, _ := fc.Field.ArgumentMap(graphql.GetOperationContext(ctx).Variables)[name].(string)
+	return raw
+}
+
+// размер буфера канала подписки на упоминания
+const mentionBufferSize = 16
+
+// Уведомляет подписчиков упомянутых в комментарии пользователей.
+// Отправка идет под мьютексом, поэтому канал не может быть закрыт посреди рассылки,
+// а переполненный канал пропускается, чтобы не блокировать мутацию
+func (r *Resolver) notifyMentioned(comment *models.Comment) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, handle := range comment.Mentions {
+		for _, observer := range r.MentionObservers[MentionKey{Tenant: models.TenantOrDefault(comment.TenantID), Handle: handle}] {
+			select {
+			case observer <- comment:
+			default:
+			}
+		}
+	}
+}
+
+func (r *queryResolver) Revisions(ctx context.Context, postID int, viewer *string) ([]*models.PostRevision, error) {
+	if _, err := r.Post(ctx, postID, viewer); err != nil {
+		return nil, err
+	}
+	return r.DB.GetPostRevisions(ctx, postID)
+}
+
+func (r *queryResolver) PostDiff(ctx context.Context, postID int, from int, to int, viewer *string) (*model.PostDiff, error) {
+	if _, err := r.Post(ctx, postID, viewer); err != nil {
+		return nil, err
+	}
+	revisions, err := r.DB.GetPostRevisions(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	fromRevision, toRevision := findRevision(revisions, from), findRevision(revisions, to)
+	if fromRevision == nil || toRevision == nil {
+		return nil, errRevisionNotFound
+	}
+
+	return &model.PostDiff{
+		PostID:  postID,
+		From:    from,
+		To:      to,
+		Title:   diffLines(fromRevision.Title, toRevision.Title),
+		Content: diffLines(fromRevision.Content, toRevision.Content),
+	}, nil
+}
+
+func (r *Resolver) Comment() CommentResolver { return &commentResolver{r} }
+
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
 func (r *Resolver) Post() PostResolver { return &postResolver{r} }
@@ -142,6 +566,7 @@ func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
 func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
 
+type commentResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
 type postResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
@@ -5,20 +5,25 @@ import (
 	"graphql-comments/graph/model"
 	"graphql-comments/models"
 	"graphql-comments/storage/postgres"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockStorage struct {
-	posts    []models.Post
-	comments []models.Comment
+	posts         []models.Post
+	comments      []models.Comment
+	notifications []models.Notification
 }
 
 func (m *mockStorage) CreatePost(ctx context.Context, post models.Post) (models.Post, error) {
 	post.ID = len(m.posts) + 1
 	post.CreatedAt = time.Now()
+	post.SetDefaultStatus(post.CreatedAt)
 	m.posts = append(m.posts, post)
 	return post, nil
 }
@@ -43,10 +48,24 @@ func (m *mockStorage) GetComments(ctx context.Context, postID int, parentID *int
 	return filteredComments, nil
 }
 
-func (m *mockStorage) GetPosts(ctx context.Context) ([]*models.Post, error) {
+func (m *mockStorage) GetMentions(ctx context.Context, handle string, limit, afterID int) ([]*models.Comment, error) {
+	var mentions []*models.Comment
+	for i := range m.comments {
+		for _, mention := range m.comments[i].Mentions {
+			if mention == handle && m.comments[i].ID > afterID && len(mentions) < limit {
+				mentions = append(mentions, &m.comments[i])
+			}
+		}
+	}
+	return mentions, nil
+}
+
+func (m *mockStorage) GetPosts(ctx context.Context, filter models.PostFilter) ([]*models.Post, error) {
 	var posts []*models.Post
 	for i := range m.posts {
-		posts = append(posts, &m.posts[i])
+		if filter.Match(&m.posts[i]) {
+			posts = append(posts, &m.posts[i])
+		}
 	}
 	return posts, nil
 }
@@ -60,6 +79,140 @@ func (m *mockStorage) GetPost(ctx context.Context, id int) (*models.Post, error)
 	return nil, postgres.ErrPostNotFound
 }
 
+func (m *mockStorage) GetComment(ctx context.Context, id int) (*models.Comment, error) {
+	for i := range m.comments {
+		if m.comments[i].ID == id {
+			return &m.comments[i], nil
+		}
+	}
+	return nil, postgres.ErrCommentNotFound
+}
+
+func (m *mockStorage) Search(ctx context.Context, q models.SearchQuery) ([]*models.SearchResult, error) {
+	var results []*models.SearchResult
+	if q.Scope.IncludesPosts() {
+		for i := range m.posts {
+			if strings.Contains(m.posts[i].Content, q.Text) && len(results) < q.Limit {
+				results = append(results, &models.SearchResult{Post: &m.posts[i], Score: 1, Snippet: m.posts[i].Content})
+			}
+		}
+	}
+	if q.Scope.IncludesComments() {
+		for i := range m.comments {
+			if strings.Contains(m.comments[i].Text, q.Text) && len(results) < q.Limit {
+				results = append(results, &models.SearchResult{Comment: &m.comments[i], Score: 1, Snippet: m.comments[i].Text})
+			}
+		}
+	}
+	return results, nil
+}
+
+func (m *mockStorage) CreateNotification(ctx context.Context, n models.Notification) (models.Notification, error) {
+	n.ID = len(m.notifications) + 1
+	n.CreatedAt = time.Now()
+	m.notifications = append(m.notifications, n)
+	return n, nil
+}
+
+func (m *mockStorage) GetNotifications(ctx context.Context, recipient string, limit, beforeID int, unreadOnly bool) ([]*models.Notification, error) {
+	var notifications []*models.Notification
+	for i := len(m.notifications) - 1; i >= 0 && len(notifications) < limit; i-- {
+		n := &m.notifications[i]
+		if n.Recipient == recipient && (beforeID == 0 || n.ID < beforeID) && (!unreadOnly || !n.Read) {
+			notifications = append(notifications, n)
+		}
+	}
+	return notifications, nil
+}
+
+func (m *mockStorage) MarkNotificationsRead(ctx context.Context, recipient string, ids []int) (int, error) {
+	marked := 0
+	for i := range m.notifications {
+		n := &m.notifications[i]
+		if n.Recipient != recipient || n.Read {
+			continue
+		}
+		for _, id := range ids {
+			if id == n.ID {
+				n.Read = true
+				marked++
+			}
+		}
+		if len(ids) == 0 {
+			n.Read = true
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (m *mockStorage) UpdatePost(ctx context.Context, p models.Post, expectedVersion int) (models.Post, error) {
+	return p, nil
+}
+
+func (m *mockStorage) GetPostRevisions(ctx context.Context, postID int) ([]*models.PostRevision, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) SetPostStatus(ctx context.Context, id int, status models.PostStatus, publishAt *time.Time) (models.Post, error) {
+	for i := range m.posts {
+		if m.posts[i].ID == id {
+			m.posts[i].Status = status
+			m.posts[i].PublishAt = publishAt
+			return m.posts[i], nil
+		}
+	}
+	return models.Post{}, models.ErrPostNotFound
+}
+
+func (m *mockStorage) PublishDuePosts(ctx context.Context, now time.Time) ([]models.Post, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) UpdatePostTags(ctx context.Context, postID int, add, remove []string) (models.Post, error) {
+	return models.Post{}, nil
+}
+
+func (m *mockStorage) SetPostCategory(ctx context.Context, postID int, category string) (models.Post, error) {
+	return models.Post{}, nil
+}
+
+func (m *mockStorage) GetTags(ctx context.Context) ([]models.TagCount, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) GetThread(ctx context.Context, key models.ThreadKey) (*models.Post, error) {
+	return nil, models.ErrThreadNotFound
+}
+
+func (m *mockStorage) GetOrCreateThread(ctx context.Context, key models.ThreadKey) (models.Post, error) {
+	return models.Post{}, nil
+}
+
+func (m *mockStorage) ImportPosts(ctx context.Context, posts []models.Post) ([]models.Post, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) ImportComments(ctx context.Context, comments []models.Comment) ([]models.Comment, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) ReserveIdempotencyKey(ctx context.Context, k models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) CompleteIdempotencyKey(ctx context.Context, scope, key string, resultID int) error {
+	return nil
+}
+
+func (m *mockStorage) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	return nil
+}
+
+func (m *mockStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
 func (m *mockStorage) Close() error {
 	return nil
 }
@@ -76,7 +229,7 @@ func TestCreatePost(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	post, err := resolver.Mutation().CreatePost(ctx, input)
+	post, err := resolver.Mutation().CreatePost(ctx, input, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, "Тест", post.Title)
 	assert.Equal(t, "Вася", post.Author)
@@ -95,7 +248,7 @@ func TestCreateComment(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	post, err := resolver.Mutation().CreatePost(ctx, postInput)
+	post, err := resolver.Mutation().CreatePost(ctx, postInput, nil)
 	assert.NoError(t, err)
 
 	commentInput := model.NewComment{
@@ -104,7 +257,7 @@ func TestCreateComment(t *testing.T) {
 		Text:   "Баян",
 	}
 
-	comment, err := resolver.Mutation().CreateComment(ctx, commentInput)
+	comment, err := resolver.Mutation().CreateComment(ctx, commentInput, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, post.ID, comment.PostID)
 	assert.Equal(t, "Вася", comment.Author)
@@ -120,7 +273,7 @@ func TestGetPosts(t *testing.T) {
 		Author:        "1",
 		Content:       "Первый",
 		AllowComments: true,
-	})
+	}, nil)
 	assert.NoError(t, err)
 
 	_, err = resolver.Mutation().CreatePost(context.Background(), model.NewPost{
@@ -128,10 +281,10 @@ func TestGetPosts(t *testing.T) {
 		Author:        "2",
 		Content:       "Второй",
 		AllowComments: true,
-	})
+	}, nil)
 	assert.NoError(t, err)
 
-	posts, err := resolver.Query().Posts(context.Background())
+	posts, err := resolver.Query().Posts(context.Background(), nil, nil, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, len(posts))
 }
@@ -148,7 +301,7 @@ func TestSubscriptionNewComment(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	post, err := resolver.Mutation().CreatePost(ctx, postInput)
+	post, err := resolver.Mutation().CreatePost(ctx, postInput, nil)
 	assert.NoError(t, err)
 
 	commentChan, err := resolver.Subscription().NewComment(ctx, post.ID)
@@ -161,7 +314,7 @@ func TestSubscriptionNewComment(t *testing.T) {
 	}
 
 	go func() {
-		_, err := resolver.Mutation().CreateComment(ctx, commentInput)
+		_, err := resolver.Mutation().CreateComment(ctx, commentInput, nil)
 		assert.NoError(t, err)
 	}()
 
@@ -174,3 +327,349 @@ func TestSubscriptionNewComment(t *testing.T) {
 		t.Fatal("expected a comment but got none")
 	}
 }
+
+func TestCreateCommentParsesMentions(t *testing.T) {
+	db := &mockStorage{}
+	resolver := NewResolver(db)
+
+	ctx := context.Background()
+	post, err := resolver.Mutation().CreatePost(ctx, model.NewPost{
+		Title:         "Тест",
+		Author:        "Автор",
+		Content:       "Пост",
+		AllowComments: true,
+	}, nil)
+	assert.NoError(t, err)
+
+	comment, err := resolver.Mutation().CreateComment(ctx, model.NewComment{
+		PostID: post.ID,
+		Author: "Петя",
+		Text:   "@Вася, @masha посмотрите",
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"вася", "masha"}, comment.Mentions)
+
+	mentions, err := resolver.Query().Mentions(ctx, "masha", 10, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(mentions))
+	assert.Equal(t, comment.ID, mentions[0].ID)
+}
+
+func TestSubscriptionMentionedIn(t *testing.T) {
+	db := &mockStorage{}
+	resolver := NewResolver(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	post, err := resolver.Mutation().CreatePost(ctx, model.NewPost{
+		Title:         "Тест",
+		Author:        "Автор",
+		Content:       "Пост",
+		AllowComments: true,
+	}, nil)
+	assert.NoError(t, err)
+
+	mentionChan, err := resolver.Subscription().MentionedIn(ctx, "@Masha")
+	assert.NoError(t, err)
+
+	_, err = resolver.Mutation().CreateComment(ctx, model.NewComment{
+		PostID: post.ID,
+		Author: "Петя",
+		Text:   "без упоминаний",
+	}, nil)
+	assert.NoError(t, err)
+
+	_, err = resolver.Mutation().CreateComment(ctx, model.NewComment{
+		PostID: post.ID,
+		Author: "Петя",
+		Text:   "@masha привет",
+	}, nil)
+	assert.NoError(t, err)
+
+	select {
+	case comment := <-mentionChan:
+		assert.Equal(t, "@masha привет", comment.Text)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a mention but got none")
+	}
+}
+
+func TestCreateCommentNotifiesAuthors(t *testing.T) {
+	db := &mockStorage{}
+	resolver := NewResolver(db)
+
+	ctx := context.Background()
+	post, err := resolver.Mutation().CreatePost(ctx, model.NewPost{
+		Title:         "Тест",
+		Author:        "Автор",
+		Content:       "Пост",
+		AllowComments: true,
+	}, nil)
+	assert.NoError(t, err)
+
+	comment, err := resolver.Mutation().CreateComment(ctx, model.NewComment{
+		PostID: post.ID,
+		Author: "Петя",
+		Text:   "Первый, @masha смотри",
+	}, nil)
+	assert.NoError(t, err)
+
+	_, err = resolver.Mutation().CreateComment(ctx, model.NewComment{
+		PostID:   post.ID,
+		ParentID: &comment.ID,
+		Author:   "Вася",
+		Text:     "Ответ",
+	}, nil)
+	assert.NoError(t, err)
+
+	notifications, err := resolver.Query().Notifications(ctx, "автор", 10, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(notifications))
+	assert.Equal(t, models.NotificationTypeReply, notifications[0].Type)
+
+	notifications, err = resolver.Query().Notifications(ctx, "masha", 10, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(notifications))
+	assert.Equal(t, models.NotificationTypeMention, notifications[0].Type)
+
+	notifications, err = resolver.Query().Notifications(ctx, "петя", 10, nil, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(notifications))
+	assert.Equal(t, "Вася", notifications[0].Actor)
+
+	marked, err := resolver.Mutation().MarkNotificationsRead(ctx, "петя", []int{notifications[0].ID})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, marked)
+
+	notifications, err = resolver.Query().Notifications(ctx, "петя", 10, nil, true)
+	assert.NoError(t, err)
+	assert.Empty(t, notifications)
+}
+
+func TestSubscriptionNotificationAdded(t *testing.T) {
+	db := &mockStorage{}
+	resolver := NewResolver(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	post, err := resolver.Mutation().CreatePost(ctx, model.NewPost{
+		Title:         "Тест",
+		Author:        "Автор",
+		Content:       "Пост",
+		AllowComments: true,
+	}, nil)
+	assert.NoError(t, err)
+
+	notificationChan, err := resolver.Subscription().NotificationAdded(ctx, "Автор")
+	assert.NoError(t, err)
+
+	_, err = resolver.Mutation().CreateComment(ctx, model.NewComment{
+		PostID: post.ID,
+		Author: "Петя",
+		Text:   "Много букв",
+	}, nil)
+	assert.NoError(t, err)
+
+	select {
+	case notification := <-notificationChan:
+		assert.Equal(t, models.NotificationTypeReply, notification.Type)
+		assert.Equal(t, post.ID, notification.PostID)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a notification but got none")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	db := &mockStorage{}
+	resolver := NewResolver(db)
+
+	ctx := context.Background()
+	post, err := resolver.Mutation().CreatePost(ctx, model.NewPost{
+		Title:         "Тест",
+		Author:        "Автор",
+		Content:       "Про котиков",
+		AllowComments: true,
+	}, nil)
+	assert.NoError(t, err)
+
+	_, err = resolver.Mutation().CreateComment(ctx, model.NewComment{
+		PostID: post.ID,
+		Author: "Петя",
+		Text:   "Люблю котиков",
+	}, nil)
+	assert.NoError(t, err)
+
+	results, err := resolver.Query().Search(ctx, "котиков", models.SearchScopeAll, nil, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(results))
+
+	results, err = resolver.Query().Search(ctx, "котиков", models.SearchScopeComments, nil, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.NotNil(t, results[0].Comment)
+
+	results, err = resolver.Query().Search(ctx, "   ", models.SearchScopeAll, nil, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestCreateMarkdownComment(t *testing.T) {
+	db := &mockStorage{}
+	resolver := NewResolver(db)
+
+	ctx := context.Background()
+	post, err := resolver.Mutation().CreatePost(ctx, model.NewPost{
+		Title:         "Тест",
+		Author:        "Автор",
+		Content:       "# Заголовок",
+		AllowComments: true,
+		Format:        models.TextFormatMarkdown,
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<h1>Заголовок</h1>", post.ContentHTML)
+
+	comment, err := resolver.Mutation().CreateComment(ctx, model.NewComment{
+		PostID: post.ID,
+		Author: "Петя",
+		Text:   "*курсив* <script>alert(1)</script>",
+		Format: models.TextFormatMarkdown,
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<p><em>курсив</em> alert(1)</p>", comment.HTML)
+
+	// для записей без закешированного HTML он рендерится при запросе
+	html, err := resolver.Comment().HTML(ctx, &models.Comment{Text: "a < b", Format: models.TextFormatPlain})
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>a &lt; b</p>", html)
+}
+
+func newTestClient(db *mockStorage) *client.Client {
+	return client.New(handler.NewDefaultServer(NewExecutableSchema(Config{Resolvers: NewResolver(db)})))
+}
+
+func TestGlobalIDs(t *testing.T) {
+	c := newTestClient(&mockStorage{})
+
+	var created struct {
+		CreatePost struct {
+			ID string
+		}
+	}
+	c.MustPost(`mutation { createPost(input: {title: "Тест", content: "Пост", author: "Автор", allowComments: true}) { id } }`, &created)
+	assert.Equal(t, models.EncodeGlobalID(models.NodeTypePost, 1), created.CreatePost.ID)
+
+	var comment struct {
+		CreateComment struct {
+			ID     string
+			PostID string
+		}
+	}
+	c.MustPost(`mutation($postId: ID!) { createComment(input: {postId: $postId, text: "Коммент", author: "Петя"}) { id postId } }`,
+		&comment, client.Var("postId", created.CreatePost.ID))
+	assert.Equal(t, models.EncodeGlobalID(models.NodeTypeComment, 1), comment.CreateComment.ID)
+	assert.Equal(t, created.CreatePost.ID, comment.CreateComment.PostID)
+
+	// пост и комментарий с одинаковым числовым id различаются
+	assert.NotEqual(t, created.CreatePost.ID, comment.CreateComment.ID)
+
+	var post struct {
+		Post struct {
+			Title string
+		}
+	}
+	c.MustPost(`query($id: ID!) { Post(id: $id) { title } }`, &post, client.Var("id", created.CreatePost.ID))
+	assert.Equal(t, "Тест", post.Post.Title)
+
+	// старые числовые id по-прежнему принимаются
+	c.MustPost(`query { Post(id: "1") { title } }`, &post)
+	assert.Equal(t, "Тест", post.Post.Title)
+
+	// id комментария вместо id поста
+	err := c.Post(`query($id: ID!) { Post(id: $id) { title } }`, &post, client.Var("id", comment.CreateComment.ID))
+	assert.ErrorContains(t, err, "expected Post id, got Comment id")
+
+	// мутации поста тоже не принимают id комментария
+	for _, mutation := range []string{
+		`mutation($id: ID!) { updatePost(input: {id: $id, expectedVersion: 1, title: "Новый"}) { id } }`,
+		`mutation($id: ID!) { publishPost(id: $id) { id } }`,
+		`mutation($id: ID!) { unpublishPost(id: $id) { id } }`,
+	} {
+		var resp map[string]interface{}
+		err = c.Post(mutation, &resp, client.Var("id", comment.CreateComment.ID))
+		assert.ErrorContains(t, err, "expected Post id, got Comment id", mutation)
+	}
+}
+
+func TestCommentsAfterGlobalID(t *testing.T) {
+	db := &mockStorage{}
+	c := newTestClient(db)
+
+	_, err := db.CreatePost(context.Background(), models.Post{Title: "Тест", Author: "Автор", Content: "Пост", AllowComments: true})
+	assert.NoError(t, err)
+	for _, text := range []string{"первый", "второй"} {
+		_, err = db.CreateComment(context.Background(), models.Comment{PostID: 1, Author: "Петя", Text: text}, nil)
+		assert.NoError(t, err)
+	}
+
+	// курсор это id из предыдущей выдачи
+	var resp struct {
+		Comments []struct {
+			ID   string
+			Text string
+		}
+	}
+	query := `query($post: ID!, $after: ID) { Comments(postId: $post, afterID: $after) { id text } }`
+	postID := models.EncodeGlobalID(models.NodeTypePost, 1)
+	c.MustPost(query, &resp, client.Var("post", postID), client.Var("after", models.EncodeGlobalID(models.NodeTypeComment, 1)))
+	if assert.Len(t, resp.Comments, 1) {
+		assert.Equal(t, "второй", resp.Comments[0].Text)
+	}
+
+	err = c.Post(query, &resp, client.Var("post", postID), client.Var("after", postID))
+	assert.ErrorContains(t, err, "expected Comment id, got Post id")
+}
+
+func TestNodeQuery(t *testing.T) {
+	db := &mockStorage{}
+	c := newTestClient(db)
+
+	_, err := db.CreatePost(context.Background(), models.Post{Title: "Тест", Author: "Автор", Content: "Пост", AllowComments: true})
+	assert.NoError(t, err)
+	_, err = db.CreateComment(context.Background(), models.Comment{PostID: 1, Author: "Петя", Text: "Коммент"}, nil)
+	assert.NoError(t, err)
+
+	postID := models.EncodeGlobalID(models.NodeTypePost, 1)
+	commentID := models.EncodeGlobalID(models.NodeTypeComment, 1)
+
+	var resp struct {
+		Node struct {
+			Typename string `json:"__typename"`
+			ID       string
+			Text     string
+		}
+	}
+	c.MustPost(`query($id: ID!) { node(id: $id) { __typename id ... on Comment { text } } }`, &resp, client.Var("id", commentID))
+	assert.Equal(t, "Comment", resp.Node.Typename)
+	assert.Equal(t, commentID, resp.Node.ID)
+	assert.Equal(t, "Коммент", resp.Node.Text)
+
+	var nodes struct {
+		Nodes []*struct {
+			Typename string `json:"__typename"`
+			ID       string
+		}
+	}
+	missingID := models.EncodeGlobalID(models.NodeTypePost, 42)
+	err = c.Post(`query($ids: [ID!]!) { nodes(ids: $ids) { __typename id } }`, &nodes,
+		client.Var("ids", []string{postID, missingID, commentID}))
+	assert.ErrorContains(t, err, "post not found")
+	assert.Equal(t, 3, len(nodes.Nodes))
+	assert.Equal(t, "Post", nodes.Nodes[0].Typename)
+	assert.Nil(t, nodes.Nodes[1])
+	assert.Equal(t, "Comment", nodes.Nodes[2].Typename)
+
+	err = c.Post(`query { node(id: "1") { id } }`, &resp)
+	assert.ErrorContains(t, err, "global id")
+}
@@ -0,0 +1,48 @@
+package graph
+
+import (
+	"errors"
+	"graphql-comments/diff"
+	"graphql-comments/graph/model"
+	"graphql-comments/models"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// код ошибки в extensions.code, когда пост изменили после того, как редактор его открыл
+const codeConflict = "CONFLICT"
+
+var errRevisionNotFound = errors.New("post has no such version")
+
+// Ошибка конфликта версий, текущая версия передается в extensions.currentVersion,
+// чтобы клиент мог перечитать пост и повторить правку
+func conflictError(currentVersion int) error {
+	err := gqlerror.Errorf("post was changed by another request, current version is %d", currentVersion)
+	err.Extensions = map[string]interface{}{"code": codeConflict, "currentVersion": currentVersion}
+	return err
+}
+
+// ревизии отсортированы по версии, но после импорта история может начинаться не с 1
+func findRevision(revisions []*models.PostRevision, version int) *models.PostRevision {
+	for _, r := range revisions {
+		if r.Version == version {
+			return r
+		}
+	}
+	return nil
+}
+
+var diffOps = map[diff.Op]model.DiffOp{
+	diff.Equal:  model.DiffOpEqual,
+	diff.Insert: model.DiffOpInsert,
+	diff.Delete: model.DiffOpDelete,
+}
+
+func diffLines(from, to string) []*model.DiffLine {
+	lines := diff.Lines(from, to)
+	result := make([]*model.DiffLine, len(lines))
+	for i, line := range lines {
+		result[i] = &model.DiffLine{Op: diffOps[line.Op], Text: line.Text}
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"graphql-comments/graph/model"
+	"graphql-comments/models"
+	"graphql-comments/storage/inmemory"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestUpdatePost(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+
+	post, err := resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Тест", Content: "первая строка\nвторая", Author: "Вася", AllowComments: true, Format: models.TextFormatPlain}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, post.Version)
+
+	title := "Новый заголовок"
+	updated, err := resolver.Mutation().UpdatePost(ctx, model.UpdatePost{ID: post.ID, ExpectedVersion: 1, Title: &title})
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+	assert.Equal(t, "Новый заголовок", updated.Title)
+	assert.Equal(t, "первая строка\nвторая", updated.Content)
+	assert.True(t, updated.AllowComments)
+
+	// правка с устаревшей версией не проходит, а в ошибке есть текущая версия
+	content, format := "**жирный**", models.TextFormatMarkdown
+	_, err = resolver.Mutation().UpdatePost(ctx, model.UpdatePost{ID: post.ID, ExpectedVersion: 1, Content: &content})
+	var gqlErr *gqlerror.Error
+	require.True(t, errors.As(err, &gqlErr), err)
+	assert.Equal(t, codeConflict, gqlErr.Extensions["code"])
+	assert.Equal(t, 2, gqlErr.Extensions["currentVersion"])
+
+	_, err = resolver.Mutation().UpdatePost(ctx, model.UpdatePost{ID: post.ID, ExpectedVersion: 7, Content: &content})
+	assert.Equal(t, codeConflict, errorCode(t, err))
+
+	updated, err = resolver.Mutation().UpdatePost(ctx, model.UpdatePost{ID: post.ID, ExpectedVersion: 2, Content: &content, Format: &format})
+	require.NoError(t, err)
+	assert.Equal(t, 3, updated.Version)
+	assert.Equal(t, "Новый заголовок", updated.Title)
+	assert.Contains(t, updated.ContentHTML, "<strong>жирный</strong>")
+
+	_, err = resolver.Mutation().UpdatePost(ctx, model.UpdatePost{ID: 1337, ExpectedVersion: 1, Title: &title})
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+
+	revisions, err := resolver.Query().Revisions(ctx, post.ID, nil)
+	require.NoError(t, err)
+	require.Len(t, revisions, 3)
+	assert.Equal(t, "Тест", revisions[0].Title)
+}
+
+func TestPostDiff(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+
+	post, err := resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Тест", Content: "a\nb\nc", Author: "Вася"}, nil)
+	require.NoError(t, err)
+	content := "a\nx\nc"
+	_, err = resolver.Mutation().UpdatePost(ctx, model.UpdatePost{ID: post.ID, ExpectedVersion: 1, Content: &content})
+	require.NoError(t, err)
+
+	d, err := resolver.Query().PostDiff(ctx, post.ID, 1, 2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []*model.DiffLine{{Op: model.DiffOpEqual, Text: "Тест"}}, d.Title)
+	assert.Equal(t, []*model.DiffLine{
+		{Op: model.DiffOpEqual, Text: "a"},
+		{Op: model.DiffOpDelete, Text: "b"},
+		{Op: model.DiffOpInsert, Text: "x"},
+		{Op: model.DiffOpEqual, Text: "c"},
+	}, d.Content)
+
+	_, err = resolver.Query().PostDiff(ctx, post.ID, 1, 5, nil)
+	assert.ErrorIs(t, err, errRevisionNotFound)
+	_, err = resolver.Query().PostDiff(ctx, 1337, 1, 2, nil)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+}
@@ -0,0 +1,85 @@
+package graph
+
+import (
+	"context"
+	"graphql-comments/models"
+)
+
+func (r *mutationResolver) AddPostTags(ctx context.Context, postID int, tags []string) (*models.Post, error) {
+	normalized, err := models.NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	post, err := r.DB.UpdatePostTags(ctx, postID, normalized, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+func (r *mutationResolver) RemovePostTags(ctx context.Context, postID int, tags []string) (*models.Post, error) {
+	normalized, err := models.NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	post, err := r.DB.UpdatePostTags(ctx, postID, nil, normalized)
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+func (r *mutationResolver) SetPostCategory(ctx context.Context, postID int, category *string) (*models.Post, error) {
+	normalized, err := normalizeCategory(category)
+	if err != nil {
+		return nil, err
+	}
+	post, err := r.DB.SetPostCategory(ctx, postID, normalized)
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// у поста без категории поле category равно null
+func (r *postResolver) Category(ctx context.Context, obj *models.Post) (*string, error) {
+	if obj.Category == "" {
+		return nil, nil
+	}
+	return &obj.Category, nil
+}
+
+func (r *queryResolver) Tags(ctx context.Context) ([]*models.TagCount, error) {
+	counts, err := r.DB.GetTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]*models.TagCount, len(counts))
+	for i := range counts {
+		tags[i] = &counts[i]
+	}
+	return tags, nil
+}
+
+// Собирает фильтр GetPosts из аргументов запроса Posts, теги и категория сравниваются в нормализованном виде
+func postFilter(viewer *string, tags []string, category *string) (models.PostFilter, error) {
+	filter := models.PostFilter{Viewer: stringOrEmpty(viewer)}
+
+	var err error
+	if filter.Tags, err = models.NormalizeTags(tags); err != nil {
+		return filter, err
+	}
+	if filter.Category, err = normalizeCategory(category); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// пустая категория значит, что ее нет
+func normalizeCategory(category *string) (string, error) {
+	if category == nil || *category == "" {
+		return "", nil
+	}
+	return models.NormalizeTag(*category)
+}
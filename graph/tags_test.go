@@ -0,0 +1,63 @@
+package graph
+
+import (
+	"context"
+	"graphql-comments/graph/model"
+	"graphql-comments/models"
+	"graphql-comments/storage/inmemory"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostTags(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+
+	category := "Разработка"
+	post, err := resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Тест", Tags: []string{"Go"}, Category: &category}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go"}, post.Tags)
+	other, err := resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Другой"}, nil)
+	require.NoError(t, err)
+
+	got, err := resolver.Post().Category(ctx, post)
+	require.NoError(t, err)
+	assert.Equal(t, "разработка", *got)
+	got, err = resolver.Post().Category(ctx, other)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	updated, err := resolver.Mutation().AddPostTags(ctx, post.ID, []string{"SQL", "api"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api", "go", "sql"}, updated.Tags)
+	updated, err = resolver.Mutation().RemovePostTags(ctx, post.ID, []string{"API"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "sql"}, updated.Tags)
+	_, err = resolver.Mutation().AddPostTags(ctx, post.ID, []string{"a,b"})
+	assert.ErrorIs(t, err, models.ErrInvalidTag)
+	_, err = resolver.Mutation().AddPostTags(ctx, 1337, []string{"go"})
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+
+	// фильтр сравнивает теги и категорию в нормализованном виде
+	upper := "РАЗРАБОТКА"
+	posts, err := resolver.Query().Posts(ctx, nil, []string{"GO", "sql"}, &upper)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, post.ID, posts[0].ID)
+
+	updated, err = resolver.Mutation().SetPostCategory(ctx, post.ID, nil)
+	require.NoError(t, err)
+	assert.Empty(t, updated.Category)
+	posts, err = resolver.Query().Posts(ctx, nil, nil, &upper)
+	require.NoError(t, err)
+	assert.Empty(t, posts)
+
+	tags, err := resolver.Query().Tags(ctx)
+	require.NoError(t, err)
+	require.Len(t, tags, 2)
+	assert.Equal(t, models.TagCount{Tag: "go", Count: 1}, *tags[0])
+}
@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"context"
+	"graphql-comments/graph/model"
+	"graphql-comments/models"
+	"graphql-comments/storage/inmemory"
+	"graphql-comments/tenant"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantLimits(t *testing.T) {
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+	ctx := tenant.WithTenant(context.Background(), &tenant.Tenant{ID: "shop", MaxCommentLength: 10, MaxPageSize: 2})
+
+	post, err := resolver.Mutation().CreatePost(ctx, model.NewPost{Title: "Пост", Author: "alice", Content: "текст", AllowComments: true}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "shop", post.TenantID)
+
+	_, err = resolver.Mutation().CreateComment(ctx, model.NewComment{PostID: post.ID, Author: "bob", Text: "слишком длинный комментарий"}, nil)
+	assert.ErrorIs(t, err, tenant.ErrCommentTooLong)
+
+	for i := 0; i < 3; i++ {
+		_, err = resolver.Mutation().CreateComment(ctx, model.NewComment{PostID: post.ID, Author: "bob", Text: "коротко"}, nil)
+		require.NoError(t, err)
+	}
+	comments, err := resolver.Query().Comments(ctx, post.ID, nil, 10, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, comments, 2)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+	blog := models.WithTenant(context.Background(), "blog")
+	shop := models.WithTenant(context.Background(), "shop")
+
+	post, err := resolver.Mutation().CreatePost(blog, model.NewPost{Title: "Пост", Author: "alice", Content: "текст", AllowComments: true}, nil)
+	require.NoError(t, err)
+
+	// пост другого сайта не виден ни в запросах, ни в подписке
+	_, err = resolver.Query().Post(shop, post.ID, nil)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = resolver.Subscription().NewComment(shop, post.ID)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = resolver.Mutation().CreateComment(shop, model.NewComment{PostID: post.ID, Author: "bob", Text: "привет"}, nil)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+
+	// тот же хендл на другом сайте не получает упоминание
+	shopCtx, cancelShop := context.WithCancel(shop)
+	defer cancelShop()
+	shopMentions, err := resolver.Subscription().MentionedIn(shopCtx, "masha")
+	require.NoError(t, err)
+	blogCtx, cancelBlog := context.WithCancel(blog)
+	defer cancelBlog()
+	blogMentions, err := resolver.Subscription().MentionedIn(blogCtx, "masha")
+	require.NoError(t, err)
+
+	_, err = resolver.Mutation().CreateComment(blog, model.NewComment{PostID: post.ID, Author: "bob", Text: "@masha привет"}, nil)
+	require.NoError(t, err)
+
+	select {
+	case c := <-blogMentions:
+		assert.Equal(t, "blog", c.TenantID)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a mention but got none")
+	}
+	select {
+	case c := <-shopMentions:
+		t.Fatalf("unexpected mention from tenant %s", c.TenantID)
+	default:
+	}
+}
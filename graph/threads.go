@@ -0,0 +1,62 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"graphql-comments/graph/model"
+	"graphql-comments/models"
+	"graphql-comments/tenant"
+)
+
+// Тред создается первым комментарием. Ответ требует уже существующего треда, иначе и родителя в нем нет
+func (r *mutationResolver) CreateThreadComment(ctx context.Context, input model.NewThreadComment, idempotencyKey *string) (*models.Comment, error) {
+	key, err := models.NormalizeThreadKey(models.ThreadKey{Namespace: input.Namespace, Key: input.Key})
+	if err != nil {
+		return nil, err
+	}
+
+	comment := &models.Comment{
+		Author:   input.Author,
+		ParentID: input.ParentID,
+		Text:     input.Text,
+		Mentions: models.ParseMentions(input.Text),
+		Format:   input.Format,
+	}
+
+	return r.createComment(ctx, comment, models.IdempotencyScopeCreateThreadComment, idempotencyKey, input, func() (int, error) {
+		if comment.ParentID != nil {
+			thread, err := r.DB.GetThread(ctx, key)
+			if errors.Is(err, models.ErrThreadNotFound) {
+				return 0, models.ErrParentCommentNotFound
+			}
+			if err != nil {
+				return 0, err
+			}
+			return thread.ID, nil
+		}
+		thread, err := r.DB.GetOrCreateThread(ctx, key)
+		return thread.ID, err
+	})
+}
+
+func (r *queryResolver) Thread(ctx context.Context, namespace string, key string) (*models.Post, error) {
+	threadKey, err := models.NormalizeThreadKey(models.ThreadKey{Namespace: namespace, Key: key})
+	if err != nil {
+		return nil, err
+	}
+
+	thread, err := r.DB.GetThread(ctx, threadKey)
+	if errors.Is(err, models.ErrThreadNotFound) {
+		return nil, nil
+	}
+	return thread, err
+}
+
+// Ресурс без треда выглядит так же, как тред без комментариев
+func (r *queryResolver) ThreadComments(ctx context.Context, namespace string, key string, parentID *int, limit int, afterID *int) ([]*models.Comment, error) {
+	thread, err := r.Thread(ctx, namespace, key)
+	if err != nil || thread == nil {
+		return nil, err
+	}
+	return r.DB.GetComments(ctx, thread.ID, parentID, tenant.FromContext(ctx).PageSize(limit), intOrZero(afterID))
+}
@@ -0,0 +1,82 @@
+package graph
+
+import (
+	"context"
+	"graphql-comments/graph/model"
+	"graphql-comments/models"
+	"graphql-comments/storage/inmemory"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThreadComments(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+
+	// пока комментариев нет, треда тоже нет
+	thread, err := resolver.Query().Thread(ctx, "blog", "https://example.com/a")
+	require.NoError(t, err)
+	assert.Nil(t, thread)
+	comments, err := resolver.Query().ThreadComments(ctx, "blog", "https://example.com/a", nil, 10, nil)
+	require.NoError(t, err)
+	assert.Empty(t, comments)
+
+	// ответ в несуществующем треде не создает его
+	parent := 1
+	_, err = resolver.Mutation().CreateThreadComment(ctx, model.NewThreadComment{Namespace: "blog", Key: "https://example.com/a", ParentID: &parent, Text: "ответ"}, nil)
+	assert.ErrorIs(t, err, models.ErrParentCommentNotFound)
+
+	root, err := resolver.Mutation().CreateThreadComment(ctx, model.NewThreadComment{Namespace: "Blog", Key: " https://example.com/a ", Text: "первый", Author: "alice"}, nil)
+	require.NoError(t, err)
+	_, err = resolver.Mutation().CreateThreadComment(ctx, model.NewThreadComment{Namespace: "blog", Key: "https://example.com/a", ParentID: &root.ID, Text: "ответ", Author: "bob"}, nil)
+	require.NoError(t, err)
+
+	thread, err = resolver.Query().Thread(ctx, "BLOG", "https://example.com/a")
+	require.NoError(t, err)
+	require.NotNil(t, thread)
+	assert.Equal(t, &models.ThreadKey{Namespace: "blog", Key: "https://example.com/a"}, thread.Thread)
+	assert.Equal(t, root.PostID, thread.ID)
+
+	comments, err = resolver.Query().ThreadComments(ctx, "blog", "https://example.com/a", nil, 10, nil)
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.True(t, comments[0].HasReplies)
+
+	// тред не попадает в ленту, а ключ с другим регистром пути это другой ресурс
+	posts, err := resolver.Query().Posts(ctx, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, posts)
+	comments, err = resolver.Query().ThreadComments(ctx, "blog", "https://example.com/A", nil, 10, nil)
+	require.NoError(t, err)
+	assert.Empty(t, comments)
+
+	_, err = resolver.Query().Thread(ctx, "не латиница", "x")
+	assert.ErrorIs(t, err, models.ErrInvalidThreadKey)
+}
+
+func TestThreadCommentIdempotency(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	resolver := NewResolver(store)
+
+	key := "thread-1"
+	input := model.NewThreadComment{Namespace: "docs", Key: "intro", Text: "привет", Author: "alice"}
+	first, err := resolver.Mutation().CreateThreadComment(ctx, input, &key)
+	require.NoError(t, err)
+	again, err := resolver.Mutation().CreateThreadComment(ctx, input, &key)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, again.ID)
+
+	// у createComment свое пространство ключей
+	_, err = resolver.Mutation().CreateComment(ctx, model.NewComment{PostID: first.PostID, Text: "привет", Author: "alice"}, &key)
+	require.NoError(t, err)
+
+	comments, err := resolver.Query().ThreadComments(ctx, "docs", "intro", nil, 10, nil)
+	require.NoError(t, err)
+	assert.Len(t, comments, 2)
+}
@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/rs/zerolog"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Extension это расширение gqlgen, которое пишет в лог каждую операцию
+// и добавляет идентификатор запроса в extensions.requestId ошибок
+type Extension struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+	graphql.ResponseInterceptor
+} = Extension{}
+
+func (Extension) ExtensionName() string {
+	return "Logging"
+}
+
+func (Extension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (Extension) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	oc := graphql.GetOperationContext(ctx)
+
+	operationType, operationName := "unknown", oc.OperationName
+	if oc.Operation != nil {
+		operationType = string(oc.Operation.Operation)
+		if operationName == "" {
+			operationName = oc.Operation.Name
+		}
+	}
+
+	logger := zerolog.Ctx(ctx).With().
+		Str("operation", operationName).
+		Str("operation_type", operationType).
+		Logger()
+	ctx = logger.WithContext(ctx)
+
+	handler := next(ctx)
+
+	// подписка пишет в лог начало, каждое событие с ошибками и завершение
+	if operationType == string(ast.Subscription) {
+		logger.Info().Msg("subscription started")
+		return func(ctx context.Context) *graphql.Response {
+			resp := handler(ctx)
+			if resp == nil {
+				logger.Info().Dur("duration", time.Since(oc.Stats.OperationStart)).Msg("subscription finished")
+				return nil
+			}
+			if len(resp.Errors) > 0 {
+				logger.Warn().Strs("error_codes", errorCodes(resp.Errors)).Msg("subscription event failed")
+			}
+			return resp
+		}
+	}
+
+	var once sync.Once
+	return func(ctx context.Context) *graphql.Response {
+		resp := handler(ctx)
+		if resp == nil {
+			return nil
+		}
+		once.Do(func() {
+			event := logger.Info()
+			if len(resp.Errors) > 0 {
+				event = logger.Warn().Strs("error_codes", errorCodes(resp.Errors))
+			}
+			event.Dur("duration", time.Since(oc.Stats.OperationStart)).Msg("graphql operation")
+		})
+		return resp
+	}
+}
+
+// Добавляет идентификатор запроса ко всем ошибкам ответа, включая ошибки разбора и валидации
+func (Extension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	resp := next(ctx)
+	id := RequestID(ctx)
+	if resp == nil || id == "" {
+		return resp
+	}
+	for _, err := range resp.Errors {
+		if err.Extensions == nil {
+			err.Extensions = make(map[string]interface{})
+		}
+		err.Extensions["requestId"] = id
+	}
+	return resp
+}
+
+// коды из extensions.code, ошибки без кода считаются UNKNOWN
+func errorCodes(errs gqlerror.List) []string {
+	codes := make([]string, 0, len(errs))
+	for _, err := range errs {
+		code, _ := err.Extensions["code"].(string)
+		if code == "" {
+			code = "UNKNOWN"
+		}
+		codes = append(codes, code)
+	}
+	return codes
+}
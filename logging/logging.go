@@ -0,0 +1,108 @@
+// Пакет logging настраивает структурированные JSON логи и сквозной идентификатор запроса
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	stdlog "log"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// заголовок, из которого берется и в который возвращается идентификатор запроса
+const RequestIDHeader = "X-Request-ID"
+
+// чужие идентификаторы длиннее этого заменяются своими, чтобы не раздувать логи
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// Настраивает глобальный логгер: JSON в out с уровнем level (debug, info, warn, error).
+// Стандартный log тоже пишет в него, чтобы в выводе не было строк другого формата
+func Setup(level string, out io.Writer) error {
+	lvl, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	zerolog.TimeFieldFormat = time.RFC3339Nano
+	zerolog.DurationFieldUnit = time.Millisecond
+	zerolog.SetGlobalLevel(lvl)
+
+	log.Logger = zerolog.New(out).With().Timestamp().Logger()
+	zerolog.DefaultContextLogger = &log.Logger
+
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(log.Logger)
+	return nil
+}
+
+// Возвращает идентификатор запроса из контекста или пустую строку
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Кладет идентификатор запроса в контекст вместе с логгером, который добавляет его к каждой записи
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	logger := zerolog.Ctx(ctx).With().Str("request_id", id).Logger()
+	return logger.WithContext(ctx)
+}
+
+// Оборачивает обработчик HTTP: присваивает запросу идентификатор, возвращает его в заголовке X-Request-ID
+// и пишет строку лога с кодом ответа и временем обработки
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := WithRequestID(r.Context(), id)
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			logger := zerolog.Ctx(ctx).With().Str("trace_id", sc.TraceID().String()).Logger()
+			ctx = logger.WithContext(ctx)
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		zerolog.Ctx(ctx).Info().
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Int("status", rec.status).
+			Dur("duration", time.Since(start)).
+			Str("remote_addr", r.RemoteAddr).
+			Msg("http request")
+	})
+}
+
+// допускаются только короткие печатные ASCII идентификаторы, остальное может сломать логи
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
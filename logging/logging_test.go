@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	stdlog "log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"graphql-comments/graph"
+	"graphql-comments/storage/inmemory"
+)
+
+// перенаправляет логи в буфер и возвращает разобранные JSON записи
+func capture(t *testing.T) func() []map[string]interface{} {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	prev := zerolog.DefaultContextLogger
+	zerolog.DefaultContextLogger = &logger
+	t.Cleanup(func() { zerolog.DefaultContextLogger = prev })
+
+	return func() []map[string]interface{} {
+		var entries []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var entry map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	entries := capture(t)
+
+	var seen string
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	// чужой идентификатор сохраняется
+	r := httptest.NewRequest(http.MethodGet, "/query", nil)
+	r.Header.Set(RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, "req-42", seen)
+	assert.Equal(t, "req-42", w.Header().Get(RequestIDHeader))
+
+	// без заголовка и с мусором в заголовке генерируется новый
+	for _, header := range []string{"", "bad id\n", strings.Repeat("x", maxRequestIDLength+1)} {
+		r = httptest.NewRequest(http.MethodGet, "/query", nil)
+		if header != "" {
+			r.Header.Set(RequestIDHeader, header)
+		}
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Len(t, seen, 32)
+		assert.Equal(t, seen, w.Header().Get(RequestIDHeader))
+	}
+
+	logs := entries()
+	require.Len(t, logs, 4)
+	assert.Equal(t, "req-42", logs[0]["request_id"])
+	assert.Equal(t, "http request", logs[0]["message"])
+	assert.Equal(t, float64(http.StatusTeapot), logs[0]["status"])
+	assert.Equal(t, "/query", logs[0]["path"])
+}
+
+func TestExtension(t *testing.T) {
+	entries := capture(t)
+
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: graph.NewResolver(store)}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(Extension{})
+
+	post := func(body string) map[string]interface{} {
+		r := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(RequestIDHeader, "req-7")
+		w := httptest.NewRecorder()
+		Middleware(srv).ServeHTTP(w, r)
+
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	// ошибка резольвера
+	resp := post(`{"query":"query Missing { Post(id: \"999\") { title } }"}`)
+	errs := resp["errors"].([]interface{})
+	require.Len(t, errs, 1)
+	assert.Equal(t, "req-7", errs[0].(map[string]interface{})["extensions"].(map[string]interface{})["requestId"])
+
+	// ошибка валидации тоже получает идентификатор
+	resp = post(`{"query":"{ nope }"}`)
+	errs = resp["errors"].([]interface{})
+	require.Len(t, errs, 1)
+	assert.Equal(t, "req-7", errs[0].(map[string]interface{})["extensions"].(map[string]interface{})["requestId"])
+
+	var operation map[string]interface{}
+	for _, entry := range entries() {
+		if entry["message"] == "graphql operation" {
+			operation = entry
+		}
+	}
+	require.NotNil(t, operation)
+	assert.Equal(t, "warn", operation["level"])
+	assert.Equal(t, "req-7", operation["request_id"])
+	assert.Equal(t, "Missing", operation["operation"])
+	assert.Equal(t, "query", operation["operation_type"])
+	assert.Equal(t, []interface{}{"UNKNOWN"}, operation["error_codes"])
+	assert.Contains(t, operation, "duration")
+}
+
+func TestSetup(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, Setup("debug", &buf))
+	assert.Equal(t, zerolog.DebugLevel, zerolog.GlobalLevel())
+
+	// стандартный log тоже пишет JSON
+	stdlog.Print("hello")
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "hello", entry["message"])
+
+	assert.Error(t, Setup("loud", &buf))
+	assert.NoError(t, Setup("info", &buf))
+}
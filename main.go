@@ -1,83 +1,123 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"graphql-comments/config"
-	"graphql-comments/graph"
+	"graphql-comments/logging"
 	"graphql-comments/migrations"
 	"graphql-comments/storage"
-	"syscall"
-
-	"context"
-	"log"
-	"net/http"
+	"io"
 	"os"
-	"os/signal"
-	"time"
-
-	"github.com/99designs/gqlgen/graphql/handler"
-	"github.com/99designs/gqlgen/graphql/handler/transport"
-	"github.com/99designs/gqlgen/graphql/playground"
-	"github.com/gorilla/websocket"
 )
 
+// подкоманда бинарника, без аргументов запускается serve
+type command struct {
+	name  string
+	usage string
+	run   func(cfg *config.Config, args []string) error
+}
+
+var commands = []command{
+	{"serve", "serve                                     start the GraphQL server (default)", runServe},
+	{"migrate", "migrate up [N] | down [N|all] | goto V | force V | status", runMigrate},
+	{"seed", "seed [-posts N] [-comments N] [-seed N]   fill the storage with demo data", runSeed},
+	{"export", "export [-o FILE] [-post ID] [-tenant T]   write posts with comment trees as JSON Lines", runExport},
+	{"import", "import [-format F] [-remap] [-tenant T] [FILE] load an export into site T, F=disqus or wordpress loads their archives; - or no FILE reads stdin", runImport},
+	{"check", "check                                     verify configuration, schema version and storage", runCheck},
+}
+
+// ошибка неправильного вызова, вместе с ней печатается справка
+var errUsage = errors.New("invalid usage")
+
 func main() {
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		log.Fatalf("failed to load configuration: %v", err)
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, errUsage) {
+			printUsage(os.Stderr)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage(os.Stdout)
+		return nil
 	}
 
-	if cfg.StorageType == storage.StorageTypePostgres {
-		err = migrations.RunDatabaseMigrations(cfg)
-		if err != nil {
-			log.Fatalf("failed to run migrations: %v", err)
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
 		}
 	}
+	if cmd == nil {
+		return fmt.Errorf("%w: unknown command %q", errUsage, name)
+	}
 
-	store, err := storage.New(cfg)
+	cfg, err := config.LoadConfig()
 	if err != nil {
-		log.Fatalf("failed to initialize storage: %v", err)
+		return fmt.Errorf("failed to load configuration: %w", err)
 	}
-	defer store.Close()
-
-	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{Resolvers: graph.NewResolver(store)}))
 
-	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", srv)
+	// у служебных команд stdout занят результатом, например выгрузкой, поэтому логи идут в stderr
+	logOutput := io.Writer(os.Stderr)
+	if cmd.name == "serve" {
+		logOutput = os.Stdout
+	}
+	if err := logging.Setup(cfg.LogLevel, logOutput); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", cfg.LogLevel, err)
+	}
 
-	srv.AddTransport(transport.Websocket{
-		Upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true
-			},
-		},
-		KeepAlivePingInterval: 10 * time.Second,
-	})
+	return cmd.run(cfg, args)
+}
 
-	server := &http.Server{
-		Addr:    ":" + cfg.ServerPort,
-		Handler: nil,
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: graphql-comments <command> [arguments]")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintln(w, "  "+cmd.usage)
 	}
+	fmt.Fprintln(w, "\nconfiguration is read from environment variables, see config/config.go")
+}
 
-	go func() {
-		log.Printf("connect to http://localhost:%s/ for GraphQL playground", cfg.ServerPort)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("could not listen on %s: %v\n", cfg.ServerPort, err)
+// разбирает флаги подкоманды, ошибки флагов считаются неправильным вызовом
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return errUsage
 		}
-	}()
-
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM, syscall.SIGALRM)
-
-	<-stop
-
-	log.Println("уходим красиво, нажми Ctrl+C еще раз, если невтерпеж")
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	return nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+// Накатывает миграции и открывает хранилище, так делают все команды, которые работают с данными
+func openStorage(cfg *config.Config) (storage.Storager, error) {
+	if err := migrateUp(cfg); err != nil {
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("server forced to shutdown: %v", err)
+	store, err := storage.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
 	}
+	return store, nil
+}
 
-	log.Println("server exiting")
+func migrateUp(cfg *config.Config) error {
+	switch cfg.StorageType {
+	case storage.StorageTypePostgres:
+		return migrations.RunDatabaseMigrations(cfg)
+	case storage.StorageTypeSQLite:
+		return migrations.RunSQLiteMigrations(cfg)
+	}
+	return nil
 }
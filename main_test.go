@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"graphql-comments/config"
+	"graphql-comments/migrations"
+)
+
+func sqliteEnv(t *testing.T) *config.Config {
+	path := filepath.Join(t.TempDir(), "comments.db")
+	t.Setenv("STORAGE_TYPE", "sqlite")
+	t.Setenv("SQLITE_PATH", path)
+	t.Setenv("LOG_LEVEL", "error")
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err)
+	return cfg
+}
+
+func schemaVersion(t *testing.T, cfg *config.Config) migrations.Status {
+	m, err := migrations.OpenSQLite(cfg)
+	require.NoError(t, err)
+	defer m.Close()
+
+	status, err := m.Status()
+	require.NoError(t, err)
+	return status
+}
+
+func TestRunUsage(t *testing.T) {
+	assert.ErrorIs(t, run([]string{"bogus"}), errUsage)
+	assert.ErrorIs(t, run([]string{"seed", "-unknown"}), errUsage)
+	assert.ErrorIs(t, run([]string{"export", "-tenant", "Not Valid"}), errUsage)
+	assert.NoError(t, run([]string{"help"}))
+
+	sqliteEnv(t)
+	assert.ErrorIs(t, run([]string{"migrate"}), errUsage)
+	assert.ErrorIs(t, run([]string{"migrate", "sideways"}), errUsage)
+	assert.ErrorIs(t, run([]string{"migrate", "up", "-1"}), errUsage)
+	assert.ErrorIs(t, run([]string{"migrate", "goto"}), errUsage)
+}
+
+func TestRunMigrate(t *testing.T) {
+	cfg := sqliteEnv(t)
+	latest, err := migrations.SQLiteVersion()
+	require.NoError(t, err)
+
+	// до миграций check не проходит
+	assert.ErrorIs(t, run([]string{"check"}), errCheckFailed)
+
+	require.NoError(t, run([]string{"migrate", "up"}))
+	assert.Equal(t, latest, schemaVersion(t, cfg).Version)
+	require.NoError(t, run([]string{"migrate", "up"})) // повторный up ничего не меняет
+	require.NoError(t, run([]string{"check"}))
+
+	require.NoError(t, run([]string{"migrate", "down", "all"}))
+	assert.Equal(t, uint(0), schemaVersion(t, cfg).Version)
+
+	require.NoError(t, run([]string{"migrate", "goto", "1"}))
+	assert.Equal(t, uint(1), schemaVersion(t, cfg).Version)
+
+	assert.Error(t, run([]string{"migrate", "goto", "9999"}))
+	require.NoError(t, run([]string{"migrate", "force", "1"}))
+	require.NoError(t, run([]string{"migrate", "status"}))
+}
+
+func TestRunSeedExportImport(t *testing.T) {
+	sqliteEnv(t)
+	dump := filepath.Join(t.TempDir(), "dump.jsonl")
+
+	require.NoError(t, run([]string{"seed", "-posts", "2", "-comments", "3"}))
+	require.NoError(t, run([]string{"export", "-o", dump}))
+
+	// загрузка в чистую базу
+	sqliteEnv(t)
+	require.NoError(t, run([]string{"import", dump}))
+	assert.ErrorIs(t, run([]string{"import", dump, "extra"}), errUsage)
+
+	// копия одного поста рядом с оригиналом получает новые id
+	require.NoError(t, run([]string{"export", "-post", "1", "-o", dump}))
+	require.NoError(t, run([]string{"import", dump}))
+	assert.Error(t, run([]string{"export", "-post", "1337", "-o", dump}))
+}
+
+func TestRunImportWordPress(t *testing.T) {
+	sqliteEnv(t)
+	archive := filepath.Join(t.TempDir(), "blog.xml")
+	require.NoError(t, os.WriteFile(archive, []byte(`<rss xmlns:wp="http://wordpress.org/export/1.2/"><channel><item>
+<title>Запись</title><wp:post_id>1</wp:post_id><wp:post_date_gmt>2020-01-02 10:00:00</wp:post_date_gmt>
+<wp:status>publish</wp:status><wp:post_type>post</wp:post_type>
+<wp:comment><wp:comment_id>2</wp:comment_id><wp:comment_author>Иван</wp:comment_author>
+<wp:comment_date_gmt>2020-01-02 11:00:00</wp:comment_date_gmt><wp:comment_content>Привет</wp:comment_content>
+<wp:comment_approved>0</wp:comment_approved></wp:comment>
+</item></channel></rss>`), 0o644))
+
+	require.NoError(t, run([]string{"import", "-format", "wordpress", archive}))
+	assert.ErrorIs(t, run([]string{"import", "-format", "blogger", archive}), errUsage)
+}
+
+func TestRunMigrateInmemory(t *testing.T) {
+	t.Setenv("STORAGE_TYPE", "inmemory")
+	t.Setenv("LOG_LEVEL", "error")
+	assert.Error(t, run([]string{"migrate", "status"}))
+}
@@ -0,0 +1,150 @@
+package markup
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+	gohtml "golang.org/x/net/html"
+	"graphql-comments/models"
+)
+
+var (
+	// goldmark без WithUnsafe не пропускает сырой HTML, но итоговую разметку
+	// все равно прогоняем через санитайзер, чтобы не зависеть от рендерера
+	markdown = goldmark.New(
+		goldmark.WithExtensions(extension.Strikethrough, extension.Linkify, extension.Table),
+		goldmark.WithRendererOptions(gmhtml.WithHardWraps()),
+	)
+
+	policy = newPolicy()
+)
+
+// Разрешенные теги и атрибуты, все остальное вырезается
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+
+	p.AllowElements("p", "br", "hr", "strong", "em", "del", "code", "pre", "blockquote",
+		"ul", "ol", "li", "h1", "h2", "h3", "h4", "h5", "h6",
+		"table", "thead", "tbody", "tr", "th", "td")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|right|center)$`)).OnElements("th", "td")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+
+	return p
+}
+
+// Превращает текст в безопасный HTML в зависимости от формата: Markdown рендерится и очищается
+// санитайзером, обычный текст экранируется с сохранением переносов строк
+func Render(text string, format models.TextFormat) (string, error) {
+	if format != models.TextFormatMarkdown {
+		return renderPlain(text), nil
+	}
+
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(text), &buf); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(policy.Sanitize(buf.String())), nil
+}
+
+func renderPlain(text string) string {
+	escaped := html.EscapeString(strings.TrimSpace(text))
+	if escaped == "" {
+		return ""
+	}
+	return "<p>" + strings.ReplaceAll(escaped, "\n", "<br>\n") + "</p>"
+}
+
+// Теги, после которых в тексте начинается новая строка
+var blockTags = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "blockquote": true, "pre": true, "tr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true,
+}
+
+var extraNewlines = regexp.MustCompile(`\n{3,}`)
+
+// Превращает HTML из чужих систем в обычный текст: теги отбрасываются, блоки разделяются переносами строк,
+// у ссылок адрес дописывается в скобках после текста, если не совпадает с ним. Скрипты и стили вырезаются целиком
+func PlainText(source string) string {
+	// ссылка, текст которой сейчас читается: адрес и позиция начала текста
+	type link struct {
+		href  string
+		start int
+	}
+
+	var (
+		b     strings.Builder
+		links []link
+		skip  int
+	)
+	z := gohtml.NewTokenizer(strings.NewReader(source))
+	for {
+		tt := z.Next()
+		switch tt {
+		case gohtml.ErrorToken:
+			text := extraNewlines.ReplaceAllString(b.String(), "\n\n")
+			return strings.TrimSpace(text)
+
+		case gohtml.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+			}
+
+		case gohtml.StartTagToken, gohtml.SelfClosingTagToken, gohtml.EndTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			if tag == "script" || tag == "style" {
+				if tt == gohtml.StartTagToken {
+					skip++
+				} else if tt == gohtml.EndTagToken && skip > 0 {
+					skip--
+				}
+				continue
+			}
+
+			if tag == "a" {
+				if tt == gohtml.StartTagToken {
+					links = append(links, link{href: linkTarget(z, hasAttr), start: b.Len()})
+				} else if tt == gohtml.EndTagToken && len(links) > 0 {
+					l := links[len(links)-1]
+					links = links[:len(links)-1]
+					if label := b.String()[l.start:]; l.href != "" && strings.TrimSpace(label) != l.href {
+						b.WriteString(" (" + l.href + ")")
+					}
+				}
+				continue
+			}
+
+			if blockTags[tag] && (tag == "br" || tt != gohtml.StartTagToken) {
+				b.WriteString("\n")
+				if tag == "p" || tag == "blockquote" || tag == "pre" {
+					b.WriteString("\n")
+				}
+			}
+		}
+	}
+}
+
+func linkTarget(z *gohtml.Tokenizer, hasAttr bool) string {
+	for hasAttr {
+		var key, value []byte
+		key, value, hasAttr = z.TagAttr()
+		if string(key) == "href" {
+			return string(value)
+		}
+	}
+	return ""
+}
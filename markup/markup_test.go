@@ -0,0 +1,66 @@
+package markup
+
+import (
+	"graphql-comments/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderPlain(t *testing.T) {
+	html, err := Render("<script>alert(1)</script>\n**не жирный**", models.TextFormatPlain)
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>&lt;script&gt;alert(1)&lt;/script&gt;<br>\n**не жирный**</p>", html)
+
+	html, err = Render("  ", models.TextFormatPlain)
+	assert.NoError(t, err)
+	assert.Equal(t, "", html)
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	html, err := Render("**жирный** и ~~зачеркнутый~~", models.TextFormatMarkdown)
+	assert.NoError(t, err)
+	assert.Equal(t, "<p><strong>жирный</strong> и <del>зачеркнутый</del></p>", html)
+
+	html, err = Render("```go\nfmt.Println()\n```", models.TextFormatMarkdown)
+	assert.NoError(t, err)
+	assert.Equal(t, "<pre><code class=\"language-go\">fmt.Println()\n</code></pre>", html)
+}
+
+func TestRenderMarkdownSanitizesHTML(t *testing.T) {
+	cases := []string{
+		"<script>alert(1)</script>",
+		"<img src=x onerror=alert(1)>",
+		"[клик](javascript:alert(1))",
+		"<a href=\"https://example.com\" onclick=\"alert(1)\">ссылка</a>",
+	}
+
+	for _, text := range cases {
+		html, err := Render(text, models.TextFormatMarkdown)
+		assert.NoError(t, err)
+		assert.NotContains(t, html, "<script", text)
+		assert.NotContains(t, html, "onerror", text)
+		assert.NotContains(t, html, "onclick", text)
+		assert.NotContains(t, html, "javascript:", text)
+	}
+}
+
+func TestRenderMarkdownLinks(t *testing.T) {
+	html, err := Render("[пример](https://example.com)", models.TextFormatMarkdown)
+	assert.NoError(t, err)
+	assert.Equal(t, "<p><a href=\"https://example.com\" rel=\"nofollow noopener\" target=\"_blank\">пример</a></p>", html)
+}
+
+func TestPlainText(t *testing.T) {
+	cases := map[string]string{
+		"<p>Привет, <b>мир</b> &amp; все</p><p>Второй абзац<br>с переносом</p>":                "Привет, мир & все\n\nВторой абзац\nс переносом",
+		`<a href="https://example.com">сайт</a> и <a href="https://go.dev">https://go.dev</a>`: "сайт (https://example.com) и https://go.dev",
+		"<script>alert(1)</script>текст<style>p{}</style>":                                     "текст",
+		"<ul><li>один</li><li>два</li></ul>":                                                   "один\nдва",
+		"просто текст": "просто текст",
+	}
+
+	for source, want := range cases {
+		assert.Equal(t, want, PlainText(source), source)
+	}
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// код для ошибок резольверов, которые не указали extensions.code
+const codeUnknown = "UNKNOWN"
+
+// Extension это расширение gqlgen, которое считает операции, их длительность и ошибки резольверов
+type Extension struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+} = Extension{}
+
+func (Extension) ExtensionName() string {
+	return "Metrics"
+}
+
+func (Extension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (Extension) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	oc := graphql.GetOperationContext(ctx)
+	name, operationType := operationLabels(oc)
+	GraphQLRequests.WithLabelValues(name, operationType).Inc()
+
+	handler := next(ctx)
+	// у подписки нет общего времени выполнения, каждый ответ это отдельное событие
+	if operationType == string(ast.Subscription) {
+		return func(ctx context.Context) *graphql.Response {
+			resp := handler(ctx)
+			if resp != nil {
+				countErrors(resp.Errors)
+			}
+			return resp
+		}
+	}
+
+	var once sync.Once
+	return func(ctx context.Context) *graphql.Response {
+		resp := handler(ctx)
+		if resp != nil {
+			once.Do(func() {
+				GraphQLDuration.WithLabelValues(name, operationType).Observe(time.Since(oc.Stats.OperationStart).Seconds())
+				countErrors(resp.Errors)
+			})
+		}
+		return resp
+	}
+}
+
+// имя операции берется из запроса, у анонимных операций его нет
+func operationLabels(oc *graphql.OperationContext) (name, operationType string) {
+	name = oc.OperationName
+	if name == "" && oc.Operation != nil {
+		name = oc.Operation.Name
+	}
+	if name == "" {
+		name = "anonymous"
+	}
+
+	operationType = "unknown"
+	if oc.Operation != nil {
+		operationType = string(oc.Operation.Operation)
+	}
+	return name, operationType
+}
+
+func countErrors(errs gqlerror.List) {
+	for _, err := range errs {
+		code, _ := err.Extensions["code"].(string)
+		if code == "" {
+			code = codeUnknown
+		}
+		GraphQLErrors.WithLabelValues(code).Inc()
+	}
+}
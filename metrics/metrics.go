@@ -0,0 +1,111 @@
+// Пакет metrics описывает метрики Prometheus сервиса и отдает их по /metrics
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "comments"
+
+// реестр метрик сервиса, вместе с ними отдаются стандартные метрики рантайма Go и процесса
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	GraphQLRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "graphql_requests_total",
+		Help:      "Число GraphQL операций по имени и типу.",
+	}, []string{"operation", "type"})
+
+	GraphQLDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "graphql_request_duration_seconds",
+		Help:      "Время выполнения GraphQL запросов и мутаций.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "type"})
+
+	GraphQLErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "graphql_errors_total",
+		Help:      "Число ошибок в ответах резольверов по коду из extensions.code.",
+	}, []string{"code"})
+
+	ActiveSubscriptions = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_comment_subscriptions",
+		Help:      "Число активных подписок newComment по постам.",
+	}, []string{"post_id"})
+
+	StorageDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_call_duration_seconds",
+		Help:      "Время вызовов методов хранилища.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"method"})
+
+	StorageErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_errors_total",
+		Help:      "Число вызовов методов хранилища, завершившихся ошибкой.",
+	}, []string{"method"})
+)
+
+func init() {
+	Registry.MustRegister(collectors.NewGoCollector())
+	Registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+// обработчик для /metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Учитывает вызов метода хранилища, начатый в start
+func ObserveStorageCall(method string, start time.Time, err error) {
+	StorageDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		StorageErrors.WithLabelValues(method).Inc()
+	}
+}
+
+var (
+	subscriptionsMu sync.Mutex
+	subscriptions   = make(map[int]int) // id поста -> число активных подписок
+)
+
+// Учитывает подписку на комментарии под постом, вызывающий должен вызвать возвращенную функцию при отписке
+func TrackSubscription(postID int) (done func()) {
+	label := strconv.Itoa(postID)
+
+	subscriptionsMu.Lock()
+	subscriptions[postID]++
+	ActiveSubscriptions.WithLabelValues(label).Set(float64(subscriptions[postID]))
+	subscriptionsMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			subscriptionsMu.Lock()
+			defer subscriptionsMu.Unlock()
+
+			subscriptions[postID]--
+			if subscriptions[postID] > 0 {
+				ActiveSubscriptions.WithLabelValues(label).Set(float64(subscriptions[postID]))
+				return
+			}
+			// не копим метки постов, на которые больше никто не подписан
+			delete(subscriptions, postID)
+			ActiveSubscriptions.DeleteLabelValues(label)
+		})
+	}
+}
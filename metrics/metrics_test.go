@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql/handler/testserver"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func post(h http.Handler, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestExtension(t *testing.T) {
+	srv := testserver.NewError()
+	srv.AddTransport(transport.POST{})
+	srv.Use(Extension{})
+
+	requests := testutil.ToFloat64(GraphQLRequests.WithLabelValues("Named", "query"))
+	errs := testutil.ToFloat64(GraphQLErrors.WithLabelValues(codeUnknown))
+
+	w := post(srv, `{"query":"query Named { name }"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, requests+1, testutil.ToFloat64(GraphQLRequests.WithLabelValues("Named", "query")))
+	assert.Equal(t, errs+1, testutil.ToFloat64(GraphQLErrors.WithLabelValues(codeUnknown)))
+	assert.Equal(t, 1, testutil.CollectAndCount(GraphQLDuration, "comments_graphql_request_duration_seconds"))
+
+	anonymous := testutil.ToFloat64(GraphQLRequests.WithLabelValues("anonymous", "query"))
+	post(srv, `{"query":"{ name }"}`)
+	assert.Equal(t, anonymous+1, testutil.ToFloat64(GraphQLRequests.WithLabelValues("anonymous", "query")))
+}
+
+func TestObserveStorageCall(t *testing.T) {
+	before := testutil.ToFloat64(StorageErrors.WithLabelValues("GetPost"))
+
+	ObserveStorageCall("GetPost", time.Now(), nil)
+	ObserveStorageCall("GetPost", time.Now(), errors.New("post not found"))
+
+	assert.Equal(t, before+1, testutil.ToFloat64(StorageErrors.WithLabelValues("GetPost")))
+}
+
+func TestTrackSubscription(t *testing.T) {
+	first := TrackSubscription(42)
+	second := TrackSubscription(42)
+	assert.Equal(t, float64(2), testutil.ToFloat64(ActiveSubscriptions.WithLabelValues("42")))
+
+	first()
+	first() // повторный вызов ничего не меняет
+	assert.Equal(t, float64(1), testutil.ToFloat64(ActiveSubscriptions.WithLabelValues("42")))
+
+	second()
+	// метка поста без подписчиков удаляется
+	assert.False(t, ActiveSubscriptions.DeleteLabelValues("42"))
+}
+
+func TestHandler(t *testing.T) {
+	ObserveStorageCall("GetPosts", time.Now(), nil)
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `comments_storage_call_duration_seconds_count{method="GetPosts"}`)
+	assert.Contains(t, w.Body.String(), "go_goroutines")
+}
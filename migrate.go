@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"graphql-comments/config"
+	"graphql-comments/migrations"
+	"graphql-comments/storage"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// Управляет схемой бд вшитыми миграциями: up, down, goto, force и status
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: migrate needs a subcommand", errUsage)
+	}
+
+	var m *migrations.Migrator
+	var err error
+	switch cfg.StorageType {
+	case storage.StorageTypePostgres:
+		m, err = migrations.OpenPostgres(cfg)
+	case storage.StorageTypeSQLite:
+		m, err = migrations.OpenSQLite(cfg)
+	default:
+		return fmt.Errorf("storage type %q has no schema migrations", cfg.StorageType)
+	}
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	sub, args := args[0], args[1:]
+	switch sub {
+	case "status":
+		if len(args) != 0 {
+			return fmt.Errorf("%w: migrate status takes no arguments", errUsage)
+		}
+		return printStatus(m)
+
+	case "up":
+		n, err := optionalCount(args)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			err = m.Up()
+		} else {
+			err = m.Steps(n)
+		}
+		return reportMigration(m, err)
+
+	case "down":
+		// откат всех миграций удаляет данные, поэтому его нужно попросить явно
+		if len(args) == 1 && args[0] == "all" {
+			return reportMigration(m, m.Down())
+		}
+		n, err := optionalCount(args)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			n = 1
+		}
+		return reportMigration(m, m.Steps(-n))
+
+	case "goto", "force":
+		version, err := requiredVersion(m, args)
+		if err != nil {
+			return err
+		}
+		if sub == "goto" {
+			return reportMigration(m, m.Migrate.Migrate(version))
+		}
+		// force только записывает версию и снимает флаг dirty, сами миграции не выполняются
+		return reportMigration(m, m.Force(int(version)))
+	}
+
+	return fmt.Errorf("%w: unknown migrate subcommand %q", errUsage, sub)
+}
+
+func optionalCount(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, nil
+	}
+	if len(args) > 1 {
+		return 0, fmt.Errorf("%w: too many arguments", errUsage)
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%w: number of steps must be a positive integer, got %q", errUsage, args[0])
+	}
+	return n, nil
+}
+
+func requiredVersion(m *migrations.Migrator, args []string) (uint, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("%w: a migration version is required", errUsage)
+	}
+	version, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid migration version %q", errUsage, args[0])
+	}
+	if !m.HasVersion(uint(version)) {
+		return 0, fmt.Errorf("migration %d does not exist", version)
+	}
+	return uint(version), nil
+}
+
+// печатает итог команды, отсутствие изменений ошибкой не считается
+func reportMigration(m *migrations.Migrator, err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Println("no change")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return printStatus(m)
+}
+
+func printStatus(m *migrations.Migrator) error {
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("version: %d\n", status.Version)
+	fmt.Printf("dirty:   %t\n", status.Dirty)
+	fmt.Printf("latest:  %d\n", status.Latest)
+	if len(status.Pending) == 0 {
+		fmt.Println("pending: none")
+	} else {
+		fmt.Printf("pending: %v\n", status.Pending)
+	}
+	return nil
+}
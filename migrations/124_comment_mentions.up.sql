@@ -0,0 +1,9 @@
+-- таблица с упоминаниями пользователей в комментах
+CREATE TABLE IF NOT EXISTS comment_mentions (
+    comment_id INT NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    handle VARCHAR(255) NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (comment_id, handle)
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_mentions_handle ON comment_mentions(handle, comment_id);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS notifications CASCADE;
\ No newline at end of file
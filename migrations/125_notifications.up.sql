@@ -0,0 +1,15 @@
+-- таблица с уведомлениями пользователей
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    recipient VARCHAR(255) NOT NULL,
+    type VARCHAR(32) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    comment_id INT REFERENCES comments(id) ON DELETE CASCADE,
+    message TEXT NOT NULL DEFAULT '',
+    read BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_recipient ON notifications(recipient, id DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(recipient, id DESC) WHERE NOT read;
@@ -0,0 +1,7 @@
+ALTER TABLE comments DROP COLUMN IF EXISTS text_html;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS format;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS content_html;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS format;
@@ -0,0 +1,7 @@
+-- формат текста и закешированный HTML, старые записи остаются обычным текстом,
+-- пустой HTML у них рендерится при запросе
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS format VARCHAR(16) NOT NULL DEFAULT 'PLAIN';
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS content_html TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS format VARCHAR(16) NOT NULL DEFAULT 'PLAIN';
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS text_html TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- ключи идемпотентности мутаций: повтор запроса с тем же ключом возвращает уже созданную запись
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    scope VARCHAR(32) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    result_id INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
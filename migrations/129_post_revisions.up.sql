@@ -0,0 +1,18 @@
+-- версия поста для оптимистичной блокировки и история его редактирования
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS post_revisions (
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    format VARCHAR(16) NOT NULL DEFAULT 'PLAIN',
+    allow_comments BOOLEAN NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (post_id, version)
+);
+
+-- история существующих постов начинается с их текущего состояния
+INSERT INTO post_revisions (post_id, version, title, content, format, allow_comments, created_at)
+SELECT id, version, title, content, format, allow_comments, created_at FROM posts
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,8 @@
+-- черновики и отложенная публикация постов. Существующие посты считаются опубликованными в момент создания
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'PUBLISHED';
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS publish_at TIMESTAMP;
+
+UPDATE posts SET publish_at = created_at WHERE publish_at IS NULL AND status = 'PUBLISHED';
+
+-- планировщик ищет только запланированные посты, их немного
+CREATE INDEX IF NOT EXISTS posts_scheduled_idx ON posts (publish_at) WHERE status = 'SCHEDULED';
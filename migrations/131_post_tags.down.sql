@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS post_tags;
+
+DROP INDEX IF EXISTS posts_category_idx;
+ALTER TABLE posts DROP COLUMN IF EXISTS category;
@@ -0,0 +1,12 @@
+-- категория поста и теги. Пустая категория значит, что она не задана
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS category VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS post_tags (
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    tag VARCHAR(64) NOT NULL,
+    PRIMARY KEY (post_id, tag)
+);
+
+-- фильтр по тегу и подсчет постов по тегам
+CREATE INDEX IF NOT EXISTS post_tags_tag_idx ON post_tags (tag);
+CREATE INDEX IF NOT EXISTS posts_category_idx ON posts (category) WHERE category <> '';
@@ -0,0 +1,6 @@
+-- посты-треды внешних ресурсов: комментарии к странице, которой нет среди постов, хранятся под служебным постом с ее ключом
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS thread_namespace VARCHAR(64);
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS thread_key VARCHAR(2048);
+
+-- у ресурса один тред, индекс же ищет тред по ключу
+CREATE UNIQUE INDEX IF NOT EXISTS posts_thread_idx ON posts (thread_namespace, thread_key) WHERE thread_namespace IS NOT NULL;
@@ -0,0 +1,20 @@
+DROP INDEX IF EXISTS idx_notifications_unread;
+DROP INDEX IF EXISTS idx_notifications_recipient;
+CREATE INDEX IF NOT EXISTS idx_notifications_recipient ON notifications(recipient, id DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(recipient, id DESC) WHERE NOT read;
+DROP INDEX IF EXISTS idx_comments_tenant_id;
+DROP INDEX IF EXISTS idx_posts_tenant_created_at;
+
+-- откат не пройдет, пока у разных сайтов есть треды одного и того же ресурса
+DROP INDEX IF EXISTS posts_thread_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS posts_thread_idx ON posts (thread_namespace, thread_key) WHERE thread_namespace IS NOT NULL;
+
+-- ключи разных сайтов могут совпадать, при откате они теряются, как при истечении срока
+DELETE FROM idempotency_keys WHERE tenant_id <> 'default';
+ALTER TABLE idempotency_keys DROP CONSTRAINT IF EXISTS idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (scope, key);
+
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE notifications DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE comments DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE posts DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,20 @@
+-- арендаторы: каждый пост, комментарий, уведомление и ключ идемпотентности принадлежит одному сайту,
+-- записи, созданные до этой миграции, переходят к сайту default
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT IF EXISTS idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (tenant_id, scope, key);
+
+-- у каждого сайта свое пространство ключей тредов
+DROP INDEX IF EXISTS posts_thread_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS posts_thread_idx ON posts (tenant_id, thread_namespace, thread_key) WHERE thread_namespace IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_posts_tenant_created_at ON posts(tenant_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_comments_tenant_id ON comments(tenant_id, id);
+DROP INDEX IF EXISTS idx_notifications_recipient;
+DROP INDEX IF EXISTS idx_notifications_unread;
+CREATE INDEX IF NOT EXISTS idx_notifications_recipient ON notifications(tenant_id, recipient, id DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(tenant_id, recipient, id DESC) WHERE NOT read;
@@ -0,0 +1,3 @@
+ALTER TABLE post_revisions ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE current_setting('TimeZone');
+ALTER TABLE posts ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE current_setting('TimeZone');
+ALTER TABLE posts ALTER COLUMN publish_at TYPE TIMESTAMP USING publish_at AT TIME ZONE 'UTC';
@@ -0,0 +1,9 @@
+-- время создания и публикации поста и время ревизий хранятся с часовым поясом: created_at заполнял
+-- CURRENT_TIMESTAMP в поясе сессии бд, а publish_at сервис писал в UTC. Время, перенесенное миграцией 130
+-- из created_at, совпадает с ним и читается в поясе сессии, остальное время публикации записано в UTC
+ALTER TABLE posts ALTER COLUMN publish_at TYPE TIMESTAMPTZ USING CASE
+    WHEN publish_at = created_at THEN publish_at AT TIME ZONE current_setting('TimeZone')
+    ELSE publish_at AT TIME ZONE 'UTC' END;
+ALTER TABLE posts ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone');
+-- ревизии получали время от CURRENT_TIMESTAMP или из created_at поста, оба в поясе сессии
+ALTER TABLE post_revisions ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone');
@@ -1,22 +1,186 @@
 package migrations
 
 import (
+	"embed"
+	"errors"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"graphql-comments/config"
+	"io/fs"
 )
 
+// миграции вшиты в бинарник, чтобы для установки и обслуживания хватало одного файла
+//
+//go:embed *.sql
+var postgresMigrations embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// Migrator это golang-migrate вместе со списком версий из источника миграций
+type Migrator struct {
+	*migrate.Migrate
+	versions []uint
+}
+
+// Состояние схемы бд относительно доступных миграций
+type Status struct {
+	Version uint // текущая версия, 0 если миграции еще не накатывались
+	Dirty   bool // последняя миграция упала на середине, нужен force
+	Latest  uint
+	Pending []uint // версии, которые накатит up
+}
+
+// Открывает мигратор Postgres. Миграции берутся из каталога MigrationsPath, если он задан, иначе вшитые
+func OpenPostgres(cfg *config.Config) (*Migrator, error) {
+	return open(func() (source.Driver, error) { return postgresSource(cfg) }, cfg.DatabaseURL)
+}
+
+// Открывает мигратор SQLite для файла из SqlitePath
+func OpenSQLite(cfg *config.Config) (*Migrator, error) {
+	return open(sqliteSource, "sqlite://"+cfg.SqlitePath)
+}
+
 func RunDatabaseMigrations(cfg *config.Config) error {
-	m, err := migrate.New(
-		"file://"+cfg.MigrationsPath,
-		cfg.DatabaseURL)
+	m, err := OpenPostgres(cfg)
+	if err != nil {
+		return err
+	}
+
+	return up(m)
+}
+
+// Накатывает миграции SQLite на файл из SqlitePath
+func RunSQLiteMigrations(cfg *config.Config) error {
+	m, err := OpenSQLite(cfg)
 	if err != nil {
 		return err
 	}
+
+	return up(m)
+}
+
+// Последняя версия миграций Postgres, до нее должна быть накачена схема
+func PostgresVersion(cfg *config.Config) (uint, error) {
+	src, err := postgresSource(cfg)
+	if err != nil {
+		return 0, err
+	}
+	return latestVersion(src)
+}
+
+// Последняя версия вшитых миграций SQLite
+func SQLiteVersion() (uint, error) {
+	src, err := sqliteSource()
+	if err != nil {
+		return 0, err
+	}
+	return latestVersion(src)
+}
+
+func (m *Migrator) Status() (Status, error) {
+	var status Status
+	if len(m.versions) > 0 {
+		status.Latest = m.versions[len(m.versions)-1]
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return status, err
+	}
+	status.Version, status.Dirty = version, dirty
+
+	for _, v := range m.versions {
+		if v > version {
+			status.Pending = append(status.Pending, v)
+		}
+	}
+	return status, nil
+}
+
+// Проверяет, что версия есть среди миграций: goto и force на несуществующую версию ломают схему
+func (m *Migrator) HasVersion(version uint) bool {
+	for _, v := range m.versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+func postgresSource(cfg *config.Config) (source.Driver, error) {
+	if cfg.MigrationsPath != "" {
+		return source.Open("file://" + cfg.MigrationsPath)
+	}
+	return iofs.New(postgresMigrations, ".")
+}
+
+func sqliteSource() (source.Driver, error) {
+	return iofs.New(sqliteMigrations, "sqlite")
+}
+
+// golang-migrate закрывает источник вместе с мигратором, поэтому список версий читается из отдельного экземпляра
+func open(newSource func() (source.Driver, error), databaseURL string) (*Migrator, error) {
+	src, err := newSource()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := listVersions(src)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err = newSource()
+	if err != nil {
+		return nil, err
+	}
+	m, err := migrate.NewWithSourceInstance("migrations", src, databaseURL)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+
+	return &Migrator{Migrate: m, versions: versions}, nil
+}
+
+func latestVersion(src source.Driver) (uint, error) {
+	versions, err := listVersions(src)
+	if err != nil {
+		return 0, err
+	}
+	return versions[len(versions)-1], nil
+}
+
+// версии миграций в порядке применения, закрывает источник
+func listVersions(src source.Driver) ([]uint, error) {
+	defer src.Close()
+
+	version, err := src.First()
+	if err != nil {
+		return nil, err
+	}
+	versions := []uint{version}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return versions, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, next)
+		version = next
+	}
+}
+
+func up(m *Migrator) error {
 	defer m.Close()
 
-	err = m.Up()
+	err := m.Up()
 	if err != nil && err != migrate.ErrNoChange {
 		return err
 	}
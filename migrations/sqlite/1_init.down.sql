@@ -0,0 +1,13 @@
+DROP TRIGGER IF EXISTS comments_fts_update;
+DROP TRIGGER IF EXISTS comments_fts_delete;
+DROP TRIGGER IF EXISTS comments_fts_insert;
+DROP TRIGGER IF EXISTS posts_fts_update;
+DROP TRIGGER IF EXISTS posts_fts_delete;
+DROP TRIGGER IF EXISTS posts_fts_insert;
+DROP TABLE IF EXISTS comments_fts;
+DROP TABLE IF EXISTS posts_fts;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS comment_mentions;
+DROP TABLE IF EXISTS comment_hierarchy;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS posts;
@@ -0,0 +1,86 @@
+-- схема для SQLite повторяет схему postgres, собранную из всех миграций в корне пакета
+
+-- таблица с постами
+CREATE TABLE IF NOT EXISTS posts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title VARCHAR(255) NOT NULL,
+    author VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    allow_comments BOOLEAN NOT NULL DEFAULT TRUE,
+    format VARCHAR(16) NOT NULL DEFAULT 'PLAIN',
+    content_html TEXT NOT NULL DEFAULT ''
+);
+
+-- таблица с комментами
+CREATE TABLE IF NOT EXISTS comments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    author VARCHAR(255) NOT NULL,
+    text TEXT NOT NULL CHECK (length(text) <= 2000),
+    created_at TIMESTAMP NOT NULL,
+    has_replies BOOLEAN NOT NULL DEFAULT FALSE,
+    format VARCHAR(16) NOT NULL DEFAULT 'PLAIN',
+    text_html TEXT NOT NULL DEFAULT ''
+);
+
+-- таблица со связями комментов
+CREATE TABLE IF NOT EXISTS comment_hierarchy (
+    parent_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    child_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    PRIMARY KEY (parent_id, child_id)
+);
+
+-- таблица с упоминаниями пользователей в комментах
+CREATE TABLE IF NOT EXISTS comment_mentions (
+    comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    handle VARCHAR(255) NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (comment_id, handle)
+);
+
+-- таблица с уведомлениями пользователей
+CREATE TABLE IF NOT EXISTS notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    recipient VARCHAR(255) NOT NULL,
+    type VARCHAR(32) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    message TEXT NOT NULL DEFAULT '',
+    read BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts(created_at);
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(post_id);
+CREATE INDEX IF NOT EXISTS idx_comments_created_at ON comments(created_at);
+CREATE INDEX IF NOT EXISTS idx_comment_hierarchy_child_id ON comment_hierarchy(child_id);
+CREATE INDEX IF NOT EXISTS idx_comment_mentions_handle ON comment_mentions(handle, comment_id);
+CREATE INDEX IF NOT EXISTS idx_notifications_recipient ON notifications(recipient, id DESC);
+
+-- полнотекстовый поиск на FTS5, индексы хранят только токены и ссылаются на исходные таблицы
+CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(title, content, content='posts', content_rowid='id');
+CREATE VIRTUAL TABLE IF NOT EXISTS comments_fts USING fts5(text, content='comments', content_rowid='id');
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO posts_fts(rowid, title, content) VALUES (new.id, new.title, new.content);
+END;
+CREATE TRIGGER IF NOT EXISTS posts_fts_delete AFTER DELETE ON posts BEGIN
+    INSERT INTO posts_fts(posts_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+END;
+CREATE TRIGGER IF NOT EXISTS posts_fts_update AFTER UPDATE OF title, content ON posts BEGIN
+    INSERT INTO posts_fts(posts_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+    INSERT INTO posts_fts(rowid, title, content) VALUES (new.id, new.title, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS comments_fts_insert AFTER INSERT ON comments BEGIN
+    INSERT INTO comments_fts(rowid, text) VALUES (new.id, new.text);
+END;
+CREATE TRIGGER IF NOT EXISTS comments_fts_delete AFTER DELETE ON comments BEGIN
+    INSERT INTO comments_fts(comments_fts, rowid, text) VALUES ('delete', old.id, old.text);
+END;
+CREATE TRIGGER IF NOT EXISTS comments_fts_update AFTER UPDATE OF text ON comments BEGIN
+    INSERT INTO comments_fts(comments_fts, rowid, text) VALUES ('delete', old.id, old.text);
+    INSERT INTO comments_fts(rowid, text) VALUES (new.id, new.text);
+END;
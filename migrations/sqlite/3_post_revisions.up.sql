@@ -0,0 +1,16 @@
+-- версия поста и история его редактирования, повторяет миграцию 129 postgres
+ALTER TABLE posts ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS post_revisions (
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    format VARCHAR(16) NOT NULL DEFAULT 'PLAIN',
+    allow_comments BOOLEAN NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (post_id, version)
+);
+
+INSERT OR IGNORE INTO post_revisions (post_id, version, title, content, format, allow_comments, created_at)
+SELECT id, version, title, content, format, allow_comments, created_at FROM posts;
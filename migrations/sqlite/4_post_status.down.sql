@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS posts_scheduled_idx;
+
+ALTER TABLE posts DROP COLUMN publish_at;
+ALTER TABLE posts DROP COLUMN status;
@@ -0,0 +1,7 @@
+-- статус публикации поста, повторяет миграцию 130 postgres
+ALTER TABLE posts ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'PUBLISHED';
+ALTER TABLE posts ADD COLUMN publish_at TIMESTAMP;
+
+UPDATE posts SET publish_at = created_at WHERE publish_at IS NULL AND status = 'PUBLISHED';
+
+CREATE INDEX IF NOT EXISTS posts_scheduled_idx ON posts (publish_at) WHERE status = 'SCHEDULED';
@@ -0,0 +1,11 @@
+-- категория и теги постов, повторяет миграцию 131 postgres
+ALTER TABLE posts ADD COLUMN category VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS post_tags (
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    tag VARCHAR(64) NOT NULL,
+    PRIMARY KEY (post_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS post_tags_tag_idx ON post_tags (tag);
+CREATE INDEX IF NOT EXISTS posts_category_idx ON posts (category) WHERE category <> '';
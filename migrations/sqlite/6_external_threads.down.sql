@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS posts_thread_idx;
+ALTER TABLE posts DROP COLUMN thread_key;
+ALTER TABLE posts DROP COLUMN thread_namespace;
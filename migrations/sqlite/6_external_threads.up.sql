@@ -0,0 +1,5 @@
+-- треды внешних ресурсов, повторяет миграцию 132 postgres
+ALTER TABLE posts ADD COLUMN thread_namespace VARCHAR(64);
+ALTER TABLE posts ADD COLUMN thread_key VARCHAR(2048);
+
+CREATE UNIQUE INDEX IF NOT EXISTS posts_thread_idx ON posts (thread_namespace, thread_key) WHERE thread_namespace IS NOT NULL;
@@ -0,0 +1,26 @@
+DROP INDEX IF EXISTS idx_notifications_recipient;
+CREATE INDEX IF NOT EXISTS idx_notifications_recipient ON notifications(recipient, id DESC);
+DROP INDEX IF EXISTS idx_comments_tenant_id;
+DROP INDEX IF EXISTS idx_posts_tenant_created_at;
+
+-- откат не пройдет, пока у разных сайтов есть треды одного и того же ресурса
+DROP INDEX IF EXISTS posts_thread_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS posts_thread_idx ON posts (thread_namespace, thread_key) WHERE thread_namespace IS NOT NULL;
+
+CREATE TABLE idempotency_keys_old (
+    scope VARCHAR(32) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    result_id INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (scope, key)
+);
+INSERT INTO idempotency_keys_old (scope, key, request_hash, result_id, expires_at)
+    SELECT scope, key, request_hash, result_id, expires_at FROM idempotency_keys WHERE tenant_id = 'default';
+DROP TABLE idempotency_keys;
+ALTER TABLE idempotency_keys_old RENAME TO idempotency_keys;
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+ALTER TABLE notifications DROP COLUMN tenant_id;
+ALTER TABLE comments DROP COLUMN tenant_id;
+ALTER TABLE posts DROP COLUMN tenant_id;
@@ -0,0 +1,28 @@
+-- арендаторы, повторяет миграцию 133 postgres
+ALTER TABLE posts ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE comments ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE notifications ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+-- первичный ключ в SQLite не меняется, поэтому таблица ключей идемпотентности пересоздается
+CREATE TABLE idempotency_keys_new (
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    scope VARCHAR(32) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    result_id INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (tenant_id, scope, key)
+);
+INSERT INTO idempotency_keys_new (scope, key, request_hash, result_id, expires_at)
+    SELECT scope, key, request_hash, result_id, expires_at FROM idempotency_keys;
+DROP TABLE idempotency_keys;
+ALTER TABLE idempotency_keys_new RENAME TO idempotency_keys;
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+DROP INDEX IF EXISTS posts_thread_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS posts_thread_idx ON posts (tenant_id, thread_namespace, thread_key) WHERE thread_namespace IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_posts_tenant_created_at ON posts(tenant_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_comments_tenant_id ON comments(tenant_id, id);
+DROP INDEX IF EXISTS idx_notifications_recipient;
+CREATE INDEX IF NOT EXISTS idx_notifications_recipient ON notifications(tenant_id, recipient, id DESC);
@@ -0,0 +1,19 @@
+package models
+
+import "errors"
+
+// ошибки хранилища, общие для всех реализаций Storager, чтобы вызывающий код
+// мог сравнивать их через errors.Is независимо от выбранного бэкенда
+var (
+	ErrPostNotFound          = errors.New("post not found")
+	ErrCommentsAreNotAllowed = errors.New("comments are not allowed for this post")
+	ErrParentCommentNotFound = errors.New("parent comment not found")
+	ErrCommentNotFound       = errors.New("comment not found")
+	ErrIDConflict            = errors.New("record with this id already exists")
+	ErrVersionConflict       = errors.New("post was changed by another request")
+	ErrThreadNotFound        = errors.New("thread not found")
+
+	// схема бд не докачена до версии, которую ожидает сервис, или последняя миграция упала на середине
+	ErrSchemaOutdated = errors.New("database schema is outdated")
+	ErrSchemaDirty    = errors.New("database schema is dirty")
+)
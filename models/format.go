@@ -0,0 +1,42 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// формат текста поста или комментария
+type TextFormat string
+
+const (
+	TextFormatPlain    TextFormat = "PLAIN"
+	TextFormatMarkdown TextFormat = "MARKDOWN"
+)
+
+func (f TextFormat) IsValid() bool {
+	switch f {
+	case TextFormatPlain, TextFormatMarkdown:
+		return true
+	}
+	return false
+}
+
+// маршалер перечисления TextFormat
+func (f TextFormat) MarshalGQL(w io.Writer) {
+	io.WriteString(w, strconv.Quote(string(f)))
+}
+
+// анмаршалер перечисления TextFormat
+func (f *TextFormat) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*f = TextFormat(str)
+	if !f.IsValid() {
+		return fmt.Errorf("%s is not a valid TextFormat", str)
+	}
+	return nil
+}
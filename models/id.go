@@ -0,0 +1,131 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// типы объектов, которые получают глобальные идентификаторы
+const (
+	NodeTypePost         = "Post"
+	NodeTypeComment      = "Comment"
+	NodeTypeNotification = "Notification"
+)
+
+var ErrInvalidID = errors.New("error occured while parsing id")
+
+// поля и аргументы, которые ссылаются на объект другого типа, а не на объект, в котором объявлены
+var referenceFieldTypes = map[string]string{
+	"postId":    NodeTypePost,
+	"parentId":  NodeTypeComment,
+	"commentId": NodeTypeComment,
+	"afterID":   NodeTypeComment, // курсор страниц комментариев
+}
+
+// корневые поля, у которых аргументы id, ids и after относятся к определенному типу;
+// node и nodes принимают идентификатор любого типа
+var rootFieldTypes = map[string]string{
+	"Post":                  NodeTypePost,
+	"updatePost":            NodeTypePost,
+	"publishPost":           NodeTypePost,
+	"unpublishPost":         NodeTypePost,
+	"notifications":         NodeTypeNotification,
+	"markNotificationsRead": NodeTypeNotification,
+}
+
+// Кодирует глобальный идентификатор вида base64("Post:5")
+func EncodeGlobalID(nodeType string, id int) string {
+	return base64.StdEncoding.EncodeToString([]byte(nodeType + ":" + strconv.Itoa(id)))
+}
+
+// Раскодирует глобальный идентификатор. Для совместимости со старыми клиентами принимает
+// и голые числа, тогда тип возвращается пустым
+func DecodeGlobalID(globalID string) (string, int, error) {
+	if id, err := strconv.Atoi(globalID); err == nil {
+		return "", id, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(globalID)
+	if err != nil {
+		return "", 0, ErrInvalidID
+	}
+	nodeType, rawID, ok := strings.Cut(string(raw), ":")
+	if !ok || nodeType == "" {
+		return "", 0, ErrInvalidID
+	}
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		return "", 0, ErrInvalidID
+	}
+
+	return nodeType, id, nil
+}
+
+// маршалер скалярного типа ID, тип объекта определяется по полю, которое сейчас сериализуется:
+// id принадлежит самому объекту, а postId, parentId и commentId ссылаются на пост или комментарий
+func MarshalID(id int) graphql.ContextMarshaler {
+	return graphql.ContextWriterFunc(func(ctx context.Context, w io.Writer) error {
+		nodeType := outputIDType(ctx)
+		if nodeType == "" {
+			io.WriteString(w, strconv.Quote(strconv.Itoa(id)))
+			return nil
+		}
+		io.WriteString(w, strconv.Quote(EncodeGlobalID(nodeType, id)))
+		return nil
+	})
+}
+
+// анмаршалер скалярного типа ID, проверяет, что идентификатор принадлежит ожидаемому типу
+func UnmarshalID(ctx context.Context, v interface{}) (int, error) {
+	globalID, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("ids must be strings")
+	}
+
+	nodeType, id, err := DecodeGlobalID(globalID)
+	if err != nil {
+		return 0, err
+	}
+
+	if expected := inputIDType(ctx); nodeType != "" && expected != "" && nodeType != expected {
+		return 0, fmt.Errorf("expected %s id, got %s id", expected, nodeType)
+	}
+	return id, nil
+}
+
+func outputIDType(ctx context.Context) string {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil {
+		return ""
+	}
+	if fc.Field.Name == "id" {
+		return fc.Object
+	}
+	return referenceFieldTypes[fc.Field.Name]
+}
+
+// Тип, которому должен принадлежать входящий идентификатор: по имени аргумента или поля
+// входного объекта, а для id, ids и after по корневому полю, в котором они переданы
+func inputIDType(ctx context.Context) string {
+	for pc := graphql.GetPathContext(ctx); pc != nil; pc = pc.Parent {
+		if pc.Field == nil {
+			continue
+		}
+		if nodeType, ok := referenceFieldTypes[*pc.Field]; ok {
+			return nodeType
+		}
+		break
+	}
+
+	if fc := graphql.GetFieldContext(ctx); fc != nil {
+		return rootFieldTypes[fc.Field.Name]
+	}
+	return ""
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlobalIDRoundTrip(t *testing.T) {
+	globalID := EncodeGlobalID(NodeTypeComment, 5)
+	assert.Equal(t, "Q29tbWVudDo1", globalID)
+
+	nodeType, id, err := DecodeGlobalID(globalID)
+	assert.NoError(t, err)
+	assert.Equal(t, NodeTypeComment, nodeType)
+	assert.Equal(t, 5, id)
+}
+
+func TestDecodeGlobalIDLegacy(t *testing.T) {
+	nodeType, id, err := DecodeGlobalID("42")
+	assert.NoError(t, err)
+	assert.Equal(t, "", nodeType)
+	assert.Equal(t, 42, id)
+}
+
+func TestDecodeGlobalIDInvalid(t *testing.T) {
+	for _, globalID := range []string{"", "не base64", EncodeGlobalID("", 1), "UG9zdDphYmM="} {
+		_, _, err := DecodeGlobalID(globalID)
+		assert.Equal(t, ErrInvalidID, err, globalID)
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// операции, для которых клиент может передать ключ идемпотентности. Ключи разных операций не пересекаются
+const (
+	IdempotencyScopeCreatePost          = "createPost"
+	IdempotencyScopeCreateComment       = "createComment"
+	IdempotencyScopeCreateThreadComment = "createThreadComment"
+)
+
+// структура описывает ключ идемпотентности и результат запроса, выполненного с ним
+type IdempotencyKey struct {
+	Scope       string
+	Key         string
+	RequestHash string    // хеш тела запроса, повтор с тем же ключом и другим телом отклоняется
+	ResultID    int       // id созданной записи, 0 пока запрос выполняется
+	ExpiresAt   time.Time // после этого момента ключ можно использовать заново
+}
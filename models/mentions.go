@@ -0,0 +1,41 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// максимальная длина хендла, совпадает с длиной колонки handle в comment_mentions
+const maxHandleLength = 255
+
+// упоминание начинается с @ в начале строки или после символа, который не может быть частью
+// хендла или email, так что адреса вида user@example.com упоминаниями не считаются
+var mentionRegexp = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@.])@([\p{L}\p{N}_][\p{L}\p{N}_.-]*)`)
+
+// Находит упоминания вида @handle в тексте комментария.
+// Хендлы приводятся к нижнему регистру и возвращаются без повторов в порядке появления в тексте
+func ParseMentions(text string) []string {
+	var mentions []string
+	seen := make(map[string]struct{})
+
+	for _, match := range mentionRegexp.FindAllStringSubmatch(text, -1) {
+		// точка или дефис в конце скорее относятся к предложению, чем к хендлу
+		handle := NormalizeHandle(strings.TrimRight(match[1], ".-"))
+		if handle == "" || utf8.RuneCountInString(handle) > maxHandleLength {
+			continue
+		}
+		if _, ok := seen[handle]; ok {
+			continue
+		}
+		seen[handle] = struct{}{}
+		mentions = append(mentions, handle)
+	}
+
+	return mentions
+}
+
+// Приводит хендл пользователя к виду, в котором он хранится: без @ и в нижнем регистре
+func NormalizeHandle(handle string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+}
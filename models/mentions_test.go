@@ -0,0 +1,32 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMentions(t *testing.T) {
+	cases := []struct {
+		text     string
+		expected []string
+	}{
+		{"без упоминаний", nil},
+		{"@vasya привет", []string{"vasya"}},
+		{"привет, @Вася и @petya_1!", []string{"вася", "petya_1"}},
+		{"@Vasya @vasya @VASYA", []string{"vasya"}},
+		{"пиши на vasya@example.com", nil},
+		{"спасибо @john.doe.", []string{"john.doe"}},
+		{"(@anna) и @@bob", []string{"anna"}},
+		{"@ просто собака", nil},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, ParseMentions(c.text), c.text)
+	}
+}
+
+func TestNormalizeHandle(t *testing.T) {
+	assert.Equal(t, "vasya", NormalizeHandle(" @Vasya "))
+	assert.Equal(t, "вася", NormalizeHandle("Вася"))
+}
@@ -1,11 +1,6 @@
 package models
 
 import (
-	"errors"
-	"fmt"
-	"github.com/99designs/gqlgen/graphql"
-	"io"
-	"strconv"
 	"time"
 )
 
@@ -18,49 +13,40 @@ type Post struct {
 	AllowComments bool      `json:"AllowComments"`
 	CreatedAt     time.Time `json:"createdAt"`
 	Comments      []Comment
+	Format        TextFormat `json:"format"`
+	ContentHTML   string     `json:"contentHtml"` // закешированный результат рендеринга Content
+	Version       int        `json:"version"`     // номер текущей ревизии, у нового поста 1
+	Status        PostStatus `json:"status"`
+	PublishAt     *time.Time `json:"publishAt"`        // когда пост опубликован или будет опубликован, у черновика nil
+	Tags          []string   `json:"tags"`             // нормализованные теги в алфавитном порядке
+	Category      string     `json:"category"`         // пустая строка, если категория не задана
+	Thread        *ThreadKey `json:"thread,omitempty"` // внешний ресурс, если пост служит тредом для него
+	TenantID      string     `json:"tenantId,omitempty"`
 }
 
 // структура описывает комментарии под постом
 type Comment struct {
-	ID         int       `json:"id"`
-	PostID     int       `json:"post_id"`
-	ParentID   *int      `json:"parent_id"`
-	Author     string    `json:"author"`
-	Text       string    `json:"text"`
-	CreatedAt  time.Time `json:"createdAt"`
-	HasReplies bool      `json:"hasReplies"`
+	ID         int        `json:"id"`
+	PostID     int        `json:"post_id"`
+	ParentID   *int       `json:"parent_id"`
+	Author     string     `json:"author"`
+	Text       string     `json:"text"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	HasReplies bool       `json:"hasReplies"`
+	Mentions   []string   `json:"mentions"` // хендлы упомянутых через @ пользователей
+	Format     TextFormat `json:"format"`
+	HTML       string     `json:"html"` // закешированный результат рендеринга Text
+	TenantID   string     `json:"tenantId,omitempty"`
 }
 
-func MarshalID(id int) graphql.Marshaler {
-	return graphql.WriterFunc(func(w io.Writer) {
-		io.WriteString(w, strconv.Quote(fmt.Sprintf("%d", id)))
-	})
+// Node это объект с глобальным идентификатором, который можно получить запросом node(id)
+type Node interface {
+	IsNode()
+	GetID() int
 }
 
-func UnmarshalID(v interface{}) (int, error) {
-	id, ok := v.(string)
-	if !ok {
-		return 0, fmt.Errorf("ids must be strings")
-	}
-	i, err := strconv.Atoi(id)
-	if err != nil {
-		return 0, errors.New("error occured while parsing id")
-	}
-	return int(i), err
-}
-
-// маршалер скалярного пользовательского типа Timestamp
-func MarshalTimestamp(t time.Time) graphql.Marshaler {
+func (Post) IsNode()      {}
+func (p Post) GetID() int { return p.ID }
 
-	return graphql.WriterFunc(func(w io.Writer) {
-		io.WriteString(w, "\""+t.Format("02.01.2006 15:04:05 MST")+"\"")
-	})
-}
-
-// анмаршалер скалярного пользовательского типа Timestamp
-func UnmarshalTimestamp(v interface{}) (time.Time, error) {
-	if tmpStr, ok := v.(int); ok {
-		return time.Unix(int64(tmpStr), 0), nil
-	}
-	return time.Time{}, errors.New("wrong timestamp")
-}
+func (Comment) IsNode()      {}
+func (c Comment) GetID() int { return c.ID }
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// тип уведомления
+type NotificationType string
+
+const (
+	NotificationTypeReply      NotificationType = "REPLY"      // ответ на пост или комментарий пользователя
+	NotificationTypeMention    NotificationType = "MENTION"    // пользователя упомянули через @
+	NotificationTypeModeration NotificationType = "MODERATION" // модератор изменил пост или комментарий пользователя
+)
+
+// структура описывает уведомление в ящике пользователя
+type Notification struct {
+	ID        int              `json:"id"`
+	Recipient string           `json:"recipient"` // хендл получателя
+	Type      NotificationType `json:"type"`
+	Actor     string           `json:"actor"` // кто вызвал уведомление
+	PostID    int              `json:"postId"`
+	CommentID *int             `json:"commentId"`
+	Message   string           `json:"message"`
+	Read      bool             `json:"read"`
+	CreatedAt time.Time        `json:"createdAt"`
+	TenantID  string           `json:"tenantId,omitempty"`
+}
+
+func (t NotificationType) IsValid() bool {
+	switch t {
+	case NotificationTypeReply, NotificationTypeMention, NotificationTypeModeration:
+		return true
+	}
+	return false
+}
+
+// маршалер перечисления NotificationType
+func (t NotificationType) MarshalGQL(w io.Writer) {
+	io.WriteString(w, strconv.Quote(string(t)))
+}
+
+// анмаршалер перечисления NotificationType
+func (t *NotificationType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*t = NotificationType(str)
+	if !t.IsValid() {
+		return fmt.Errorf("%s is not a valid NotificationType", str)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Ревизия поста: редактируемые поля в том виде, в котором они были сохранены в версии Version.
+// Первая ревизия появляется при создании поста, каждое обновление добавляет следующую
+type PostRevision struct {
+	PostID        int        `json:"postId"`
+	Version       int        `json:"version"`
+	Title         string     `json:"title"`
+	Content       string     `json:"content"`
+	Format        TextFormat `json:"format"`
+	AllowComments bool       `json:"allowComments"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+// Ревизия с текущим состоянием поста, сохраненная в момент at
+func RevisionOf(p *Post, at time.Time) PostRevision {
+	return PostRevision{
+		PostID:        p.ID,
+		Version:       p.Version,
+		Title:         p.Title,
+		Content:       p.Content,
+		Format:        p.Format,
+		AllowComments: p.AllowComments,
+		CreatedAt:     at,
+	}
+}
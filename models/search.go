@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// где искать
+type SearchScope string
+
+const (
+	SearchScopePosts    SearchScope = "POSTS"
+	SearchScopeComments SearchScope = "COMMENTS"
+	SearchScopeAll      SearchScope = "ALL"
+)
+
+// Хранилища выделяют найденные слова в сниппете этими управляющими символами,
+// FormatSnippet экранирует текст и заменяет их на теги <mark>. Управляющие символы
+// не встречаются в пользовательском тексте, поэтому подсветка не смешивается с разметкой
+const (
+	SnippetHighlightStart = "\x01"
+	SnippetHighlightStop  = "\x02"
+)
+
+// структура описывает поисковый запрос
+type SearchQuery struct {
+	Text   string
+	Scope  SearchScope
+	PostID *int // ограничивает поиск одним постом и комментариями под ним
+	Limit  int
+}
+
+// структура описывает найденный пост или комментарий
+type SearchResult struct {
+	Post    *Post    `json:"post"`
+	Comment *Comment `json:"comment"`
+	Score   float64  `json:"score"`   // релевантность, чем больше, тем выше в выдаче
+	Snippet string   `json:"snippet"` // фрагмент текста с найденными словами в <mark>
+}
+
+// Экранирует сниппет и заменяет служебные маркеры подсветки на теги <mark>
+func FormatSnippet(raw string) string {
+	escaped := html.EscapeString(raw)
+	escaped = strings.ReplaceAll(escaped, SnippetHighlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, SnippetHighlightStop, "</mark>")
+}
+
+func (s SearchScope) IsValid() bool {
+	switch s {
+	case SearchScopePosts, SearchScopeComments, SearchScopeAll:
+		return true
+	}
+	return false
+}
+
+// Нужно ли искать среди постов
+func (s SearchScope) IncludesPosts() bool {
+	return s == SearchScopePosts || s == SearchScopeAll
+}
+
+// Нужно ли искать среди комментариев
+func (s SearchScope) IncludesComments() bool {
+	return s == SearchScopeComments || s == SearchScopeAll
+}
+
+// маршалер перечисления SearchScope
+func (s SearchScope) MarshalGQL(w io.Writer) {
+	io.WriteString(w, strconv.Quote(string(s)))
+}
+
+// анмаршалер перечисления SearchScope
+func (s *SearchScope) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*s = SearchScope(str)
+	if !s.IsValid() {
+		return fmt.Errorf("%s is not a valid SearchScope", str)
+	}
+	return nil
+}
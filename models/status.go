@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// статус публикации поста
+type PostStatus string
+
+const (
+	PostStatusDraft     PostStatus = "DRAFT"
+	PostStatusScheduled PostStatus = "SCHEDULED" // опубликуется планировщиком в PublishAt
+	PostStatusPublished PostStatus = "PUBLISHED"
+)
+
+func (s PostStatus) IsValid() bool {
+	switch s {
+	case PostStatusDraft, PostStatusScheduled, PostStatusPublished:
+		return true
+	}
+	return false
+}
+
+// маршалер перечисления PostStatus
+func (s PostStatus) MarshalGQL(w io.Writer) {
+	io.WriteString(w, strconv.Quote(string(s)))
+}
+
+// анмаршалер перечисления PostStatus
+func (s *PostStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*s = PostStatus(str)
+	if !s.IsValid() {
+		return fmt.Errorf("%s is not a valid PostStatus", str)
+	}
+	return nil
+}
+
+// Какие посты отдает GetPosts. Нулевой фильтр отдает только опубликованные
+type PostFilter struct {
+	Viewer      string   // автор, которому кроме опубликованных видны и его черновики и запланированные посты
+	Unpublished bool     // все посты независимо от статуса, включая треды внешних ресурсов, для выгрузки и служебных команд
+	Tags        []string // только посты со всеми этими тегами, теги уже нормализованы
+	Category    string   // только посты этой категории, пустая строка не фильтрует
+}
+
+// Нулевой фильтр, то есть общая лента опубликованных постов
+func (f PostFilter) IsZero() bool {
+	return f.Viewer == "" && !f.Unpublished && len(f.Tags) == 0 && f.Category == ""
+}
+
+// Виден ли пост читателю viewer. Неопубликованные посты видит только их автор
+func (p *Post) VisibleTo(viewer string) bool {
+	return p.Status == PostStatusPublished || (viewer != "" && p.Author == viewer)
+}
+
+// Попадает ли пост в выборку по фильтру
+func (f PostFilter) Match(p *Post) bool {
+	if f.Unpublished {
+		return f.matchTaxonomy(p)
+	}
+	// треды внешних ресурсов не посты ленты
+	if p.Thread != nil || !p.VisibleTo(f.Viewer) {
+		return false
+	}
+	return f.matchTaxonomy(p)
+}
+
+func (f PostFilter) matchTaxonomy(p *Post) bool {
+	if f.Category != "" && p.Category != f.Category {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !p.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// Заполняет статус нового или загружаемого поста: пустой статус означает немедленную публикацию,
+// опубликованный пост без PublishAt считается опубликованным в publishedAt, у черновика PublishAt нет
+func (p *Post) SetDefaultStatus(publishedAt time.Time) {
+	if p.Status == "" {
+		p.Status = PostStatusPublished
+	}
+	switch p.Status {
+	case PostStatusPublished:
+		if p.PublishAt == nil {
+			p.PublishAt = &publishedAt
+		}
+	case PostStatusDraft:
+		p.PublishAt = nil
+	}
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// наибольшая длина тега и категории в символах
+const MaxTagLength = 64
+
+// запятая запрещена, потому что SQLite склеивает теги поста через нее
+var ErrInvalidTag = errors.New("tag must be 1 to 64 characters long and must not contain commas")
+
+// Сколько опубликованных постов отмечено тегом
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// Приводит тег или категорию к виду, в котором они хранятся: без пробелов по краям и в нижнем регистре
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" || utf8.RuneCountInString(tag) > MaxTagLength || strings.Contains(tag, ",") {
+		return "", ErrInvalidTag
+	}
+	return tag, nil
+}
+
+// Нормализует теги, убирает повторы и сортирует их, теги поста хранятся в таком виде
+func NormalizeTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	seen := make(map[string]struct{}, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag, err := NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := seen[tag]; dup {
+			continue
+		}
+		seen[tag] = struct{}{}
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// Есть ли у поста тег. Теги поста отсортированы
+func (p *Post) HasTag(tag string) bool {
+	i := sort.SearchStrings(p.Tags, tag)
+	return i < len(p.Tags) && p.Tags[i] == tag
+}
+
+// Добавляет теги add и убирает теги remove, результат снова отсортирован. Все теги уже нормализованы
+func MergeTags(tags, add, remove []string) []string {
+	removed := make(map[string]struct{}, len(remove))
+	for _, tag := range remove {
+		removed[tag] = struct{}{}
+	}
+
+	seen := make(map[string]struct{}, len(tags)+len(add))
+	var merged []string
+	for _, list := range [][]string{tags, add} {
+		for _, tag := range list {
+			if _, skip := removed[tag]; skip {
+				continue
+			}
+			if _, dup := seen[tag]; dup {
+				continue
+			}
+			seen[tag] = struct{}{}
+			merged = append(merged, tag)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// Упорядочивает счетчики от популярных тегов к редким, при равенстве по алфавиту
+func SortTagCounts(counts []TagCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Tag < counts[j].Tag
+	})
+}
+
+// Нормализует теги и категорию поста перед сохранением
+func (p *Post) NormalizeTaxonomy() error {
+	tags, err := NormalizeTags(p.Tags)
+	if err != nil {
+		return err
+	}
+	p.Tags = tags
+
+	if p.Category != "" {
+		category, err := NormalizeTag(p.Category)
+		if err != nil {
+			return err
+		}
+		p.Category = category
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := NormalizeTags([]string{" Go ", "graphql", "go", "Базы Данных"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "graphql", "базы данных"}, tags)
+
+	for _, bad := range []string{"", "  ", "a,b", strings.Repeat("я", MaxTagLength+1)} {
+		_, err := NormalizeTags([]string{"go", bad})
+		assert.ErrorIs(t, err, ErrInvalidTag, bad)
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	assert.Equal(t, []string{"a", "c", "d"}, MergeTags([]string{"a", "b"}, []string{"d", "c", "a"}, []string{"b"}))
+	assert.Nil(t, MergeTags([]string{"a"}, nil, []string{"a"}))
+}
+
+func TestPostFilterMatch(t *testing.T) {
+	post := &Post{Author: "вася", Status: PostStatusPublished, Tags: []string{"go", "sql"}, Category: "разработка"}
+
+	assert.True(t, PostFilter{}.Match(post))
+	assert.True(t, PostFilter{Tags: []string{"go", "sql"}}.Match(post))
+	assert.False(t, PostFilter{Tags: []string{"go", "rust"}}.Match(post))
+	assert.True(t, PostFilter{Category: "разработка"}.Match(post))
+	assert.False(t, PostFilter{Category: "новости"}.Match(post))
+
+	post.Status = PostStatusDraft
+	assert.False(t, PostFilter{Tags: []string{"go"}}.Match(post))
+	assert.True(t, PostFilter{Viewer: "вася", Tags: []string{"go"}}.Match(post))
+}
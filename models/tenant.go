@@ -0,0 +1,46 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"regexp"
+)
+
+// Сайт, которому принадлежат записи без арендатора: созданные до появления арендаторов
+// и созданные служебными командами без выбранного сайта
+const DefaultTenant = "default"
+
+var ErrInvalidTenant = errors.New("tenant id must be 1 to 64 characters of a-z, 0-9, '.', '_' or '-'")
+
+var tenantPattern = regexp.MustCompile(`^[a-z0-9._-]{1,64}$`)
+
+type tenantKey struct{}
+
+// Проверяет идентификатор арендатора, он хранится в бд как есть
+func ValidateTenant(id string) error {
+	if !tenantPattern.MatchString(id) {
+		return ErrInvalidTenant
+	}
+	return nil
+}
+
+// Кладет в контекст арендатора, которым хранилище ограничивает все запросы
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// Возвращает арендатора из контекста, без него DefaultTenant
+func TenantFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(tenantKey{}).(string); ok && id != "" {
+		return id
+	}
+	return DefaultTenant
+}
+
+// арендатор записи, загруженной из старого снапшота, журнала или выгрузки
+func TenantOrDefault(id string) string {
+	if id == "" {
+		return DefaultTenant
+	}
+	return id
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTenant(t *testing.T) {
+	assert.NoError(t, ValidateTenant("blog"))
+	assert.NoError(t, ValidateTenant("shop-2.eu_west"))
+	assert.ErrorIs(t, ValidateTenant(""), ErrInvalidTenant)
+	assert.ErrorIs(t, ValidateTenant("Blog"), ErrInvalidTenant)
+	assert.ErrorIs(t, ValidateTenant("a/b"), ErrInvalidTenant)
+}
+
+func TestTenantFromContext(t *testing.T) {
+	assert.Equal(t, DefaultTenant, TenantFromContext(context.Background()))
+	assert.Equal(t, "blog", TenantFromContext(WithTenant(context.Background(), "blog")))
+	assert.Equal(t, DefaultTenant, TenantOrDefault(""))
+	assert.Equal(t, "shop", TenantOrDefault("shop"))
+}
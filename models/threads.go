@@ -0,0 +1,43 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// наибольшая длина ключа внешнего треда в символах, ключом обычно служит URL страницы
+const MaxThreadKeyLength = 2048
+
+var ErrInvalidThreadKey = errors.New("thread namespace must be 1 to 64 characters of a-z, 0-9, '.', '_' or '-' and key must be 1 to 2048 characters long")
+
+var namespacePattern = regexp.MustCompile(`^[a-z0-9._-]{1,64}$`)
+
+// Внешний ресурс, к которому привязан тред комментариев: Namespace задает вид ресурса или сайт,
+// Key его адрес внутри него. Тред хранится как служебный пост, который не попадает в ленту
+type ThreadKey struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+}
+
+// Приводит ключ треда к виду, в котором он хранится: namespace в нижнем регистре, у key убираются пробелы по краям.
+// Регистр key сохраняется, потому что пути в URL к нему чувствительны
+func NormalizeThreadKey(k ThreadKey) (ThreadKey, error) {
+	k.Namespace = strings.ToLower(strings.TrimSpace(k.Namespace))
+	k.Key = strings.TrimSpace(k.Key)
+	if !namespacePattern.MatchString(k.Namespace) || k.Key == "" || utf8.RuneCountInString(k.Key) > MaxThreadKeyLength {
+		return k, ErrInvalidThreadKey
+	}
+	return k, nil
+}
+
+// Служебный пост нового треда: открыт для комментариев и опубликован сразу
+func NewThreadPost(k ThreadKey) Post {
+	return Post{
+		AllowComments: true,
+		Format:        TextFormatPlain,
+		Status:        PostStatusPublished,
+		Thread:        &k,
+	}
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeThreadKey(t *testing.T) {
+	key, err := NormalizeThreadKey(ThreadKey{Namespace: " Blog.Example ", Key: " https://example.com/Posts/1 "})
+	require.NoError(t, err)
+	assert.Equal(t, ThreadKey{Namespace: "blog.example", Key: "https://example.com/Posts/1"}, key)
+
+	for _, bad := range []ThreadKey{
+		{Namespace: "", Key: "a"},
+		{Namespace: "блог", Key: "a"},
+		{Namespace: "a b", Key: "a"},
+		{Namespace: strings.Repeat("a", 65), Key: "a"},
+		{Namespace: "blog", Key: "  "},
+		{Namespace: "blog", Key: strings.Repeat("я", MaxThreadKeyLength+1)},
+	} {
+		_, err := NormalizeThreadKey(bad)
+		assert.ErrorIs(t, err, ErrInvalidThreadKey, bad)
+	}
+}
+
+func TestPostFilterSkipsThreads(t *testing.T) {
+	thread := NewThreadPost(ThreadKey{Namespace: "blog", Key: "a"})
+	assert.False(t, PostFilter{}.Match(&thread))
+	assert.True(t, PostFilter{Unpublished: true}.Match(&thread))
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// формат вывода скаляра Timestamp, выбирается аргументом format у полей с временем
+type TimestampFormat string
+
+const (
+	TimestampFormatRFC3339    TimestampFormat = "RFC3339"     // "2006-01-02T15:04:05.000Z07:00", формат по умолчанию
+	TimestampFormatUnix       TimestampFormat = "UNIX"        // число секунд с начала эпохи
+	TimestampFormatUnixMillis TimestampFormat = "UNIX_MILLIS" // число миллисекунд с начала эпохи
+	TimestampFormatLegacy     TimestampFormat = "LEGACY"      // "02.01.2006 15:04:05 MST", как отдавали раньше
+)
+
+const (
+	// RFC 3339 с фиксированными миллисекундами, такую строку понимает Date.parse в браузере
+	timestampLayout       = "2006-01-02T15:04:05.000Z07:00"
+	legacyTimestampLayout = "02.01.2006 15:04:05 MST"
+
+	// числа по модулю больше этого считаются миллисекундами: в секундах это уже 5138 год
+	unixMillisThreshold = 1e11
+)
+
+var ErrWrongTimestamp = errors.New("wrong timestamp: expected RFC 3339 string, unix seconds or milliseconds")
+
+// маршалер скалярного пользовательского типа Timestamp.
+// Формат и часовой пояс берутся из аргументов format и timezone текущего поля, если они есть,
+// по умолчанию время отдается в RFC 3339 в UTC
+func MarshalTimestamp(t time.Time) graphql.ContextMarshaler {
+	return graphql.ContextWriterFunc(func(ctx context.Context, w io.Writer) error {
+		format, loc, err := timestampOptions(ctx)
+		if err != nil {
+			return err
+		}
+		local := t.In(loc)
+
+		switch format {
+		case TimestampFormatUnix:
+			io.WriteString(w, strconv.FormatInt(local.Unix(), 10))
+		case TimestampFormatUnixMillis:
+			io.WriteString(w, strconv.FormatInt(local.UnixNano()/int64(time.Millisecond), 10))
+		case TimestampFormatLegacy:
+			io.WriteString(w, strconv.Quote(local.Format(legacyTimestampLayout)))
+		default:
+			io.WriteString(w, strconv.Quote(local.Format(timestampLayout)))
+		}
+		return nil
+	})
+}
+
+// анмаршалер скалярного пользовательского типа Timestamp.
+// Принимает строку в RFC 3339, а также секунды или миллисекунды с начала эпохи числом или строкой
+func UnmarshalTimestamp(ctx context.Context, v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case string:
+		return parseTimestamp(v)
+	case json.Number:
+		return parseTimestamp(v.String())
+	case int:
+		return unixToTime(int64(v)), nil
+	case int32:
+		return unixToTime(int64(v)), nil
+	case int64:
+		return unixToTime(v), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return time.Time{}, ErrWrongTimestamp
+		}
+		return unixToTime(int64(v)), nil
+	default:
+		return time.Time{}, ErrWrongTimestamp
+	}
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return unixToTime(n), nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, ErrWrongTimestamp
+	}
+	return t, nil
+}
+
+// переводит секунды или миллисекунды с начала эпохи во время
+func unixToTime(n int64) time.Time {
+	if n >= unixMillisThreshold || n <= -unixMillisThreshold {
+		return time.Unix(0, n*int64(time.Millisecond)).UTC()
+	}
+	return time.Unix(n, 0).UTC()
+}
+
+// Достает формат и часовой пояс из аргументов поля, которое сейчас сериализуется
+func timestampOptions(ctx context.Context) (TimestampFormat, *time.Location, error) {
+	format, loc := TimestampFormatRFC3339, time.UTC
+
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil {
+		return format, loc, nil
+	}
+
+	switch f := fc.Args["format"].(type) {
+	case TimestampFormat:
+		format = f
+	case *TimestampFormat:
+		if f != nil {
+			format = *f
+		}
+	}
+
+	if tz, ok := fc.Args["timezone"].(*string); ok && tz != nil && *tz != "" {
+		l, err := time.LoadLocation(*tz)
+		if err != nil {
+			return format, loc, fmt.Errorf("unknown timezone %q", *tz)
+		}
+		loc = l
+	}
+
+	return format, loc, nil
+}
+
+func (f TimestampFormat) IsValid() bool {
+	switch f {
+	case TimestampFormatRFC3339, TimestampFormatUnix, TimestampFormatUnixMillis, TimestampFormatLegacy:
+		return true
+	}
+	return false
+}
+
+// маршалер перечисления TimestampFormat
+func (f TimestampFormat) MarshalGQL(w io.Writer) {
+	io.WriteString(w, strconv.Quote(string(f)))
+}
+
+// анмаршалер перечисления TimestampFormat
+func (f *TimestampFormat) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*f = TimestampFormat(str)
+	if !f.IsValid() {
+		return fmt.Errorf("%s is not a valid TimestampFormat", str)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+func marshalTimestamp(t *testing.T, ctx context.Context, ts time.Time) string {
+	var buf bytes.Buffer
+	err := MarshalTimestamp(ts).MarshalGQLContext(ctx, &buf)
+	assert.NoError(t, err)
+	return buf.String()
+}
+
+func fieldContext(args map[string]interface{}) context.Context {
+	return graphql.WithFieldContext(context.Background(), &graphql.FieldContext{Args: args})
+}
+
+func TestMarshalTimestampDefault(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	ts := time.Date(2024, 5, 17, 15, 4, 5, 123456789, moscow)
+
+	assert.Equal(t, `"2024-05-17T12:04:05.123Z"`, marshalTimestamp(t, context.Background(), ts))
+}
+
+func TestMarshalTimestampFormats(t *testing.T) {
+	ts := time.Date(2024, 5, 17, 12, 4, 5, 123000000, time.UTC)
+	unix := TimestampFormatUnix
+	tz := "Europe/Moscow"
+
+	assert.Equal(t, `1715947445`, marshalTimestamp(t, fieldContext(map[string]interface{}{"format": &unix}), ts))
+	assert.Equal(t, `1715947445123`, marshalTimestamp(t, fieldContext(map[string]interface{}{"format": TimestampFormatUnixMillis}), ts))
+	assert.Equal(t, `"17.05.2024 12:04:05 UTC"`, marshalTimestamp(t, fieldContext(map[string]interface{}{"format": TimestampFormatLegacy}), ts))
+	assert.Equal(t, `"2024-05-17T15:04:05.123+03:00"`, marshalTimestamp(t, fieldContext(map[string]interface{}{"timezone": &tz}), ts))
+}
+
+func TestMarshalTimestampUnknownTimezone(t *testing.T) {
+	tz := "Mars/Olympus"
+	var buf bytes.Buffer
+	err := MarshalTimestamp(time.Now()).MarshalGQLContext(fieldContext(map[string]interface{}{"timezone": &tz}), &buf)
+	assert.Error(t, err)
+}
+
+func TestUnmarshalTimestamp(t *testing.T) {
+	expected := time.Date(2024, 5, 17, 12, 4, 5, 0, time.UTC)
+	ctx := context.Background()
+
+	cases := []interface{}{
+		"2024-05-17T12:04:05Z",
+		"2024-05-17T15:04:05+03:00",
+		"1715947445",
+		"1715947445000",
+		1715947445,
+		int64(1715947445000),
+		json.Number("1715947445"),
+		float64(1715947445),
+	}
+
+	for _, v := range cases {
+		ts, err := UnmarshalTimestamp(ctx, v)
+		assert.NoError(t, err, v)
+		assert.True(t, expected.Equal(ts), "%v: got %v", v, ts)
+	}
+
+	for _, v := range []interface{}{"17.05.2024", true, 1.5, nil} {
+		_, err := UnmarshalTimestamp(ctx, v)
+		assert.Equal(t, ErrWrongTimestamp, err, v)
+	}
+}
+
+func TestTimestampRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 5, 17, 12, 4, 5, 123000000, time.UTC)
+
+	var out string
+	assert.NoError(t, json.Unmarshal([]byte(marshalTimestamp(t, context.Background(), ts)), &out))
+
+	parsed, err := UnmarshalTimestamp(context.Background(), out)
+	assert.NoError(t, err)
+	assert.True(t, ts.Equal(parsed))
+}
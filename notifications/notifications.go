@@ -0,0 +1,167 @@
+package notifications
+
+import (
+	"context"
+	"graphql-comments/models"
+	"graphql-comments/storage"
+	"sync"
+)
+
+// размер буфера канала подписки, переполненный подписчик пропускает уведомления, а не блокирует мутации
+const subscriberBufferSize = 16
+
+// Сервис уведомлений: решает, кому и о чем сообщить, сохраняет уведомления в хранилище
+// и рассылает их подписчикам notificationAdded
+type Service struct {
+	db        storage.Storager
+	observers map[subscriber][]chan *models.Notification
+	mu        sync.Mutex
+}
+
+// получатель уведомлений: одинаковые хендлы на разных сайтах это разные пользователи
+type subscriber struct {
+	tenant string
+	handle string
+}
+
+// Конструктор сервиса уведомлений
+func NewService(db storage.Storager) *Service {
+	return &Service{
+		db:        db,
+		observers: make(map[subscriber][]chan *models.Notification),
+	}
+}
+
+// Создает уведомления о новом комментарии: автору поста или родительского комментария об ответе
+// и упомянутым пользователям. Автор комментария сам себе уведомлений не получает,
+// а получатель ответа не получает второе уведомление об упоминании в том же комментарии
+func (s *Service) CommentCreated(ctx context.Context, comment *models.Comment) ([]models.Notification, error) {
+	actor := models.NormalizeHandle(comment.Author)
+	notified := map[string]struct{}{actor: {}}
+	commentID := comment.ID
+
+	var recipients []models.Notification
+	replyTo, err := s.replyRecipient(ctx, comment)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := notified[replyTo]; !ok && replyTo != "" {
+		notified[replyTo] = struct{}{}
+		recipients = append(recipients, models.Notification{
+			Recipient: replyTo,
+			Type:      models.NotificationTypeReply,
+			Actor:     comment.Author,
+			PostID:    comment.PostID,
+			CommentID: &commentID,
+		})
+	}
+
+	for _, handle := range comment.Mentions {
+		if _, ok := notified[handle]; ok {
+			continue
+		}
+		notified[handle] = struct{}{}
+		recipients = append(recipients, models.Notification{
+			Recipient: handle,
+			Type:      models.NotificationTypeMention,
+			Actor:     comment.Author,
+			PostID:    comment.PostID,
+			CommentID: &commentID,
+		})
+	}
+
+	created := make([]models.Notification, 0, len(recipients))
+	for _, n := range recipients {
+		notification, err := s.Notify(ctx, n)
+		if err != nil {
+			return created, err
+		}
+		created = append(created, notification)
+	}
+
+	return created, nil
+}
+
+// Создает уведомление о действии модератора над постом или комментарием пользователя
+func (s *Service) Moderated(ctx context.Context, recipient, moderator string, postID int, commentID *int, reason string) (models.Notification, error) {
+	return s.Notify(ctx, models.Notification{
+		Recipient: models.NormalizeHandle(recipient),
+		Type:      models.NotificationTypeModeration,
+		Actor:     moderator,
+		PostID:    postID,
+		CommentID: commentID,
+		Message:   reason,
+	})
+}
+
+// Сохраняет уведомление и рассылает его подписчикам получателя
+func (s *Service) Notify(ctx context.Context, n models.Notification) (models.Notification, error) {
+	created, err := s.db.CreateNotification(ctx, n)
+	if err != nil {
+		return created, err
+	}
+
+	s.publish(&created)
+	return created, nil
+}
+
+// Подписывает на новые уведомления пользователя арендатора из контекста, подписка живет пока жив контекст
+func (s *Service) Subscribe(ctx context.Context, recipient string) <-chan *models.Notification {
+	handle := subscriber{tenant: models.TenantFromContext(ctx), handle: models.NormalizeHandle(recipient)}
+	notificationChan := make(chan *models.Notification, subscriberBufferSize)
+
+	s.mu.Lock()
+	s.observers[handle] = append(s.observers[handle], notificationChan)
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		subscribers := s.observers[handle]
+		for i, sub := range subscribers {
+			if sub == notificationChan {
+				s.observers[handle] = append(subscribers[:i], subscribers[i+1:]...)
+				break
+			}
+		}
+		if len(s.observers[handle]) == 0 {
+			delete(s.observers, handle)
+		}
+		close(notificationChan)
+	}()
+
+	return notificationChan
+}
+
+// Рассылает уведомление подписчикам. Отправка идет под мьютексом, поэтому канал
+// не может быть закрыт посреди рассылки
+func (s *Service) publish(n *models.Notification) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, observer := range s.observers[subscriber{tenant: models.TenantOrDefault(n.TenantID), handle: n.Recipient}] {
+		select {
+		case observer <- n:
+		default:
+		}
+	}
+}
+
+// Определяет, кому адресован ответ: автору родительского комментария или автору поста
+func (s *Service) replyRecipient(ctx context.Context, comment *models.Comment) (string, error) {
+	if comment.ParentID != nil {
+		parent, err := s.db.GetComment(ctx, *comment.ParentID)
+		if err != nil {
+			return "", err
+		}
+		return models.NormalizeHandle(parent.Author), nil
+	}
+
+	post, err := s.db.GetPost(ctx, comment.PostID)
+	if err != nil {
+		return "", err
+	}
+	return models.NormalizeHandle(post.Author), nil
+}
@@ -0,0 +1,120 @@
+package notifications
+
+import (
+	"context"
+	"graphql-comments/models"
+	"graphql-comments/storage/inmemory"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommentCreated(t *testing.T) {
+	db, err := inmemory.NewMemoryStorage(nil)
+	assert.NoError(t, err)
+	service := NewService(db)
+
+	ctx := context.Background()
+	post, err := db.CreatePost(ctx, models.Post{Title: "Тест", Author: "Автор", Content: "Пост", AllowComments: true})
+	assert.NoError(t, err)
+
+	// ответ на пост с упоминанием автора поста: одно уведомление об ответе, без дубля об упоминании
+	comment, err := db.CreateComment(ctx, models.Comment{
+		PostID:   post.ID,
+		Author:   "Петя",
+		Text:     "@автор @masha @петя",
+		Mentions: []string{"автор", "masha", "петя"},
+	}, nil)
+	assert.NoError(t, err)
+
+	created, err := service.CommentCreated(ctx, &comment)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(created))
+	assert.Equal(t, "автор", created[0].Recipient)
+	assert.Equal(t, models.NotificationTypeReply, created[0].Type)
+	assert.Equal(t, "masha", created[1].Recipient)
+	assert.Equal(t, models.NotificationTypeMention, created[1].Type)
+
+	// ответ самому себе не порождает уведомлений
+	reply, err := db.CreateComment(ctx, models.Comment{PostID: post.ID, ParentID: &comment.ID, Author: "петя", Text: "Дополню"}, &comment.ID)
+	assert.NoError(t, err)
+
+	created, err = service.CommentCreated(ctx, &reply)
+	assert.NoError(t, err)
+	assert.Empty(t, created)
+}
+
+func TestModerated(t *testing.T) {
+	db, err := inmemory.NewMemoryStorage(nil)
+	assert.NoError(t, err)
+	service := NewService(db)
+
+	ctx := context.Background()
+	post, err := db.CreatePost(ctx, models.Post{Title: "Тест", Author: "Автор", Content: "Пост", AllowComments: true})
+	assert.NoError(t, err)
+
+	n, err := service.Moderated(ctx, "Автор", "модератор", post.ID, nil, "спам")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NotificationTypeModeration, n.Type)
+	assert.Equal(t, "спам", n.Message)
+}
+
+func TestSubscribe(t *testing.T) {
+	db, err := inmemory.NewMemoryStorage(nil)
+	assert.NoError(t, err)
+	service := NewService(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	notificationChan := service.Subscribe(ctx, "@Masha")
+
+	_, err = service.Notify(context.Background(), models.Notification{Recipient: "vasya", Type: models.NotificationTypeMention})
+	assert.NoError(t, err)
+	_, err = service.Notify(context.Background(), models.Notification{Recipient: "masha", Type: models.NotificationTypeMention})
+	assert.NoError(t, err)
+
+	select {
+	case n := <-notificationChan:
+		assert.Equal(t, "masha", n.Recipient)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a notification but got none")
+	}
+
+	// после отмены контекста канал закрывается
+	cancel()
+	select {
+	case _, ok := <-notificationChan:
+		assert.False(t, ok)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected channel to be closed")
+	}
+}
+
+func TestSubscribeIsolatesTenants(t *testing.T) {
+	db, err := inmemory.NewMemoryStorage(nil)
+	assert.NoError(t, err)
+	service := NewService(db)
+
+	ctx, cancel := context.WithCancel(models.WithTenant(context.Background(), "blog"))
+	defer cancel()
+	notificationChan := service.Subscribe(ctx, "masha")
+
+	// тот же хендл на другом сайте это другой пользователь
+	_, err = service.Notify(models.WithTenant(context.Background(), "shop"), models.Notification{Recipient: "masha", Type: models.NotificationTypeMention})
+	assert.NoError(t, err)
+	_, err = service.Notify(models.WithTenant(context.Background(), "blog"), models.Notification{Recipient: "masha", Type: models.NotificationTypeReply})
+	assert.NoError(t, err)
+
+	select {
+	case n := <-notificationChan:
+		assert.Equal(t, "blog", n.TenantID)
+		assert.Equal(t, models.NotificationTypeReply, n.Type)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a notification but got none")
+	}
+	select {
+	case n := <-notificationChan:
+		t.Fatalf("unexpected notification from tenant %s", n.TenantID)
+	default:
+	}
+}
@@ -0,0 +1,50 @@
+// Пакет publishing публикует запланированные посты, когда наступает их время
+package publishing
+
+import (
+	"context"
+	"graphql-comments/storage"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Планировщик раз в interval публикует посты со статусом SCHEDULED, у которых наступил PublishAt.
+// Публикация атомарна в хранилище, поэтому планировщики нескольких экземпляров сервиса не мешают друг другу
+type Scheduler struct {
+	db       storage.Storager
+	interval time.Duration
+	now      func() time.Time
+}
+
+// Конструктор планировщика
+func NewScheduler(db storage.Storager, interval time.Duration) *Scheduler {
+	return &Scheduler{db: db, interval: interval, now: time.Now}
+}
+
+// Работает до отмены ctx. Ошибка одного прохода только логируется, следующий проход попробует снова
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.PublishDue(ctx); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("failed to publish scheduled posts")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Публикует посты, время которых пришло, и возвращает их число
+func (s *Scheduler) PublishDue(ctx context.Context) (int, error) {
+	published, err := s.db.PublishDuePosts(ctx, s.now())
+	for _, p := range published {
+		log.Info().Str("tenant", p.TenantID).Int("post_id", p.ID).Time("publish_at", *p.PublishAt).Msg("scheduled post published")
+	}
+	return len(published), err
+}
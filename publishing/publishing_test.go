@@ -0,0 +1,68 @@
+package publishing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"graphql-comments/models"
+	"graphql-comments/storage/inmemory"
+)
+
+func TestPublishDue(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+
+	now := time.Now()
+	soon := now.Add(time.Minute)
+	later := now.Add(time.Hour)
+	due, err := store.CreatePost(ctx, models.Post{Title: "Скоро", Status: models.PostStatusScheduled, PublishAt: &soon})
+	require.NoError(t, err)
+	_, err = store.CreatePost(ctx, models.Post{Title: "Позже", Status: models.PostStatusScheduled, PublishAt: &later})
+	require.NoError(t, err)
+
+	s := NewScheduler(store, time.Second)
+	s.now = func() time.Time { return now }
+	n, err := s.PublishDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	s.now = func() time.Time { return soon }
+	n, err = s.PublishDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	posts, err := store.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, due.ID, posts[0].ID)
+	assert.Equal(t, models.PostStatusPublished, posts[0].Status)
+
+	// повторный проход ничего не публикует второй раз
+	n, err = s.PublishDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewScheduler(store, time.Millisecond).Run(ctx)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("scheduler did not stop after cancel")
+	}
+}
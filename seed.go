@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"graphql-comments/config"
+	"graphql-comments/seed"
+)
+
+// Наполняет хранилище демонстрационными данными
+func runSeed(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	opts := seed.Options{}
+	fs.IntVar(&opts.Posts, "posts", 10, "number of posts")
+	fs.IntVar(&opts.Comments, "comments", 20, "number of comments under each post")
+	fs.Int64Var(&opts.Seed, "seed", 1, "random seed, the same seed produces the same data")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+
+	stats, err := seed.Run(context.Background(), store, opts)
+	if closeErr := store.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created %d posts and %d comments\n", stats.Posts, stats.Comments)
+	return nil
+}
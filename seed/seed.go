@@ -0,0 +1,129 @@
+// Пакет seed наполняет хранилище демонстрационными постами и деревьями комментариев
+package seed
+
+import (
+	"context"
+	"fmt"
+	"graphql-comments/markup"
+	"graphql-comments/models"
+	"graphql-comments/storage"
+	"math/rand"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Options struct {
+	Posts    int   // сколько постов создать
+	Comments int   // сколько комментариев создать под каждым постом
+	Seed     int64 // одинаковый seed дает одинаковые данные
+}
+
+// Сколько записей создано
+type Stats struct {
+	Posts    int
+	Comments int
+}
+
+var authors = []string{"alice", "bob", "carol", "dave", "erin", "frank", "grace", "heidi"}
+
+var words = strings.Fields(`graphql go postgres комментарий пост тред ответ подписка кеш индекс
+	схема миграция запрос резольвер сервер клиент очередь поиск заметка идея вопрос пример`)
+
+// Создает opts.Posts постов, под каждым opts.Comments комментариев со случайной вложенностью.
+// Часть комментариев упоминает других авторов, часть постов написана в MARKDOWN, часть закрыта для комментариев
+func Run(ctx context.Context, store storage.Storager, opts Options) (Stats, error) {
+	var stats Stats
+	rnd := rand.New(rand.NewSource(opts.Seed))
+
+	for i := 0; i < opts.Posts; i++ {
+		post := models.Post{
+			Title:  capitalize(sentence(rnd, 3+rnd.Intn(4))),
+			Author: pick(rnd, authors),
+			// закрытых постов немного, и под ними комментариев нет
+			AllowComments: i == 0 || rnd.Intn(10) > 0,
+			Format:        models.TextFormatPlain,
+		}
+		if rnd.Intn(2) == 0 {
+			post.Format = models.TextFormatMarkdown
+			post.Content = fmt.Sprintf("## %s\n\n%s\n\n- %s\n- %s", sentence(rnd, 3), paragraph(rnd), sentence(rnd, 4), sentence(rnd, 4))
+		} else {
+			post.Content = paragraph(rnd)
+		}
+
+		html, err := markup.Render(post.Content, post.Format)
+		if err != nil {
+			return stats, err
+		}
+		post.ContentHTML = html
+
+		created, err := store.CreatePost(ctx, post)
+		if err != nil {
+			return stats, err
+		}
+		stats.Posts++
+
+		if !created.AllowComments {
+			continue
+		}
+
+		var ids []int
+		for j := 0; j < opts.Comments; j++ {
+			comment := models.Comment{
+				PostID: created.ID,
+				Author: pick(rnd, authors),
+				Text:   sentence(rnd, 5+rnd.Intn(10)),
+				Format: models.TextFormatPlain,
+			}
+			if rnd.Intn(4) == 0 {
+				comment.Text = "@" + pick(rnd, authors) + " " + comment.Text
+			}
+			comment.Mentions = models.ParseMentions(comment.Text)
+			comment.HTML, err = markup.Render(comment.Text, comment.Format)
+			if err != nil {
+				return stats, err
+			}
+
+			// примерно треть комментариев верхнего уровня, остальные отвечают на уже созданные
+			var parentID *int
+			if len(ids) > 0 && rnd.Intn(3) > 0 {
+				parent := ids[rnd.Intn(len(ids))]
+				parentID = &parent
+			}
+
+			createdComment, err := store.CreateComment(ctx, comment, parentID)
+			if err != nil {
+				return stats, err
+			}
+			ids = append(ids, createdComment.ID)
+			stats.Comments++
+		}
+	}
+
+	return stats, nil
+}
+
+func pick(rnd *rand.Rand, from []string) string {
+	return from[rnd.Intn(len(from))]
+}
+
+func sentence(rnd *rand.Rand, n int) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = pick(rnd, words)
+	}
+	return strings.Join(parts, " ")
+}
+
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+func paragraph(rnd *rand.Rand) string {
+	sentences := make([]string, 2+rnd.Intn(3))
+	for i := range sentences {
+		sentences[i] = capitalize(sentence(rnd, 6+rnd.Intn(6))) + "."
+	}
+	return strings.Join(sentences, " ")
+}
@@ -0,0 +1,68 @@
+package seed
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"graphql-comments/models"
+	"graphql-comments/storage/inmemory"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+
+	stats, err := Run(ctx, store, Options{Posts: 5, Comments: 10, Seed: 42})
+	require.NoError(t, err)
+	assert.Equal(t, 5, stats.Posts)
+
+	posts, err := store.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	assert.Len(t, posts, 5)
+
+	total, replies := 0, 0
+	for _, p := range posts {
+		assert.NotEmpty(t, p.ContentHTML)
+		if !p.AllowComments {
+			continue
+		}
+		top, err := store.GetComments(ctx, p.ID, nil, 100, 0)
+		require.NoError(t, err)
+		total += len(top)
+		for _, c := range top {
+			if c.HasReplies {
+				replies++
+			}
+		}
+	}
+	// первый пост всегда открыт, значит комментарии были созданы и часть из них вложенные
+	assert.Zero(t, stats.Comments%10)
+	assert.NotZero(t, stats.Comments)
+	assert.NotZero(t, total)
+	assert.Less(t, total, stats.Comments)
+	assert.NotZero(t, replies)
+}
+
+func TestRunIsDeterministic(t *testing.T) {
+	ctx := context.Background()
+	titles := func() []string {
+		store, err := inmemory.NewMemoryStorage(nil)
+		require.NoError(t, err)
+		_, err = Run(ctx, store, Options{Posts: 3, Comments: 2, Seed: 7})
+		require.NoError(t, err)
+
+		posts, err := store.GetPosts(ctx, models.PostFilter{})
+		require.NoError(t, err)
+		var titles []string
+		for _, p := range posts {
+			titles = append(titles, p.Title)
+		}
+		return titles
+	}
+
+	assert.Equal(t, titles(), titles())
+}
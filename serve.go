@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"graphql-comments/config"
+	"graphql-comments/graph"
+	"graphql-comments/logging"
+	"graphql-comments/metrics"
+	"graphql-comments/publishing"
+	"graphql-comments/server"
+	"graphql-comments/tenant"
+	"graphql-comments/tracing"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/rs/zerolog/log"
+)
+
+// Запускает GraphQL сервер и работает до SIGINT или SIGTERM
+func runServe(cfg *config.Config, args []string) error {
+	if err := parseFlags(flag.NewFlagSet("serve", flag.ContinueOnError), args); err != nil {
+		return err
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+
+	tenants, err := tenant.Load(cfg.TenantsPath, cfg.AllowedOrigins)
+	if err != nil {
+		return fmt.Errorf("failed to load tenants: %w", err)
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+
+	resolver := graph.NewResolver(store)
+	resolver.IdempotencyTTL = cfg.IdempotencyKeyTTL
+	srv := server.NewGraphQLServer(cfg, graph.NewExecutableSchema(graph.Config{Resolvers: resolver}), tenants)
+	health := server.NewHealth(store, cfg.HealthCheckTimeout)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", playground.Handler("GraphQL playground", "/query"))
+	// сайт определяется до CORS, потому что у каждого сайта свой список источников,
+	// а preflight без сайта проверяется по источникам всех сайтов
+	mux.Handle("/query", tracing.Handler(logging.Middleware(tenant.Middleware(tenants, server.TenantCORS(tenants.AllowedOrigins(), srv))), "/query"))
+	if cfg.MetricsEnabled {
+		mux.Handle("/metrics", metrics.Handler())
+	}
+	mux.Handle("/healthz", health.Liveness())
+	mux.Handle("/readyz", health.Readiness())
+
+	httpServer := &http.Server{
+		Addr:    ":" + cfg.ServerPort,
+		Handler: mux,
+	}
+
+	// планировщик останавливается вместе с сервером, до закрытия хранилища
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		if cfg.PublishInterval > 0 {
+			publishing.NewScheduler(store, cfg.PublishInterval).Run(schedulerCtx)
+		}
+	}()
+
+	listenErr := make(chan error, 1)
+	go func() {
+		log.Info().Str("port", cfg.ServerPort).Str("storage", cfg.StorageType).Int("tenants", len(tenants.Tenants())).Msg("server started")
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			listenErr <- err
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM, syscall.SIGALRM)
+
+	select {
+	case err := <-listenErr:
+		stopScheduler()
+		<-schedulerDone
+		store.Close()
+		return fmt.Errorf("could not listen on %s: %w", cfg.ServerPort, err)
+	case <-stop:
+	}
+
+	log.Info().Dur("delay", cfg.ShutdownDelay).Msg("shutting down")
+
+	// сначала перестаем быть готовыми и ждем, пока балансировщик уберет нас из ротации,
+	// запросы в это время обслуживаются как обычно
+	health.SetShuttingDown()
+	time.Sleep(cfg.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Error().Err(err).Msg("server forced to shutdown")
+	}
+
+	stopScheduler()
+	<-schedulerDone
+
+	// закрываем хранилище после остановки сервера, чтобы в снапшот попали все записи
+	if err := store.Close(); err != nil {
+		log.Error().Err(err).Msg("failed to close storage")
+	}
+
+	// выгружаем спаны, накопленные за время остановки
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to flush traces")
+	}
+
+	log.Info().Msg("server exiting")
+	return nil
+}
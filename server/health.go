@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Health отдает пробы для оркестратора: liveness отвечает, пока процесс жив,
+// readiness проверяет хранилище и начинает отказывать с началом остановки, чтобы трафик успел уйти
+type Health struct {
+	store        pinger
+	timeout      time.Duration
+	shuttingDown int32
+}
+
+func NewHealth(store pinger, timeout time.Duration) *Health {
+	return &Health{store: store, timeout: timeout}
+}
+
+// Переводит readiness в состояние отказа, вызывается до server.Shutdown
+func (h *Health) SetShuttingDown() {
+	atomic.StoreInt32(&h.shuttingDown, 1)
+}
+
+// Обработчик /healthz. Хранилище не проверяется: его недоступность не лечится перезапуском процесса
+func (h *Health) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, "ok", nil)
+	})
+}
+
+// Обработчик /readyz
+func (h *Health) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&h.shuttingDown) == 1 {
+			writeHealth(w, http.StatusServiceUnavailable, "shutting down", nil)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+		defer cancel()
+
+		if err := h.store.Ping(ctx); err != nil {
+			writeHealth(w, http.StatusServiceUnavailable, "unavailable", err)
+			return
+		}
+		writeHealth(w, http.StatusOK, "ok", nil)
+	})
+}
+
+func writeHealth(w http.ResponseWriter, status int, state string, err error) {
+	body := struct {
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}{Status: state}
+	if err != nil {
+		body.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type pingFunc func(ctx context.Context) error
+
+func (f pingFunc) Ping(ctx context.Context) error {
+	return f(ctx)
+}
+
+func probe(h http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestHealth(t *testing.T) {
+	var pingErr error
+	health := NewHealth(pingFunc(func(ctx context.Context) error { return pingErr }), time.Second)
+
+	w := probe(health.Readiness(), "/readyz")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+
+	pingErr = errors.New("connection refused")
+	w = probe(health.Readiness(), "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"unavailable","error":"connection refused"}`, w.Body.String())
+
+	// liveness не зависит от хранилища
+	assert.Equal(t, http.StatusOK, probe(health.Liveness(), "/healthz").Code)
+
+	pingErr = nil
+	health.SetShuttingDown()
+	w = probe(health.Readiness(), "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"shutting down"}`, w.Body.String())
+	assert.Equal(t, http.StatusOK, probe(health.Liveness(), "/healthz").Code)
+}
+
+func TestHealthTimeout(t *testing.T) {
+	health := NewHealth(pingFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), 10*time.Millisecond)
+
+	w := probe(health.Readiness(), "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "deadline exceeded")
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"graphql-comments/config"
+	"graphql-comments/logging"
+	"graphql-comments/metrics"
+	"graphql-comments/tenant"
+	"graphql-comments/tracing"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	subprotocolGraphQLTransportWS = "graphql-transport-ws"
+	subprotocolGraphQLWS          = "graphql-ws"
+)
+
+// Собирает GraphQL сервер с транспортами из конфигурации.
+// Порядок транспортов важен: используется первый, который поддерживает запрос,
+// поэтому SSE регистрируется раньше обычного POST
+func NewGraphQLServer(cfg *config.Config, es graphql.ExecutableSchema, tenants *tenant.Registry) *handler.Server {
+	srv := handler.New(es)
+
+	srv.AddTransport(transport.Websocket{
+		// сайт соединения, открытого без API ключа, определяется ключом из connection_init
+		InitFunc: tenant.WebsocketInit(tenants),
+		Upgrader: websocket.Upgrader{
+			CheckOrigin: TenantOriginChecker(tenants.AllowedOrigins()),
+			// graphql-transport-ws предпочтительнее, устаревший graphql-ws оставлен для старых клиентов
+			Subprotocols: []string{subprotocolGraphQLTransportWS, subprotocolGraphQLWS},
+		},
+		KeepAlivePingInterval: cfg.WebsocketKeepAlive,
+		PingPongInterval:      cfg.WebsocketPingInterval,
+	})
+	if cfg.SSEEnabled {
+		srv.AddTransport(transport.SSE{})
+	}
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{})
+
+	srv.SetQueryCache(lru.New(1000))
+
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.AutomaticPersistedQuery{
+		Cache: lru.New(100),
+	})
+	srv.Use(logging.Extension{})
+	if cfg.MetricsEnabled {
+		srv.Use(metrics.Extension{})
+	}
+	if cfg.TracingExporter != tracing.ExporterNone {
+		srv.Use(tracing.Extension{})
+	}
+
+	return srv
+}
+
+// Возвращает функцию проверки заголовка Origin по списку разрешенных источников.
+// "*" в списке разрешает любой источник, запросы без Origin (не из браузера) пропускаются всегда
+func OriginChecker(allowed []string) func(r *http.Request) bool {
+	origins := make(map[string]struct{}, len(allowed))
+	allowAll := false
+	for _, origin := range allowed {
+		origin = normalizeOrigin(origin)
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			allowAll = true
+		}
+		origins[origin] = struct{}{}
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || allowAll {
+			return true
+		}
+		_, ok := origins[normalizeOrigin(origin)]
+		return ok
+	}
+}
+
+// Как OriginChecker, но список источников берется у сайта из контекста запроса, а без сайта используется fallback.
+// Проверка для каждого сайта собирается один раз
+func TenantOriginChecker(fallback []string) func(r *http.Request) bool {
+	fallbackCheck := OriginChecker(fallback)
+	var checkers sync.Map
+
+	return func(r *http.Request) bool {
+		t := tenant.FromContext(r.Context())
+		if t == nil {
+			return fallbackCheck(r)
+		}
+		check, ok := checkers.Load(t)
+		if !ok {
+			check, _ = checkers.LoadOrStore(t, OriginChecker(t.AllowedOrigins))
+		}
+		return check.(func(r *http.Request) bool)(r)
+	}
+}
+
+// Оборачивает обработчик и выставляет CORS заголовки для разрешенных источников,
+// без них браузер не даст открыть SSE поток с чужого домена
+func CORS(allowed []string, next http.Handler) http.Handler {
+	return cors(OriginChecker(allowed), next)
+}
+
+// CORS с источниками сайта запроса, должен стоять после tenant.Middleware.
+// fallback проверяет запросы без сайта, которые пропускает tenant.Middleware
+func TenantCORS(fallback []string, next http.Handler) http.Handler {
+	return cors(TenantOriginChecker(fallback), next)
+}
+
+func cors(check func(r *http.Request) bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" && check(r) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, Authorization, "+tenant.APIKeyHeader)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Add("Vary", "Origin")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// приводит источник к виду scheme://host[:port] в нижнем регистре
+func normalizeOrigin(origin string) string {
+	origin = strings.ToLower(strings.TrimSpace(origin))
+	if origin == "" || origin == "*" {
+		return origin
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return origin
+	}
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"graphql-comments/tenant"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func requestWithOrigin(origin string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/query", nil)
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	return r
+}
+
+func TestOriginCheckerAllowAll(t *testing.T) {
+	check := OriginChecker([]string{"*"})
+
+	assert.True(t, check(requestWithOrigin("https://evil.example")))
+	assert.True(t, check(requestWithOrigin("")))
+}
+
+func TestOriginCheckerAllowlist(t *testing.T) {
+	check := OriginChecker([]string{"https://example.com", " HTTP://localhost:3000/ "})
+
+	assert.True(t, check(requestWithOrigin("https://example.com")))
+	assert.True(t, check(requestWithOrigin("https://EXAMPLE.com")))
+	assert.True(t, check(requestWithOrigin("http://localhost:3000")))
+	assert.False(t, check(requestWithOrigin("http://localhost:3001")))
+	assert.False(t, check(requestWithOrigin("https://blog.example.com")))
+	// запросы без Origin приходят не из браузера
+	assert.True(t, check(requestWithOrigin("")))
+}
+
+func TestOriginCheckerEmptyList(t *testing.T) {
+	check := OriginChecker(nil)
+
+	assert.False(t, check(requestWithOrigin("https://example.com")))
+	assert.True(t, check(requestWithOrigin("")))
+}
+
+func TestCORS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := CORS([]string{"https://example.com"}, next)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, requestWithOrigin("https://example.com"))
+	assert.Equal(t, "https://example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, requestWithOrigin("https://evil.example"))
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestTenantCORS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	reg, err := tenant.NewRegistry([]tenant.Tenant{
+		{ID: "blog", Hosts: []string{"blog.example"}, AllowedOrigins: []string{"https://blog.example"}},
+		{ID: "shop", Hosts: []string{"shop.example"}},
+	}, "", []string{"https://shop.example"})
+	assert.NoError(t, err)
+	h := tenant.Middleware(reg, TenantCORS(nil, next))
+
+	serve := func(host, origin string) *httptest.ResponseRecorder {
+		r := requestWithOrigin(origin)
+		r.Host = host
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	assert.Equal(t, "https://blog.example", serve("blog.example", "https://blog.example").Header().Get("Access-Control-Allow-Origin"))
+	// источник другого сайта не разрешен
+	assert.Empty(t, serve("blog.example", "https://shop.example").Header().Get("Access-Control-Allow-Origin"))
+	// сайт без своего списка берет общий
+	assert.Equal(t, "https://shop.example", serve("shop.example", "https://shop.example").Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestTenantCORSPreflightByAPIKey(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	// сайт известен только по API ключу, а preflight ключа не несет
+	reg, err := tenant.NewRegistry([]tenant.Tenant{
+		{ID: "widget", APIKeys: []string{"widget-key"}, AllowedOrigins: []string{"https://widget.example"}},
+	}, "", nil)
+	assert.NoError(t, err)
+	h := tenant.Middleware(reg, TenantCORS(reg.AllowedOrigins(), next))
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodOptions, "/query", nil)
+		r.Host = "api.example"
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Headers", tenant.APIKeyHeader)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := preflight("https://widget.example")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "https://widget.example", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, preflight("https://evil.example").Header().Get("Access-Control-Allow-Origin"))
+}
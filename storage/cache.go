@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"context"
+	"graphql-comments/models"
+	"sync"
+	"time"
+)
+
+// виды закешированных запросов
+type cacheKind int
+
+const (
+	cachePost cacheKind = iota
+	cachePosts
+	cacheComments
+)
+
+// ключ кеша: tenant это арендатор запроса, для cachePost id это id поста, для cacheComments это id поста,
+// parentID задает уровень треда (0 верхний уровень), limit размер первой страницы
+type cacheKey struct {
+	tenant   string
+	kind     cacheKind
+	id       int
+	parentID int
+	limit    int
+}
+
+// CachingStorage оборачивает любое хранилище и кеширует GetPost, GetPosts и первые страницы GetComments.
+// Остальные методы уходят в обернутое хранилище без изменений
+type CachingStorage struct {
+	Storager
+
+	mu           sync.Mutex
+	cache        *lru
+	commentPages map[int]map[cacheKey]struct{} // id поста -> закешированные страницы комментариев под ним
+	version      uint64                        // увеличивается при каждой записи, см. store
+}
+
+// Конструктор кеширующей обертки над next, хранит не больше size запросов не дольше ttl
+func NewCachingStorage(next Storager, size int, ttl time.Duration) *CachingStorage {
+	s := &CachingStorage{
+		Storager:     next,
+		commentPages: make(map[int]map[cacheKey]struct{}),
+	}
+	s.cache = newLRU(size, ttl, s.evicted)
+	return s
+}
+
+func (s *CachingStorage) GetPost(ctx context.Context, id int) (*models.Post, error) {
+	key := cacheKey{tenant: models.TenantFromContext(ctx), kind: cachePost, id: id}
+	if value, ok := s.lookup(key); ok {
+		return copyPost(value.(*models.Post)), nil
+	}
+
+	version := s.currentVersion()
+	post, err := s.Storager.GetPost(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.store(key, copyPost(post), version)
+	return post, nil
+}
+
+// Кешируется только общий список опубликованных постов, выборки для автора и администратора идут в хранилище
+func (s *CachingStorage) GetPosts(ctx context.Context, filter models.PostFilter) ([]*models.Post, error) {
+	if !filter.IsZero() {
+		return s.Storager.GetPosts(ctx, filter)
+	}
+
+	key := cacheKey{tenant: models.TenantFromContext(ctx), kind: cachePosts}
+	if value, ok := s.lookup(key); ok {
+		return copyPosts(value.([]*models.Post)), nil
+	}
+
+	version := s.currentVersion()
+	posts, err := s.Storager.GetPosts(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	s.store(key, copyPosts(posts), version)
+	return posts, nil
+}
+
+// Кешируется только первая страница треда, дальше пользователи листают редко
+func (s *CachingStorage) GetComments(ctx context.Context, postID int, parentID *int, limit, afterID int) ([]*models.Comment, error) {
+	if afterID != 0 {
+		return s.Storager.GetComments(ctx, postID, parentID, limit, afterID)
+	}
+
+	key := cacheKey{tenant: models.TenantFromContext(ctx), kind: cacheComments, id: postID, limit: limit}
+	if parentID != nil {
+		key.parentID = *parentID
+	}
+	if value, ok := s.lookup(key); ok {
+		return copyComments(value.([]*models.Comment)), nil
+	}
+
+	version := s.currentVersion()
+	comments, err := s.Storager.GetComments(ctx, postID, parentID, limit, afterID)
+	if err != nil {
+		return nil, err
+	}
+	s.store(key, copyComments(comments), version)
+	return comments, nil
+}
+
+func (s *CachingStorage) CreatePost(ctx context.Context, p models.Post) (models.Post, error) {
+	post, err := s.Storager.CreatePost(ctx, p)
+	if err != nil {
+		return post, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	s.cache.remove(cacheKey{tenant: models.TenantFromContext(ctx), kind: cachePosts})
+
+	return post, nil
+}
+
+// Сбрасывает пост и список постов. Конфликт версий тоже сбрасывает их: он значит, что пост изменился
+// в обход этого кеша, например на другом экземпляре сервиса, и закешированная версия устарела
+func (s *CachingStorage) UpdatePost(ctx context.Context, p models.Post, expectedVersion int) (models.Post, error) {
+	post, err := s.Storager.UpdatePost(ctx, p, expectedVersion)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	s.invalidatePost(ctx, p.ID)
+
+	return post, err
+}
+
+func (s *CachingStorage) SetPostStatus(ctx context.Context, id int, status models.PostStatus, publishAt *time.Time) (models.Post, error) {
+	post, err := s.Storager.SetPostStatus(ctx, id, status, publishAt)
+	if err != nil {
+		return post, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	s.invalidatePost(ctx, id)
+
+	return post, nil
+}
+
+func (s *CachingStorage) UpdatePostTags(ctx context.Context, postID int, add, remove []string) (models.Post, error) {
+	post, err := s.Storager.UpdatePostTags(ctx, postID, add, remove)
+	if err != nil {
+		return post, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	s.invalidatePost(ctx, postID)
+
+	return post, nil
+}
+
+func (s *CachingStorage) SetPostCategory(ctx context.Context, postID int, category string) (models.Post, error) {
+	post, err := s.Storager.SetPostCategory(ctx, postID, category)
+	if err != nil {
+		return post, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	s.invalidatePost(ctx, postID)
+
+	return post, nil
+}
+
+// Сбрасывает опубликованные посты и список, даже если часть постов не успела опубликоваться из-за ошибки
+func (s *CachingStorage) PublishDuePosts(ctx context.Context, now time.Time) ([]models.Post, error) {
+	published, err := s.Storager.PublishDuePosts(ctx, now)
+	if len(published) == 0 {
+		return published, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	// планировщик публикует посты всех арендаторов, поэтому арендатор берется из самого поста
+	for _, p := range published {
+		s.cache.remove(cacheKey{tenant: p.TenantID, kind: cachePost, id: p.ID})
+		s.cache.remove(cacheKey{tenant: p.TenantID, kind: cachePosts})
+	}
+
+	return published, err
+}
+
+// Сбрасывает первые страницы уровня, на который добавлен комментарий, и страницы,
+// в которых лежит родительский комментарий, так как у него меняется HasReplies
+func (s *CachingStorage) CreateComment(ctx context.Context, c models.Comment, parentID *int) (models.Comment, error) {
+	comment, err := s.Storager.CreateComment(ctx, c, parentID)
+	if err != nil {
+		return comment, err
+	}
+
+	level := 0
+	if parentID != nil {
+		level = *parentID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+
+	var stale []cacheKey
+	for key := range s.commentPages[comment.PostID] {
+		if key.parentID == level || (parentID != nil && s.pageContains(key, *parentID)) {
+			stale = append(stale, key)
+		}
+	}
+	for _, key := range stale {
+		s.cache.remove(key)
+	}
+
+	return comment, nil
+}
+
+// Импорт меняет сразу много тредов, поэтому после него кеш сбрасывается целиком
+func (s *CachingStorage) ImportPosts(ctx context.Context, posts []models.Post) ([]models.Post, error) {
+	imported, err := s.Storager.ImportPosts(ctx, posts)
+	s.invalidateAll()
+	return imported, err
+}
+
+func (s *CachingStorage) ImportComments(ctx context.Context, comments []models.Comment) ([]models.Comment, error) {
+	imported, err := s.Storager.ImportComments(ctx, comments)
+	s.invalidateAll()
+	return imported, err
+}
+
+// сбрасывает пост и список постов его арендатора, вызывающий держит s.mu
+func (s *CachingStorage) invalidatePost(ctx context.Context, id int) {
+	tenant := models.TenantFromContext(ctx)
+	s.cache.remove(cacheKey{tenant: tenant, kind: cachePost, id: id})
+	s.cache.remove(cacheKey{tenant: tenant, kind: cachePosts})
+}
+
+func (s *CachingStorage) invalidateAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	s.cache.purge()
+}
+
+func (s *CachingStorage) lookup(key cacheKey) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cache.get(key)
+}
+
+func (s *CachingStorage) currentVersion() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.version
+}
+
+// Сохраняет результат чтения, только если с его начала не было записей,
+// иначе в кеш могли бы попасть данные, которые запись уже успела сделать устаревшими
+func (s *CachingStorage) store(key cacheKey, value interface{}, version uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.version != version {
+		return
+	}
+
+	s.cache.add(key, value)
+	if key.kind == cacheComments {
+		if s.commentPages[key.id] == nil {
+			s.commentPages[key.id] = make(map[cacheKey]struct{})
+		}
+		s.commentPages[key.id][key] = struct{}{}
+	}
+}
+
+// вызывается кешем под s.mu при удалении любой записи
+func (s *CachingStorage) evicted(key cacheKey) {
+	if key.kind != cacheComments {
+		return
+	}
+	delete(s.commentPages[key.id], key)
+	if len(s.commentPages[key.id]) == 0 {
+		delete(s.commentPages, key.id)
+	}
+}
+
+func (s *CachingStorage) pageContains(key cacheKey, commentID int) bool {
+	value, ok := s.cache.peek(key)
+	if !ok {
+		return false
+	}
+	for _, c := range value.([]*models.Comment) {
+		if c.ID == commentID {
+			return true
+		}
+	}
+	return false
+}
+
+// Кеш хранит и отдает копии, чтобы вызывающий код не мог изменить закешированные данные
+
+func copyPost(p *models.Post) *models.Post {
+	post := *p
+	return &post
+}
+
+func copyPosts(posts []*models.Post) []*models.Post {
+	if posts == nil {
+		return nil
+	}
+	copied := make([]*models.Post, len(posts))
+	for i, p := range posts {
+		copied[i] = copyPost(p)
+	}
+	return copied
+}
+
+func copyComments(comments []*models.Comment) []*models.Comment {
+	if comments == nil {
+		return nil
+	}
+	copied := make([]*models.Comment, len(comments))
+	for i, c := range comments {
+		comment := *c
+		copied[i] = &comment
+	}
+	return copied
+}
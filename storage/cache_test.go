@@ -0,0 +1,257 @@
+package storage_test
+
+import (
+	"context"
+	"graphql-comments/models"
+	"graphql-comments/storage"
+	"graphql-comments/storage/inmemory"
+	"graphql-comments/storage/storagetest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// обертка считает чтения, которые дошли до настоящего хранилища
+type countingStorage struct {
+	storage.Storager
+	posts, postLists, comments int
+}
+
+func (s *countingStorage) GetPost(ctx context.Context, id int) (*models.Post, error) {
+	s.posts++
+	return s.Storager.GetPost(ctx, id)
+}
+
+func (s *countingStorage) GetPosts(ctx context.Context, filter models.PostFilter) ([]*models.Post, error) {
+	s.postLists++
+	return s.Storager.GetPosts(ctx, filter)
+}
+
+func (s *countingStorage) GetComments(ctx context.Context, postID int, parentID *int, limit, afterID int) ([]*models.Comment, error) {
+	s.comments++
+	return s.Storager.GetComments(ctx, postID, parentID, limit, afterID)
+}
+
+func newCounting(t *testing.T) *countingStorage {
+	db, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	return &countingStorage{Storager: db}
+}
+
+func TestCachingStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storager {
+		db, err := inmemory.NewMemoryStorage(nil)
+		require.NoError(t, err)
+		return storage.NewCachingStorage(db, 100, time.Minute)
+	})
+}
+
+func TestCachingStorageHits(t *testing.T) {
+	backend := newCounting(t)
+	s := storage.NewCachingStorage(backend, 100, time.Minute)
+	ctx := context.Background()
+
+	post, err := s.CreatePost(ctx, models.Post{Title: "Популярный", AllowComments: true})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		_, err = s.GetPosts(ctx, models.PostFilter{})
+		require.NoError(t, err)
+		_, err = s.GetComments(ctx, post.ID, nil, 10, 0)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, backend.posts)
+	assert.Equal(t, 1, backend.postLists)
+	assert.Equal(t, 1, backend.comments)
+
+	// следующие страницы не кешируются
+	_, err = s.GetComments(ctx, post.ID, nil, 10, 5)
+	require.NoError(t, err)
+	_, err = s.GetComments(ctx, post.ID, nil, 10, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 3, backend.comments)
+
+	// ошибки не кешируются
+	_, err = s.GetPost(ctx, 1337)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = s.GetPost(ctx, 1337)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	assert.Equal(t, 3, backend.posts)
+}
+
+func TestCachingStorageInvalidation(t *testing.T) {
+	backend := newCounting(t)
+	s := storage.NewCachingStorage(backend, 100, time.Minute)
+	ctx := context.Background()
+
+	post, err := s.CreatePost(ctx, models.Post{Title: "Тест", AllowComments: true})
+	require.NoError(t, err)
+	other, err := s.CreatePost(ctx, models.Post{Title: "Другой", AllowComments: true})
+	require.NoError(t, err)
+
+	root, err := s.CreateComment(ctx, models.Comment{PostID: post.ID, Text: "Корень"}, nil)
+	require.NoError(t, err)
+
+	posts, err := s.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	assert.Len(t, posts, 2)
+	_, err = s.CreatePost(ctx, models.Post{Title: "Новый"})
+	require.NoError(t, err)
+	posts, err = s.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	assert.Len(t, posts, 3)
+
+	top, err := s.GetComments(ctx, post.ID, nil, 10, 0)
+	require.NoError(t, err)
+	assert.False(t, top[0].HasReplies)
+	_, err = s.GetComments(ctx, other.ID, nil, 10, 0)
+	require.NoError(t, err)
+	backend.comments = 0
+
+	// ответ меняет HasReplies у корня, поэтому страница с корнем сбрасывается
+	_, err = s.CreateComment(ctx, models.Comment{PostID: post.ID, Text: "Ответ"}, &root.ID)
+	require.NoError(t, err)
+
+	top, err = s.GetComments(ctx, post.ID, nil, 10, 0)
+	require.NoError(t, err)
+	assert.True(t, top[0].HasReplies)
+	assert.Equal(t, 1, backend.comments)
+
+	// страницы под другим постом не затронуты
+	_, err = s.GetComments(ctx, other.ID, nil, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, backend.comments)
+
+	replies, err := s.GetComments(ctx, post.ID, &root.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, replies, 1)
+	_, err = s.CreateComment(ctx, models.Comment{PostID: post.ID, Text: "Еще ответ"}, &root.ID)
+	require.NoError(t, err)
+	replies, err = s.GetComments(ctx, post.ID, &root.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, replies, 2)
+}
+
+func TestCachingStorageReturnsCopies(t *testing.T) {
+	s := storage.NewCachingStorage(newCounting(t), 100, time.Minute)
+	ctx := context.Background()
+
+	post, err := s.CreatePost(ctx, models.Post{Title: "Тест"})
+	require.NoError(t, err)
+
+	got, err := s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	got.Title = "Изменен"
+
+	got, err = s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Тест", got.Title)
+}
+
+func TestCachingStorageTTLAndSize(t *testing.T) {
+	backend := newCounting(t)
+	s := storage.NewCachingStorage(backend, 2, 20*time.Millisecond)
+	ctx := context.Background()
+
+	var ids []int
+	for i := 0; i < 3; i++ {
+		post, err := s.CreatePost(ctx, models.Post{Title: "Тест"})
+		require.NoError(t, err)
+		ids = append(ids, post.ID)
+	}
+
+	// третий пост вытесняет первый
+	for _, id := range ids {
+		_, err := s.GetPost(ctx, id)
+		require.NoError(t, err)
+	}
+	_, err := s.GetPost(ctx, ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, 4, backend.posts)
+
+	_, err = s.GetPost(ctx, ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, 4, backend.posts)
+
+	time.Sleep(30 * time.Millisecond)
+	_, err = s.GetPost(ctx, ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, 5, backend.posts)
+}
+
+func TestCachingStoragePostStatus(t *testing.T) {
+	backend := newCounting(t)
+	s := storage.NewCachingStorage(backend, 100, time.Minute)
+	ctx := context.Background()
+
+	post, err := s.CreatePost(ctx, models.Post{Title: "Тест", Author: "Вася"})
+	require.NoError(t, err)
+	posts, err := s.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	assert.Len(t, posts, 1)
+	_, err = s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+
+	// выборки автора не кешируются
+	for i := 0; i < 2; i++ {
+		_, err = s.GetPosts(ctx, models.PostFilter{Viewer: "Вася"})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, backend.postLists)
+
+	_, err = s.SetPostStatus(ctx, post.ID, models.PostStatusDraft, nil)
+	require.NoError(t, err)
+	posts, err = s.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, posts)
+	got, err := s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.PostStatusDraft, got.Status)
+
+	later := time.Now().Add(-time.Second)
+	_, err = s.SetPostStatus(ctx, post.ID, models.PostStatusScheduled, &later)
+	require.NoError(t, err)
+	_, err = s.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	published, err := s.PublishDuePosts(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, published, 1)
+	posts, err = s.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	assert.Len(t, posts, 1)
+}
+
+func TestCachingStorageSeparatesTenants(t *testing.T) {
+	db := newCounting(t)
+	cache := storage.NewCachingStorage(db, 100, time.Minute)
+	blog := models.WithTenant(context.Background(), "blog")
+	shop := models.WithTenant(context.Background(), "shop")
+
+	post, err := cache.CreatePost(blog, models.Post{Title: "Пост", AllowComments: true})
+	require.NoError(t, err)
+	_, err = cache.GetPost(blog, post.ID)
+	require.NoError(t, err)
+	posts, err := cache.GetPosts(blog, models.PostFilter{})
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+
+	// закешированный ответ одного сайта не отдается другому
+	_, err = cache.GetPost(shop, post.ID)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	posts, err = cache.GetPosts(shop, models.PostFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, posts)
+	assert.Equal(t, 2, db.posts)
+	assert.Equal(t, 2, db.postLists)
+
+	// правка сбрасывает кеш своего сайта
+	_, err = cache.SetPostCategory(blog, post.ID, "news")
+	require.NoError(t, err)
+	got, err := cache.GetPost(blog, post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "news", got.Category)
+}
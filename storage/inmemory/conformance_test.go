@@ -0,0 +1,34 @@
+package inmemory_test
+
+import (
+	"graphql-comments/config"
+	"graphql-comments/storage"
+	"graphql-comments/storage/inmemory"
+	"graphql-comments/storage/storagetest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storager {
+		s, err := inmemory.NewMemoryStorage(nil)
+		require.NoError(t, err)
+		return s
+	})
+}
+
+// тот же набор с включенными снапшотом и журналом, запись идет через другой путь кода
+func TestConformanceDurable(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storager {
+		dir := t.TempDir()
+		s, err := inmemory.NewMemoryStorage(&config.Config{
+			SnapshotPath: filepath.Join(dir, "snapshot.json"),
+			WALPath:      filepath.Join(dir, "wal.jsonl"),
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
@@ -0,0 +1,103 @@
+package inmemory
+
+import (
+	"context"
+	"graphql-comments/models"
+	"time"
+)
+
+// как часто Reserve удаляет просроченные ключи
+const idempotencySweepInterval = time.Minute
+
+type idempotencyID struct {
+	tenant string
+	scope  string
+	key    string
+}
+
+// выполненный ключ в журнале и снапшоте
+type idempotencyRecord struct {
+	Tenant      string    `json:"tenant"`
+	Scope       string    `json:"scope"`
+	Key         string    `json:"key"`
+	RequestHash string    `json:"requestHash"`
+	ResultID    int       `json:"resultId"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// Занятые ключи живут только в памяти: запрос, прерванный рестартом, можно повторить сразу.
+// Выполненные ключи попадают в журнал и снапшот и переживают рестарт
+func (s *InMemoryStorage) ReserveIdempotencyKey(ctx context.Context, k models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	s.idempotencyMu.Lock()
+	defer s.idempotencyMu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.idempotencySweep) >= idempotencySweepInterval {
+		for id, existing := range s.idempotencyKeys {
+			if !existing.ExpiresAt.After(now) {
+				delete(s.idempotencyKeys, id)
+			}
+		}
+		s.idempotencySweep = now
+	}
+
+	id := idempotencyID{tenant: models.TenantFromContext(ctx), scope: k.Scope, key: k.Key}
+	if existing, ok := s.idempotencyKeys[id]; ok && existing.ExpiresAt.After(now) {
+		found := *existing
+		return &found, nil
+	}
+
+	k.ResultID = 0
+	s.idempotencyKeys[id] = &k
+	return nil, nil
+}
+
+func (s *InMemoryStorage) CompleteIdempotencyKey(ctx context.Context, scope, key string, resultID int) error {
+	s.idempotencyMu.Lock()
+	defer s.idempotencyMu.Unlock()
+
+	id := idempotencyID{tenant: models.TenantFromContext(ctx), scope: scope, key: key}
+	existing, ok := s.idempotencyKeys[id]
+	if !ok {
+		return nil
+	}
+
+	rec := idempotencyRecordOf(id, existing)
+	rec.ResultID = resultID
+	if err := s.logWrite(&walRecord{Op: opCompleteIdempotencyKey, IdempotencyKey: &rec}); err != nil {
+		return err
+	}
+	s.applyIdempotencyKey(&rec)
+	s.touch()
+	return nil
+}
+
+func (s *InMemoryStorage) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	s.idempotencyMu.Lock()
+	defer s.idempotencyMu.Unlock()
+
+	delete(s.idempotencyKeys, idempotencyID{tenant: models.TenantFromContext(ctx), scope: scope, key: key})
+	return nil
+}
+
+func idempotencyRecordOf(id idempotencyID, k *models.IdempotencyKey) idempotencyRecord {
+	return idempotencyRecord{
+		Tenant:      id.tenant,
+		Scope:       id.scope,
+		Key:         id.key,
+		RequestHash: k.RequestHash,
+		ResultID:    k.ResultID,
+		ExpiresAt:   k.ExpiresAt,
+	}
+}
+
+// Сохраняет выполненный ключ. Вызывается под idempotencyMu или при старте хранилища
+func (s *InMemoryStorage) applyIdempotencyKey(rec *idempotencyRecord) {
+	s.idempotencyKeys[idempotencyID{tenant: models.TenantOrDefault(rec.Tenant), scope: rec.Scope, key: rec.Key}] = &models.IdempotencyKey{
+		Scope:       rec.Scope,
+		Key:         rec.Key,
+		RequestHash: rec.RequestHash,
+		ResultID:    rec.ResultID,
+		ExpiresAt:   rec.ExpiresAt,
+	}
+}
@@ -0,0 +1,159 @@
+package inmemory
+
+import (
+	"context"
+	"graphql-comments/models"
+	"time"
+)
+
+// Загружает посты пачкой. Пачка сначала целиком проверяется, поэтому конфликт id не оставляет
+// половину записей. Новые id выдаются после наибольшего из уже занятых и заданных в пачке
+func (s *InMemoryStorage) ImportPosts(ctx context.Context, posts []models.Post) ([]models.Post, error) {
+	s.postMu.Lock()
+	defer s.postMu.Unlock()
+
+	next := s.postCounter
+	tenant := models.TenantFromContext(ctx)
+	seen := make(map[int]struct{}, len(posts))
+	threads := make(map[models.ThreadKey]struct{})
+	// нормализация не должна менять слайс вызывающего
+	posts = append([]models.Post(nil), posts...)
+	for i := range posts {
+		p := &posts[i]
+		if err := p.NormalizeTaxonomy(); err != nil {
+			return nil, err
+		}
+		// у внешнего ресурса может быть только один тред
+		if p.Thread != nil {
+			key, err := models.NormalizeThreadKey(*p.Thread)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := s.threads[threadID{tenant: tenant, key: key}]; exists {
+				return nil, ErrIDConflict
+			}
+			if _, dup := threads[key]; dup {
+				return nil, ErrIDConflict
+			}
+			threads[key] = struct{}{}
+			p.Thread = &key
+		}
+		if p.ID == 0 {
+			continue
+		}
+		if _, exists := s.posts[p.ID]; exists {
+			return nil, ErrIDConflict
+		}
+		if _, dup := seen[p.ID]; dup {
+			return nil, ErrIDConflict
+		}
+		seen[p.ID] = struct{}{}
+		if p.ID > next {
+			next = p.ID
+		}
+	}
+
+	now := time.Now()
+	imported := make([]models.Post, 0, len(posts))
+	for _, p := range posts {
+		if p.ID == 0 {
+			next++
+			p.ID = next
+		}
+		p.TenantID = tenant
+		if p.CreatedAt.IsZero() {
+			p.CreatedAt = now
+		}
+		if p.Format == "" {
+			p.Format = models.TextFormatPlain
+		}
+		if p.Version == 0 {
+			p.Version = 1
+		}
+		p.SetDefaultStatus(p.CreatedAt)
+
+		if err := s.logWrite(&walRecord{Op: opCreatePost, Post: &p}); err != nil {
+			return imported, err
+		}
+		post := p
+		s.applyPost(&post)
+		imported = append(imported, p)
+	}
+	s.touch()
+
+	return imported, nil
+}
+
+// Загружает комментарии пачкой, порядок внутри пачки должен быть таким, чтобы родитель шел раньше потомков.
+// Как и ImportPosts, сначала проверяет всю пачку и только потом применяет
+func (s *InMemoryStorage) ImportComments(ctx context.Context, comments []models.Comment) ([]models.Comment, error) {
+	s.commentMu.Lock()
+	s.hierarchyMu.Lock()
+	defer s.commentMu.Unlock()
+	defer s.hierarchyMu.Unlock()
+
+	next := s.commentCounter
+	tenant := models.TenantFromContext(ctx)
+	batch := make(map[int]int, len(comments)) // id комментария из пачки -> id поста
+	s.postMu.RLock()
+	for _, c := range comments {
+		if _, exists := s.tenantPost(ctx, c.PostID); !exists {
+			s.postMu.RUnlock()
+			return nil, ErrPostNotFound
+		}
+		if c.ParentID != nil {
+			postID, inBatch := batch[*c.ParentID]
+			if !inBatch && s.findComment(c.PostID, *c.ParentID) != nil {
+				postID, inBatch = c.PostID, true
+			}
+			if !inBatch || postID != c.PostID {
+				s.postMu.RUnlock()
+				return nil, ErrParentCommentNotFound
+			}
+		}
+		if c.ID == 0 {
+			continue
+		}
+		if _, exists := s.commentIndex[c.ID]; exists {
+			s.postMu.RUnlock()
+			return nil, ErrIDConflict
+		}
+		if _, dup := batch[c.ID]; dup {
+			s.postMu.RUnlock()
+			return nil, ErrIDConflict
+		}
+		batch[c.ID] = c.PostID
+		if c.ID > next {
+			next = c.ID
+		}
+	}
+	s.postMu.RUnlock()
+
+	now := time.Now()
+	imported := make([]models.Comment, 0, len(comments))
+	for _, c := range comments {
+		if c.ID == 0 {
+			next++
+			c.ID = next
+		}
+		c.TenantID = tenant
+		if c.CreatedAt.IsZero() {
+			c.CreatedAt = now
+		}
+		if c.Format == "" {
+			c.Format = models.TextFormatPlain
+		}
+		// флаг выставит applyComment у родителя, когда дойдет до ответов
+		c.HasReplies = false
+
+		if err := s.logWrite(&walRecord{Op: opCreateComment, Comment: &c}); err != nil {
+			return imported, err
+		}
+		comment := c
+		s.applyComment(&comment)
+		imported = append(imported, c)
+	}
+	s.touch()
+
+	return imported, nil
+}
@@ -2,88 +2,185 @@ package inmemory
 
 import (
 	"context"
-	"fmt"
+	"graphql-comments/config"
 	"graphql-comments/models"
 	"sort"
 	"sync"
 	"time"
 )
 
+// ошибки объявлены в models и общие для всех хранилищ
 var (
-	ErrPostNotFound          = fmt.Errorf("post not found")
-	ErrCommentsAreNotAllowed = fmt.Errorf("comments are not allowed for this post")
-	ErrParentCommentNotFound = fmt.Errorf("parent comment not found")
+	ErrPostNotFound          = models.ErrPostNotFound
+	ErrCommentsAreNotAllowed = models.ErrCommentsAreNotAllowed
+	ErrParentCommentNotFound = models.ErrParentCommentNotFound
+	ErrCommentNotFound       = models.ErrCommentNotFound
+	ErrIDConflict            = models.ErrIDConflict
+	ErrVersionConflict       = models.ErrVersionConflict
+	ErrThreadNotFound        = models.ErrThreadNotFound
 )
 
 // структура описывает хранилище в памяти
 type InMemoryStorage struct {
-	posts            map[int]*models.Post      // хеш-таблица для хранения постов, где ключ это id поста
-	comments         map[int][]*models.Comment // хеш-таблица для хранения коментариев первого уровня под постом, где ключ это id поста
-	commentHierarchy map[int][]*models.Comment // хеш-таблица для хранения коментариев последующих уровней под постом, где ключ это id родительского комментария
-	postCounter      int                       // cчетчик числа постов
-	commentCounter   int                       // cчетчик числа комментариев
-	postMu           sync.RWMutex
-	commentMu        sync.RWMutex
-	hierarchyMu      sync.RWMutex
-}
-
-// Конструктор inmemory хранилища
-func NewMemoryStorage() (*InMemoryStorage, error) {
-	return &InMemoryStorage{
+	posts               map[int]*models.Post              // хеш-таблица для хранения постов, где ключ это id поста
+	revisions           map[int][]*models.PostRevision    // хеш-таблица для хранения ревизий поста по возрастанию версии, где ключ это id поста
+	comments            map[int][]*models.Comment         // хеш-таблица для хранения коментариев первого уровня под постом, где ключ это id поста
+	commentHierarchy    map[int][]*models.Comment         // хеш-таблица для хранения коментариев последующих уровней под постом, где ключ это id родительского комментария
+	commentIndex        map[int]*models.Comment           // хеш-таблица для поиска любого комментария по его id
+	mentions            map[string][]*models.Comment      // хеш-таблица для хранения упоминаний, где ключ это хендл упомянутого пользователя
+	notifications       map[string][]*models.Notification // хеш-таблица для хранения уведомлений, где ключ это хендл получателя
+	threads             map[threadID]int                  // хеш-таблица для поиска поста-треда по арендатору и ключу внешнего ресурса
+	postCounter         int                               // cчетчик числа постов
+	commentCounter      int                               // cчетчик числа комментариев
+	notificationCounter int                               // cчетчик числа уведомлений
+	postMu              sync.RWMutex
+	commentMu           sync.RWMutex
+	hierarchyMu         sync.RWMutex
+	mentionMu           sync.RWMutex
+	notificationMu      sync.RWMutex
+	index               *searchIndex // инвертированный индекс для полнотекстового поиска
+	searchMu            sync.RWMutex
+
+	idempotencyKeys  map[idempotencyID]*models.IdempotencyKey // ключи идемпотентности, в снапшот и журнал попадают только выполненные
+	idempotencySweep time.Time                                // когда последний раз удалялись просроченные ключи
+	idempotencyMu    sync.Mutex
+
+	snapshotPath     string        // файл снапшота, пустой путь отключает сохранение на диск
+	snapshotMu       sync.Mutex    // не дает двум снапшотам писаться одновременно
+	snapshotRevision uint64        // значение revision на момент последнего снапшота
+	snapshotStop     chan struct{} // закрывается в Close, останавливает периодические снапшоты
+	snapshotDone     chan struct{} // закрывается горутиной снапшотов при выходе
+	revision         uint64        // счетчик изменений, увеличивается при каждой записи
+	wal              *wal          // журнал упреждающей записи, nil если журнал отключен
+	closeOnce        sync.Once
+}
+
+// Конструктор inmemory хранилища. Если в конфигурации задан SnapshotPath, данные загружаются
+// из снапшота и сохраняются в него периодически и при закрытии. Если задан WALPath, поверх
+// снапшота проигрывается журнал, а каждая запись попадает в журнал до подтверждения.
+// Журнал без снапшота не поддерживается. nil конфигурация создает хранилище без сохранения на диск
+func NewMemoryStorage(cfg *config.Config) (*InMemoryStorage, error) {
+	s := &InMemoryStorage{
 		posts:            make(map[int]*models.Post),
+		revisions:        make(map[int][]*models.PostRevision),
 		comments:         make(map[int][]*models.Comment),
 		commentHierarchy: make(map[int][]*models.Comment),
-	}, nil
+		commentIndex:     make(map[int]*models.Comment),
+		mentions:         make(map[string][]*models.Comment),
+		notifications:    make(map[string][]*models.Notification),
+		threads:          make(map[threadID]int),
+		index:            newSearchIndex(),
+		idempotencyKeys:  make(map[idempotencyID]*models.IdempotencyKey),
+	}
+
+	if cfg == nil {
+		return s, nil
+	}
+	if cfg.WALPath != "" && cfg.SnapshotPath == "" {
+		return nil, ErrWALWithoutSnapshot
+	}
+
+	var walSeq uint64
+	if cfg.SnapshotPath != "" {
+		seq, err := s.loadSnapshot(cfg.SnapshotPath)
+		if err != nil {
+			return nil, err
+		}
+		s.snapshotPath = cfg.SnapshotPath
+		walSeq = seq
+	}
+
+	if cfg.WALPath != "" {
+		w, err := openWAL(cfg.WALPath, walSeq, s.replay)
+		if err != nil {
+			return nil, err
+		}
+		s.wal = w
+	}
+
+	if s.snapshotPath != "" && cfg.SnapshotInterval > 0 {
+		s.snapshotStop = make(chan struct{})
+		s.snapshotDone = make(chan struct{})
+		go s.runSnapshots(cfg.SnapshotInterval)
+	}
+
+	return s, nil
 }
 
 // Сохраняет пост в памяти, возвращает созданный пост или ошибку
 func (s *InMemoryStorage) CreatePost(ctx context.Context, p models.Post) (models.Post, error) {
+	if err := p.NormalizeTaxonomy(); err != nil {
+		return p, err
+	}
+	p.TenantID = models.TenantFromContext(ctx)
+
 	s.postMu.Lock()
 	defer s.postMu.Unlock()
 
+	return s.createPost(p)
+}
+
+// Выдает посту id и сохраняет его, вызывающий держит postMu
+func (s *InMemoryStorage) createPost(p models.Post) (models.Post, error) {
 	s.postCounter++
 	p.ID = s.postCounter
 	p.CreatedAt = time.Now()
-	s.posts[p.ID] = &p
+	p.Version = 1
+	if p.Format == "" {
+		p.Format = models.TextFormatPlain
+	}
+	p.SetDefaultStatus(p.CreatedAt)
+
+	if err := s.logWrite(&walRecord{Op: opCreatePost, Post: &p}); err != nil {
+		s.postCounter--
+		return p, err
+	}
+	s.applyPost(&p)
+	s.touch()
 
 	return p, nil
 }
 
 // Сохраняет комментарии в памяти, возвращает созданный комментарии или ошибку
 func (s *InMemoryStorage) CreateComment(ctx context.Context, c models.Comment, parentID *int) (models.Comment, error) {
-	s.commentMu.RLock()
-	s.hierarchyMu.RLock()
-	defer s.commentMu.RUnlock()
-	defer s.hierarchyMu.RUnlock()
+	s.commentMu.Lock()
+	s.hierarchyMu.Lock()
+	defer s.commentMu.Unlock()
+	defer s.hierarchyMu.Unlock()
 
 	s.postMu.RLock()
-	post, exists := s.posts[c.PostID]
+	post, exists := s.tenantPost(ctx, c.PostID)
 	s.postMu.RUnlock()
 	if !exists {
 		return c, ErrPostNotFound
 	}
 
-	if !post.AllowComments {
+	// черновики и запланированные посты еще никто не видит, комментировать их нельзя
+	if !post.AllowComments || post.Status != models.PostStatusPublished {
 		return c, ErrCommentsAreNotAllowed
 	}
 
+	// если указан id родительского коммента, то он должен быть под тем же постом
+	if parentID != nil && s.findComment(c.PostID, *parentID) == nil {
+		return c, ErrParentCommentNotFound
+	}
+
 	s.commentCounter++
 	c.ID = s.commentCounter
+	c.TenantID = post.TenantID
 	c.CreatedAt = time.Now()
 	c.HasReplies = false
+	c.ParentID = parentID
+	if c.Format == "" {
+		c.Format = models.TextFormatPlain
+	}
 
-	if parentID != nil {
-		// если указан id родительского коммента, то сначала находим его
-		parentComment := s.findComment(c.PostID, *parentID)
-		if parentComment == nil {
-			return c, ErrParentCommentNotFound
-		}
-		// теперь у родительского коммента есть дрочерние, фиксируем это
-		parentComment.HasReplies = true
-		s.commentHierarchy[*parentID] = append(s.commentHierarchy[*parentID], &c)
-	} else {
-		s.comments[c.PostID] = append(s.comments[c.PostID], &c)
+	if err := s.logWrite(&walRecord{Op: opCreateComment, Comment: &c}); err != nil {
+		s.commentCounter--
+		return c, err
 	}
+	s.applyComment(&c)
+	s.touch()
 
 	return c, nil
 }
@@ -93,7 +190,7 @@ func (s *InMemoryStorage) GetPost(ctx context.Context, id int) (*models.Post, er
 	s.postMu.RLock()
 	defer s.postMu.RUnlock()
 
-	post, exists := s.posts[id]
+	post, exists := s.tenantPost(ctx, id)
 	if !exists {
 		return nil, ErrPostNotFound
 	}
@@ -101,18 +198,37 @@ func (s *InMemoryStorage) GetPost(ctx context.Context, id int) (*models.Post, er
 	return post, nil
 }
 
-// Получает слайс всех постов из памяти, посты сортированы от нового к старому
-func (s *InMemoryStorage) GetPosts(ctx context.Context) ([]*models.Post, error) {
+// Находит комментарий в памяти по id
+func (s *InMemoryStorage) GetComment(ctx context.Context, id int) (*models.Comment, error) {
+	s.commentMu.RLock()
+	defer s.commentMu.RUnlock()
+
+	comment, exists := s.commentIndex[id]
+	if !exists || comment.TenantID != models.TenantFromContext(ctx) {
+		return nil, ErrCommentNotFound
+	}
+
+	return comment, nil
+}
+
+// Получает слайс постов из памяти, подходящих под фильтр, посты сортированы от нового к старому
+func (s *InMemoryStorage) GetPosts(ctx context.Context, filter models.PostFilter) ([]*models.Post, error) {
 	s.postMu.RLock()
 	defer s.postMu.RUnlock()
 
+	tenant := models.TenantFromContext(ctx)
 	posts := make([]*models.Post, 0, len(s.posts))
 	for _, post := range s.posts {
-		posts = append(posts, post)
+		if post.TenantID == tenant && filter.Match(post) {
+			posts = append(posts, post)
+		}
 	}
 
 	sort.Slice(posts, func(i, j int) bool {
-		return posts[i].CreatedAt.After(posts[j].CreatedAt)
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.After(posts[j].CreatedAt)
+		}
+		return posts[i].ID > posts[j].ID
 	})
 
 	return posts, nil
@@ -126,7 +242,7 @@ func (s *InMemoryStorage) GetComments(ctx context.Context, postID int, parentID
 	defer s.hierarchyMu.RUnlock()
 
 	s.postMu.RLock()
-	_, postExists := s.posts[postID]
+	_, postExists := s.tenantPost(ctx, postID)
 	s.postMu.RUnlock()
 	if !postExists {
 		return nil, ErrPostNotFound
@@ -136,64 +252,261 @@ func (s *InMemoryStorage) GetComments(ctx context.Context, postID int, parentID
 	if parentID == nil {
 		comments = s.comments[postID]
 	} else {
-
-		parentComment := s.findComment(postID, *parentID)
-		if parentComment == nil {
+		if s.findComment(postID, *parentID) == nil {
 			return nil, ErrParentCommentNotFound
 		}
 
 		comments = s.commentHierarchy[*parentID]
 	}
 
-	sort.Slice(comments, func(i, j int) bool {
-		return comments[i].CreatedAt.Before(comments[j].CreatedAt)
-	})
+	// applyComment держит срез отсортированным по id, а id растут вместе со временем создания
+	var page []*models.Comment
+	for _, comment := range comments {
+		if len(page) >= limit {
+			break
+		}
+		if comment.ID > afterID {
+			page = append(page, comment)
+		}
+	}
 
-	if afterID > 0 {
-		var startIndex int
-		for i, comment := range comments {
-			if comment.ID == afterID {
-				startIndex = i + 1
-				break
-			}
+	return page, nil
+}
+
+// Получает сплайс комментариев c id > afterID, в которых упомянут пользователь handle, длинной limit.
+// applyComment держит срез отсортированным по id, поэтому дополнительная сортировка не нужна
+// Упоминания в комментариях неопубликованных постов не отдаются, как и в поиске
+func (s *InMemoryStorage) GetMentions(ctx context.Context, handle string, limit, afterID int) ([]*models.Comment, error) {
+	// порядок блокировок как при записи комментария: сначала посты, потом упоминания
+	s.postMu.RLock()
+	defer s.postMu.RUnlock()
+	s.mentionMu.RLock()
+	defer s.mentionMu.RUnlock()
+
+	tenant := models.TenantFromContext(ctx)
+	var comments []*models.Comment
+	for _, comment := range s.mentions[models.NormalizeHandle(handle)] {
+		if comment.ID <= afterID || comment.TenantID != tenant {
+			continue
 		}
-		if startIndex >= len(comments) {
-			return nil, nil
+		if post, ok := s.posts[comment.PostID]; !ok || post.Status != models.PostStatusPublished {
+			continue
 		}
-		comments = comments[startIndex:]
+		if len(comments) >= limit {
+			break
+		}
+		comments = append(comments, comment)
 	}
 
-	end := limit
-	if end > len(comments) {
-		end = len(comments)
-	} else if end < 0 {
-		end = 0
+	return comments, nil
+}
+
+// Сохраняет уведомление в ящик получателя
+func (s *InMemoryStorage) CreateNotification(ctx context.Context, n models.Notification) (models.Notification, error) {
+	s.notificationMu.Lock()
+	defer s.notificationMu.Unlock()
+
+	s.notificationCounter++
+	n.ID = s.notificationCounter
+	n.TenantID = models.TenantFromContext(ctx)
+	n.Recipient = models.NormalizeHandle(n.Recipient)
+	n.CreatedAt = time.Now()
+	n.Read = false
+
+	if err := s.logWrite(&walRecord{Op: opCreateNotification, Notification: &n}); err != nil {
+		s.notificationCounter--
+		return n, err
 	}
+	s.applyNotification(&n)
+	s.touch()
 
-	return comments[:end], nil
+	return n, nil
 }
 
-// Не делаем ничего, но тем самым реализуем интерфейс Storager
-func (s *InMemoryStorage) Close() error {
-	return nil
+// Получает уведомления пользователя от новых к старым c id < beforeID длинной limit.
+// Уведомления добавляются в порядке создания, поэтому ящик обходится с конца
+func (s *InMemoryStorage) GetNotifications(ctx context.Context, recipient string, limit, beforeID int, unreadOnly bool) ([]*models.Notification, error) {
+	s.notificationMu.RLock()
+	defer s.notificationMu.RUnlock()
+
+	tenant := models.TenantFromContext(ctx)
+	inbox := s.notifications[models.NormalizeHandle(recipient)]
+	var notifications []*models.Notification
+	for i := len(inbox) - 1; i >= 0 && len(notifications) < limit; i-- {
+		n := inbox[i]
+		if n.TenantID != tenant || (beforeID > 0 && n.ID >= beforeID) {
+			continue
+		}
+		if unreadOnly && n.Read {
+			continue
+		}
+		// отдаем копию, чтобы последующая отметка о прочтении не меняла уже выданные данные
+		notification := *n
+		notifications = append(notifications, &notification)
+	}
+
+	return notifications, nil
 }
 
-// Вспомогательная функция находит комментарий с заданным id под постом с postID
-func (s *InMemoryStorage) findComment(postID, commentID int) *models.Comment {
+// Помечает уведомления пользователя прочитанными, пустой ids помечает весь ящик
+func (s *InMemoryStorage) MarkNotificationsRead(ctx context.Context, recipient string, ids []int) (int, error) {
+	s.notificationMu.Lock()
+	defer s.notificationMu.Unlock()
+
+	wanted := make(map[int]struct{}, len(ids))
+	for _, id := range ids {
+		wanted[id] = struct{}{}
+	}
 
-	for _, comment := range s.comments[postID] {
-		if comment.ID == commentID {
-			return comment
+	recipient = models.NormalizeHandle(recipient)
+	tenant := models.TenantFromContext(ctx)
+	var marked []int
+	for _, n := range s.notifications[recipient] {
+		if _, ok := wanted[n.ID]; (len(ids) > 0 && !ok) || n.TenantID != tenant {
+			continue
 		}
+		if !n.Read {
+			marked = append(marked, n.ID)
+		}
+	}
+	if len(marked) == 0 {
+		return 0, nil
+	}
+
+	// в журнал пишутся фактически отмеченные id, чтобы повтор не зависел от состояния ящика
+	if err := s.logWrite(&walRecord{Op: opMarkNotificationsRead, Recipient: recipient, IDs: marked}); err != nil {
+		return 0, err
 	}
+	s.applyMarkRead(recipient, marked)
+	s.touch()
 
-	for _, comments := range s.commentHierarchy {
-		for _, comment := range comments {
-			if comment.ID == commentID {
-				return comment
+	return len(marked), nil
+}
+
+// Данные в памяти доступны всегда, пока процесс жив
+func (s *InMemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Останавливает периодические снапшоты, сохраняет последний снапшот и закрывает журнал, если они включены
+func (s *InMemoryStorage) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		if s.snapshotStop != nil {
+			close(s.snapshotStop)
+			<-s.snapshotDone
+		}
+		if s.snapshotPath != "" {
+			err = s.Snapshot()
+		}
+		if s.wal != nil {
+			if closeErr := s.wal.close(); err == nil {
+				err = closeErr
 			}
 		}
+	})
+	return err
+}
+
+// Вспомогательные функции apply* раскладывают уже сформированную запись по хеш-таблицам.
+// Они вызываются и при обычной записи, и при проигрывании журнала, вызывающий держит нужные мьютексы
+
+func (s *InMemoryStorage) applyPost(p *models.Post) {
+	// записи журнала, сделанные до появления ревизий и статусов, не знают версию и статус
+	if p.Version == 0 {
+		p.Version = 1
+	}
+	p.SetDefaultStatus(p.CreatedAt)
+	// и до появления арендаторов все записи принадлежали одному сайту
+	p.TenantID = models.TenantOrDefault(p.TenantID)
+	s.posts[p.ID] = p
+	revision := models.RevisionOf(p, p.CreatedAt)
+	s.revisions[p.ID] = []*models.PostRevision{&revision}
+	s.indexPost(p)
+	if p.Thread != nil {
+		s.threads[threadID{tenant: p.TenantID, key: *p.Thread}] = p.ID
+	}
+	if p.ID > s.postCounter {
+		s.postCounter = p.ID
 	}
+}
 
-	return nil
+func (s *InMemoryStorage) applyComment(c *models.Comment) {
+	c.TenantID = models.TenantOrDefault(c.TenantID)
+	if c.ParentID != nil {
+		// теперь у родительского коммента есть дрочерние, фиксируем это
+		if parent, ok := s.commentIndex[*c.ParentID]; ok {
+			parent.HasReplies = true
+		}
+		s.commentHierarchy[*c.ParentID] = insertByID(s.commentHierarchy[*c.ParentID], c)
+	} else {
+		s.comments[c.PostID] = insertByID(s.comments[c.PostID], c)
+	}
+	s.commentIndex[c.ID] = c
+	s.indexComment(c)
+
+	if len(c.Mentions) > 0 {
+		s.mentionMu.Lock()
+		for _, handle := range c.Mentions {
+			s.mentions[handle] = insertByID(s.mentions[handle], c)
+		}
+		s.mentionMu.Unlock()
+	}
+
+	if c.ID > s.commentCounter {
+		s.commentCounter = c.ID
+	}
+}
+
+// Вставляет комментарий с сохранением порядка по id. Обычно id больше всех в срезе и это append,
+// при импорте комментарий с сохраненным id может оказаться в середине
+func insertByID(list []*models.Comment, c *models.Comment) []*models.Comment {
+	i := len(list)
+	for i > 0 && list[i-1].ID > c.ID {
+		i--
+	}
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = c
+	return list
+}
+
+func (s *InMemoryStorage) applyNotification(n *models.Notification) {
+	n.TenantID = models.TenantOrDefault(n.TenantID)
+	s.notifications[n.Recipient] = append(s.notifications[n.Recipient], n)
+	if n.ID > s.notificationCounter {
+		s.notificationCounter = n.ID
+	}
+}
+
+func (s *InMemoryStorage) applyMarkRead(recipient string, ids []int) {
+	wanted := make(map[int]struct{}, len(ids))
+	for _, id := range ids {
+		wanted[id] = struct{}{}
+	}
+	for _, n := range s.notifications[recipient] {
+		if _, ok := wanted[n.ID]; ok {
+			n.Read = true
+		}
+	}
+}
+
+// Находит пост арендатора из контекста, посты других арендаторов для него не существуют.
+// Вызывающий держит postMu
+func (s *InMemoryStorage) tenantPost(ctx context.Context, id int) (*models.Post, bool) {
+	post, exists := s.posts[id]
+	if !exists || post.TenantID != models.TenantFromContext(ctx) {
+		return nil, false
+	}
+	return post, true
+}
+
+// Вспомогательная функция находит комментарий с заданным id под постом с postID
+func (s *InMemoryStorage) findComment(postID, commentID int) *models.Comment {
+	comment, exists := s.commentIndex[commentID]
+	if !exists || comment.PostID != postID {
+		return nil
+	}
+
+	return comment
 }
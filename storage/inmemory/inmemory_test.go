@@ -10,7 +10,7 @@ import (
 )
 
 func TestCreatePost(t *testing.T) {
-	storage, err := NewMemoryStorage()
+	storage, err := NewMemoryStorage(nil)
 	assert.NoError(t, err)
 
 	ctx := context.Background()
@@ -33,7 +33,7 @@ func TestCreatePost(t *testing.T) {
 }
 
 func TestCreateComment(t *testing.T) {
-	storage, err := NewMemoryStorage()
+	storage, err := NewMemoryStorage(nil)
 	assert.NoError(t, err)
 
 	ctx := context.Background()
@@ -63,7 +63,7 @@ func TestCreateComment(t *testing.T) {
 }
 
 func TestCreateCommentForNonExistingPost(t *testing.T) {
-	storage, err := NewMemoryStorage()
+	storage, err := NewMemoryStorage(nil)
 	assert.NoError(t, err)
 
 	ctx := context.Background()
@@ -79,7 +79,7 @@ func TestCreateCommentForNonExistingPost(t *testing.T) {
 }
 
 func TestCreateCommentWhenCommentsNotAllowed(t *testing.T) {
-	storage, err := NewMemoryStorage()
+	storage, err := NewMemoryStorage(nil)
 	assert.NoError(t, err)
 
 	ctx := context.Background()
@@ -105,7 +105,7 @@ func TestCreateCommentWhenCommentsNotAllowed(t *testing.T) {
 }
 
 func TestGetPost(t *testing.T) {
-	storage, err := NewMemoryStorage()
+	storage, err := NewMemoryStorage(nil)
 	assert.NoError(t, err)
 
 	ctx := context.Background()
@@ -125,7 +125,7 @@ func TestGetPost(t *testing.T) {
 }
 
 func TestGetPostNotFound(t *testing.T) {
-	storage, err := NewMemoryStorage()
+	storage, err := NewMemoryStorage(nil)
 	assert.NoError(t, err)
 
 	ctx := context.Background()
@@ -136,7 +136,7 @@ func TestGetPostNotFound(t *testing.T) {
 }
 
 func TestGetPosts(t *testing.T) {
-	storage, err := NewMemoryStorage()
+	storage, err := NewMemoryStorage(nil)
 	assert.NoError(t, err)
 
 	ctx := context.Background()
@@ -159,7 +159,7 @@ func TestGetPosts(t *testing.T) {
 	createdPost2, err := storage.CreatePost(ctx, post2)
 	assert.NoError(t, err)
 
-	posts, err := storage.GetPosts(ctx)
+	posts, err := storage.GetPosts(ctx, models.PostFilter{})
 	assert.NoError(t, err)
 	assert.Equal(t, 2, len(posts))
 	assert.Equal(t, createdPost2, *posts[0]) // пост2 должен добавиться позже
@@ -167,7 +167,7 @@ func TestGetPosts(t *testing.T) {
 }
 
 func TestGetComments(t *testing.T) {
-	storage, err := NewMemoryStorage()
+	storage, err := NewMemoryStorage(nil)
 	assert.NoError(t, err)
 
 	ctx := context.Background()
@@ -206,7 +206,7 @@ func TestGetComments(t *testing.T) {
 }
 
 func TestGetCommentsWithPagination(t *testing.T) {
-	storage, err := NewMemoryStorage()
+	storage, err := NewMemoryStorage(nil)
 	assert.NoError(t, err)
 
 	ctx := context.Background()
@@ -244,7 +244,7 @@ func TestGetCommentsWithPagination(t *testing.T) {
 }
 
 func TestGetCommentsHierarchy(t *testing.T) {
-	storage, err := NewMemoryStorage()
+	storage, err := NewMemoryStorage(nil)
 	assert.NoError(t, err)
 
 	ctx := context.Background()
@@ -279,3 +279,160 @@ func TestGetCommentsHierarchy(t *testing.T) {
 	assert.Equal(t, 1, len(comments))
 	assert.Equal(t, createdComment2, *comments[0])
 }
+
+func TestGetMentions(t *testing.T) {
+	storage, err := NewMemoryStorage(nil)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	createdPost, err := storage.CreatePost(ctx, models.Post{
+		Title:         "Тест",
+		Content:       "Пост",
+		Author:        "Автор",
+		AllowComments: true,
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := storage.CreateComment(ctx, models.Comment{
+			PostID:   createdPost.ID,
+			Text:     "@masha коммент номер " + fmt.Sprint(i),
+			Author:   "Уткин",
+			Mentions: []string{"masha"},
+		}, nil)
+		assert.NoError(t, err)
+	}
+	_, err = storage.CreateComment(ctx, models.Comment{
+		PostID: createdPost.ID,
+		Text:   "без упоминаний",
+		Author: "Уткин",
+	}, nil)
+	assert.NoError(t, err)
+
+	mentions, err := storage.GetMentions(ctx, "@Masha", 2, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(mentions))
+	assert.Equal(t, []string{"masha"}, mentions[0].Mentions)
+
+	mentions, err = storage.GetMentions(ctx, "masha", 2, mentions[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(mentions))
+
+	mentions, err = storage.GetMentions(ctx, "vasya", 10, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, mentions)
+}
+
+func TestGetComment(t *testing.T) {
+	storage, err := NewMemoryStorage(nil)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	createdPost, err := storage.CreatePost(ctx, models.Post{Title: "Тест", Content: "Пост", Author: "Автор", AllowComments: true})
+	assert.NoError(t, err)
+
+	createdComment, err := storage.CreateComment(ctx, models.Comment{PostID: createdPost.ID, Text: "Первый", Author: "1"}, nil)
+	assert.NoError(t, err)
+
+	comment, err := storage.GetComment(ctx, createdComment.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, createdComment, *comment)
+
+	_, err = storage.GetComment(ctx, 1337)
+	assert.Equal(t, ErrCommentNotFound, err)
+}
+
+func TestNotifications(t *testing.T) {
+	storage, err := NewMemoryStorage(nil)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err := storage.CreateNotification(ctx, models.Notification{
+			Recipient: "@Masha",
+			Type:      models.NotificationTypeMention,
+			Actor:     "Уткин",
+			PostID:    1,
+		})
+		assert.NoError(t, err)
+	}
+
+	notifications, err := storage.GetNotifications(ctx, "masha", 2, 0, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(notifications))
+	assert.Equal(t, 3, notifications[0].ID) // от новых к старым
+	assert.Equal(t, 2, notifications[1].ID)
+
+	notifications, err = storage.GetNotifications(ctx, "masha", 2, notifications[1].ID, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(notifications))
+	assert.Equal(t, 1, notifications[0].ID)
+
+	marked, err := storage.MarkNotificationsRead(ctx, "masha", []int{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, marked)
+
+	notifications, err = storage.GetNotifications(ctx, "masha", 10, 0, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(notifications))
+	assert.Equal(t, 3, notifications[0].ID)
+
+	marked, err = storage.MarkNotificationsRead(ctx, "masha", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, marked)
+
+	notifications, err = storage.GetNotifications(ctx, "masha", 10, 0, true)
+	assert.NoError(t, err)
+	assert.Empty(t, notifications)
+}
+
+func TestSearch(t *testing.T) {
+	storage, err := NewMemoryStorage(nil)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	post1, err := storage.CreatePost(ctx, models.Post{Title: "Котики", Content: "Все о домашних животных", Author: "Автор", AllowComments: true})
+	assert.NoError(t, err)
+	post2, err := storage.CreatePost(ctx, models.Post{Title: "Собаки", Content: "Собаки тоже любят котики, но не всегда", Author: "Автор", AllowComments: true})
+	assert.NoError(t, err)
+
+	comment, err := storage.CreateComment(ctx, models.Comment{PostID: post2.ID, Text: "А у меня дома <b>два</b> кота и котики", Author: "Петя"}, nil)
+	assert.NoError(t, err)
+	_, err = storage.CreateComment(ctx, models.Comment{PostID: post1.ID, Text: "Ничего интересного", Author: "Вася"}, nil)
+	assert.NoError(t, err)
+
+	results, err := storage.Search(ctx, models.SearchQuery{Text: "КОТИКИ", Scope: models.SearchScopeAll, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(results))
+	// совпадение в заголовке весит больше, чем в тексте
+	assert.Equal(t, post1.ID, results[0].Post.ID)
+	assert.Equal(t, "<mark>Котики</mark> Все о домашних животных", results[0].Snippet)
+
+	results, err = storage.Search(ctx, models.SearchQuery{Text: "котики дома", Scope: models.SearchScopeComments, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, comment.ID, results[0].Comment.ID)
+	assert.Equal(t, "А у меня <mark>дома</mark> &lt;b&gt;два&lt;/b&gt; кота и <mark>котики</mark>", results[0].Snippet)
+
+	results, err = storage.Search(ctx, models.SearchQuery{Text: "котики", Scope: models.SearchScopePosts, PostID: &post2.ID, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, post2.ID, results[0].Post.ID)
+
+	results, err = storage.Search(ctx, models.SearchQuery{Text: "котики", Scope: models.SearchScopeAll, Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(results))
+
+	results, err = storage.Search(ctx, models.SearchQuery{Text: "жирафы", Scope: models.SearchScopeAll, Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestSearchSnippetTruncation(t *testing.T) {
+	text := "раз два три четыре пять шесть семь восемь девять десять одиннадцать двенадцать " +
+		"тринадцать четырнадцать пятнадцать шестнадцать семнадцать восемнадцать девятнадцать двадцать " +
+		"двадцать один двадцать два"
+	snippet := makeSnippet(text, []string{"семь"})
+	assert.Equal(t, "…два три четыре пять шесть <mark>семь</mark> восемь девять десять одиннадцать двенадцать "+
+		"тринадцать четырнадцать пятнадцать шестнадцать семнадцать восемнадцать девятнадцать двадцать двадцать…", snippet)
+}
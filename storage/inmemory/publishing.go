@@ -0,0 +1,75 @@
+package inmemory
+
+import (
+	"context"
+	"graphql-comments/models"
+	"sort"
+	"time"
+)
+
+// Меняет статус публикации поста. Как и в UpdatePost, хранимый пост заменяется новым объектом
+func (s *InMemoryStorage) SetPostStatus(ctx context.Context, id int, status models.PostStatus, publishAt *time.Time) (models.Post, error) {
+	s.postMu.Lock()
+	defer s.postMu.Unlock()
+
+	current, exists := s.tenantPost(ctx, id)
+	if !exists {
+		return models.Post{}, ErrPostNotFound
+	}
+
+	updated := *current
+	updated.Status = status
+	updated.PublishAt = publishAt
+	if updated.PublishAt == nil && status != models.PostStatusDraft {
+		now := time.Now()
+		updated.PublishAt = &now
+	}
+	if status == models.PostStatusDraft {
+		updated.PublishAt = nil
+	}
+
+	if err := s.logWrite(&walRecord{Op: opSetPostStatus, Post: &updated}); err != nil {
+		return *current, err
+	}
+	s.applyReplacePost(&updated)
+	s.touch()
+
+	return updated, nil
+}
+
+// Публикует запланированные посты всех арендаторов, время которых пришло, в порядке PublishAt
+func (s *InMemoryStorage) PublishDuePosts(ctx context.Context, now time.Time) ([]models.Post, error) {
+	s.postMu.Lock()
+	defer s.postMu.Unlock()
+
+	var due []*models.Post
+	for _, post := range s.posts {
+		if post.Status == models.PostStatusScheduled && post.PublishAt != nil && !post.PublishAt.After(now) {
+			due = append(due, post)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].PublishAt.Before(*due[j].PublishAt) })
+
+	published := make([]models.Post, 0, len(due))
+	for _, post := range due {
+		updated := *post
+		updated.Status = models.PostStatusPublished
+		if err := s.logWrite(&walRecord{Op: opSetPostStatus, Post: &updated}); err != nil {
+			return published, err
+		}
+		s.applyReplacePost(&updated)
+		published = append(published, updated)
+	}
+	if len(published) > 0 {
+		s.touch()
+	}
+
+	return published, nil
+}
+
+// Заменяет хранимый пост новым объектом с теми же текстом и версией, так применяются смена статуса, тегов и категории
+func (s *InMemoryStorage) applyReplacePost(p *models.Post) {
+	if _, exists := s.posts[p.ID]; exists {
+		s.posts[p.ID] = p
+	}
+}
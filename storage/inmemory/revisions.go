@@ -0,0 +1,67 @@
+package inmemory
+
+import (
+	"context"
+	"graphql-comments/models"
+	"time"
+)
+
+// Обновляет пост, если его версия равна expectedVersion. Хранимый пост заменяется новым объектом,
+// поэтому уже выданные указатели продолжают видеть прежнюю версию
+func (s *InMemoryStorage) UpdatePost(ctx context.Context, p models.Post, expectedVersion int) (models.Post, error) {
+	s.postMu.Lock()
+	defer s.postMu.Unlock()
+
+	current, exists := s.tenantPost(ctx, p.ID)
+	if !exists {
+		return p, ErrPostNotFound
+	}
+	if current.Version != expectedVersion {
+		return *current, ErrVersionConflict
+	}
+
+	updated := *current
+	updated.Title = p.Title
+	updated.Content = p.Content
+	updated.ContentHTML = p.ContentHTML
+	updated.AllowComments = p.AllowComments
+	updated.Format = p.Format
+	if updated.Format == "" {
+		updated.Format = models.TextFormatPlain
+	}
+	updated.Version = current.Version + 1
+	revision := models.RevisionOf(&updated, time.Now())
+
+	if err := s.logWrite(&walRecord{Op: opUpdatePost, Post: &updated, Revision: &revision}); err != nil {
+		return *current, err
+	}
+	s.applyUpdatePost(&updated, &revision)
+	s.touch()
+
+	return updated, nil
+}
+
+// Получает ревизии поста по возрастанию версии
+func (s *InMemoryStorage) GetPostRevisions(ctx context.Context, postID int) ([]*models.PostRevision, error) {
+	s.postMu.RLock()
+	defer s.postMu.RUnlock()
+
+	if _, exists := s.tenantPost(ctx, postID); !exists {
+		return nil, ErrPostNotFound
+	}
+
+	// ревизии не меняются после записи, но срез может расти, поэтому отдается его копия
+	revisions := make([]*models.PostRevision, len(s.revisions[postID]))
+	copy(revisions, s.revisions[postID])
+	return revisions, nil
+}
+
+func (s *InMemoryStorage) applyUpdatePost(p *models.Post, revision *models.PostRevision) {
+	old, exists := s.posts[p.ID]
+	if !exists {
+		return
+	}
+	s.posts[p.ID] = p
+	s.revisions[p.ID] = append(s.revisions[p.ID], revision)
+	s.reindexPost(old, p)
+}
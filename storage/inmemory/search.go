@@ -0,0 +1,331 @@
+package inmemory
+
+import (
+	"context"
+	"graphql-comments/models"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// веса полей при ранжировании: совпадение в заголовке поста важнее совпадения в тексте
+const (
+	titleWeight   = 2.0
+	contentWeight = 1.0
+)
+
+// сколько слов сниппета показывать до первого совпадения и всего
+const (
+	snippetWordsBefore = 5
+	snippetWords       = 20
+)
+
+// тип проиндексированного документа
+type docKind int
+
+const (
+	docPost docKind = iota
+	docComment
+)
+
+// документ в инвертированном индексе
+type searchDoc struct {
+	kind docKind
+	id   int
+}
+
+// Инвертированный индекс: для каждого слова хранится взвешенная частота в каждом документе,
+// в котором оно встречается. Защищается мьютексом хранилища searchMu
+type searchIndex struct {
+	postings map[string]map[searchDoc]float64
+	docs     map[docKind]int // число проиндексированных документов каждого типа, нужно для idf
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[searchDoc]float64),
+		docs:     make(map[docKind]int),
+	}
+}
+
+// добавляет документ в индекс, слова из text учитываются с весом weight
+func (idx *searchIndex) add(doc searchDoc, weight float64, text string) {
+	for _, term := range tokenize(text) {
+		docs, ok := idx.postings[term]
+		if !ok {
+			docs = make(map[searchDoc]float64)
+			idx.postings[term] = docs
+		}
+		docs[doc] += weight
+	}
+}
+
+// убирает документ из списков слов, встречающихся в text
+func (idx *searchIndex) remove(doc searchDoc, text string) {
+	for _, term := range tokenize(text) {
+		docs, ok := idx.postings[term]
+		if !ok {
+			continue
+		}
+		delete(docs, doc)
+		if len(docs) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+}
+
+// Находит документы типа kind, содержащие все слова запроса, и считает их tf-idf
+func (idx *searchIndex) search(kind docKind, terms []string, filter func(id int) bool) map[int]float64 {
+	scores := make(map[int]float64)
+	total := float64(idx.docs[kind])
+
+	for i, term := range terms {
+		matched := make(map[int]float64)
+		df := 0
+		for doc, tf := range idx.postings[term] {
+			if doc.kind == kind {
+				df++
+				matched[doc.id] = tf
+			}
+		}
+		idf := math.Log(1 + total/float64(df+1))
+
+		if i == 0 {
+			for id, tf := range matched {
+				if filter == nil || filter(id) {
+					scores[id] = tf * idf
+				}
+			}
+			continue
+		}
+		// все слова запроса должны встретиться в документе
+		for id := range scores {
+			tf, ok := matched[id]
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+			scores[id] += tf * idf
+		}
+	}
+
+	return scores
+}
+
+// Ищет посты и комментарии, содержащие все слова запроса
+func (s *InMemoryStorage) Search(ctx context.Context, q models.SearchQuery) ([]*models.SearchResult, error) {
+	terms := uniqueTerms(tokenize(q.Text))
+	if len(terms) == 0 || q.Limit <= 0 {
+		return nil, nil
+	}
+
+	s.searchMu.RLock()
+	var postScores, commentScores map[int]float64
+	if q.Scope.IncludesPosts() {
+		postScores = s.index.search(docPost, terms, func(id int) bool {
+			return q.PostID == nil || id == *q.PostID
+		})
+	}
+	if q.Scope.IncludesComments() {
+		commentScores = s.index.search(docComment, terms, nil)
+	}
+	s.searchMu.RUnlock()
+
+	var results []*models.SearchResult
+
+	// неопубликованные посты и комментарии под ними в поиск не попадают
+	s.postMu.RLock()
+	for id, score := range postScores {
+		if post, ok := s.tenantPost(ctx, id); ok && post.Status == models.PostStatusPublished {
+			results = append(results, &models.SearchResult{
+				Post:    post,
+				Score:   score,
+				Snippet: makeSnippet(post.Title+" "+post.Content, terms),
+			})
+		}
+	}
+	s.postMu.RUnlock()
+
+	s.commentMu.RLock()
+	s.postMu.RLock()
+	for id, score := range commentScores {
+		comment, ok := s.commentIndex[id]
+		if !ok || (q.PostID != nil && comment.PostID != *q.PostID) {
+			continue
+		}
+		if post, ok := s.tenantPost(ctx, comment.PostID); !ok || post.Status != models.PostStatusPublished {
+			continue
+		}
+		results = append(results, &models.SearchResult{
+			Comment: comment,
+			Score:   score,
+			Snippet: makeSnippet(comment.Text, terms),
+		})
+	}
+	s.postMu.RUnlock()
+	s.commentMu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return resultCreatedAt(results[i]) > resultCreatedAt(results[j])
+	})
+
+	if len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
+
+// индексирует пост, вызывается при создании
+func (s *InMemoryStorage) indexPost(p *models.Post) {
+	s.searchMu.Lock()
+	defer s.searchMu.Unlock()
+
+	doc := searchDoc{kind: docPost, id: p.ID}
+	s.index.add(doc, titleWeight, p.Title)
+	s.index.add(doc, contentWeight, p.Content)
+	s.index.docs[docPost]++
+}
+
+// заменяет в индексе старые заголовок и текст поста новыми, вызывается при обновлении
+func (s *InMemoryStorage) reindexPost(old, p *models.Post) {
+	s.searchMu.Lock()
+	defer s.searchMu.Unlock()
+
+	doc := searchDoc{kind: docPost, id: p.ID}
+	s.index.remove(doc, old.Title+" "+old.Content)
+	s.index.add(doc, titleWeight, p.Title)
+	s.index.add(doc, contentWeight, p.Content)
+}
+
+// индексирует комментарий, вызывается при создании
+func (s *InMemoryStorage) indexComment(c *models.Comment) {
+	s.searchMu.Lock()
+	defer s.searchMu.Unlock()
+
+	s.index.add(searchDoc{kind: docComment, id: c.ID}, contentWeight, c.Text)
+	s.index.docs[docComment]++
+}
+
+// время создания найденного документа в наносекундах, нужно для стабильной сортировки
+func resultCreatedAt(r *models.SearchResult) int64 {
+	if r.Post != nil {
+		return r.Post.CreatedAt.UnixNano()
+	}
+	return r.Comment.CreatedAt.UnixNano()
+}
+
+// разбивает текст на слова в нижнем регистре
+func tokenize(text string) []string {
+	var terms []string
+	for _, t := range scanTokens(text) {
+		terms = append(terms, strings.ToLower(text[t.start:t.end]))
+	}
+	return terms
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]struct{}, len(terms))
+	unique := terms[:0]
+	for _, term := range terms {
+		if _, ok := seen[term]; ok {
+			continue
+		}
+		seen[term] = struct{}{}
+		unique = append(unique, term)
+	}
+	return unique
+}
+
+// слово и его границы в байтах исходного текста
+type token struct {
+	start, end int
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func scanTokens(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, token{start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{start: start, end: len(text)})
+	}
+	return tokens
+}
+
+// Вырезает из текста фрагмент вокруг первого совпадения и выделяет в нем слова запроса
+func makeSnippet(text string, terms []string) string {
+	wanted := make(map[string]struct{}, len(terms))
+	for _, term := range terms {
+		wanted[term] = struct{}{}
+	}
+
+	tokens := scanTokens(text)
+	first := -1
+	for i, t := range tokens {
+		if _, ok := wanted[strings.ToLower(text[t.start:t.end])]; ok {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		first = 0
+	}
+
+	from := first - snippetWordsBefore
+	if from < 0 {
+		from = 0
+	}
+	to := from + snippetWords
+	if to > len(tokens) {
+		to = len(tokens)
+	}
+	if from >= to {
+		return models.FormatSnippet(text)
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := tokens[from].start
+	for _, t := range tokens[from:to] {
+		b.WriteString(text[pos:t.start])
+		word := text[t.start:t.end]
+		if _, ok := wanted[strings.ToLower(word)]; ok {
+			b.WriteString(models.SnippetHighlightStart + word + models.SnippetHighlightStop)
+		} else {
+			b.WriteString(word)
+		}
+		pos = t.end
+	}
+	if to < len(tokens) {
+		b.WriteString("…")
+	} else {
+		// хвост после последнего слова, например знак препинания
+		tail := text[pos:]
+		if utf8.RuneCountInString(tail) <= 3 {
+			b.WriteString(tail)
+		}
+	}
+
+	return models.FormatSnippet(b.String())
+}
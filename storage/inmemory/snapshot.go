@@ -0,0 +1,304 @@
+package inmemory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"graphql-comments/models"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// версия формата снапшота, увеличивается при любом изменении формата, чтобы старый бинарник
+// отказался загружать снапшот, а не потерял незнакомые ему поля. Новый бинарник читает все прежние версии.
+// 2: ревизии, выполненные ключи идемпотентности и сайт у каждой записи
+const snapshotVersion = 2
+
+var ErrUnsupportedSnapshot = errors.New("unsupported snapshot version")
+
+// структура описывает снапшот хранилища на диске
+type snapshot struct {
+	Version             int                   `json:"version"`
+	CreatedAt           time.Time             `json:"createdAt"`
+	PostCounter         int                   `json:"postCounter"`
+	CommentCounter      int                   `json:"commentCounter"`
+	NotificationCounter int                   `json:"notificationCounter"`
+	WALSeq              uint64                `json:"walSeq"` // номер последней записи журнала, вошедшей в снапшот
+	Posts               []models.Post         `json:"posts"`
+	Revisions           []models.PostRevision `json:"revisions"`        // ревизии всех постов по id поста и версии
+	Comments            []models.Comment      `json:"comments"`         // все комментарии по возрастанию id
+	CommentHierarchy    map[int][]int         `json:"commentHierarchy"` // id родителя -> id ответов в порядке добавления
+	Notifications       []models.Notification `json:"notifications"`
+	IdempotencyKeys     []idempotencyRecord   `json:"idempotencyKeys"` // выполненные ключи, срок которых еще не истек
+}
+
+// Сохраняет снапшот, если с прошлого сохранения были изменения.
+// Файл сначала пишется рядом во временный, а затем атомарно переименовывается,
+// так что при падении на диске остается либо старый, либо новый снапшот целиком.
+// После записи снапшота из журнала удаляются вошедшие в него записи
+func (s *InMemoryStorage) Snapshot() error {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	revision := atomic.LoadUint64(&s.revision)
+	if revision == s.snapshotRevision {
+		return nil
+	}
+
+	snap := s.collectSnapshot()
+	err := writeFileAtomic(s.snapshotPath, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(snap)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	if s.wal != nil {
+		if err := s.wal.compact(snap.WALSeq); err != nil {
+			return fmt.Errorf("failed to compact wal: %w", err)
+		}
+	}
+
+	s.snapshotRevision = revision
+	return nil
+}
+
+// Собирает согласованный срез данных, захватывая мьютексы в том же порядке, что и CreateComment.
+// Записи копируются, так как HasReplies и Read могут меняться после освобождения мьютексов
+func (s *InMemoryStorage) collectSnapshot() *snapshot {
+	s.commentMu.RLock()
+	defer s.commentMu.RUnlock()
+	s.hierarchyMu.RLock()
+	defer s.hierarchyMu.RUnlock()
+	s.postMu.RLock()
+	defer s.postMu.RUnlock()
+	s.notificationMu.RLock()
+	defer s.notificationMu.RUnlock()
+	s.idempotencyMu.Lock()
+	defer s.idempotencyMu.Unlock()
+
+	snap := &snapshot{
+		Version:             snapshotVersion,
+		CreatedAt:           time.Now(),
+		PostCounter:         s.postCounter,
+		CommentCounter:      s.commentCounter,
+		NotificationCounter: s.notificationCounter,
+		Posts:               make([]models.Post, 0, len(s.posts)),
+		Comments:            make([]models.Comment, 0, len(s.commentIndex)),
+		CommentHierarchy:    make(map[int][]int, len(s.commentHierarchy)),
+	}
+	// все записи в журнал делаются под мьютексами данных, поэтому номер согласован со снапшотом
+	if s.wal != nil {
+		snap.WALSeq = s.wal.lastSeq()
+	}
+
+	for _, post := range s.posts {
+		snap.Posts = append(snap.Posts, *post)
+	}
+	sort.Slice(snap.Posts, func(i, j int) bool { return snap.Posts[i].ID < snap.Posts[j].ID })
+	for _, post := range snap.Posts {
+		for _, revision := range s.revisions[post.ID] {
+			snap.Revisions = append(snap.Revisions, *revision)
+		}
+	}
+
+	for _, comment := range s.commentIndex {
+		snap.Comments = append(snap.Comments, *comment)
+	}
+	sort.Slice(snap.Comments, func(i, j int) bool { return snap.Comments[i].ID < snap.Comments[j].ID })
+
+	for parentID, replies := range s.commentHierarchy {
+		for _, reply := range replies {
+			snap.CommentHierarchy[parentID] = append(snap.CommentHierarchy[parentID], reply.ID)
+		}
+	}
+
+	for _, inbox := range s.notifications {
+		for _, n := range inbox {
+			snap.Notifications = append(snap.Notifications, *n)
+		}
+	}
+	sort.Slice(snap.Notifications, func(i, j int) bool { return snap.Notifications[i].ID < snap.Notifications[j].ID })
+
+	for id, k := range s.idempotencyKeys {
+		if k.ResultID != 0 && k.ExpiresAt.After(snap.CreatedAt) {
+			snap.IdempotencyKeys = append(snap.IdempotencyKeys, idempotencyRecordOf(id, k))
+		}
+	}
+	sort.Slice(snap.IdempotencyKeys, func(i, j int) bool {
+		a, b := snap.IdempotencyKeys[i], snap.IdempotencyKeys[j]
+		if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		if a.Scope != b.Scope {
+			return a.Scope < b.Scope
+		}
+		return a.Key < b.Key
+	})
+
+	return snap
+}
+
+// Загружает снапшот в пустое хранилище и возвращает номер последней вошедшей в него записи журнала.
+// Отсутствие файла не считается ошибкой
+func (s *InMemoryStorage) loadSnapshot(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return 0, fmt.Errorf("failed to parse snapshot %s: %w", path, err)
+	}
+	if snap.Version < 1 || snap.Version > snapshotVersion {
+		return 0, fmt.Errorf("%w: %d", ErrUnsupportedSnapshot, snap.Version)
+	}
+
+	s.restoreSnapshot(&snap)
+	return snap.WALSeq, nil
+}
+
+// Раскладывает данные снапшота по хеш-таблицам и заново строит производные индексы
+func (s *InMemoryStorage) restoreSnapshot(snap *snapshot) {
+	for i := range snap.Revisions {
+		revision := &snap.Revisions[i]
+		s.revisions[revision.PostID] = append(s.revisions[revision.PostID], revision)
+	}
+	for i := range snap.Posts {
+		post := &snap.Posts[i]
+		// в снапшотах, сделанных до появления ревизий, у поста нет версии и истории
+		if post.Version == 0 {
+			post.Version = 1
+		}
+		// а до появления статусов все посты были опубликованы сразу при создании
+		post.SetDefaultStatus(post.CreatedAt)
+		// и до появления арендаторов все записи принадлежали одному сайту
+		post.TenantID = models.TenantOrDefault(post.TenantID)
+		if len(s.revisions[post.ID]) == 0 {
+			revision := models.RevisionOf(post, post.CreatedAt)
+			s.revisions[post.ID] = []*models.PostRevision{&revision}
+		}
+		s.posts[post.ID] = post
+		s.indexPost(post)
+		if post.Thread != nil {
+			s.threads[threadID{tenant: post.TenantID, key: *post.Thread}] = post.ID
+		}
+	}
+
+	replies := make(map[int]struct{})
+	for _, children := range snap.CommentHierarchy {
+		for _, childID := range children {
+			replies[childID] = struct{}{}
+		}
+	}
+
+	for i := range snap.Comments {
+		comment := &snap.Comments[i]
+		comment.TenantID = models.TenantOrDefault(comment.TenantID)
+		s.commentIndex[comment.ID] = comment
+		if _, isReply := replies[comment.ID]; !isReply {
+			s.comments[comment.PostID] = append(s.comments[comment.PostID], comment)
+		}
+		for _, handle := range comment.Mentions {
+			s.mentions[handle] = append(s.mentions[handle], comment)
+		}
+		s.indexComment(comment)
+	}
+
+	for parentID, children := range snap.CommentHierarchy {
+		for _, childID := range children {
+			if comment, ok := s.commentIndex[childID]; ok {
+				s.commentHierarchy[parentID] = append(s.commentHierarchy[parentID], comment)
+			}
+		}
+	}
+
+	for i := range snap.Notifications {
+		n := &snap.Notifications[i]
+		n.TenantID = models.TenantOrDefault(n.TenantID)
+		s.notifications[n.Recipient] = append(s.notifications[n.Recipient], n)
+	}
+
+	now := time.Now()
+	for i := range snap.IdempotencyKeys {
+		if snap.IdempotencyKeys[i].ExpiresAt.After(now) {
+			s.applyIdempotencyKey(&snap.IdempotencyKeys[i])
+		}
+	}
+
+	s.postCounter = snap.PostCounter
+	s.commentCounter = snap.CommentCounter
+	s.notificationCounter = snap.NotificationCounter
+}
+
+// Периодически сохраняет снапшоты, пока не закрыт канал stop
+func (s *InMemoryStorage) runSnapshots(interval time.Duration) {
+	defer close(s.snapshotDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil {
+				log.Error().Err(err).Str("path", s.snapshotPath).Msg("failed to write snapshot")
+			}
+		case <-s.snapshotStop:
+			return
+		}
+	}
+}
+
+// отмечает изменение данных, чтобы следующий снапшот не был пропущен
+func (s *InMemoryStorage) touch() {
+	atomic.AddUint64(&s.revision, 1)
+}
+
+// Пишет содержимое через write во временный файл в той же директории, сбрасывает его на диск
+// и переименовывает поверх path
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// переименование и создание файла становятся надежными только после fsync директории
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
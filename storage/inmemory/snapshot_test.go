@@ -0,0 +1,129 @@
+package inmemory
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"graphql-comments/config"
+	"graphql-comments/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	cfg := &config.Config{SnapshotPath: filepath.Join(t.TempDir(), "snapshot.json")}
+	ctx := context.Background()
+
+	storage, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+
+	post, err := storage.CreatePost(ctx, models.Post{Title: "Снапшоты", Author: "alice", Content: "переживают рестарт", AllowComments: true})
+	assert.NoError(t, err)
+	root, err := storage.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "bob", Text: "привет @alice", Mentions: []string{"alice"}}, nil)
+	assert.NoError(t, err)
+	reply, err := storage.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "alice", Text: "ответ"}, &root.ID)
+	assert.NoError(t, err)
+	_, err = storage.CreateNotification(ctx, models.Notification{Recipient: "alice", Type: models.NotificationTypeMention, Actor: "bob", PostID: post.ID})
+	assert.NoError(t, err)
+
+	// снапшот пишется при закрытии
+	assert.NoError(t, storage.Close())
+
+	restored, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	gotPost, err := restored.GetPost(ctx, post.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, post.Title, gotPost.Title)
+
+	roots, err := restored.GetComments(ctx, post.ID, nil, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, roots, 1)
+	assert.True(t, roots[0].HasReplies)
+
+	replies, err := restored.GetComments(ctx, post.ID, &root.ID, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, replies, 1)
+	assert.Equal(t, reply.ID, replies[0].ID)
+
+	mentions, err := restored.GetMentions(ctx, "alice", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, mentions, 1)
+
+	notifications, err := restored.GetNotifications(ctx, "alice", 10, 0, false)
+	assert.NoError(t, err)
+	assert.Len(t, notifications, 1)
+
+	results, err := restored.Search(ctx, models.SearchQuery{Text: "рестарт", Scope: models.SearchScopeAll, Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	// счетчики восстановлены, новые id не пересекаются со старыми
+	next, err := restored.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "carol", Text: "еще"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, reply.ID+1, next.ID)
+}
+
+func TestSnapshotMissingFile(t *testing.T) {
+	cfg := &config.Config{SnapshotPath: filepath.Join(t.TempDir(), "snapshot.json")}
+
+	storage, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+
+	posts, err := storage.GetPosts(context.Background(), models.PostFilter{})
+	assert.NoError(t, err)
+	assert.Empty(t, posts)
+
+	// пустое хранилище без изменений не пишет файл
+	assert.NoError(t, storage.Close())
+	_, err = os.Stat(cfg.SnapshotPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSnapshotUnsupportedVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	data, err := json.Marshal(snapshot{Version: snapshotVersion + 1})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+
+	_, err = NewMemoryStorage(&config.Config{SnapshotPath: path})
+	assert.ErrorIs(t, err, ErrUnsupportedSnapshot)
+}
+
+func TestSnapshotPreviousVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	content := `{"version":1,"postCounter":1,"posts":[{"id":1,"title":"Старый","createdAt":"2024-01-01T00:00:00Z"}]}`
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	storage, err := NewMemoryStorage(&config.Config{SnapshotPath: path})
+	assert.NoError(t, err)
+	post, err := storage.GetPost(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Старый", post.Title)
+	assert.Equal(t, models.DefaultTenant, post.TenantID)
+}
+
+func TestPeriodicSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{SnapshotPath: filepath.Join(dir, "snapshot.json"), SnapshotInterval: 10 * time.Millisecond}
+
+	storage, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+	defer storage.Close()
+
+	_, err = storage.CreatePost(context.Background(), models.Post{Title: "Тест"})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(cfg.SnapshotPath)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	// временные файлы не остаются рядом со снапшотом
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
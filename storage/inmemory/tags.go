@@ -0,0 +1,71 @@
+package inmemory
+
+import (
+	"context"
+	"graphql-comments/models"
+)
+
+func (s *InMemoryStorage) UpdatePostTags(ctx context.Context, postID int, add, remove []string) (models.Post, error) {
+	s.postMu.Lock()
+	defer s.postMu.Unlock()
+
+	current, exists := s.tenantPost(ctx, postID)
+	if !exists {
+		return models.Post{}, ErrPostNotFound
+	}
+
+	updated := *current
+	updated.Tags = models.MergeTags(current.Tags, add, remove)
+
+	if err := s.logWrite(&walRecord{Op: opUpdatePostTags, Post: &updated}); err != nil {
+		return *current, err
+	}
+	s.applyReplacePost(&updated)
+	s.touch()
+
+	return updated, nil
+}
+
+func (s *InMemoryStorage) SetPostCategory(ctx context.Context, postID int, category string) (models.Post, error) {
+	s.postMu.Lock()
+	defer s.postMu.Unlock()
+
+	current, exists := s.tenantPost(ctx, postID)
+	if !exists {
+		return models.Post{}, ErrPostNotFound
+	}
+
+	updated := *current
+	updated.Category = category
+
+	if err := s.logWrite(&walRecord{Op: opSetPostCategory, Post: &updated}); err != nil {
+		return *current, err
+	}
+	s.applyReplacePost(&updated)
+	s.touch()
+
+	return updated, nil
+}
+
+func (s *InMemoryStorage) GetTags(ctx context.Context) ([]models.TagCount, error) {
+	s.postMu.RLock()
+	defer s.postMu.RUnlock()
+
+	tenant := models.TenantFromContext(ctx)
+	counts := make(map[string]int)
+	for _, post := range s.posts {
+		if post.Status != models.PostStatusPublished || post.TenantID != tenant {
+			continue
+		}
+		for _, tag := range post.Tags {
+			counts[tag]++
+		}
+	}
+
+	tags := make([]models.TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, models.TagCount{Tag: tag, Count: count})
+	}
+	models.SortTagCounts(tags)
+	return tags, nil
+}
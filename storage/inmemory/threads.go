@@ -0,0 +1,38 @@
+package inmemory
+
+import (
+	"context"
+	"graphql-comments/models"
+)
+
+// у каждого арендатора свое пространство ключей тредов
+type threadID struct {
+	tenant string
+	key    models.ThreadKey
+}
+
+func (s *InMemoryStorage) GetThread(ctx context.Context, key models.ThreadKey) (*models.Post, error) {
+	s.postMu.RLock()
+	defer s.postMu.RUnlock()
+
+	id, exists := s.threads[threadID{tenant: models.TenantFromContext(ctx), key: key}]
+	if !exists {
+		return nil, ErrThreadNotFound
+	}
+	return s.posts[id], nil
+}
+
+// Поиск и создание идут под одной блокировкой postMu, поэтому два первых комментария
+// к одному ресурсу не создадут два треда
+func (s *InMemoryStorage) GetOrCreateThread(ctx context.Context, key models.ThreadKey) (models.Post, error) {
+	s.postMu.Lock()
+	defer s.postMu.Unlock()
+
+	tenant := models.TenantFromContext(ctx)
+	if id, exists := s.threads[threadID{tenant: tenant, key: key}]; exists {
+		return *s.posts[id], nil
+	}
+	p := models.NewThreadPost(key)
+	p.TenantID = tenant
+	return s.createPost(p)
+}
@@ -0,0 +1,257 @@
+package inmemory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"graphql-comments/models"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrCorruptedWAL = errors.New("corrupted wal")
+	// журнал очищается только после снапшота, без него файл журнала растет бесконечно
+	ErrWALWithoutSnapshot = errors.New("WAL_PATH requires SNAPSHOT_PATH: the wal is compacted only after a snapshot")
+)
+
+// операции, которые пишутся в журнал
+const (
+	opCreatePost             = "createPost"
+	opUpdatePost             = "updatePost"
+	opSetPostStatus          = "setPostStatus"
+	opUpdatePostTags         = "updatePostTags"
+	opSetPostCategory        = "setPostCategory"
+	opCreateComment          = "createComment"
+	opCreateNotification     = "createNotification"
+	opMarkNotificationsRead  = "markNotificationsRead"
+	opCompleteIdempotencyKey = "completeIdempotencyKey"
+)
+
+// структура описывает одну запись журнала, каждая запись хранится в файле отдельной JSON строкой
+type walRecord struct {
+	Seq            uint64               `json:"seq"`
+	Op             string               `json:"op"`
+	Post           *models.Post         `json:"post,omitempty"`
+	Revision       *models.PostRevision `json:"revision,omitempty"`
+	Comment        *models.Comment      `json:"comment,omitempty"`
+	Notification   *models.Notification `json:"notification,omitempty"`
+	Recipient      string               `json:"recipient,omitempty"`
+	IDs            []int                `json:"ids,omitempty"`
+	IdempotencyKey *idempotencyRecord   `json:"idempotencyKey,omitempty"`
+}
+
+// журнал упреждающей записи: запись считается подтвержденной только после fsync файла
+type wal struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64  // размер файла без недописанного хвоста
+	seq  uint64 // номер последней записи
+}
+
+// Открывает журнал и передает в apply все записи с номером больше afterSeq.
+// Недописанная последняя строка остается от падения во время записи, она отбрасывается
+func openWAL(path string, afterSeq uint64, apply func(*walRecord) error) (*wal, error) {
+	_, statErr := os.Stat(path)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if errors.Is(statErr, os.ErrNotExist) {
+		if err := syncDir(filepath.Dir(path)); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	w := &wal{path: path, file: file, seq: afterSeq}
+	size, torn, err := readWAL(file, func(rec *walRecord, _ []byte) error {
+		if rec.Seq > w.seq {
+			w.seq = rec.Seq
+		}
+		if rec.Seq <= afterSeq {
+			return nil
+		}
+		return apply(rec)
+	})
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to replay wal %s: %w", path, err)
+	}
+
+	if torn {
+		log.Warn().Str("path", path).Int64("offset", size).Msg("dropping torn tail of wal")
+		if err := file.Truncate(size); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	w.size = size
+
+	return w, nil
+}
+
+// Дописывает запись в конец журнала и ждет fsync, присваивая ей следующий номер
+func (w *wal) append(rec *walRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	rec.Seq = w.seq + 1
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if _, err := w.file.Write(data); err != nil {
+		// не оставляем после себя недописанную строку
+		w.file.Truncate(w.size)
+		return fmt.Errorf("failed to write wal: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Truncate(w.size)
+		return fmt.Errorf("failed to sync wal: %w", err)
+	}
+
+	w.size += int64(len(data))
+	w.seq = rec.Seq
+	return nil
+}
+
+// номер последней записи в журнале
+func (w *wal) lastSeq() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.seq
+}
+
+// Удаляет из журнала записи с номером не больше upTo, которые уже вошли в снапшот.
+// Оставшиеся записи переписываются в новый файл, который атомарно заменяет старый
+func (w *wal) compact(upTo uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var kept bytes.Buffer
+	_, _, err := readWAL(io.LimitReader(w.file, w.size), func(rec *walRecord, line []byte) error {
+		if rec.Seq > upTo {
+			kept.Write(line)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(w.path, func(dst io.Writer) error {
+		_, err := dst.Write(kept.Bytes())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(w.path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	w.file.Close()
+	w.file = file
+	w.size = int64(kept.Len())
+	return nil
+}
+
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Close()
+}
+
+// Читает записи журнала и передает их в fn вместе с исходной строкой.
+// Возвращает размер корректной части и признак недописанного хвоста.
+// Нечитаемая запись в середине журнала считается повреждением
+func readWAL(r io.Reader, fn func(rec *walRecord, line []byte) error) (int64, bool, error) {
+	reader := bufio.NewReader(r)
+	var size int64
+	var prevSeq uint64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// строка без перевода строки в конце файла недописана
+			return size, len(line) > 0, nil
+		}
+		if err != nil {
+			return size, false, err
+		}
+
+		var rec walRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			rest, readErr := io.ReadAll(reader)
+			if readErr != nil {
+				return size, false, readErr
+			}
+			if len(bytes.TrimSpace(rest)) == 0 {
+				return size, true, nil
+			}
+			return size, false, fmt.Errorf("%w: bad record at offset %d", ErrCorruptedWAL, size)
+		}
+		if rec.Seq <= prevSeq {
+			return size, false, fmt.Errorf("%w: sequence %d after %d", ErrCorruptedWAL, rec.Seq, prevSeq)
+		}
+		prevSeq = rec.Seq
+
+		if err := fn(&rec, line); err != nil {
+			return size, false, err
+		}
+		size += int64(len(line))
+	}
+}
+
+// Пишет запись в журнал, если он включен. Вызывается под мьютексами изменяемых данных до их изменения
+func (s *InMemoryStorage) logWrite(rec *walRecord) error {
+	if s.wal == nil {
+		return nil
+	}
+	return s.wal.append(rec)
+}
+
+// Применяет запись журнала при старте хранилища
+func (s *InMemoryStorage) replay(rec *walRecord) error {
+	switch {
+	case rec.Op == opCreatePost && rec.Post != nil:
+		s.applyPost(rec.Post)
+	case rec.Op == opUpdatePost && rec.Post != nil && rec.Revision != nil:
+		s.applyUpdatePost(rec.Post, rec.Revision)
+	case (rec.Op == opSetPostStatus || rec.Op == opUpdatePostTags || rec.Op == opSetPostCategory) && rec.Post != nil:
+		s.applyReplacePost(rec.Post)
+	case rec.Op == opCreateComment && rec.Comment != nil:
+		s.applyComment(rec.Comment)
+	case rec.Op == opCreateNotification && rec.Notification != nil:
+		s.applyNotification(rec.Notification)
+	case rec.Op == opMarkNotificationsRead:
+		s.applyMarkRead(rec.Recipient, rec.IDs)
+	case rec.Op == opCompleteIdempotencyKey && rec.IdempotencyKey != nil:
+		s.applyIdempotencyKey(rec.IdempotencyKey)
+	default:
+		return fmt.Errorf("%w: unknown operation %q in record %d", ErrCorruptedWAL, rec.Op, rec.Seq)
+	}
+	// после проигрывания журнала следующий снапшот не должен быть пропущен
+	s.touch()
+	return nil
+}
@@ -0,0 +1,322 @@
+package inmemory
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"graphql-comments/config"
+	"graphql-comments/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// эмулирует падение процесса: файлы не закрываются и финальный снапшот не пишется
+func crash(s *InMemoryStorage) {
+	if s.wal != nil {
+		s.wal.file.Close()
+	}
+}
+
+// журнал работает только поверх снапшота
+func walConfig(t *testing.T) *config.Config {
+	dir := t.TempDir()
+	return &config.Config{SnapshotPath: filepath.Join(dir, "snapshot.json"), WALPath: filepath.Join(dir, "wal.jsonl")}
+}
+
+func TestWALRequiresSnapshot(t *testing.T) {
+	_, err := NewMemoryStorage(&config.Config{WALPath: filepath.Join(t.TempDir(), "wal.jsonl")})
+	assert.ErrorIs(t, err, ErrWALWithoutSnapshot)
+}
+
+func TestWALReplay(t *testing.T) {
+	cfg := walConfig(t)
+	ctx := context.Background()
+
+	storage, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+
+	post, err := storage.CreatePost(ctx, models.Post{Title: "Журнал", Author: "alice", AllowComments: true})
+	assert.NoError(t, err)
+	root, err := storage.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "bob", Text: "привет @alice", Mentions: []string{"alice"}}, nil)
+	assert.NoError(t, err)
+	_, err = storage.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "alice", Text: "ответ"}, &root.ID)
+	assert.NoError(t, err)
+	n, err := storage.CreateNotification(ctx, models.Notification{Recipient: "alice", Type: models.NotificationTypeMention, Actor: "bob", PostID: post.ID})
+	assert.NoError(t, err)
+	marked, err := storage.MarkNotificationsRead(ctx, "alice", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, marked)
+	crash(storage)
+
+	restored, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	roots, err := restored.GetComments(ctx, post.ID, nil, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, roots, 1)
+	assert.True(t, roots[0].HasReplies)
+
+	replies, err := restored.GetComments(ctx, post.ID, &root.ID, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, replies, 1)
+
+	mentions, err := restored.GetMentions(ctx, "alice", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, mentions, 1)
+
+	notifications, err := restored.GetNotifications(ctx, "alice", 10, 0, false)
+	assert.NoError(t, err)
+	assert.Len(t, notifications, 1)
+	assert.Equal(t, n.ID, notifications[0].ID)
+	assert.True(t, notifications[0].Read)
+
+	next, err := restored.CreatePost(ctx, models.Post{Title: "Следующий"})
+	assert.NoError(t, err)
+	assert.Equal(t, post.ID+1, next.ID)
+}
+
+func TestWALOnTopOfSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{SnapshotPath: filepath.Join(dir, "snapshot.json"), WALPath: filepath.Join(dir, "wal.jsonl")}
+	ctx := context.Background()
+
+	storage, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+
+	first, err := storage.CreatePost(ctx, models.Post{Title: "До снапшота"})
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Snapshot())
+
+	// записи, вошедшие в снапшот, удалены из журнала
+	data, err := os.ReadFile(cfg.WALPath)
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+
+	second, err := storage.CreatePost(ctx, models.Post{Title: "После снапшота"})
+	assert.NoError(t, err)
+	crash(storage)
+
+	restored, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	posts, err := restored.GetPosts(ctx, models.PostFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, posts, 2)
+
+	_, err = restored.GetPost(ctx, first.ID)
+	assert.NoError(t, err)
+	_, err = restored.GetPost(ctx, second.ID)
+	assert.NoError(t, err)
+}
+
+func TestWALTornTail(t *testing.T) {
+	cfg := walConfig(t)
+	ctx := context.Background()
+
+	storage, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+	_, err = storage.CreatePost(ctx, models.Post{Title: "Целый"})
+	assert.NoError(t, err)
+	crash(storage)
+
+	// падение посреди записи оставляет недописанную строку
+	f, err := os.OpenFile(cfg.WALPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"seq":2,"op":"createPo`)
+	assert.NoError(t, err)
+	f.Close()
+
+	restored, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+
+	posts, err := restored.GetPosts(ctx, models.PostFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, posts, 1)
+
+	// новая запись пишется с начала строки
+	_, err = restored.CreatePost(ctx, models.Post{Title: "Новый"})
+	assert.NoError(t, err)
+	crash(restored) // Close сжал бы журнал после снапшота
+
+	data, err := os.ReadFile(cfg.WALPath)
+	assert.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 2)
+}
+
+func TestWALCorruptedRecord(t *testing.T) {
+	cfg := walConfig(t)
+	content := `{"seq":1,"op":"createPost","post":{"id":1}}` + "\n" + "мусор\n" + `{"seq":3,"op":"createPost","post":{"id":2}}` + "\n"
+	assert.NoError(t, os.WriteFile(cfg.WALPath, []byte(content), 0o644))
+
+	_, err := NewMemoryStorage(cfg)
+	assert.ErrorIs(t, err, ErrCorruptedWAL)
+}
+
+func TestWALReplayPostRevisions(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{WALPath: filepath.Join(dir, "wal.jsonl"), SnapshotPath: filepath.Join(dir, "snapshot.json")}
+	ctx := context.Background()
+
+	storage, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+	post, err := storage.CreatePost(ctx, models.Post{Title: "Журнал", Content: "первая", Author: "alice"})
+	assert.NoError(t, err)
+	post.Content = "вторая"
+	_, err = storage.UpdatePost(ctx, post, 1)
+	assert.NoError(t, err)
+	// правка до снапшота восстанавливается из него, а после из журнала
+	assert.NoError(t, storage.Snapshot())
+	post.Content = "третья"
+	_, err = storage.UpdatePost(ctx, post, 2)
+	assert.NoError(t, err)
+	crash(storage)
+
+	restored, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	got, err := restored.GetPost(ctx, post.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, got.Version)
+	assert.Equal(t, "третья", got.Content)
+
+	revisions, err := restored.GetPostRevisions(ctx, post.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, revisions, 3) {
+		assert.Equal(t, "первая", revisions[0].Content)
+		assert.Equal(t, "вторая", revisions[1].Content)
+	}
+
+	results, err := restored.Search(ctx, models.SearchQuery{Text: "вторая", Scope: models.SearchScopePosts, Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestWALReplayPostStatus(t *testing.T) {
+	cfg := walConfig(t)
+	ctx := context.Background()
+
+	storage, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+	later := time.Now().Add(time.Hour)
+	scheduled, err := storage.CreatePost(ctx, models.Post{Title: "Позже", Status: models.PostStatusScheduled, PublishAt: &later})
+	assert.NoError(t, err)
+	draft, err := storage.CreatePost(ctx, models.Post{Title: "Черновик", Status: models.PostStatusDraft})
+	assert.NoError(t, err)
+	_, err = storage.PublishDuePosts(ctx, later)
+	assert.NoError(t, err)
+	_, err = storage.SetPostStatus(ctx, draft.ID, models.PostStatusScheduled, &later)
+	assert.NoError(t, err)
+	crash(storage)
+
+	restored, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	got, err := restored.GetPost(ctx, scheduled.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.PostStatusPublished, got.Status)
+	got, err = restored.GetPost(ctx, draft.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.PostStatusScheduled, got.Status)
+	if assert.NotNil(t, got.PublishAt) {
+		assert.True(t, later.Equal(*got.PublishAt))
+	}
+}
+
+func TestWALReplayPostTags(t *testing.T) {
+	cfg := walConfig(t)
+	ctx := context.Background()
+
+	storage, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+	post, err := storage.CreatePost(ctx, models.Post{Title: "Теги", Tags: []string{"go"}})
+	assert.NoError(t, err)
+	_, err = storage.UpdatePostTags(ctx, post.ID, []string{"sql"}, []string{"go"})
+	assert.NoError(t, err)
+	_, err = storage.SetPostCategory(ctx, post.ID, "разработка")
+	assert.NoError(t, err)
+	crash(storage)
+
+	restored, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	got, err := restored.GetPost(ctx, post.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sql"}, got.Tags)
+	assert.Equal(t, "разработка", got.Category)
+}
+
+func TestWALReplayThreads(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{WALPath: filepath.Join(dir, "wal.jsonl"), SnapshotPath: filepath.Join(dir, "snapshot.json")}
+	ctx := context.Background()
+
+	storage, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+	// один тред восстанавливается из снапшота, другой из журнала
+	first, err := storage.GetOrCreateThread(ctx, models.ThreadKey{Namespace: "blog", Key: "a"})
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Snapshot())
+	second, err := storage.GetOrCreateThread(ctx, models.ThreadKey{Namespace: "blog", Key: "b"})
+	assert.NoError(t, err)
+	crash(storage)
+
+	restored, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	got, err := restored.GetOrCreateThread(ctx, models.ThreadKey{Namespace: "blog", Key: "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, first.ID, got.ID)
+	got, err = restored.GetOrCreateThread(ctx, models.ThreadKey{Namespace: "blog", Key: "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, second.ID, got.ID)
+}
+
+func TestWALReplayIdempotencyKeys(t *testing.T) {
+	cfg := walConfig(t)
+	ctx := models.WithTenant(context.Background(), "shop")
+	key := func(name string) models.IdempotencyKey {
+		return models.IdempotencyKey{Scope: models.IdempotencyScopeCreatePost, Key: name, RequestHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+	}
+
+	storage, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+	// один ключ восстанавливается из снапшота, другой из журнала, а незавершенный теряется
+	for _, name := range []string{"a", "b", "pending"} {
+		existing, err := storage.ReserveIdempotencyKey(ctx, key(name))
+		assert.NoError(t, err)
+		assert.Nil(t, existing)
+	}
+	assert.NoError(t, storage.CompleteIdempotencyKey(ctx, models.IdempotencyScopeCreatePost, "a", 1))
+	assert.NoError(t, storage.Snapshot())
+	assert.NoError(t, storage.CompleteIdempotencyKey(ctx, models.IdempotencyScopeCreatePost, "b", 2))
+	crash(storage)
+
+	restored, err := NewMemoryStorage(cfg)
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	for name, resultID := range map[string]int{"a": 1, "b": 2} {
+		existing, err := restored.ReserveIdempotencyKey(ctx, key(name))
+		assert.NoError(t, err)
+		if assert.NotNil(t, existing, name) {
+			assert.Equal(t, resultID, existing.ResultID)
+			assert.Equal(t, "hash", existing.RequestHash)
+		}
+	}
+	existing, err := restored.ReserveIdempotencyKey(ctx, key("pending"))
+	assert.NoError(t, err)
+	assert.Nil(t, existing)
+
+	// ключ принадлежит сайту, на котором был выполнен запрос
+	existing, err = restored.ReserveIdempotencyKey(context.Background(), key("a"))
+	assert.NoError(t, err)
+	assert.Nil(t, existing)
+}
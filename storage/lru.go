@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"container/list"
+	"time"
+)
+
+// LRU кеш с ограничением времени жизни записей. Не потокобезопасен, защищается мьютексом владельца
+type lru struct {
+	size    int
+	ttl     time.Duration
+	ll      *list.List // от недавно использованных к давно использованным
+	items   map[cacheKey]*list.Element
+	onEvict func(key cacheKey) // вызывается при любом удалении записи
+}
+
+type lruEntry struct {
+	key     cacheKey
+	value   interface{}
+	expires time.Time
+}
+
+func newLRU(size int, ttl time.Duration, onEvict func(key cacheKey)) *lru {
+	return &lru{
+		size:    size,
+		ttl:     ttl,
+		ll:      list.New(),
+		items:   make(map[cacheKey]*list.Element),
+		onEvict: onEvict,
+	}
+}
+
+// Возвращает живую запись и поднимает ее в начало списка, просроченная запись удаляется
+func (c *lru) get(key cacheKey) (interface{}, bool) {
+	value, ok := c.peek(key)
+	if ok {
+		c.ll.MoveToFront(c.items[key])
+	}
+	return value, ok
+}
+
+// Возвращает живую запись, не меняя порядок вытеснения
+func (c *lru) peek(key cacheKey) (interface{}, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := el.Value.(*lruEntry)
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.removeElement(el)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *lru) add(key cacheKey, value interface{}) {
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+
+	el := c.ll.PushFront(&lruEntry{key: key, value: value, expires: time.Now().Add(c.ttl)})
+	c.items[key] = el
+
+	for c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *lru) remove(key cacheKey) {
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// Удаляет все записи, onEvict вызывается для каждой
+func (c *lru) purge() {
+	for c.ll.Len() > 0 {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *lru) removeElement(el *list.Element) {
+	entry := c.ll.Remove(el).(*lruEntry)
+	delete(c.items, entry.key)
+	if c.onEvict != nil {
+		c.onEvict(entry.key)
+	}
+}
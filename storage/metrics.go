@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"graphql-comments/metrics"
+	"graphql-comments/models"
+	"time"
+)
+
+// MetricsStorage оборачивает любое хранилище и измеряет время и ошибки каждого вызова
+type MetricsStorage struct {
+	next Storager
+}
+
+// Конструктор обертки с метриками над next
+func NewMetricsStorage(next Storager) *MetricsStorage {
+	return &MetricsStorage{next: next}
+}
+
+func (s *MetricsStorage) CreatePost(ctx context.Context, p models.Post) (post models.Post, err error) {
+	defer observe("CreatePost", time.Now(), &err)
+	return s.next.CreatePost(ctx, p)
+}
+
+func (s *MetricsStorage) UpdatePost(ctx context.Context, p models.Post, expectedVersion int) (post models.Post, err error) {
+	defer observe("UpdatePost", time.Now(), &err)
+	return s.next.UpdatePost(ctx, p, expectedVersion)
+}
+
+func (s *MetricsStorage) GetPostRevisions(ctx context.Context, postID int) (revisions []*models.PostRevision, err error) {
+	defer observe("GetPostRevisions", time.Now(), &err)
+	return s.next.GetPostRevisions(ctx, postID)
+}
+
+func (s *MetricsStorage) SetPostStatus(ctx context.Context, id int, status models.PostStatus, publishAt *time.Time) (post models.Post, err error) {
+	defer observe("SetPostStatus", time.Now(), &err)
+	return s.next.SetPostStatus(ctx, id, status, publishAt)
+}
+
+func (s *MetricsStorage) PublishDuePosts(ctx context.Context, now time.Time) (published []models.Post, err error) {
+	defer observe("PublishDuePosts", time.Now(), &err)
+	return s.next.PublishDuePosts(ctx, now)
+}
+
+func (s *MetricsStorage) UpdatePostTags(ctx context.Context, postID int, add, remove []string) (post models.Post, err error) {
+	defer observe("UpdatePostTags", time.Now(), &err)
+	return s.next.UpdatePostTags(ctx, postID, add, remove)
+}
+
+func (s *MetricsStorage) SetPostCategory(ctx context.Context, postID int, category string) (post models.Post, err error) {
+	defer observe("SetPostCategory", time.Now(), &err)
+	return s.next.SetPostCategory(ctx, postID, category)
+}
+
+func (s *MetricsStorage) GetTags(ctx context.Context) (tags []models.TagCount, err error) {
+	defer observe("GetTags", time.Now(), &err)
+	return s.next.GetTags(ctx)
+}
+
+func (s *MetricsStorage) GetThread(ctx context.Context, key models.ThreadKey) (post *models.Post, err error) {
+	defer observe("GetThread", time.Now(), &err)
+	return s.next.GetThread(ctx, key)
+}
+
+func (s *MetricsStorage) GetOrCreateThread(ctx context.Context, key models.ThreadKey) (post models.Post, err error) {
+	defer observe("GetOrCreateThread", time.Now(), &err)
+	return s.next.GetOrCreateThread(ctx, key)
+}
+
+func (s *MetricsStorage) CreateComment(ctx context.Context, c models.Comment, parentID *int) (comment models.Comment, err error) {
+	defer observe("CreateComment", time.Now(), &err)
+	return s.next.CreateComment(ctx, c, parentID)
+}
+
+func (s *MetricsStorage) ImportPosts(ctx context.Context, posts []models.Post) (imported []models.Post, err error) {
+	defer observe("ImportPosts", time.Now(), &err)
+	return s.next.ImportPosts(ctx, posts)
+}
+
+func (s *MetricsStorage) ImportComments(ctx context.Context, comments []models.Comment) (imported []models.Comment, err error) {
+	defer observe("ImportComments", time.Now(), &err)
+	return s.next.ImportComments(ctx, comments)
+}
+
+func (s *MetricsStorage) GetPost(ctx context.Context, id int) (post *models.Post, err error) {
+	defer observe("GetPost", time.Now(), &err)
+	return s.next.GetPost(ctx, id)
+}
+
+func (s *MetricsStorage) GetComment(ctx context.Context, id int) (comment *models.Comment, err error) {
+	defer observe("GetComment", time.Now(), &err)
+	return s.next.GetComment(ctx, id)
+}
+
+func (s *MetricsStorage) GetPosts(ctx context.Context, filter models.PostFilter) (posts []*models.Post, err error) {
+	defer observe("GetPosts", time.Now(), &err)
+	return s.next.GetPosts(ctx, filter)
+}
+
+func (s *MetricsStorage) GetComments(ctx context.Context, postID int, parentID *int, limit, afterID int) (comments []*models.Comment, err error) {
+	defer observe("GetComments", time.Now(), &err)
+	return s.next.GetComments(ctx, postID, parentID, limit, afterID)
+}
+
+func (s *MetricsStorage) GetMentions(ctx context.Context, handle string, limit, afterID int) (comments []*models.Comment, err error) {
+	defer observe("GetMentions", time.Now(), &err)
+	return s.next.GetMentions(ctx, handle, limit, afterID)
+}
+
+func (s *MetricsStorage) Search(ctx context.Context, q models.SearchQuery) (results []*models.SearchResult, err error) {
+	defer observe("Search", time.Now(), &err)
+	return s.next.Search(ctx, q)
+}
+
+func (s *MetricsStorage) CreateNotification(ctx context.Context, n models.Notification) (notification models.Notification, err error) {
+	defer observe("CreateNotification", time.Now(), &err)
+	return s.next.CreateNotification(ctx, n)
+}
+
+func (s *MetricsStorage) GetNotifications(ctx context.Context, recipient string, limit, beforeID int, unreadOnly bool) (notifications []*models.Notification, err error) {
+	defer observe("GetNotifications", time.Now(), &err)
+	return s.next.GetNotifications(ctx, recipient, limit, beforeID, unreadOnly)
+}
+
+func (s *MetricsStorage) MarkNotificationsRead(ctx context.Context, recipient string, ids []int) (marked int, err error) {
+	defer observe("MarkNotificationsRead", time.Now(), &err)
+	return s.next.MarkNotificationsRead(ctx, recipient, ids)
+}
+
+func (s *MetricsStorage) ReserveIdempotencyKey(ctx context.Context, k models.IdempotencyKey) (existing *models.IdempotencyKey, err error) {
+	defer observe("ReserveIdempotencyKey", time.Now(), &err)
+	return s.next.ReserveIdempotencyKey(ctx, k)
+}
+
+func (s *MetricsStorage) CompleteIdempotencyKey(ctx context.Context, scope, key string, resultID int) (err error) {
+	defer observe("CompleteIdempotencyKey", time.Now(), &err)
+	return s.next.CompleteIdempotencyKey(ctx, scope, key, resultID)
+}
+
+func (s *MetricsStorage) ReleaseIdempotencyKey(ctx context.Context, scope, key string) (err error) {
+	defer observe("ReleaseIdempotencyKey", time.Now(), &err)
+	return s.next.ReleaseIdempotencyKey(ctx, scope, key)
+}
+
+func (s *MetricsStorage) Ping(ctx context.Context) (err error) {
+	defer observe("Ping", time.Now(), &err)
+	return s.next.Ping(ctx)
+}
+
+func (s *MetricsStorage) Close() error {
+	return s.next.Close()
+}
+
+// вызывается через defer, поэтому ошибка передается указателем на именованный результат
+func observe(method string, start time.Time, err *error) {
+	metrics.ObserveStorageCall(method, start, *err)
+}
@@ -0,0 +1,18 @@
+package storage_test
+
+import (
+	"graphql-comments/storage"
+	"graphql-comments/storage/inmemory"
+	"graphql-comments/storage/storagetest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storager {
+		db, err := inmemory.NewMemoryStorage(nil)
+		require.NoError(t, err)
+		return storage.NewMetricsStorage(db)
+	})
+}
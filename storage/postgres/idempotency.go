@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"context"
+	"graphql-comments/models"
+	"time"
+)
+
+// Вставляет ключ или возвращает уже существующий одним запросом. Пустой DO UPDATE нужен, чтобы RETURNING
+// вернул и чужую строку, а xmax = 0 бывает только у строки, которую вставил этот запрос
+const reserveIdempotencyKeyQuery = `INSERT INTO idempotency_keys (scope, key, request_hash, result_id, expires_at, tenant_id)
+	VALUES ($1, $2, $3, 0, $4, $5)
+	ON CONFLICT (tenant_id, scope, key) DO UPDATE SET scope = EXCLUDED.scope
+	RETURNING request_hash, result_id, expires_at, xmax = 0`
+
+func (s *PostgresStorage) ReserveIdempotencyKey(ctx context.Context, k models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	// просроченные ключи удаляются попутно, индекс по expires_at делает это дешевым
+	if _, err := s.pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	existing := models.IdempotencyKey{Scope: k.Scope, Key: k.Key}
+	var inserted bool
+	err := s.pool.QueryRow(ctx, reserveIdempotencyKeyQuery, k.Scope, k.Key, k.RequestHash, k.ExpiresAt.UTC(), models.TenantFromContext(ctx)).
+		Scan(&existing.RequestHash, &existing.ResultID, &existing.ExpiresAt, &inserted)
+	if err != nil {
+		return nil, err
+	}
+	if inserted {
+		return nil, nil
+	}
+	return &existing, nil
+}
+
+func (s *PostgresStorage) CompleteIdempotencyKey(ctx context.Context, scope, key string, resultID int) error {
+	_, err := s.pool.Exec(ctx, `UPDATE idempotency_keys SET result_id=$3 WHERE scope=$1 AND key=$2 AND tenant_id=$4`, scope, key, resultID, models.TenantFromContext(ctx))
+	return err
+}
+
+func (s *PostgresStorage) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE scope=$1 AND key=$2 AND tenant_id=$3`, scope, key, models.TenantFromContext(ctx))
+	return err
+}
@@ -0,0 +1,242 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"graphql-comments/models"
+	"time"
+)
+
+// коды ошибок postgres, которые импорт переводит в ошибки хранилища
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// нулевой id заменяется следующим значением последовательности
+const importPostQuery = `WITH p AS (
+			INSERT INTO posts (id, title, author, content, allow_comments, format, content_html, created_at, version, status, publish_at, category, thread_namespace, thread_key, tenant_id)
+			VALUES (COALESCE($1::int, nextval(pg_get_serial_sequence('posts', 'id'))), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $14, $15, $16)
+			RETURNING *
+		), r AS (` + insertRevisionFromPosts + `), t AS (
+			INSERT INTO post_tags (post_id, tag) SELECT p.id, tag FROM p, unnest($13::text[]) tag
+		)
+		SELECT id FROM p`
+
+// один запрос на комментарий: сама запись, связь с родителем, флаг has_replies у родителя и упоминания.
+// Под постом другого арендатора строка не вставляется, и пустой результат читается как ErrPostNotFound
+const importCommentQuery = `WITH c AS (
+			INSERT INTO comments (id, post_id, text, author, created_at, format, text_html, tenant_id)
+			SELECT COALESCE($1::int, nextval(pg_get_serial_sequence('comments', 'id'))), $2, $3, $4, $5, $6, $7, $10
+			WHERE EXISTS (SELECT 1 FROM posts WHERE id = $2 AND tenant_id = $10)
+			RETURNING id
+		), h AS (
+			INSERT INTO comment_hierarchy (parent_id, child_id) SELECT $8::int, id FROM c WHERE $8::int IS NOT NULL
+		), p AS (
+			UPDATE comments SET has_replies = true WHERE id = $8::int
+		), m AS (
+			INSERT INTO comment_mentions (comment_id, handle, position)
+			SELECT c.id, mention.handle, mention.position - 1 FROM c, unnest($9::text[]) WITH ORDINALITY AS mention(handle, position)
+		)
+		SELECT id FROM c`
+
+// Загружает посты одной пачкой запросов в транзакции
+func (s *PostgresStorage) ImportPosts(ctx context.Context, posts []models.Post) ([]models.Post, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	maxID := 0
+	for _, p := range posts {
+		if p.ID > maxID {
+			maxID = p.ID
+		}
+	}
+	if err := reserveIDs(ctx, tx, "posts", maxID); err != nil {
+		return nil, err
+	}
+
+	tenant := models.TenantFromContext(ctx)
+	now := time.Now()
+	imported := make([]models.Post, len(posts))
+	batch := &pgx.Batch{}
+	for i, p := range posts {
+		if p.CreatedAt.IsZero() {
+			p.CreatedAt = now
+		}
+		p.Format = formatOrPlain(p.Format)
+		if p.Version == 0 {
+			p.Version = 1
+		}
+		p.SetDefaultStatus(p.CreatedAt)
+		p.TenantID = tenant
+		if err := p.NormalizeTaxonomy(); err != nil {
+			return nil, err
+		}
+		// второй тред того же ресурса упрется в уникальный индекс и вернет ErrIDConflict
+		if p.Thread != nil {
+			key, err := models.NormalizeThreadKey(*p.Thread)
+			if err != nil {
+				return nil, err
+			}
+			p.Thread = &key
+		}
+		imported[i] = p
+		namespace, key := threadArgs(p.Thread)
+		batch.Queue(importPostQuery, nullableID(p.ID), p.Title, p.Author, p.Content, p.AllowComments, string(p.Format), p.ContentHTML, p.CreatedAt, p.Version,
+			string(p.Status), p.PublishAt, p.Category, p.Tags, namespace, key, tenant)
+	}
+
+	if err := scanBatchIDs(tx.SendBatch(ctx, batch), len(imported), func(i int) *int { return &imported[i].ID }); err != nil {
+		return nil, err
+	}
+
+	return imported, tx.Commit(ctx)
+}
+
+// Загружает комментарии одной пачкой запросов в транзакции. Родители, которых нет в пачке,
+// проверяются заранее одним запросом
+func (s *PostgresStorage) ImportComments(ctx context.Context, comments []models.Comment) ([]models.Comment, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tenant := models.TenantFromContext(ctx)
+	if err := checkImportParents(ctx, tx, tenant, comments); err != nil {
+		return nil, err
+	}
+
+	maxID := 0
+	for _, c := range comments {
+		if c.ID > maxID {
+			maxID = c.ID
+		}
+	}
+	if err := reserveIDs(ctx, tx, "comments", maxID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	imported := make([]models.Comment, len(comments))
+	batch := &pgx.Batch{}
+	for i, c := range comments {
+		if c.CreatedAt.IsZero() {
+			c.CreatedAt = now
+		}
+		c.Format = formatOrPlain(c.Format)
+		c.HasReplies = false
+		c.TenantID = tenant
+		imported[i] = c
+		batch.Queue(importCommentQuery, nullableID(c.ID), c.PostID, c.Text, c.Author, c.CreatedAt, string(c.Format), c.HTML, c.ParentID, c.Mentions, tenant)
+	}
+
+	if err := scanBatchIDs(tx.SendBatch(ctx, batch), len(imported), func(i int) *int { return &imported[i].ID }); err != nil {
+		return nil, err
+	}
+
+	return imported, tx.Commit(ctx)
+}
+
+// Родитель должен быть под тем же постом: либо уже в таблице, либо раньше в пачке с заданным id
+func checkImportParents(ctx context.Context, tx pgx.Tx, tenant string, comments []models.Comment) error {
+	inBatch := make(map[int]struct{}, len(comments))
+	for _, c := range comments {
+		if c.ID != 0 {
+			inBatch[c.ID] = struct{}{}
+		}
+	}
+
+	// post_id родителей, которых нет в пачке, загружается одним запросом
+	var stored []int
+	for _, c := range comments {
+		if c.ParentID == nil {
+			continue
+		}
+		if _, ok := inBatch[*c.ParentID]; !ok {
+			stored = append(stored, *c.ParentID)
+		}
+	}
+	parentPost := make(map[int]int, len(stored))
+	if len(stored) > 0 {
+		rows, err := tx.Query(ctx, `SELECT id, post_id FROM comments WHERE id = ANY($1) AND tenant_id = $2`, stored, tenant)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id, postID int
+			if err := rows.Scan(&id, &postID); err != nil {
+				rows.Close()
+				return err
+			}
+			parentPost[id] = postID
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	// родитель из пачки должен идти раньше ответа, поэтому он попадает в parentPost только после проверки
+	for _, c := range comments {
+		if c.ParentID != nil {
+			postID, ok := parentPost[*c.ParentID]
+			if !ok || postID != c.PostID {
+				return ErrParentCommentNotFound
+			}
+		}
+		if c.ID != 0 {
+			parentPost[c.ID] = c.PostID
+		}
+	}
+	return nil
+}
+
+// Сдвигает последовательность за наибольший заданный id, чтобы автоматические id в той же и
+// следующих пачках не совпали с импортированными
+func reserveIDs(ctx context.Context, tx pgx.Tx, table string, maxID int) error {
+	if maxID == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `SELECT setval(pg_get_serial_sequence('`+table+`', 'id'), GREATEST(MAX(id), $1)) FROM `+table, maxID)
+	return err
+}
+
+// Читает id из результатов пачки по порядку запросов
+func scanBatchIDs(results pgx.BatchResults, n int, id func(i int) *int) error {
+	for i := 0; i < n; i++ {
+		if err := results.QueryRow().Scan(id(i)); err != nil {
+			results.Close()
+			return importError(err)
+		}
+	}
+	return importError(results.Close())
+}
+
+func importError(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrPostNotFound
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case uniqueViolation:
+			return ErrIDConflict
+		case foreignKeyViolation:
+			return ErrPostNotFound
+		}
+	}
+	return err
+}
+
+func nullableID(id int) *int {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
@@ -6,18 +6,29 @@ import (
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"graphql-comments/config"
+	"graphql-comments/migrations"
 	"graphql-comments/models"
 	"time"
 )
 
+// ошибки объявлены в models и общие для всех хранилищ
 var (
-	ErrPostNotFound          = fmt.Errorf("post not found")
-	ErrCommentsAreNotAllowed = fmt.Errorf("comments are not allowed for this post")
-	ErrParentCommentNotFound = fmt.Errorf("parent comment not found")
+	ErrPostNotFound          = models.ErrPostNotFound
+	ErrCommentsAreNotAllowed = models.ErrCommentsAreNotAllowed
+	ErrParentCommentNotFound = models.ErrParentCommentNotFound
+	ErrCommentNotFound       = models.ErrCommentNotFound
+	ErrIDConflict            = models.ErrIDConflict
+	ErrVersionConflict       = models.ErrVersionConflict
+	ErrThreadNotFound        = models.ErrThreadNotFound
+	ErrSchemaOutdated        = models.ErrSchemaOutdated
+	ErrSchemaDirty           = models.ErrSchemaDirty
 )
 
 type PostgresStorage struct {
 	pool *pgxpool.Pool
+
+	// версия миграций, до которой должна быть накачена схема
+	schemaVersion uint
 }
 
 func NewPostgresStorage(cfg *config.Config) (*PostgresStorage, error) {
@@ -30,27 +41,53 @@ func NewPostgresStorage(cfg *config.Config) (*PostgresStorage, error) {
 	}
 
 	poolConfig.MaxConns = int32(cfg.PostgresMaxConn)
+	// каждый запрос становится спаном в трейсе GraphQL операции
+	poolConfig.ConnConfig.Logger = queryTracer{}
+	poolConfig.ConnConfig.LogLevel = pgx.LogLevelInfo
+
+	schemaVersion, err := migrations.PostgresVersion(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	pool, err := pgxpool.ConnectConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	return &PostgresStorage{pool: pool}, nil
+	return &PostgresStorage{pool: pool, schemaVersion: schemaVersion}, nil
 }
 
 func (s *PostgresStorage) CreatePost(ctx context.Context, p models.Post) (models.Post, error) {
-	query := `INSERT INTO posts (title, author, content, allow_comments) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
-	row := s.pool.QueryRow(ctx, query, p.Title, p.Author, p.Content, p.AllowComments)
-
-	err := row.Scan(&p.ID, &p.CreatedAt)
+	// первая ревизия пишется тем же запросом
+	query := `WITH p AS (
+			INSERT INTO posts (title, author, content, allow_comments, format, content_html, status, publish_at, category, thread_namespace, thread_key, tenant_id) 
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $11, $12, $13) RETURNING *
+		), r AS (` + insertRevisionFromPosts + `), t AS (
+			INSERT INTO post_tags (post_id, tag) SELECT p.id, tag FROM p, unnest($10::text[]) tag
+		)
+		SELECT id, created_at, version FROM p`
+	if err := p.NormalizeTaxonomy(); err != nil {
+		return p, err
+	}
+	p.Format = formatOrPlain(p.Format)
+	p.SetDefaultStatus(time.Now().UTC())
+	p.TenantID = models.TenantFromContext(ctx)
+	namespace, key := threadArgs(p.Thread)
+	row := s.pool.QueryRow(ctx, query, p.Title, p.Author, p.Content, p.AllowComments, string(p.Format), p.ContentHTML, string(p.Status), p.PublishAt,
+		p.Category, p.Tags, namespace, key, p.TenantID)
+
+	err := row.Scan(&p.ID, &p.CreatedAt, &p.Version)
 	return p, err
 }
 
 func (s *PostgresStorage) CreateComment(ctx context.Context, c models.Comment, parentID *int) (models.Comment, error) {
+	// неопубликованные посты комментировать нельзя
+	// пост другого арендатора для этого запроса не существует
+	c.TenantID = models.TenantFromContext(ctx)
 	var allowComments bool
-	query := `SELECT allow_comments FROM posts WHERE id=$1`
-	err := s.pool.QueryRow(ctx, query, c.PostID).Scan(&allowComments)
+	query := `SELECT allow_comments AND status = 'PUBLISHED' FROM posts WHERE id=$1 AND tenant_id=$2`
+	err := s.pool.QueryRow(ctx, query, c.PostID, c.TenantID).Scan(&allowComments)
 	if err != nil {
 		return c, ErrPostNotFound
 	}
@@ -68,7 +105,7 @@ func (s *PostgresStorage) CreateComment(ctx context.Context, c models.Comment, p
 	if parentID != nil {
 		// Проверяем существует ли родительский комментарий
 		var parentExists bool
-		err = tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM comments WHERE id=$1)`, *parentID).Scan(&parentExists)
+		err = tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM comments WHERE id=$1 AND post_id=$2)`, *parentID, c.PostID).Scan(&parentExists)
 		if err != nil {
 			return c, err
 		}
@@ -84,12 +121,15 @@ func (s *PostgresStorage) CreateComment(ctx context.Context, c models.Comment, p
 
 	}
 
-	query = `INSERT INTO comments (post_id, text, author, created_at) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
-	row := tx.QueryRow(ctx, query, c.PostID, c.Text, c.Author, time.Now())
+	query = `INSERT INTO comments (post_id, text, author, created_at, format, text_html, tenant_id) 
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
+	row := tx.QueryRow(ctx, query, c.PostID, c.Text, c.Author, time.Now(), string(formatOrPlain(c.Format)), c.HTML, c.TenantID)
 	err = row.Scan(&c.ID, &c.CreatedAt)
 	if err != nil {
 		return c, err
 	}
+	c.ParentID = parentID
+	c.Format = formatOrPlain(c.Format)
 
 	if parentID != nil {
 		_, err = tx.Exec(ctx, `INSERT INTO comment_hierarchy (parent_id, child_id) VALUES ($1, $2)`, *parentID, c.ID)
@@ -98,27 +138,49 @@ func (s *PostgresStorage) CreateComment(ctx context.Context, c models.Comment, p
 		}
 	}
 
+	for i, handle := range c.Mentions {
+		_, err = tx.Exec(ctx, `INSERT INTO comment_mentions (comment_id, handle, position) VALUES ($1, $2, $3)`, c.ID, handle, i)
+		if err != nil {
+			return c, err
+		}
+	}
+
 	err = tx.Commit(ctx)
 	return c, err
 
 }
 
 func (s *PostgresStorage) GetPost(ctx context.Context, id int) (*models.Post, error) {
-	query := `SELECT id, title, author, content, created_at, allow_comments FROM posts WHERE id=$1`
-	row := s.pool.QueryRow(ctx, query, id)
+	query := `SELECT ` + postColumns + ` FROM posts p WHERE p.id=$1 AND p.tenant_id=$2`
+	row := s.pool.QueryRow(ctx, query, id, models.TenantFromContext(ctx))
 
-	var post models.Post
-	err := row.Scan(&post.ID, &post.Title, &post.Author, &post.Content, &post.CreatedAt, &post.AllowComments)
+	post, err := scanPost(row)
 	if err == pgx.ErrNoRows {
 		return nil, ErrPostNotFound
 	}
-	return &post, err
+	return post, err
 
 }
 
-func (s *PostgresStorage) GetPosts(ctx context.Context) ([]*models.Post, error) {
-	query := `SELECT id, title, content, created_at, allow_comments FROM posts ORDER BY created_at DESC`
-	rows, err := s.pool.Query(ctx, query)
+func (s *PostgresStorage) GetComment(ctx context.Context, id int) (*models.Comment, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments c WHERE c.id=$1 AND c.tenant_id=$2`
+	row := s.pool.QueryRow(ctx, query, id, models.TenantFromContext(ctx))
+
+	comment, err := scanComment(row)
+	if err == pgx.ErrNoRows {
+		return nil, ErrCommentNotFound
+	}
+	return comment, err
+}
+
+func (s *PostgresStorage) GetPosts(ctx context.Context, filter models.PostFilter) ([]*models.Post, error) {
+	query := `SELECT ` + postColumns + ` FROM posts p 
+			WHERE p.tenant_id = $5 AND ($1 OR p.status = 'PUBLISHED' OR ($2 <> '' AND p.author = $2)) 
+			AND ($1 OR p.thread_namespace IS NULL) 
+			AND ($3 = '' OR p.category = $3) 
+			AND ($4::text[] IS NULL OR (SELECT count(*) FROM post_tags t WHERE t.post_id = p.id AND t.tag = ANY($4)) = cardinality($4)) 
+			ORDER BY p.created_at DESC, p.id DESC`
+	rows, err := s.pool.Query(ctx, query, filter.Unpublished, filter.Viewer, filter.Category, filter.Tags, models.TenantFromContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -126,30 +188,38 @@ func (s *PostgresStorage) GetPosts(ctx context.Context) ([]*models.Post, error)
 
 	var posts []*models.Post
 	for rows.Next() {
-		var post models.Post
-		if err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.CreatedAt, &post.AllowComments); err != nil {
+		post, err := scanPost(rows)
+		if err != nil {
 			return nil, err
 		}
-		posts = append(posts, &post)
+		posts = append(posts, post)
 	}
 
-	return posts, nil
+	return posts, rows.Err()
 }
 
 func (s *PostgresStorage) GetComments(ctx context.Context, postID int, parentID *int, limit, afterID int) ([]*models.Comment, error) {
+	if err := s.checkThread(ctx, postID, parentID); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+
 	var rows pgx.Rows
 	var err error
 
 	if parentID == nil {
-		query := `SELECT id, post_id, author, text, created_at, has_replies FROM comments WHERE post_id=$1 AND id NOT IN 
-				(SELECT child_id FROM comment_hierarchy) AND id > $2 
-				ORDER BY created_at LIMIT $3`
+		query := `SELECT ` + commentColumns + ` FROM comments c 
+				WHERE c.post_id=$1 AND c.id NOT IN 
+				(SELECT child_id FROM comment_hierarchy) AND c.id > $2 
+				ORDER BY c.created_at, c.id LIMIT $3`
 		rows, err = s.pool.Query(ctx, query, postID, afterID, limit)
 	} else {
-		query := `SELECT c.id, c.post_id, c.author, c.text, c.created_at, c.has_replies FROM comments c 
+		query := `SELECT ` + commentColumns + ` FROM comments c 
 				JOIN comment_hierarchy ch ON c.id = ch.child_id 
 				WHERE ch.parent_id = $1 AND c.id > $2 
-				ORDER BY c.created_at LIMIT $3`
+				ORDER BY c.created_at, c.id LIMIT $3`
 		rows, err = s.pool.Query(ctx, query, *parentID, afterID, limit)
 	}
 
@@ -158,16 +228,206 @@ func (s *PostgresStorage) GetComments(ctx context.Context, postID int, parentID
 	}
 	defer rows.Close()
 
+	return scanComments(rows)
+}
+
+func (s *PostgresStorage) GetMentions(ctx context.Context, handle string, limit, afterID int) ([]*models.Comment, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	query := `SELECT ` + commentColumns + ` FROM comments c 
+			JOIN comment_mentions cm ON c.id = cm.comment_id 
+			WHERE cm.handle = $1 AND c.tenant_id = $4 AND c.id > $2 
+			AND EXISTS(SELECT 1 FROM posts p WHERE p.id = c.post_id AND p.status = 'PUBLISHED') 
+			ORDER BY c.id LIMIT $3`
+	rows, err := s.pool.Query(ctx, query, models.NormalizeHandle(handle), afterID, limit, models.TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanComments(rows)
+}
+
+func (s *PostgresStorage) CreateNotification(ctx context.Context, n models.Notification) (models.Notification, error) {
+	n.Recipient = models.NormalizeHandle(n.Recipient)
+	n.Read = false
+	n.TenantID = models.TenantFromContext(ctx)
+
+	query := `INSERT INTO notifications (recipient, type, actor, post_id, comment_id, message, tenant_id) 
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
+	row := s.pool.QueryRow(ctx, query, n.Recipient, string(n.Type), n.Actor, n.PostID, n.CommentID, n.Message, n.TenantID)
+
+	err := row.Scan(&n.ID, &n.CreatedAt)
+	return n, err
+}
+
+func (s *PostgresStorage) GetNotifications(ctx context.Context, recipient string, limit, beforeID int, unreadOnly bool) ([]*models.Notification, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	query := `SELECT id, recipient, type, actor, post_id, comment_id, message, read, created_at, tenant_id FROM notifications 
+			WHERE recipient = $1 AND tenant_id = $5 AND ($2 = 0 OR id < $2) AND (NOT $3 OR NOT read) 
+			ORDER BY id DESC LIMIT $4`
+	rows, err := s.pool.Query(ctx, query, models.NormalizeHandle(recipient), beforeID, unreadOnly, limit, models.TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []*models.Notification
+	for rows.Next() {
+		var n models.Notification
+		var notificationType string
+		if err := rows.Scan(&n.ID, &n.Recipient, &notificationType, &n.Actor, &n.PostID, &n.CommentID, &n.Message, &n.Read, &n.CreatedAt, &n.TenantID); err != nil {
+			return nil, err
+		}
+		n.Type = models.NotificationType(notificationType)
+		notifications = append(notifications, &n)
+	}
+
+	return notifications, rows.Err()
+}
+
+func (s *PostgresStorage) MarkNotificationsRead(ctx context.Context, recipient string, ids []int) (int, error) {
+	query := `UPDATE notifications SET read = true 
+			WHERE recipient = $1 AND tenant_id = $3 AND NOT read AND (cardinality($2::int[]) = 0 OR id = ANY($2::int[]))`
+	if ids == nil {
+		ids = []int{}
+	}
+	tag, err := s.pool.Exec(ctx, query, models.NormalizeHandle(recipient), ids, models.TenantFromContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// Проверяет, что пост существует, а родительский комментарий, если он указан, находится под этим постом
+func (s *PostgresStorage) checkThread(ctx context.Context, postID int, parentID *int) error {
+	var postExists, parentExists bool
+	query := `SELECT EXISTS(SELECT 1 FROM posts WHERE id=$1 AND tenant_id=$3), 
+			$2::int IS NULL OR EXISTS(SELECT 1 FROM comments WHERE id=$2 AND post_id=$1)`
+	if err := s.pool.QueryRow(ctx, query, postID, parentID, models.TenantFromContext(ctx)).Scan(&postExists, &parentExists); err != nil {
+		return err
+	}
+	if !postExists {
+		return ErrPostNotFound
+	}
+	if !parentExists {
+		return ErrParentCommentNotFound
+	}
+	return nil
+}
+
+// колонки поста p в порядке, который ожидает scanPost. Теги сортируются побайтно, как sort.Strings в models.NormalizeTags
+const postColumns = `p.id, p.title, p.author, p.content, p.created_at, p.allow_comments, p.format, p.content_html, p.version, p.status, p.publish_at, 
+	p.category, ARRAY(SELECT t.tag FROM post_tags t WHERE t.post_id = p.id ORDER BY t.tag COLLATE "C"), p.thread_namespace, p.thread_key, p.tenant_id`
+
+// колонки комментария c в порядке, который ожидает scanComment: id родителя берется из иерархии,
+// хендлы упомянутых пользователей собираются в массив
+const commentColumns = `c.id, c.post_id, 
+	(SELECT h.parent_id FROM comment_hierarchy h WHERE h.child_id = c.id), 
+	c.author, c.text, c.created_at, c.has_replies, 
+	ARRAY(SELECT m.handle FROM comment_mentions m WHERE m.comment_id = c.id ORDER BY m.position), 
+	c.format, c.text_html, c.tenant_id`
+
+// Вспомогательная функция сканирует строку с колонками postColumns, extra получают следующие за ними колонки
+func scanPost(row pgx.Row, extra ...interface{}) (*models.Post, error) {
+	var p models.Post
+	var format, status string
+	var namespace, key *string
+	dest := append([]interface{}{&p.ID, &p.Title, &p.Author, &p.Content, &p.CreatedAt, &p.AllowComments, &format, &p.ContentHTML, &p.Version, &status, &p.PublishAt, &p.Category, &p.Tags,
+		&namespace, &key, &p.TenantID}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if namespace != nil && key != nil {
+		p.Thread = &models.ThreadKey{Namespace: *namespace, Key: *key}
+	}
+	p.Format = models.TextFormat(format)
+	p.Status = models.PostStatus(status)
+	if len(p.Tags) == 0 {
+		p.Tags = nil
+	}
+
+	return &p, nil
+}
+
+// Вспомогательная функция сканирует строку с колонками commentColumns, extra получают следующие за ними колонки
+func scanComment(row pgx.Row, extra ...interface{}) (*models.Comment, error) {
+	var c models.Comment
+	var format string
+	dest := append([]interface{}{&c.ID, &c.PostID, &c.ParentID, &c.Author, &c.Text, &c.CreatedAt, &c.HasReplies, &c.Mentions, &format, &c.HTML, &c.TenantID}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	c.Format = models.TextFormat(format)
+	if len(c.Mentions) == 0 {
+		c.Mentions = nil
+	}
+
+	return &c, nil
+}
+
+// Вспомогательная функция сканирует все строки с колонками commentColumns
+func scanComments(rows pgx.Rows) ([]*models.Comment, error) {
 	var comments []*models.Comment
 	for rows.Next() {
-		var c models.Comment
-		if err := rows.Scan(&c.ID, &c.PostID, &c.Author, &c.Text, &c.CreatedAt, &c.HasReplies); err != nil {
+		c, err := scanComment(rows)
+		if err != nil {
 			return nil, err
 		}
-		comments = append(comments, &c)
+		comments = append(comments, c)
+	}
+
+	return comments, rows.Err()
+}
+
+// формат по умолчанию для записей, созданных без явного формата
+func formatOrPlain(f models.TextFormat) models.TextFormat {
+	if f == "" {
+		return models.TextFormatPlain
+	}
+	return f
+}
+
+// ключ треда хранится в двух колонках, у обычных постов обе NULL
+func threadArgs(k *models.ThreadKey) (namespace, key *string) {
+	if k == nil {
+		return nil, nil
 	}
+	return &k.Namespace, &k.Key
+}
+
+// Проверяет соединение с бд и версию схемы в таблице schema_migrations, которую ведет golang-migrate
+func (s *PostgresStorage) Ping(ctx context.Context) error {
+	if err := s.pool.Ping(ctx); err != nil {
+		return err
+	}
+
+	var version int64
+	var dirty bool
+	err := s.pool.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err == pgx.ErrNoRows {
+		return ErrSchemaOutdated
+	}
+	if err != nil {
+		return err
+	}
+	return checkSchemaVersion(uint(version), dirty, s.schemaVersion)
+}
 
-	return comments, nil
+func checkSchemaVersion(version uint, dirty bool, want uint) error {
+	if dirty {
+		return fmt.Errorf("%w: migration %d did not finish", ErrSchemaDirty, version)
+	}
+	if version < want {
+		return fmt.Errorf("%w: version %d, want %d", ErrSchemaOutdated, version, want)
+	}
+	return nil
 }
 
 func (s *PostgresStorage) Close() error {
@@ -12,7 +12,7 @@ import (
 
 // Функция для очистки базы данных
 func cleanDB(ctx context.Context, storage *PostgresStorage) {
-	_, _ = storage.pool.Exec(ctx, `TRUNCATE comments, comment_hierarchy, posts RESTART IDENTITY CASCADE`)
+	_, _ = storage.pool.Exec(ctx, `TRUNCATE idempotency_keys, notifications, comment_mentions, comments, comment_hierarchy, posts RESTART IDENTITY CASCADE`)
 }
 
 // Инициализация хранилища для тестов
@@ -175,7 +175,7 @@ func TestGetPosts(t *testing.T) {
 	createdPost2, err := storage.CreatePost(ctx, post2)
 	assert.NoError(t, err)
 
-	posts, err := storage.GetPosts(ctx)
+	posts, err := storage.GetPosts(ctx, models.PostFilter{})
 	assert.NoError(t, err)
 	assert.Equal(t, 2, len(posts))
 	assert.Equal(t, createdPost2.ID, posts[0].ID) // пост2 должен добавиться позже
@@ -292,3 +292,133 @@ func TestGetCommentsHierarchy(t *testing.T) {
 	assert.Equal(t, 1, len(comments))
 	assert.Equal(t, createdComment2, *comments[0])
 }
+
+func TestGetMentions(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	createdPost, err := storage.CreatePost(ctx, models.Post{
+		Title:         "Тест",
+		Content:       "Пост",
+		Author:        "Автор",
+		AllowComments: true,
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := storage.CreateComment(ctx, models.Comment{
+			PostID:   createdPost.ID,
+			Text:     "@masha @vasya коммент номер " + fmt.Sprint(i),
+			Author:   "Уткин",
+			Mentions: []string{"masha", "vasya"},
+		}, nil)
+		assert.NoError(t, err)
+	}
+
+	mentions, err := storage.GetMentions(ctx, "@Masha", 2, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(mentions))
+	assert.Equal(t, []string{"masha", "vasya"}, mentions[0].Mentions)
+
+	mentions, err = storage.GetMentions(ctx, "masha", 2, mentions[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(mentions))
+
+	comments, err := storage.GetComments(ctx, createdPost.ID, nil, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"masha", "vasya"}, comments[0].Mentions)
+}
+
+func TestGetComment(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	createdPost, err := storage.CreatePost(ctx, models.Post{Title: "Тест", Content: "Пост", Author: "Автор", AllowComments: true})
+	assert.NoError(t, err)
+
+	parent, err := storage.CreateComment(ctx, models.Comment{PostID: createdPost.ID, Text: "Первый", Author: "1"}, nil)
+	assert.NoError(t, err)
+	reply, err := storage.CreateComment(ctx, models.Comment{PostID: createdPost.ID, Text: "Ответ", Author: "2"}, &parent.ID)
+	assert.NoError(t, err)
+
+	comment, err := storage.GetComment(ctx, reply.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Ответ", comment.Text)
+	assert.Equal(t, &parent.ID, comment.ParentID)
+
+	_, err = storage.GetComment(ctx, 1337)
+	assert.Equal(t, ErrCommentNotFound, err)
+}
+
+func TestNotifications(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	createdPost, err := storage.CreatePost(ctx, models.Post{Title: "Тест", Content: "Пост", Author: "Автор", AllowComments: true})
+	assert.NoError(t, err)
+
+	var ids []int
+	for i := 0; i < 3; i++ {
+		n, err := storage.CreateNotification(ctx, models.Notification{
+			Recipient: "@Masha",
+			Type:      models.NotificationTypeMention,
+			Actor:     "Уткин",
+			PostID:    createdPost.ID,
+		})
+		assert.NoError(t, err)
+		ids = append(ids, n.ID)
+	}
+
+	notifications, err := storage.GetNotifications(ctx, "masha", 2, 0, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(notifications))
+	assert.Equal(t, ids[2], notifications[0].ID) // от новых к старым
+	assert.Equal(t, models.NotificationTypeMention, notifications[0].Type)
+
+	notifications, err = storage.GetNotifications(ctx, "masha", 2, notifications[1].ID, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(notifications))
+
+	marked, err := storage.MarkNotificationsRead(ctx, "masha", ids[:2])
+	assert.NoError(t, err)
+	assert.Equal(t, 2, marked)
+
+	marked, err = storage.MarkNotificationsRead(ctx, "masha", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, marked)
+
+	notifications, err = storage.GetNotifications(ctx, "masha", 10, 0, true)
+	assert.NoError(t, err)
+	assert.Empty(t, notifications)
+}
+
+func TestSearch(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	post1, err := storage.CreatePost(ctx, models.Post{Title: "Котики", Content: "Все о домашних животных", Author: "Автор", AllowComments: true})
+	assert.NoError(t, err)
+	post2, err := storage.CreatePost(ctx, models.Post{Title: "Собаки", Content: "Собаки тоже любят котики, но не всегда", Author: "Автор", AllowComments: true})
+	assert.NoError(t, err)
+
+	comment, err := storage.CreateComment(ctx, models.Comment{PostID: post2.ID, Text: "А у меня дома <b>два</b> кота и котики", Author: "Петя"}, nil)
+	assert.NoError(t, err)
+
+	results, err := storage.Search(ctx, models.SearchQuery{Text: "котики", Scope: models.SearchScopeAll, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(results))
+	// совпадение в заголовке весит больше, чем в тексте
+	assert.Equal(t, post1.ID, results[0].Post.ID)
+
+	results, err = storage.Search(ctx, models.SearchQuery{Text: "котики дома", Scope: models.SearchScopeComments, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, comment.ID, results[0].Comment.ID)
+	assert.Contains(t, results[0].Snippet, "<mark>котики</mark>")
+	assert.NotContains(t, results[0].Snippet, "<b>")
+
+	results, err = storage.Search(ctx, models.SearchQuery{Text: "котики", Scope: models.SearchScopePosts, PostID: &post2.ID, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, post2.ID, results[0].Post.ID)
+}
@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"context"
+	"graphql-comments/models"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// У черновика время публикации сбрасывается, опубликованный без времени получает текущее
+const setPostStatusQuery = `UPDATE posts p SET status = $2, 
+			publish_at = CASE WHEN $2 = 'DRAFT' THEN NULL ELSE COALESCE($3::timestamptz, $4::timestamptz) END 
+			WHERE p.id = $1 AND p.tenant_id = $5 RETURNING ` + postColumns
+
+func (s *PostgresStorage) SetPostStatus(ctx context.Context, id int, status models.PostStatus, publishAt *time.Time) (models.Post, error) {
+	row := s.pool.QueryRow(ctx, setPostStatusQuery, id, string(status), publishAt, time.Now().UTC(), models.TenantFromContext(ctx))
+	post, err := scanPost(row)
+	if err == pgx.ErrNoRows {
+		return models.Post{}, ErrPostNotFound
+	}
+	if err != nil {
+		return models.Post{}, err
+	}
+	return *post, nil
+}
+
+// Публикует запланированные посты всех арендаторов одним запросом, поэтому несколько экземпляров сервиса
+// не опубликуют один пост дважды
+func (s *PostgresStorage) PublishDuePosts(ctx context.Context, now time.Time) ([]models.Post, error) {
+	query := `UPDATE posts p SET status = 'PUBLISHED' 
+			WHERE p.status = 'SCHEDULED' AND p.publish_at <= $1 RETURNING ` + postColumns
+	rows, err := s.pool.Query(ctx, query, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var published []models.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		published = append(published, *post)
+	}
+	return published, rows.Err()
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"graphql-comments/models"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Начало части CTE, которая сохраняет ревизию поста, вставленного или обновленного в CTE p.
+// Продолжается выражением для времени ревизии и FROM p
+const insertRevision = `INSERT INTO post_revisions (post_id, version, title, content, format, allow_comments, created_at)
+			SELECT id, version, title, content, format, allow_comments, `
+
+// ревизия нового поста получает время его создания
+const insertRevisionFromPosts = insertRevision + `created_at FROM p`
+
+// Условие на версию в WHERE делает проверку и запись одним атомарным запросом
+const updatePostQuery = `WITH p AS (
+			UPDATE posts SET title=$2, content=$3, format=$4, content_html=$5, allow_comments=$6, version = version + 1
+			WHERE id=$1 AND version=$7 AND tenant_id=$8 RETURNING *
+		), r AS (` + insertRevision + `CURRENT_TIMESTAMP FROM p)
+		SELECT ` + postColumns + ` FROM p`
+
+func (s *PostgresStorage) UpdatePost(ctx context.Context, p models.Post, expectedVersion int) (models.Post, error) {
+	row := s.pool.QueryRow(ctx, updatePostQuery, p.ID, p.Title, p.Content, string(formatOrPlain(p.Format)), p.ContentHTML, p.AllowComments, expectedVersion, models.TenantFromContext(ctx))
+	updated, err := scanPost(row)
+	if err == nil {
+		return *updated, nil
+	}
+	if err != pgx.ErrNoRows {
+		return p, err
+	}
+
+	// поста нет или его версия уже другая
+	current, err := s.GetPost(ctx, p.ID)
+	if err != nil {
+		return p, err
+	}
+	return *current, ErrVersionConflict
+}
+
+func (s *PostgresStorage) GetPostRevisions(ctx context.Context, postID int) ([]*models.PostRevision, error) {
+	query := `SELECT post_id, version, title, content, format, allow_comments, created_at 
+			FROM post_revisions r WHERE r.post_id=$1 
+			AND EXISTS(SELECT 1 FROM posts p WHERE p.id = r.post_id AND p.tenant_id = $2) ORDER BY version`
+	rows, err := s.pool.Query(ctx, query, postID, models.TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*models.PostRevision
+	for rows.Next() {
+		var r models.PostRevision
+		var format string
+		if err := rows.Scan(&r.PostID, &r.Version, &r.Title, &r.Content, &format, &r.AllowComments, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.Format = models.TextFormat(format)
+		revisions = append(revisions, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// у каждого поста есть хотя бы первая ревизия, пустой результат значит, что поста нет
+	if len(revisions) == 0 {
+		return nil, ErrPostNotFound
+	}
+	return revisions, nil
+}
@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"context"
+	"graphql-comments/models"
+	"sort"
+)
+
+// параметры ts_headline: найденные слова выделяются служебными маркерами,
+// которые затем заменяются на <mark> в models.FormatSnippet
+const headlineOptions = `StartSel=` + models.SnippetHighlightStart + `, StopSel=` + models.SnippetHighlightStop +
+	`, MaxWords=20, MinWords=5, ShortWord=2, MaxFragments=1`
+
+func (s *PostgresStorage) Search(ctx context.Context, q models.SearchQuery) ([]*models.SearchResult, error) {
+	if q.Limit <= 0 {
+		return nil, nil
+	}
+
+	var results []*models.SearchResult
+	if q.Scope.IncludesPosts() {
+		posts, err := s.searchPosts(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, posts...)
+	}
+	if q.Scope.IncludesComments() {
+		comments, err := s.searchComments(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, comments...)
+	}
+
+	// каждая выборка уже отсортирована и ограничена, осталось слить их
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
+
+func (s *PostgresStorage) searchPosts(ctx context.Context, q models.SearchQuery) ([]*models.SearchResult, error) {
+	query := `SELECT ` + postColumns + `, 
+			ts_rank_cd(p.search_vector, tsq) AS score, ts_headline('simple', p.title || ' ' || p.content, tsq, $4) 
+			FROM posts p, websearch_to_tsquery('simple', $1) tsq 
+			WHERE p.search_vector @@ tsq AND p.status = 'PUBLISHED' AND p.tenant_id = $5 AND ($2::int IS NULL OR p.id = $2) 
+			ORDER BY score DESC, p.created_at DESC LIMIT $3`
+	rows, err := s.pool.Query(ctx, query, q.Text, q.PostID, q.Limit, headlineOptions, models.TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.SearchResult
+	for rows.Next() {
+		var r models.SearchResult
+		post, err := scanPost(rows, &r.Score, &r.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		r.Post = post
+		r.Snippet = models.FormatSnippet(r.Snippet)
+		results = append(results, &r)
+	}
+
+	return results, rows.Err()
+}
+
+func (s *PostgresStorage) searchComments(ctx context.Context, q models.SearchQuery) ([]*models.SearchResult, error) {
+	query := `SELECT ` + commentColumns + `, 
+			ts_rank_cd(c.search_vector, tsq) AS score, ts_headline('simple', c.text, tsq, $4) 
+			FROM comments c, websearch_to_tsquery('simple', $1) tsq 
+			WHERE c.search_vector @@ tsq AND c.tenant_id = $5 AND ($2::int IS NULL OR c.post_id = $2) 
+			AND EXISTS(SELECT 1 FROM posts p WHERE p.id = c.post_id AND p.status = 'PUBLISHED') 
+			ORDER BY score DESC, c.created_at DESC LIMIT $3`
+	rows, err := s.pool.Query(ctx, query, q.Text, q.PostID, q.Limit, headlineOptions, models.TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.SearchResult
+	for rows.Next() {
+		var r models.SearchResult
+		comment, err := scanComment(rows, &r.Score, &r.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		r.Comment = comment
+		r.Snippet = models.FormatSnippet(r.Snippet)
+		results = append(results, &r)
+	}
+
+	return results, rows.Err()
+}
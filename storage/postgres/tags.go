@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+	"graphql-comments/models"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Удаление и вставка идут в одной транзакции, а блокировка строки поста не дает двум правкам тегов смешаться
+func (s *PostgresStorage) UpdatePostTags(ctx context.Context, postID int, add, remove []string) (models.Post, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return models.Post{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	err = tx.QueryRow(ctx, `SELECT id FROM posts WHERE id=$1 AND tenant_id=$2 FOR UPDATE`, postID, models.TenantFromContext(ctx)).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return models.Post{}, ErrPostNotFound
+	}
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	if remove == nil {
+		remove = []string{}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM post_tags WHERE post_id=$1 AND tag = ANY($2::text[])`, postID, remove); err != nil {
+		return models.Post{}, err
+	}
+	// тег из обоих списков удаляется, как в models.MergeTags
+	query := `INSERT INTO post_tags (post_id, tag) SELECT $1, tag FROM unnest($2::text[]) tag 
+			WHERE NOT tag = ANY($3::text[]) ON CONFLICT DO NOTHING`
+	if _, err := tx.Exec(ctx, query, postID, add, remove); err != nil {
+		return models.Post{}, err
+	}
+
+	post, err := scanPost(tx.QueryRow(ctx, `SELECT `+postColumns+` FROM posts p WHERE p.id=$1`, postID))
+	if err != nil {
+		return models.Post{}, err
+	}
+	return *post, tx.Commit(ctx)
+}
+
+func (s *PostgresStorage) SetPostCategory(ctx context.Context, postID int, category string) (models.Post, error) {
+	query := `UPDATE posts p SET category = $2 WHERE p.id = $1 AND p.tenant_id = $3 RETURNING ` + postColumns
+	post, err := scanPost(s.pool.QueryRow(ctx, query, postID, category, models.TenantFromContext(ctx)))
+	if err == pgx.ErrNoRows {
+		return models.Post{}, ErrPostNotFound
+	}
+	if err != nil {
+		return models.Post{}, err
+	}
+	return *post, nil
+}
+
+func (s *PostgresStorage) GetTags(ctx context.Context) ([]models.TagCount, error) {
+	query := `SELECT t.tag, count(*) FROM post_tags t JOIN posts p ON p.id = t.post_id 
+			WHERE p.status = 'PUBLISHED' AND p.tenant_id = $1 GROUP BY t.tag ORDER BY count(*) DESC, t.tag COLLATE "C"`
+	rows, err := s.pool.Query(ctx, query, models.TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.TagCount{}
+	for rows.Next() {
+		var t models.TagCount
+		if err := rows.Scan(&t.Tag, &t.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
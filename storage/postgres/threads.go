@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"context"
+	"graphql-comments/models"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// При гонке двух первых комментариев второй INSERT ждет первого и ничего не вставляет, после чего
+// оба читают один и тот же тред. Ревизия пишется только вместе с реально вставленным постом
+const createThreadQuery = `WITH p AS (
+			INSERT INTO posts (title, author, content, allow_comments, format, content_html, status, publish_at, thread_namespace, thread_key, tenant_id) 
+			VALUES ('', '', '', $1, $2, '', $3, $4, $5, $6, $7) 
+			ON CONFLICT (tenant_id, thread_namespace, thread_key) WHERE thread_namespace IS NOT NULL DO NOTHING RETURNING *
+		), r AS (` + insertRevisionFromPosts + `)
+		SELECT id FROM p`
+
+func (s *PostgresStorage) GetThread(ctx context.Context, key models.ThreadKey) (*models.Post, error) {
+	query := `SELECT ` + postColumns + ` FROM posts p WHERE p.thread_namespace=$1 AND p.thread_key=$2 AND p.tenant_id=$3`
+	post, err := scanPost(s.pool.QueryRow(ctx, query, key.Namespace, key.Key, models.TenantFromContext(ctx)))
+	if err == pgx.ErrNoRows {
+		return nil, ErrThreadNotFound
+	}
+	return post, err
+}
+
+func (s *PostgresStorage) GetOrCreateThread(ctx context.Context, key models.ThreadKey) (models.Post, error) {
+	p := models.NewThreadPost(key)
+	p.SetDefaultStatus(time.Now().UTC())
+	_, err := s.pool.Exec(ctx, createThreadQuery, p.AllowComments, string(p.Format), string(p.Status), p.PublishAt, key.Namespace, key.Key, models.TenantFromContext(ctx))
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	post, err := s.GetThread(ctx, key)
+	if err != nil {
+		return models.Post{}, err
+	}
+	return *post, nil
+}
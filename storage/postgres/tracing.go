@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// queryTracer превращает логи запросов pgx в спаны OpenTelemetry.
+// В pgx v4 нет хуков на начало запроса, поэтому спан строится задним числом по длительности из лога
+type queryTracer struct{}
+
+func (queryTracer) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	sql, ok := data["sql"].(string)
+	if !ok {
+		return
+	}
+	duration, _ := data["time"].(time.Duration)
+	end := time.Now()
+
+	// аргументы запроса в спан не пишем, в них могут быть пользовательские данные
+	_, span := otel.Tracer("graphql-comments/postgres").Start(ctx, "postgres "+statementName(sql),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(end.Add(-duration)),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", msg),
+			attribute.String("db.statement", sql),
+		))
+	if err, ok := data["err"].(error); ok {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if rows, ok := data["rowCount"].(int); ok {
+		span.SetAttributes(attribute.Int("db.rows", rows))
+	}
+	span.End(trace.WithTimestamp(end))
+}
+
+// первое слово запроса (SELECT, INSERT, ...) дает короткое имя спана
+func statementName(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestQueryTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer provider.Shutdown(context.Background())
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "query Posts")
+
+	tracer := queryTracer{}
+	tracer.Log(ctx, pgx.LogLevelInfo, "Query", map[string]interface{}{
+		"sql":      "  select id from posts where id = $1",
+		"args":     []interface{}{1},
+		"time":     20 * time.Millisecond,
+		"rowCount": 1,
+	})
+	tracer.Log(ctx, pgx.LogLevelError, "Exec", map[string]interface{}{
+		"sql":  "INSERT INTO posts (title) VALUES ($1)",
+		"time": time.Millisecond,
+		"err":  errors.New("duplicate key"),
+	})
+	// сообщения без запроса, например о соединении, спанов не создают
+	tracer.Log(ctx, pgx.LogLevelInfo, "closed connection", map[string]interface{}{})
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	query := spans[0]
+	assert.Equal(t, "postgres SELECT", query.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), query.Parent().SpanID())
+	assert.GreaterOrEqual(t, query.EndTime().Sub(query.StartTime()), 20*time.Millisecond)
+	assert.Contains(t, query.Attributes(), attribute.String("db.statement", "  select id from posts where id = $1"))
+	for _, kv := range query.Attributes() {
+		assert.NotEqual(t, "args", string(kv.Key))
+	}
+
+	exec := spans[1]
+	assert.Equal(t, "postgres INSERT", exec.Name())
+	assert.Equal(t, codes.Error, exec.Status().Code)
+}
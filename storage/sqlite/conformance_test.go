@@ -0,0 +1,29 @@
+package sqlite_test
+
+import (
+	"graphql-comments/config"
+	"graphql-comments/migrations"
+	"graphql-comments/storage"
+	"graphql-comments/storage/sqlite"
+	"graphql-comments/storage/storagetest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storager {
+		cfg := &config.Config{
+			SqlitePath:  filepath.Join(t.TempDir(), "comments.db"),
+			ReadTimeout: 5 * time.Second,
+		}
+		require.NoError(t, migrations.RunSQLiteMigrations(cfg))
+
+		s, err := sqlite.NewSQLiteStorage(cfg)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
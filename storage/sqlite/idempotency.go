@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"graphql-comments/models"
+	"time"
+)
+
+// Соединение одно, поэтому проверка и вставка в одной транзакции не гоняются с другими запросами
+func (s *SQLiteStorage) ReserveIdempotencyKey(ctx context.Context, k models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	tenant := models.TenantFromContext(ctx)
+	existing := models.IdempotencyKey{Scope: k.Scope, Key: k.Key}
+	err = tx.QueryRowContext(ctx, `SELECT request_hash, result_id, expires_at FROM idempotency_keys WHERE tenant_id=? AND scope=? AND key=?`,
+		tenant, k.Scope, k.Key).Scan(&existing.RequestHash, &existing.ResultID, &existing.ExpiresAt)
+	switch {
+	case err == nil && existing.ExpiresAt.After(now):
+		return &existing, nil
+	case err != nil && err != sql.ErrNoRows:
+		return nil, err
+	}
+
+	// просроченные ключи удаляются попутно, вместе с тем, который сейчас занимается заново
+	if _, err := tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= ? OR (tenant_id=? AND scope=? AND key=?)`, now, tenant, k.Scope, k.Key); err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO idempotency_keys (tenant_id, scope, key, request_hash, result_id, expires_at) VALUES (?, ?, ?, ?, 0, ?)`,
+		tenant, k.Scope, k.Key, k.RequestHash, k.ExpiresAt.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, tx.Commit()
+}
+
+func (s *SQLiteStorage) CompleteIdempotencyKey(ctx context.Context, scope, key string, resultID int) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE idempotency_keys SET result_id=? WHERE tenant_id=? AND scope=? AND key=?`, resultID, models.TenantFromContext(ctx), scope, key)
+	return err
+}
+
+func (s *SQLiteStorage) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE tenant_id=? AND scope=? AND key=?`, models.TenantFromContext(ctx), scope, key)
+	return err
+}
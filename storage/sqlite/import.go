@@ -0,0 +1,202 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"graphql-comments/models"
+	"time"
+)
+
+// Загружает посты в одной транзакции. id назначаются заранее после наибольшего из занятых и заданных,
+// чтобы автоматический id не совпал с заданным дальше в пачке
+func (s *SQLiteStorage) ImportPosts(ctx context.Context, posts []models.Post) ([]models.Post, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids := make([]int, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	if err := assignIDs(ctx, tx, "posts", ids); err != nil {
+		return nil, err
+	}
+
+	tenant := models.TenantFromContext(ctx)
+	now := time.Now().UTC()
+	imported := make([]models.Post, len(posts))
+	query := `INSERT INTO posts (id, title, author, content, allow_comments, format, content_html, created_at, version, status, publish_at, category, thread_namespace, thread_key, tenant_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	for i, p := range posts {
+		p.ID = ids[i]
+		if p.CreatedAt.IsZero() {
+			p.CreatedAt = now
+		}
+		p.CreatedAt = p.CreatedAt.UTC()
+		p.Format = formatOrPlain(p.Format)
+		if p.Version == 0 {
+			p.Version = 1
+		}
+		p.SetDefaultStatus(p.CreatedAt)
+		p.PublishAt = utcOrNil(p.PublishAt)
+		p.TenantID = tenant
+		if err := p.NormalizeTaxonomy(); err != nil {
+			return nil, err
+		}
+		// у внешнего ресурса может быть только один тред
+		if p.Thread != nil {
+			key, err := models.NormalizeThreadKey(*p.Thread)
+			if err != nil {
+				return nil, err
+			}
+			var exists bool
+			err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM posts WHERE tenant_id=? AND thread_namespace=? AND thread_key=?)`, tenant, key.Namespace, key.Key).Scan(&exists)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				return nil, ErrIDConflict
+			}
+			p.Thread = &key
+		}
+
+		namespace, key := threadArgs(p.Thread)
+		_, err = tx.ExecContext(ctx, query, p.ID, p.Title, p.Author, p.Content, p.AllowComments, string(p.Format), p.ContentHTML, p.CreatedAt, p.Version,
+			string(p.Status), p.PublishAt, p.Category, namespace, key, tenant)
+		if err != nil {
+			return nil, err
+		}
+		if err := insertTags(ctx, tx, p.ID, p.Tags); err != nil {
+			return nil, err
+		}
+		if err := insertRevision(ctx, tx, models.RevisionOf(&p, p.CreatedAt)); err != nil {
+			return nil, err
+		}
+		imported[i] = p
+	}
+
+	return imported, tx.Commit()
+}
+
+// Загружает комментарии в одной транзакции, родитель проверяется так же, как в CreateComment
+func (s *SQLiteStorage) ImportComments(ctx context.Context, comments []models.Comment) ([]models.Comment, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids := make([]int, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+	if err := assignIDs(ctx, tx, "comments", ids); err != nil {
+		return nil, err
+	}
+
+	tenant := models.TenantFromContext(ctx)
+	now := time.Now().UTC()
+	imported := make([]models.Comment, len(comments))
+	query := `INSERT INTO comments (id, post_id, text, author, created_at, format, text_html, tenant_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	for i, c := range comments {
+		var postExists bool
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM posts WHERE id=? AND tenant_id=?)`, c.PostID, tenant).Scan(&postExists)
+		if err != nil {
+			return nil, err
+		}
+		if !postExists {
+			return nil, ErrPostNotFound
+		}
+
+		if c.ParentID != nil {
+			var parentExists bool
+			err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM comments WHERE id=? AND post_id=?)`, *c.ParentID, c.PostID).Scan(&parentExists)
+			if err != nil {
+				return nil, err
+			}
+			if !parentExists {
+				return nil, ErrParentCommentNotFound
+			}
+
+			_, err = tx.ExecContext(ctx, `UPDATE comments SET has_replies = TRUE WHERE id = ?`, *c.ParentID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		c.ID = ids[i]
+		if c.CreatedAt.IsZero() {
+			c.CreatedAt = now
+		}
+		c.CreatedAt = c.CreatedAt.UTC()
+		c.Format = formatOrPlain(c.Format)
+		c.HasReplies = false
+		c.TenantID = tenant
+
+		_, err = tx.ExecContext(ctx, query, c.ID, c.PostID, c.Text, c.Author, c.CreatedAt, string(c.Format), c.HTML, tenant)
+		if err != nil {
+			return nil, err
+		}
+
+		if c.ParentID != nil {
+			_, err = tx.ExecContext(ctx, `INSERT INTO comment_hierarchy (parent_id, child_id) VALUES (?, ?)`, *c.ParentID, c.ID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for j, handle := range c.Mentions {
+			_, err = tx.ExecContext(ctx, `INSERT INTO comment_mentions (comment_id, handle, position) VALUES (?, ?, ?)`, c.ID, handle, j)
+			if err != nil {
+				return nil, err
+			}
+		}
+		imported[i] = c
+	}
+
+	return imported, tx.Commit()
+}
+
+// Проверяет, что заданные id свободны, и заменяет нулевые следующими после наибольшего
+// из sqlite_sequence, таблицы и пачки. AUTOINCREMENT не выдает id удаленных записей, поэтому учитывается sqlite_sequence
+func assignIDs(ctx context.Context, tx *sql.Tx, table string, ids []int) error {
+	var next int
+	err := tx.QueryRowContext(ctx, `SELECT MAX(COALESCE((SELECT seq FROM sqlite_sequence WHERE name = ?), 0), COALESCE((SELECT MAX(id) FROM `+table+`), 0))`, table).Scan(&next)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[int]struct{}, len(ids))
+	for _, id := range ids {
+		if id == 0 {
+			continue
+		}
+		if _, dup := seen[id]; dup {
+			return ErrIDConflict
+		}
+		seen[id] = struct{}{}
+
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM `+table+` WHERE id=?)`, id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrIDConflict
+		}
+		if id > next {
+			next = id
+		}
+	}
+
+	for i := range ids {
+		if ids[i] == 0 {
+			next++
+			ids[i] = next
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package sqlite
+
+import (
+	"context"
+	"graphql-comments/models"
+	"time"
+)
+
+// RETURNING в SQLite не понимает псевдоним таблицы, поэтому пост перечитывается после обновления
+func (s *SQLiteStorage) SetPostStatus(ctx context.Context, id int, status models.PostStatus, publishAt *time.Time) (models.Post, error) {
+	// у черновика время публикации сбрасывается, опубликованный без времени получает текущее
+	if status == models.PostStatusDraft {
+		publishAt = nil
+	} else if publishAt == nil {
+		now := time.Now()
+		publishAt = &now
+	}
+
+	res, err := s.db.ExecContext(ctx, `UPDATE posts SET status = ?, publish_at = ? WHERE id = ? AND tenant_id = ?`, string(status), utcOrNil(publishAt), id, models.TenantFromContext(ctx))
+	if err != nil {
+		return models.Post{}, err
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return models.Post{}, err
+	} else if affected == 0 {
+		return models.Post{}, ErrPostNotFound
+	}
+
+	post, err := s.GetPost(ctx, id)
+	if err != nil {
+		return models.Post{}, err
+	}
+	return *post, nil
+}
+
+// Публикует посты всех арендаторов. Выборка и обновление идут в одной транзакции, а единственное соединение не дает другому писателю вклиниться
+func (s *SQLiteStorage) PublishDuePosts(ctx context.Context, now time.Time) ([]models.Post, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + postColumns + ` FROM posts p 
+			WHERE p.status = 'SCHEDULED' AND p.publish_at <= ? ORDER BY p.publish_at, p.id`
+	rows, err := tx.QueryContext(ctx, query, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	var published []models.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		post.Status = models.PostStatusPublished
+		published = append(published, *post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, p := range published {
+		if _, err := tx.ExecContext(ctx, `UPDATE posts SET status = 'PUBLISHED' WHERE id = ?`, p.ID); err != nil {
+			return nil, err
+		}
+	}
+	return published, tx.Commit()
+}
@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"graphql-comments/models"
+	"time"
+)
+
+// Проверка версии и запись идут в одной транзакции, а единственное соединение не дает
+// другому писателю вклиниться между ними
+func (s *SQLiteStorage) UpdatePost(ctx context.Context, p models.Post, expectedVersion int) (models.Post, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return p, err
+	}
+	defer tx.Rollback()
+
+	current, err := scanPost(tx.QueryRowContext(ctx, `SELECT `+postColumns+` FROM posts p WHERE p.id=? AND p.tenant_id=?`, p.ID, models.TenantFromContext(ctx)))
+	if err == sql.ErrNoRows {
+		return p, ErrPostNotFound
+	}
+	if err != nil {
+		return p, err
+	}
+	if current.Version != expectedVersion {
+		return *current, ErrVersionConflict
+	}
+
+	updated := *current
+	updated.Title = p.Title
+	updated.Content = p.Content
+	updated.ContentHTML = p.ContentHTML
+	updated.AllowComments = p.AllowComments
+	updated.Format = formatOrPlain(p.Format)
+	updated.Version = current.Version + 1
+
+	query := `UPDATE posts SET title=?, content=?, format=?, content_html=?, allow_comments=?, version=? WHERE id=?`
+	_, err = tx.ExecContext(ctx, query, updated.Title, updated.Content, string(updated.Format), updated.ContentHTML, updated.AllowComments, updated.Version, updated.ID)
+	if err != nil {
+		return p, err
+	}
+	if err := insertRevision(ctx, tx, models.RevisionOf(&updated, time.Now().UTC())); err != nil {
+		return p, err
+	}
+
+	return updated, tx.Commit()
+}
+
+func (s *SQLiteStorage) GetPostRevisions(ctx context.Context, postID int) ([]*models.PostRevision, error) {
+	query := `SELECT post_id, version, title, content, format, allow_comments, created_at 
+			FROM post_revisions r WHERE r.post_id=? 
+			AND EXISTS(SELECT 1 FROM posts p WHERE p.id = r.post_id AND p.tenant_id = ?) ORDER BY version`
+	rows, err := s.db.QueryContext(ctx, query, postID, models.TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*models.PostRevision
+	for rows.Next() {
+		var r models.PostRevision
+		var format string
+		if err := rows.Scan(&r.PostID, &r.Version, &r.Title, &r.Content, &format, &r.AllowComments, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.Format = models.TextFormat(format)
+		r.CreatedAt = r.CreatedAt.UTC()
+		revisions = append(revisions, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// у каждого поста есть хотя бы первая ревизия, пустой результат значит, что поста нет
+	if len(revisions) == 0 {
+		return nil, ErrPostNotFound
+	}
+	return revisions, nil
+}
+
+func insertRevision(ctx context.Context, tx *sql.Tx, r models.PostRevision) error {
+	query := `INSERT INTO post_revisions (post_id, version, title, content, format, allow_comments, created_at) 
+			VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := tx.ExecContext(ctx, query, r.PostID, r.Version, r.Title, r.Content, string(r.Format), r.AllowComments, r.CreatedAt.UTC())
+	return err
+}
@@ -0,0 +1,114 @@
+package sqlite
+
+import (
+	"context"
+	"graphql-comments/models"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// длина сниппета в токенах, как MaxWords у ts_headline в postgres
+const snippetTokens = 20
+
+func (s *SQLiteStorage) Search(ctx context.Context, q models.SearchQuery) ([]*models.SearchResult, error) {
+	match := ftsQuery(q.Text)
+	if q.Limit <= 0 || match == "" {
+		return nil, nil
+	}
+
+	var results []*models.SearchResult
+	if q.Scope.IncludesPosts() {
+		posts, err := s.searchPosts(ctx, q, match)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, posts...)
+	}
+	if q.Scope.IncludesComments() {
+		comments, err := s.searchComments(ctx, q, match)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, comments...)
+	}
+
+	// каждая выборка уже отсортирована и ограничена, осталось слить их
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
+
+// bm25 в SQLite тем меньше, чем документ релевантнее, поэтому знак меняется
+func (s *SQLiteStorage) searchPosts(ctx context.Context, q models.SearchQuery, match string) ([]*models.SearchResult, error) {
+	query := `SELECT ` + postColumns + `, 
+			-bm25(posts_fts, 2.0, 1.0) AS score, snippet(posts_fts, -1, ?1, ?2, '…', ?3) 
+			FROM posts_fts JOIN posts p ON p.id = posts_fts.rowid 
+			WHERE posts_fts MATCH ?4 AND p.status = 'PUBLISHED' AND p.tenant_id = ?7 AND (?5 IS NULL OR p.id = ?5) 
+			ORDER BY score DESC, p.created_at DESC LIMIT ?6`
+	rows, err := s.db.QueryContext(ctx, query, models.SnippetHighlightStart, models.SnippetHighlightStop, snippetTokens, match, q.PostID, q.Limit, models.TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.SearchResult
+	for rows.Next() {
+		var r models.SearchResult
+		post, err := scanPost(rows, &r.Score, &r.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		r.Post = post
+		r.Snippet = models.FormatSnippet(r.Snippet)
+		results = append(results, &r)
+	}
+
+	return results, rows.Err()
+}
+
+func (s *SQLiteStorage) searchComments(ctx context.Context, q models.SearchQuery, match string) ([]*models.SearchResult, error) {
+	query := `SELECT ` + commentColumns + `, 
+			-bm25(comments_fts) AS score, snippet(comments_fts, -1, ?1, ?2, '…', ?3) 
+			FROM comments_fts JOIN comments c ON c.id = comments_fts.rowid 
+			WHERE comments_fts MATCH ?4 AND c.tenant_id = ?7 AND (?5 IS NULL OR c.post_id = ?5) 
+			AND EXISTS(SELECT 1 FROM posts p WHERE p.id = c.post_id AND p.status = 'PUBLISHED') 
+			ORDER BY score DESC, c.created_at DESC LIMIT ?6`
+	rows, err := s.db.QueryContext(ctx, query, models.SnippetHighlightStart, models.SnippetHighlightStop, snippetTokens, match, q.PostID, q.Limit, models.TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.SearchResult
+	for rows.Next() {
+		var r models.SearchResult
+		comment, err := scanComment(rows, &r.Score, &r.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		r.Comment = comment
+		r.Snippet = models.FormatSnippet(r.Snippet)
+		results = append(results, &r)
+	}
+
+	return results, rows.Err()
+}
+
+// Превращает пользовательский запрос в запрос FTS5: каждое слово берется в кавычки,
+// чтобы операторы и спецсимволы FTS5 не ломали разбор, а слова объединяются по И
+func ftsQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		quoted = append(quoted, `"`+word+`"`)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,493 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"graphql-comments/config"
+	"graphql-comments/migrations"
+	"graphql-comments/models"
+	"net/url"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// ошибки объявлены в models и общие для всех хранилищ
+var (
+	ErrPostNotFound          = models.ErrPostNotFound
+	ErrCommentsAreNotAllowed = models.ErrCommentsAreNotAllowed
+	ErrParentCommentNotFound = models.ErrParentCommentNotFound
+	ErrCommentNotFound       = models.ErrCommentNotFound
+	ErrIDConflict            = models.ErrIDConflict
+	ErrVersionConflict       = models.ErrVersionConflict
+	ErrThreadNotFound        = models.ErrThreadNotFound
+	ErrSchemaOutdated        = models.ErrSchemaOutdated
+	ErrSchemaDirty           = models.ErrSchemaDirty
+)
+
+type SQLiteStorage struct {
+	db *sql.DB
+
+	// версия вшитых миграций, до которой должна быть накачена схема
+	schemaVersion uint
+}
+
+// Конструктор хранилища на SQLite. Схему создает migrations.RunSQLiteMigrations
+func NewSQLiteStorage(cfg *config.Config) (*SQLiteStorage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ReadTimeout)
+	defer cancel()
+
+	pragmas := url.Values{}
+	pragmas.Add("_pragma", "foreign_keys(1)")
+	pragmas.Add("_pragma", "journal_mode(WAL)")
+	pragmas.Add("_pragma", "busy_timeout(5000)")
+
+	db, err := sql.Open("sqlite", "file:"+cfg.SqlitePath+"?"+pragmas.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite допускает одного писателя, единственное соединение избавляет от SQLITE_BUSY в транзакциях
+	db.SetMaxOpenConns(1)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	schemaVersion, err := migrations.SQLiteVersion()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStorage{db: db, schemaVersion: schemaVersion}, nil
+}
+
+func (s *SQLiteStorage) CreatePost(ctx context.Context, p models.Post) (models.Post, error) {
+	if err := p.NormalizeTaxonomy(); err != nil {
+		return p, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return p, err
+	}
+	defer tx.Rollback()
+
+	if err := createPost(ctx, tx, &p); err != nil {
+		return p, err
+	}
+	return p, tx.Commit()
+}
+
+// Вставляет новый пост вместе с тегами и первой ревизией и заполняет его id
+func createPost(ctx context.Context, tx *sql.Tx, p *models.Post) error {
+	query := `INSERT INTO posts (title, author, content, allow_comments, format, content_html, created_at, version, status, publish_at, category, thread_namespace, thread_key, tenant_id) 
+			VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?, ?) RETURNING id`
+	p.Format = formatOrPlain(p.Format)
+	p.CreatedAt = time.Now().UTC()
+	p.Version = 1
+	p.SetDefaultStatus(p.CreatedAt)
+	p.PublishAt = utcOrNil(p.PublishAt)
+	p.TenantID = models.TenantFromContext(ctx)
+	namespace, key := threadArgs(p.Thread)
+	row := tx.QueryRowContext(ctx, query, p.Title, p.Author, p.Content, p.AllowComments, string(p.Format), p.ContentHTML, p.CreatedAt,
+		string(p.Status), p.PublishAt, p.Category, namespace, key, p.TenantID)
+	if err := row.Scan(&p.ID); err != nil {
+		return err
+	}
+	if err := insertTags(ctx, tx, p.ID, p.Tags); err != nil {
+		return err
+	}
+
+	return insertRevision(ctx, tx, models.RevisionOf(p, p.CreatedAt))
+}
+
+func (s *SQLiteStorage) CreateComment(ctx context.Context, c models.Comment, parentID *int) (models.Comment, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return c, err
+	}
+	defer tx.Rollback()
+
+	// неопубликованные посты комментировать нельзя, пост другого арендатора для этого запроса не существует
+	c.TenantID = models.TenantFromContext(ctx)
+	var allowComments bool
+	query := `SELECT allow_comments AND status = 'PUBLISHED' FROM posts WHERE id=? AND tenant_id=?`
+	err = tx.QueryRowContext(ctx, query, c.PostID, c.TenantID).Scan(&allowComments)
+	if err != nil {
+		return c, ErrPostNotFound
+	}
+
+	if !allowComments {
+		return c, ErrCommentsAreNotAllowed
+	}
+
+	if parentID != nil {
+		// Проверяем существует ли родительский комментарий
+		var parentExists bool
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM comments WHERE id=? AND post_id=?)`, *parentID, c.PostID).Scan(&parentExists)
+		if err != nil {
+			return c, err
+		}
+		if !parentExists {
+			return c, ErrParentCommentNotFound
+		}
+
+		// Устанавливаем HasReplies равным true у родительского комментария
+		_, err = tx.ExecContext(ctx, `UPDATE comments SET has_replies = TRUE WHERE id = ?`, *parentID)
+		if err != nil {
+			return c, err
+		}
+	}
+
+	c.CreatedAt = time.Now().UTC()
+	c.Format = formatOrPlain(c.Format)
+	query = `INSERT INTO comments (post_id, text, author, created_at, format, text_html, tenant_id) 
+			VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	err = tx.QueryRowContext(ctx, query, c.PostID, c.Text, c.Author, c.CreatedAt, string(c.Format), c.HTML, c.TenantID).Scan(&c.ID)
+	if err != nil {
+		return c, err
+	}
+	c.ParentID = parentID
+
+	if parentID != nil {
+		_, err = tx.ExecContext(ctx, `INSERT INTO comment_hierarchy (parent_id, child_id) VALUES (?, ?)`, *parentID, c.ID)
+		if err != nil {
+			return c, err
+		}
+	}
+
+	for i, handle := range c.Mentions {
+		_, err = tx.ExecContext(ctx, `INSERT INTO comment_mentions (comment_id, handle, position) VALUES (?, ?, ?)`, c.ID, handle, i)
+		if err != nil {
+			return c, err
+		}
+	}
+
+	err = tx.Commit()
+	return c, err
+}
+
+func (s *SQLiteStorage) GetPost(ctx context.Context, id int) (*models.Post, error) {
+	query := `SELECT ` + postColumns + ` FROM posts p WHERE p.id=? AND p.tenant_id=?`
+	row := s.db.QueryRowContext(ctx, query, id, models.TenantFromContext(ctx))
+
+	post, err := scanPost(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrPostNotFound
+	}
+	return post, err
+}
+
+func (s *SQLiteStorage) GetComment(ctx context.Context, id int) (*models.Comment, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments c WHERE c.id=? AND c.tenant_id=?`
+	row := s.db.QueryRowContext(ctx, query, id, models.TenantFromContext(ctx))
+
+	comment, err := scanComment(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrCommentNotFound
+	}
+	return comment, err
+}
+
+func (s *SQLiteStorage) GetPosts(ctx context.Context, filter models.PostFilter) ([]*models.Post, error) {
+	query := `SELECT ` + postColumns + ` FROM posts p 
+			WHERE p.tenant_id = ?5 AND (?1 OR p.status = 'PUBLISHED' OR (?2 <> '' AND p.author = ?2)) 
+			AND (?1 OR p.thread_namespace IS NULL) 
+			AND (?3 = '' OR p.category = ?3) 
+			AND (SELECT count(*) FROM post_tags t WHERE t.post_id = p.id AND t.tag IN (SELECT value FROM json_each(?4))) = json_array_length(?4) 
+			ORDER BY p.created_at DESC, p.id DESC`
+	// теги фильтра передаются JSON массивом, пустой массив не фильтрует
+	if filter.Tags == nil {
+		filter.Tags = []string{}
+	}
+	tags, err := json.Marshal(filter.Tags)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, query, filter.Unpublished, filter.Viewer, filter.Category, string(tags), models.TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []*models.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
+func (s *SQLiteStorage) GetComments(ctx context.Context, postID int, parentID *int, limit, afterID int) ([]*models.Comment, error) {
+	if err := s.checkThread(ctx, postID, parentID); err != nil {
+		return nil, err
+	}
+	// отрицательный LIMIT в SQLite снимает ограничение, поэтому пустую страницу отдаем сами
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	var rows *sql.Rows
+	var err error
+
+	if parentID == nil {
+		query := `SELECT ` + commentColumns + ` FROM comments c 
+				WHERE c.post_id=? AND c.id NOT IN 
+				(SELECT child_id FROM comment_hierarchy) AND c.id > ? 
+				ORDER BY c.created_at, c.id LIMIT ?`
+		rows, err = s.db.QueryContext(ctx, query, postID, afterID, limit)
+	} else {
+		query := `SELECT ` + commentColumns + ` FROM comments c 
+				JOIN comment_hierarchy ch ON c.id = ch.child_id 
+				WHERE ch.parent_id = ? AND c.id > ? 
+				ORDER BY c.created_at, c.id LIMIT ?`
+		rows, err = s.db.QueryContext(ctx, query, *parentID, afterID, limit)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanComments(rows)
+}
+
+func (s *SQLiteStorage) GetMentions(ctx context.Context, handle string, limit, afterID int) ([]*models.Comment, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	query := `SELECT ` + commentColumns + ` FROM comments c 
+			JOIN comment_mentions cm ON c.id = cm.comment_id 
+			WHERE cm.handle = ? AND c.tenant_id = ? AND c.id > ? 
+			AND EXISTS(SELECT 1 FROM posts p WHERE p.id = c.post_id AND p.status = 'PUBLISHED') 
+			ORDER BY c.id LIMIT ?`
+	rows, err := s.db.QueryContext(ctx, query, models.NormalizeHandle(handle), models.TenantFromContext(ctx), afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanComments(rows)
+}
+
+func (s *SQLiteStorage) CreateNotification(ctx context.Context, n models.Notification) (models.Notification, error) {
+	n.Recipient = models.NormalizeHandle(n.Recipient)
+	n.Read = false
+	n.CreatedAt = time.Now().UTC()
+	n.TenantID = models.TenantFromContext(ctx)
+
+	query := `INSERT INTO notifications (recipient, type, actor, post_id, comment_id, message, created_at, tenant_id) 
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	row := s.db.QueryRowContext(ctx, query, n.Recipient, string(n.Type), n.Actor, n.PostID, n.CommentID, n.Message, n.CreatedAt, n.TenantID)
+
+	err := row.Scan(&n.ID)
+	return n, err
+}
+
+func (s *SQLiteStorage) GetNotifications(ctx context.Context, recipient string, limit, beforeID int, unreadOnly bool) ([]*models.Notification, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	query := `SELECT id, recipient, type, actor, post_id, comment_id, message, read, created_at, tenant_id FROM notifications 
+			WHERE recipient = ?1 AND tenant_id = ?5 AND (?2 = 0 OR id < ?2) AND (NOT ?3 OR NOT read) 
+			ORDER BY id DESC LIMIT ?4`
+	rows, err := s.db.QueryContext(ctx, query, models.NormalizeHandle(recipient), beforeID, unreadOnly, limit, models.TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []*models.Notification
+	for rows.Next() {
+		var n models.Notification
+		var notificationType string
+		if err := rows.Scan(&n.ID, &n.Recipient, &notificationType, &n.Actor, &n.PostID, &n.CommentID, &n.Message, &n.Read, &n.CreatedAt, &n.TenantID); err != nil {
+			return nil, err
+		}
+		n.Type = models.NotificationType(notificationType)
+		n.CreatedAt = n.CreatedAt.UTC()
+		notifications = append(notifications, &n)
+	}
+
+	return notifications, rows.Err()
+}
+
+func (s *SQLiteStorage) MarkNotificationsRead(ctx context.Context, recipient string, ids []int) (int, error) {
+	query := `UPDATE notifications SET read = TRUE WHERE recipient = ? AND tenant_id = ? AND NOT read`
+	args := []interface{}{models.NormalizeHandle(recipient), models.TenantFromContext(ctx)}
+	if len(ids) > 0 {
+		// в SQLite нет массивов, поэтому список id разворачивается в плейсхолдеры
+		query += ` AND id IN (?` + strings.Repeat(`, ?`, len(ids)-1) + `)`
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := res.RowsAffected()
+	return int(affected), err
+}
+
+// Проверяет, что пост существует, а родительский комментарий, если он указан, находится под этим постом
+func (s *SQLiteStorage) checkThread(ctx context.Context, postID int, parentID *int) error {
+	var postExists, parentExists bool
+	query := `SELECT EXISTS(SELECT 1 FROM posts WHERE id=?1 AND tenant_id=?3), 
+			?2 IS NULL OR EXISTS(SELECT 1 FROM comments WHERE id=?2 AND post_id=?1)`
+	if err := s.db.QueryRowContext(ctx, query, postID, parentID, models.TenantFromContext(ctx)).Scan(&postExists, &parentExists); err != nil {
+		return err
+	}
+	if !postExists {
+		return ErrPostNotFound
+	}
+	if !parentExists {
+		return ErrParentCommentNotFound
+	}
+	return nil
+}
+
+// колонки поста p в порядке, который ожидает scanPost
+const postColumns = `p.id, p.title, p.author, p.content, p.created_at, p.allow_comments, p.format, p.content_html, p.version, p.status, p.publish_at, 
+	p.category, (SELECT group_concat(t.tag, ',') FROM (SELECT tag FROM post_tags WHERE post_id = p.id ORDER BY tag) t), p.thread_namespace, p.thread_key, p.tenant_id`
+
+// колонки комментария c в порядке, который ожидает scanComment: id родителя берется из иерархии,
+// хендлы упомянутых пользователей склеиваются через запятую, в хендлах запятых не бывает
+const commentColumns = `c.id, c.post_id, 
+	(SELECT h.parent_id FROM comment_hierarchy h WHERE h.child_id = c.id), 
+	c.author, c.text, c.created_at, c.has_replies, 
+	(SELECT group_concat(m.handle, ',') FROM (SELECT handle FROM comment_mentions WHERE comment_id = c.id ORDER BY position) m), 
+	c.format, c.text_html, c.tenant_id`
+
+// общий интерфейс *sql.Row и *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Вспомогательная функция сканирует строку с колонками postColumns, extra получают следующие за ними колонки
+func scanPost(row scanner, extra ...interface{}) (*models.Post, error) {
+	var p models.Post
+	var format, status string
+	var tags, namespace, key sql.NullString
+	dest := append([]interface{}{&p.ID, &p.Title, &p.Author, &p.Content, &p.CreatedAt, &p.AllowComments, &format, &p.ContentHTML, &p.Version, &status, &p.PublishAt,
+		&p.Category, &tags, &namespace, &key, &p.TenantID}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if namespace.Valid && key.Valid {
+		p.Thread = &models.ThreadKey{Namespace: namespace.String, Key: key.String}
+	}
+	if tags.String != "" {
+		p.Tags = strings.Split(tags.String, ",")
+	}
+	p.Format = models.TextFormat(format)
+	p.Status = models.PostStatus(status)
+	p.CreatedAt = p.CreatedAt.UTC()
+	p.PublishAt = utcOrNil(p.PublishAt)
+
+	return &p, nil
+}
+
+// Вспомогательная функция сканирует строку с колонками commentColumns, extra получают следующие за ними колонки
+func scanComment(row scanner, extra ...interface{}) (*models.Comment, error) {
+	var c models.Comment
+	var format string
+	var mentions sql.NullString
+	dest := append([]interface{}{&c.ID, &c.PostID, &c.ParentID, &c.Author, &c.Text, &c.CreatedAt, &c.HasReplies, &mentions, &format, &c.HTML, &c.TenantID}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	c.Format = models.TextFormat(format)
+	c.CreatedAt = c.CreatedAt.UTC()
+	if mentions.String != "" {
+		c.Mentions = strings.Split(mentions.String, ",")
+	}
+
+	return &c, nil
+}
+
+// Вспомогательная функция сканирует все строки с колонками commentColumns
+func scanComments(rows *sql.Rows) ([]*models.Comment, error) {
+	var comments []*models.Comment
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+
+	return comments, rows.Err()
+}
+
+// ключ треда хранится в двух колонках, у обычных постов обе NULL
+func threadArgs(k *models.ThreadKey) (namespace, key *string) {
+	if k == nil {
+		return nil, nil
+	}
+	return &k.Namespace, &k.Key
+}
+
+// формат по умолчанию для записей, созданных без явного формата
+func formatOrPlain(f models.TextFormat) models.TextFormat {
+	if f == "" {
+		return models.TextFormatPlain
+	}
+	return f
+}
+
+// время публикации хранится и отдается в UTC, как и created_at
+func utcOrNil(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// Проверяет соединение с файлом бд и версию схемы в таблице schema_migrations, которую ведет golang-migrate
+func (s *SQLiteStorage) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	var version int64
+	var dirty bool
+	err := s.db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSchemaOutdated
+	}
+	if err != nil {
+		return err
+	}
+	return checkSchemaVersion(uint(version), dirty, s.schemaVersion)
+}
+
+func checkSchemaVersion(version uint, dirty bool, want uint) error {
+	if dirty {
+		return fmt.Errorf("%w: migration %d did not finish", ErrSchemaDirty, version)
+	}
+	if version < want {
+		return fmt.Errorf("%w: version %d, want %d", ErrSchemaOutdated, version, want)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
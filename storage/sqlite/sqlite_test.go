@@ -0,0 +1,478 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"graphql-comments/config"
+	"graphql-comments/migrations"
+	"graphql-comments/models"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Инициализация хранилища для тестов, каждый тест получает собственный файл базы с накатанными миграциями
+func setupStorage(t *testing.T) *SQLiteStorage {
+	cfg := &config.Config{
+		SqlitePath:  filepath.Join(t.TempDir(), "comments.db"),
+		ReadTimeout: 5 * time.Second,
+	}
+
+	err := migrations.RunSQLiteMigrations(cfg)
+	assert.NoError(t, err)
+
+	storage, err := NewSQLiteStorage(cfg)
+	assert.NoError(t, err)
+	t.Cleanup(func() { storage.Close() })
+
+	return storage
+}
+
+func TestCreatePost(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	post := models.Post{
+		Title:         "Тест",
+		Content:       "Что-нибудь",
+		Author:        "Вася",
+		AllowComments: true,
+	}
+
+	createdPost, err := storage.CreatePost(ctx, post)
+	assert.NoError(t, err)
+	assert.NotZero(t, createdPost.ID)
+	assert.WithinDuration(t, time.Now(), createdPost.CreatedAt, time.Second)
+	assert.Equal(t, "Тест", createdPost.Title)
+	assert.Equal(t, "Что-нибудь", createdPost.Content)
+	assert.Equal(t, "Вася", createdPost.Author)
+	assert.True(t, createdPost.AllowComments)
+}
+
+func TestCreateComment(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	post := models.Post{
+		Title:         "Тест",
+		Content:       "Что-нибудь",
+		Author:        "Гена",
+		AllowComments: true,
+	}
+
+	createdPost, err := storage.CreatePost(ctx, post)
+	assert.NoError(t, err)
+
+	comment := models.Comment{
+		PostID: createdPost.ID,
+		Text:   "Баян",
+		Author: "Вася",
+	}
+
+	createdComment, err := storage.CreateComment(ctx, comment, nil)
+	assert.NoError(t, err)
+	assert.NotZero(t, createdComment.ID)
+	assert.WithinDuration(t, time.Now(), createdComment.CreatedAt, time.Second)
+	assert.Equal(t, "Баян", createdComment.Text)
+	assert.Equal(t, "Вася", createdComment.Author)
+	assert.Equal(t, createdPost.ID, createdComment.PostID)
+}
+
+func TestCreateCommentForNonExistingPost(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	comment := models.Comment{
+		PostID: 1337, // несуществующий айди поста
+		Text:   "Огонь",
+		Author: "Андрей",
+	}
+
+	_, err := storage.CreateComment(ctx, comment, nil)
+	assert.Error(t, err)
+	assert.Equal(t, ErrPostNotFound, err)
+}
+
+func TestCreateCommentWhenCommentsNotAllowed(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	post := models.Post{
+		Title:         "Тест",
+		Content:       "Простыня",
+		Author:        "Вася",
+		AllowComments: false,
+	}
+
+	createdPost, err := storage.CreatePost(ctx, post)
+	assert.NoError(t, err)
+
+	comment := models.Comment{
+		PostID: createdPost.ID,
+		Text:   "Много букв",
+		Author: "Петя",
+	}
+
+	_, err = storage.CreateComment(ctx, comment, nil)
+	assert.Error(t, err)
+	assert.Equal(t, ErrCommentsAreNotAllowed, err)
+}
+
+func TestGetPost(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	post := models.Post{
+		Title:         "Тест",
+		Content:       "Пост",
+		Author:        "Я",
+		AllowComments: true,
+	}
+
+	createdPost, err := storage.CreatePost(ctx, post)
+	assert.NoError(t, err)
+
+	retrievedPost, err := storage.GetPost(ctx, createdPost.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, createdPost, *retrievedPost)
+}
+
+func TestGetPostNotFound(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	_, err := storage.GetPost(ctx, 228) // несуществующий айди поста
+	assert.Error(t, err)
+	assert.Equal(t, ErrPostNotFound, err)
+}
+
+func TestGetPosts(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	post1 := models.Post{
+		Title:         "Тест1",
+		Content:       "Первый",
+		Author:        "1",
+		AllowComments: true,
+	}
+	post2 := models.Post{
+		Title:         "Тест2",
+		Content:       "Второй",
+		Author:        "2",
+		AllowComments: true,
+	}
+
+	createdPost1, err := storage.CreatePost(ctx, post1)
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	createdPost2, err := storage.CreatePost(ctx, post2)
+	assert.NoError(t, err)
+
+	posts, err := storage.GetPosts(ctx, models.PostFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(posts))
+	assert.Equal(t, createdPost2.ID, posts[0].ID) // пост2 должен добавиться позже
+	assert.Equal(t, createdPost1.ID, posts[1].ID)
+}
+
+func TestGetComments(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	post := models.Post{
+		Title:         "Тест",
+		Content:       "Пост",
+		Author:        "Пушкин",
+		AllowComments: true,
+	}
+
+	createdPost, err := storage.CreatePost(ctx, post)
+	assert.NoError(t, err)
+
+	comment1 := models.Comment{
+		PostID: createdPost.ID,
+		Text:   "1",
+		Author: "Лермонтов",
+	}
+	comment2 := models.Comment{
+		PostID: createdPost.ID,
+		Text:   "2",
+		Author: "Дантес",
+	}
+
+	createdComment1, err := storage.CreateComment(ctx, comment1, nil)
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	createdComment2, err := storage.CreateComment(ctx, comment2, nil)
+	assert.NoError(t, err)
+
+	comments, err := storage.GetComments(ctx, createdPost.ID, nil, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(comments))
+	assert.Equal(t, createdComment1.ID, comments[0].ID)
+	assert.Equal(t, createdComment2.ID, comments[1].ID)
+}
+
+func TestGetCommentsWithPagination(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	post := models.Post{
+		Title:         "Тест",
+		Content:       "Пост",
+		Author:        "Автор",
+		AllowComments: true,
+	}
+
+	createdPost, err := storage.CreatePost(ctx, post)
+	assert.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		comment := models.Comment{
+			PostID: createdPost.ID,
+			Text:   "Коммент номер " + fmt.Sprint(i),
+			Author: "Уткин",
+		}
+		_, err := storage.CreateComment(ctx, comment, nil)
+		assert.NoError(t, err)
+	}
+
+	comments, err := storage.GetComments(ctx, createdPost.ID, nil, 2, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(comments))
+
+	comments, err = storage.GetComments(ctx, createdPost.ID, nil, 2, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(comments))
+
+	comments, err = storage.GetComments(ctx, createdPost.ID, nil, 2, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(comments))
+}
+
+func TestGetCommentsHierarchy(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	post := models.Post{
+		Title:         "Тест",
+		Content:       "Пост",
+		Author:        "Автор",
+		AllowComments: true,
+	}
+
+	createdPost, err := storage.CreatePost(ctx, post)
+	assert.NoError(t, err)
+
+	comment1 := models.Comment{
+		PostID: createdPost.ID,
+		Text:   "Первый",
+		Author: "1",
+	}
+	createdComment1, err := storage.CreateComment(ctx, comment1, nil)
+	assert.NoError(t, err)
+
+	comment2 := models.Comment{
+		PostID: createdPost.ID,
+		Text:   "Ответ на первый",
+		Author: "2",
+	}
+	createdComment2, err := storage.CreateComment(ctx, comment2, &createdComment1.ID)
+	assert.NoError(t, err)
+
+	comments, err := storage.GetComments(ctx, createdPost.ID, &createdComment1.ID, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(comments))
+	assert.Equal(t, createdComment2, *comments[0])
+}
+
+func TestGetMentions(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	createdPost, err := storage.CreatePost(ctx, models.Post{
+		Title:         "Тест",
+		Content:       "Пост",
+		Author:        "Автор",
+		AllowComments: true,
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := storage.CreateComment(ctx, models.Comment{
+			PostID:   createdPost.ID,
+			Text:     "@masha @vasya коммент номер " + fmt.Sprint(i),
+			Author:   "Уткин",
+			Mentions: []string{"masha", "vasya"},
+		}, nil)
+		assert.NoError(t, err)
+	}
+
+	mentions, err := storage.GetMentions(ctx, "@Masha", 2, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(mentions))
+	assert.Equal(t, []string{"masha", "vasya"}, mentions[0].Mentions)
+
+	mentions, err = storage.GetMentions(ctx, "masha", 2, mentions[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(mentions))
+
+	comments, err := storage.GetComments(ctx, createdPost.ID, nil, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"masha", "vasya"}, comments[0].Mentions)
+}
+
+func TestGetComment(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	createdPost, err := storage.CreatePost(ctx, models.Post{Title: "Тест", Content: "Пост", Author: "Автор", AllowComments: true})
+	assert.NoError(t, err)
+
+	parent, err := storage.CreateComment(ctx, models.Comment{PostID: createdPost.ID, Text: "Первый", Author: "1"}, nil)
+	assert.NoError(t, err)
+	reply, err := storage.CreateComment(ctx, models.Comment{PostID: createdPost.ID, Text: "Ответ", Author: "2"}, &parent.ID)
+	assert.NoError(t, err)
+
+	comment, err := storage.GetComment(ctx, reply.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Ответ", comment.Text)
+	assert.Equal(t, &parent.ID, comment.ParentID)
+
+	_, err = storage.GetComment(ctx, 1337)
+	assert.Equal(t, ErrCommentNotFound, err)
+}
+
+func TestNotifications(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	createdPost, err := storage.CreatePost(ctx, models.Post{Title: "Тест", Content: "Пост", Author: "Автор", AllowComments: true})
+	assert.NoError(t, err)
+
+	var ids []int
+	for i := 0; i < 3; i++ {
+		n, err := storage.CreateNotification(ctx, models.Notification{
+			Recipient: "@Masha",
+			Type:      models.NotificationTypeMention,
+			Actor:     "Уткин",
+			PostID:    createdPost.ID,
+		})
+		assert.NoError(t, err)
+		ids = append(ids, n.ID)
+	}
+
+	notifications, err := storage.GetNotifications(ctx, "masha", 2, 0, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(notifications))
+	assert.Equal(t, ids[2], notifications[0].ID) // от новых к старым
+	assert.Equal(t, models.NotificationTypeMention, notifications[0].Type)
+
+	notifications, err = storage.GetNotifications(ctx, "masha", 2, notifications[1].ID, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(notifications))
+
+	marked, err := storage.MarkNotificationsRead(ctx, "masha", ids[:2])
+	assert.NoError(t, err)
+	assert.Equal(t, 2, marked)
+
+	marked, err = storage.MarkNotificationsRead(ctx, "masha", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, marked)
+
+	notifications, err = storage.GetNotifications(ctx, "masha", 10, 0, true)
+	assert.NoError(t, err)
+	assert.Empty(t, notifications)
+}
+
+func TestSearch(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	post1, err := storage.CreatePost(ctx, models.Post{Title: "Котики", Content: "Все о домашних животных", Author: "Автор", AllowComments: true})
+	assert.NoError(t, err)
+	post2, err := storage.CreatePost(ctx, models.Post{Title: "Собаки", Content: "Собаки тоже любят котики, но не всегда", Author: "Автор", AllowComments: true})
+	assert.NoError(t, err)
+
+	comment, err := storage.CreateComment(ctx, models.Comment{PostID: post2.ID, Text: "А у меня дома <b>два</b> кота и котики", Author: "Петя"}, nil)
+	assert.NoError(t, err)
+
+	results, err := storage.Search(ctx, models.SearchQuery{Text: "котики", Scope: models.SearchScopeAll, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(results))
+	// совпадение в заголовке весит больше, чем в тексте
+	assert.Equal(t, post1.ID, results[0].Post.ID)
+
+	results, err = storage.Search(ctx, models.SearchQuery{Text: "котики дома", Scope: models.SearchScopeComments, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, comment.ID, results[0].Comment.ID)
+	assert.Contains(t, results[0].Snippet, "<mark>котики</mark>")
+	assert.NotContains(t, results[0].Snippet, "<b>")
+
+	results, err = storage.Search(ctx, models.SearchQuery{Text: "котики", Scope: models.SearchScopePosts, PostID: &post2.ID, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, post2.ID, results[0].Post.ID)
+}
+
+func TestConcurrentComments(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	createdPost, err := storage.CreatePost(ctx, models.Post{Title: "Тест", Content: "Пост", Author: "Автор", AllowComments: true})
+	assert.NoError(t, err)
+	parent, err := storage.CreateComment(ctx, models.Comment{PostID: createdPost.ID, Text: "Первый", Author: "1"}, nil)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := storage.CreateComment(ctx, models.Comment{PostID: createdPost.ID, Text: fmt.Sprint(i), Author: "2"}, &parent.ID)
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	comments, err := storage.GetComments(ctx, createdPost.ID, &parent.ID, 100, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, len(comments))
+
+	comment, err := storage.GetComment(ctx, parent.ID)
+	assert.NoError(t, err)
+	assert.True(t, comment.HasReplies)
+}
+
+func TestFTSQuery(t *testing.T) {
+	assert.Equal(t, `"котики" "dogs"`, ftsQuery(`котики, "dogs"`))
+	assert.Equal(t, `"NEAR" "x"`, ftsQuery(`NEAR(x`))
+	assert.Equal(t, "", ftsQuery(` * - `))
+}
+
+func TestPingChecksSchemaVersion(t *testing.T) {
+	storage := setupStorage(t)
+	ctx := context.Background()
+
+	assert.NoError(t, storage.Ping(ctx))
+
+	_, err := storage.db.ExecContext(ctx, `UPDATE schema_migrations SET dirty = 1`)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, storage.Ping(ctx), ErrSchemaDirty)
+
+	storage.schemaVersion++
+	_, err = storage.db.ExecContext(ctx, `UPDATE schema_migrations SET dirty = 0`)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, storage.Ping(ctx), ErrSchemaOutdated)
+
+	_, err = storage.db.ExecContext(ctx, `DELETE FROM schema_migrations`)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, storage.Ping(ctx), ErrSchemaOutdated)
+
+	assert.NoError(t, storage.Close())
+	assert.Error(t, storage.Ping(ctx))
+}
@@ -0,0 +1,94 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"graphql-comments/models"
+)
+
+func insertTags(ctx context.Context, tx *sql.Tx, postID int, tags []string) error {
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO post_tags (post_id, tag) VALUES (?, ?)`, postID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Удаление и вставка идут в одной транзакции, тег из обоих списков удаляется, как в models.MergeTags
+func (s *SQLiteStorage) UpdatePostTags(ctx context.Context, postID int, add, remove []string) (models.Post, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Post{}, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM posts WHERE id=? AND tenant_id=?)`, postID, models.TenantFromContext(ctx)).Scan(&exists); err != nil {
+		return models.Post{}, err
+	}
+	if !exists {
+		return models.Post{}, ErrPostNotFound
+	}
+
+	removed := make(map[string]struct{}, len(remove))
+	for _, tag := range remove {
+		removed[tag] = struct{}{}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM post_tags WHERE post_id=? AND tag=?`, postID, tag); err != nil {
+			return models.Post{}, err
+		}
+	}
+	var added []string
+	for _, tag := range add {
+		if _, skip := removed[tag]; !skip {
+			added = append(added, tag)
+		}
+	}
+	if err := insertTags(ctx, tx, postID, added); err != nil {
+		return models.Post{}, err
+	}
+
+	post, err := scanPost(tx.QueryRowContext(ctx, `SELECT `+postColumns+` FROM posts p WHERE p.id=?`, postID))
+	if err != nil {
+		return models.Post{}, err
+	}
+	return *post, tx.Commit()
+}
+
+func (s *SQLiteStorage) SetPostCategory(ctx context.Context, postID int, category string) (models.Post, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE posts SET category = ? WHERE id = ? AND tenant_id = ?`, category, postID, models.TenantFromContext(ctx))
+	if err != nil {
+		return models.Post{}, err
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return models.Post{}, err
+	} else if affected == 0 {
+		return models.Post{}, ErrPostNotFound
+	}
+
+	post, err := s.GetPost(ctx, postID)
+	if err != nil {
+		return models.Post{}, err
+	}
+	return *post, nil
+}
+
+func (s *SQLiteStorage) GetTags(ctx context.Context) ([]models.TagCount, error) {
+	query := `SELECT t.tag, count(*) FROM post_tags t JOIN posts p ON p.id = t.post_id 
+			WHERE p.status = 'PUBLISHED' AND p.tenant_id = ? GROUP BY t.tag ORDER BY count(*) DESC, t.tag`
+	rows, err := s.db.QueryContext(ctx, query, models.TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.TagCount{}
+	for rows.Next() {
+		var t models.TagCount
+		if err := rows.Scan(&t.Tag, &t.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
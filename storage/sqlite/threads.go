@@ -0,0 +1,40 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"graphql-comments/models"
+)
+
+func (s *SQLiteStorage) GetThread(ctx context.Context, key models.ThreadKey) (*models.Post, error) {
+	query := `SELECT ` + postColumns + ` FROM posts p WHERE p.tenant_id=? AND p.thread_namespace=? AND p.thread_key=?`
+	post, err := scanPost(s.db.QueryRowContext(ctx, query, models.TenantFromContext(ctx), key.Namespace, key.Key))
+	if err == sql.ErrNoRows {
+		return nil, ErrThreadNotFound
+	}
+	return post, err
+}
+
+// Единственное соединение с бд делает поиск и вставку в одной транзакции атомарными
+func (s *SQLiteStorage) GetOrCreateThread(ctx context.Context, key models.ThreadKey) (models.Post, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Post{}, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + postColumns + ` FROM posts p WHERE p.tenant_id=? AND p.thread_namespace=? AND p.thread_key=?`
+	post, err := scanPost(tx.QueryRowContext(ctx, query, models.TenantFromContext(ctx), key.Namespace, key.Key))
+	if err == nil {
+		return *post, nil
+	}
+	if err != sql.ErrNoRows {
+		return models.Post{}, err
+	}
+
+	p := models.NewThreadPost(key)
+	if err := createPost(ctx, tx, &p); err != nil {
+		return p, err
+	}
+	return p, tx.Commit()
+}
@@ -7,42 +7,139 @@ import (
 	"graphql-comments/models"
 	"graphql-comments/storage/inmemory"
 	"graphql-comments/storage/postgres"
+	"graphql-comments/storage/sqlite"
 	"io"
+	"time"
 )
 
 const (
 	StorageTypePostgres string = "postgres"
 	StorageTypeInmemory string = "inmemory"
+	StorageTypeSQLite   string = "sqlite"
 )
 
 type Storager interface {
-	// Сохраняет пост в хранилище, возвращает созданный пост или ошибку
+	// Сохраняет пост в хранилище, возвращает созданный пост или ошибку. Пост без статуса публикуется сразу,
+	// у опубликованного поста PublishAt равен времени создания.
+	// Теги и категория нормализуются, недопустимые отклоняются с ErrInvalidTag
 	CreatePost(ctx context.Context, p models.Post) (models.Post, error)
 
+	// Меняет заголовок, текст, формат и AllowComments поста p.ID и сохраняет новую ревизию, если текущая
+	// версия поста равна expectedVersion. Возвращает обновленный пост, а при несовпадении версий
+	// текущий пост и ErrVersionConflict
+	UpdatePost(ctx context.Context, p models.Post, expectedVersion int) (models.Post, error)
+
+	// Получает ревизии поста по возрастанию версии
+	GetPostRevisions(ctx context.Context, postID int) ([]*models.PostRevision, error)
+
 	// Сохраняет комментарии в хранилище, возвращает созданный комментарии или ошибку
 	CreateComment(ctx context.Context, c models.Comment, parentID *int) (models.Comment, error)
 
 	// Находит пост в хранилище по id
 	GetPost(ctx context.Context, id int) (*models.Post, error)
 
-	// Получает слайс всех постов из хранилища
-	GetPosts(ctx context.Context) ([]*models.Post, error)
+	// Находит комментарий в хранилище по id
+	GetComment(ctx context.Context, id int) (*models.Comment, error)
+
+	// Получает слайс постов, подходящих под фильтр, от новых к старым
+	GetPosts(ctx context.Context, filter models.PostFilter) ([]*models.Post, error)
+
+	// Меняет статус публикации поста. PUBLISHED без publishAt публикует пост сейчас,
+	// SCHEDULED откладывает публикацию до publishAt, DRAFT снимает пост с публикации
+	SetPostStatus(ctx context.Context, id int, status models.PostStatus, publishAt *time.Time) (models.Post, error)
+
+	// Публикует запланированные посты, у которых PublishAt не позже now, и возвращает их
+	PublishDuePosts(ctx context.Context, now time.Time) ([]models.Post, error)
+
+	// Добавляет посту теги add и убирает теги remove одной операцией, теги уже нормализованы.
+	// Версия поста не меняется, теги не входят в ревизии
+	UpdatePostTags(ctx context.Context, postID int, add, remove []string) (models.Post, error)
+
+	// Задает категорию поста, пустая строка убирает ее
+	SetPostCategory(ctx context.Context, postID int, category string) (models.Post, error)
+
+	// Получает теги опубликованных постов с числом постов, от популярных к редким
+	GetTags(ctx context.Context) ([]models.TagCount, error)
+
+	// Находит тред внешнего ресурса по нормализованному ключу, ErrThreadNotFound если под ресурсом еще нет комментариев
+	GetThread(ctx context.Context, key models.ThreadKey) (*models.Post, error)
+
+	// Возвращает тред внешнего ресурса, создавая его при первом обращении. Тред это служебный опубликованный пост
+	// с открытыми комментариями, он не попадает в ленту. Конкурентные вызовы с одним ключом получают один и тот же тред
+	GetOrCreateThread(ctx context.Context, key models.ThreadKey) (models.Post, error)
 
 	// Получает сплайс комментариев в треде под постом с id = postID или под комментарием с id = parenID.
 	// Поддерживается keyset пагинация
 	GetComments(ctx context.Context, postID int, parentID *int, limit, afterID int) ([]*models.Comment, error)
 
+	// Получает слайс комментариев, в которых упомянут пользователь handle, с id > afterID длинной limit
+	GetMentions(ctx context.Context, handle string, limit, afterID int) ([]*models.Comment, error)
+
+	// Полнотекстовый поиск по постам и комментариям, результаты отсортированы по релевантности
+	Search(ctx context.Context, q models.SearchQuery) ([]*models.SearchResult, error)
+
+	// Сохраняет уведомление в ящик получателя, возвращает созданное уведомление или ошибку
+	CreateNotification(ctx context.Context, n models.Notification) (models.Notification, error)
+
+	// Получает уведомления пользователя от новых к старым: не больше limit штук с id < beforeID,
+	// beforeID = 0 означает начало ящика. При unreadOnly возвращаются только непрочитанные
+	GetNotifications(ctx context.Context, recipient string, limit, beforeID int, unreadOnly bool) ([]*models.Notification, error)
+
+	// Помечает уведомления пользователя с указанными id прочитанными, пустой ids помечает все.
+	// Возвращает число уведомлений, которые были непрочитанными
+	MarkNotificationsRead(ctx context.Context, recipient string, ids []int) (int, error)
+
+	// Загружает посты пачкой в одной транзакции, нужен для импорта. Заданные ID и CreatedAt сохраняются,
+	// нулевые назначаются как в CreatePost. Возвращает посты с итоговыми id
+	ImportPosts(ctx context.Context, posts []models.Post) ([]models.Post, error)
+
+	// Загружает комментарии пачкой в одной транзакции без проверки AllowComments, нужен для импорта.
+	// Родитель должен быть уже в хранилище или раньше в той же пачке и относиться к тому же посту.
+	// Заданные ID и CreatedAt сохраняются, нулевые назначаются как в CreateComment
+	ImportComments(ctx context.Context, comments []models.Comment) ([]models.Comment, error)
+
+	// Занимает ключ идемпотентности под запрос. Если живой ключ уже есть, он не меняется
+	// и возвращается вызывающему, иначе возвращается nil. Просроченный ключ занимается заново
+	ReserveIdempotencyKey(ctx context.Context, k models.IdempotencyKey) (*models.IdempotencyKey, error)
+
+	// Запоминает id записи, созданной запросом с этим ключом
+	CompleteIdempotencyKey(ctx context.Context, scope, key string, resultID int) error
+
+	// Освобождает ключ, если запрос с ним не удался, чтобы клиент мог повторить его
+	ReleaseIdempotencyKey(ctx context.Context, scope, key string) error
+
+	// Проверяет, что хранилище готово обслуживать запросы: бд доступна и схема актуальна
+	Ping(ctx context.Context) error
+
 	// Великий закрыватор
 	io.Closer
 }
 
-// Конструктор хранилища, выбирает реализацию на основании конфигурации
+// Конструктор хранилища, выбирает реализацию на основании конфигурации и при необходимости
+// оборачивает ее метриками и кешем. Метрики стоят под кешем и измеряют только вызовы, дошедшие до бэкенда
 func New(cfg *config.Config) (Storager, error) {
+	s, err := newBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.MetricsEnabled {
+		s = NewMetricsStorage(s)
+	}
+	if cfg.CacheEnabled {
+		s = NewCachingStorage(s, cfg.CacheSize, cfg.CacheTTL)
+	}
+	return s, nil
+}
+
+func newBackend(cfg *config.Config) (Storager, error) {
 	switch cfg.StorageType {
 	case StorageTypePostgres:
 		return postgres.NewPostgresStorage(cfg)
 	case StorageTypeInmemory:
-		return inmemory.NewMemoryStorage()
+		return inmemory.NewMemoryStorage(cfg)
+	case StorageTypeSQLite:
+		return sqlite.NewSQLiteStorage(cfg)
 	default:
 		return nil, errors.New("unknown storage type")
 	}
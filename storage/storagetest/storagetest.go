@@ -0,0 +1,1169 @@
+// Пакет storagetest содержит общий набор тестов, который должна проходить любая реализация storage.Storager.
+// Каждый бэкенд подключает его в своем conformance_test.go, передавая фабрику пустых хранилищ
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"graphql-comments/models"
+	"graphql-comments/storage"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory возвращает новое пустое хранилище, закрывать его должна сама фабрика через t.Cleanup
+type Factory func(t *testing.T) storage.Storager
+
+// Run прогоняет все сценарии против хранилищ, созданных newStorage
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Storager)
+	}{
+		{"CreatePost", testCreatePost},
+		{"GetPostNotFound", testGetPostNotFound},
+		{"GetPostsOrdering", testGetPostsOrdering},
+		{"CreateCommentErrors", testCreateCommentErrors},
+		{"GetCommentsErrors", testGetCommentsErrors},
+		{"CommentsHierarchy", testCommentsHierarchy},
+		{"CommentsPagination", testCommentsPagination},
+		{"GetComment", testGetComment},
+		{"Mentions", testMentions},
+		{"MentionsOfUnpublishedPosts", testMentionsOfUnpublishedPosts},
+		{"Notifications", testNotifications},
+		{"Search", testSearch},
+		{"ConcurrentWrites", testConcurrentWrites},
+		{"Ping", testPing},
+		{"ImportPreservesIDs", testImportPreservesIDs},
+		{"ImportAssignsIDs", testImportAssignsIDs},
+		{"ImportErrors", testImportErrors},
+		{"IdempotencyKeys", testIdempotencyKeys},
+		{"UpdatePost", testUpdatePost},
+		{"UpdatePostConflict", testUpdatePostConflict},
+		{"PostStatusVisibility", testPostStatusVisibility},
+		{"SetPostStatus", testSetPostStatus},
+		{"PublishDuePosts", testPublishDuePosts},
+		{"PostTags", testPostTags},
+		{"PostCategory", testPostCategory},
+		{"ExternalThreads", testExternalThreads},
+		{"ConcurrentThreadCreation", testConcurrentThreadCreation},
+		{"ImportThreads", testImportThreads},
+		{"TenantIsolation", testTenantIsolation},
+		{"TenantThreadsAndKeys", testTenantThreadsAndKeys},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStorage(t))
+		})
+	}
+}
+
+func createPost(t *testing.T, s storage.Storager, title string, allowComments bool) models.Post {
+	post, err := s.CreatePost(context.Background(), models.Post{
+		Title:         title,
+		Content:       "Содержимое поста " + title,
+		Author:        "Автор",
+		AllowComments: allowComments,
+	})
+	require.NoError(t, err)
+	return post
+}
+
+func createComment(t *testing.T, s storage.Storager, postID int, parentID *int, text string) models.Comment {
+	comment, err := s.CreateComment(context.Background(), models.Comment{
+		PostID: postID,
+		Text:   text,
+		Author: "Комментатор",
+	}, parentID)
+	require.NoError(t, err)
+	return comment
+}
+
+func commentIDs(comments []*models.Comment) []int {
+	ids := make([]int, 0, len(comments))
+	for _, c := range comments {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func testCreatePost(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+
+	created, err := s.CreatePost(ctx, models.Post{Title: "Тест", Content: "Что-нибудь", Author: "Вася", AllowComments: true})
+	require.NoError(t, err)
+	assert.NotZero(t, created.ID)
+	assert.WithinDuration(t, time.Now(), created.CreatedAt, time.Second)
+	assert.Equal(t, models.TextFormatPlain, created.Format)
+
+	got, err := s.GetPost(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, got.ID)
+	assert.Equal(t, "Тест", got.Title)
+	assert.Equal(t, "Что-нибудь", got.Content)
+	assert.Equal(t, "Вася", got.Author)
+	assert.True(t, got.AllowComments)
+	assert.Equal(t, models.TextFormatPlain, got.Format)
+	assert.True(t, created.CreatedAt.Equal(got.CreatedAt))
+	assert.Equal(t, 1, created.Version)
+	assert.Equal(t, 1, got.Version)
+	assert.Equal(t, models.PostStatusPublished, got.Status)
+	if assert.NotNil(t, got.PublishAt) {
+		assert.WithinDuration(t, created.CreatedAt, *got.PublishAt, time.Second)
+	}
+}
+
+func testGetPostNotFound(t *testing.T, s storage.Storager) {
+	_, err := s.GetPost(context.Background(), 1337)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+}
+
+func testGetPostsOrdering(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+
+	posts, err := s.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, posts)
+
+	var ids []int
+	for i := 0; i < 3; i++ {
+		ids = append(ids, createPost(t, s, fmt.Sprint(i), true).ID)
+	}
+
+	posts, err = s.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	require.Len(t, posts, 3)
+	// от новых к старым
+	assert.Equal(t, []int{ids[2], ids[1], ids[0]}, []int{posts[0].ID, posts[1].ID, posts[2].ID})
+}
+
+func testCreateCommentErrors(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+
+	_, err := s.CreateComment(ctx, models.Comment{PostID: 1337, Text: "Огонь", Author: "Андрей"}, nil)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+
+	closed := createPost(t, s, "Закрытый", false)
+	_, err = s.CreateComment(ctx, models.Comment{PostID: closed.ID, Text: "Много букв", Author: "Петя"}, nil)
+	assert.ErrorIs(t, err, models.ErrCommentsAreNotAllowed)
+
+	post := createPost(t, s, "Открытый", true)
+	missing := 1337
+	_, err = s.CreateComment(ctx, models.Comment{PostID: post.ID, Text: "Ответ", Author: "Петя"}, &missing)
+	assert.ErrorIs(t, err, models.ErrParentCommentNotFound)
+
+	// родительский комментарий должен быть под тем же постом
+	other := createPost(t, s, "Другой", true)
+	foreign := createComment(t, s, other.ID, nil, "Чужой")
+	_, err = s.CreateComment(ctx, models.Comment{PostID: post.ID, Text: "Ответ", Author: "Петя"}, &foreign.ID)
+	assert.ErrorIs(t, err, models.ErrParentCommentNotFound)
+
+	comments, err := s.GetComments(ctx, post.ID, nil, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, comments)
+}
+
+func testGetCommentsErrors(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+
+	_, err := s.GetComments(ctx, 1337, nil, 10, 0)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+
+	post := createPost(t, s, "Тест", true)
+	missing := 1337
+	_, err = s.GetComments(ctx, post.ID, &missing, 10, 0)
+	assert.ErrorIs(t, err, models.ErrParentCommentNotFound)
+
+	other := createPost(t, s, "Другой", true)
+	foreign := createComment(t, s, other.ID, nil, "Чужой")
+	_, err = s.GetComments(ctx, post.ID, &foreign.ID, 10, 0)
+	assert.ErrorIs(t, err, models.ErrParentCommentNotFound)
+
+	// у существующего поста без комментариев пустая страница, а не ошибка
+	comments, err := s.GetComments(ctx, post.ID, nil, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, comments)
+}
+
+func testCommentsHierarchy(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	post := createPost(t, s, "Тест", true)
+
+	root := createComment(t, s, post.ID, nil, "Первый")
+	assert.Nil(t, root.ParentID)
+	assert.False(t, root.HasReplies)
+
+	reply := createComment(t, s, post.ID, &root.ID, "Ответ на первый")
+	require.NotNil(t, reply.ParentID)
+	assert.Equal(t, root.ID, *reply.ParentID)
+	nested := createComment(t, s, post.ID, &reply.ID, "Ответ на ответ")
+	second := createComment(t, s, post.ID, nil, "Второй")
+
+	// ответы не попадают в верхний уровень
+	comments, err := s.GetComments(ctx, post.ID, nil, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{root.ID, second.ID}, commentIDs(comments))
+	assert.True(t, comments[0].HasReplies)
+	assert.False(t, comments[1].HasReplies)
+
+	comments, err = s.GetComments(ctx, post.ID, &root.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{reply.ID}, commentIDs(comments))
+	assert.True(t, comments[0].HasReplies)
+	require.NotNil(t, comments[0].ParentID)
+	assert.Equal(t, root.ID, *comments[0].ParentID)
+
+	comments, err = s.GetComments(ctx, post.ID, &reply.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{nested.ID}, commentIDs(comments))
+	assert.False(t, comments[0].HasReplies)
+}
+
+func testCommentsPagination(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	post := createPost(t, s, "Тест", true)
+
+	var ids []int
+	for i := 0; i < 5; i++ {
+		ids = append(ids, createComment(t, s, post.ID, nil, "Коммент номер "+fmt.Sprint(i)).ID)
+	}
+
+	comments, err := s.GetComments(ctx, post.ID, nil, 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, ids[:2], commentIDs(comments))
+
+	comments, err = s.GetComments(ctx, post.ID, nil, 2, ids[1])
+	require.NoError(t, err)
+	assert.Equal(t, ids[2:4], commentIDs(comments))
+
+	comments, err = s.GetComments(ctx, post.ID, nil, 2, ids[3])
+	require.NoError(t, err)
+	assert.Equal(t, ids[4:], commentIDs(comments))
+
+	comments, err = s.GetComments(ctx, post.ID, nil, 2, ids[4])
+	require.NoError(t, err)
+	assert.Empty(t, comments)
+
+	// курсор не обязан быть id комментария с этой страницы
+	comments, err = s.GetComments(ctx, post.ID, nil, 10, ids[2]-1)
+	require.NoError(t, err)
+	assert.Equal(t, ids[2:], commentIDs(comments))
+
+	comments, err = s.GetComments(ctx, post.ID, nil, 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, comments)
+}
+
+func testGetComment(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	post := createPost(t, s, "Тест", true)
+
+	parent := createComment(t, s, post.ID, nil, "Первый")
+	reply := createComment(t, s, post.ID, &parent.ID, "Ответ")
+
+	comment, err := s.GetComment(ctx, reply.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Ответ", comment.Text)
+	assert.Equal(t, post.ID, comment.PostID)
+	require.NotNil(t, comment.ParentID)
+	assert.Equal(t, parent.ID, *comment.ParentID)
+	assert.True(t, reply.CreatedAt.Equal(comment.CreatedAt))
+
+	comment, err = s.GetComment(ctx, parent.ID)
+	require.NoError(t, err)
+	assert.True(t, comment.HasReplies)
+
+	_, err = s.GetComment(ctx, 1337)
+	assert.ErrorIs(t, err, models.ErrCommentNotFound)
+}
+
+func testMentions(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	post := createPost(t, s, "Тест", true)
+
+	var ids []int
+	for i := 0; i < 3; i++ {
+		c, err := s.CreateComment(ctx, models.Comment{
+			PostID:   post.ID,
+			Text:     "@masha @vasya коммент номер " + fmt.Sprint(i),
+			Author:   "Уткин",
+			Mentions: []string{"masha", "vasya"},
+		}, nil)
+		require.NoError(t, err)
+		ids = append(ids, c.ID)
+	}
+	createComment(t, s, post.ID, nil, "без упоминаний")
+
+	mentions, err := s.GetMentions(ctx, "@Masha", 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, ids[:2], commentIDs(mentions))
+	assert.Equal(t, []string{"masha", "vasya"}, mentions[0].Mentions)
+
+	mentions, err = s.GetMentions(ctx, "masha", 2, ids[1])
+	require.NoError(t, err)
+	assert.Equal(t, ids[2:], commentIDs(mentions))
+
+	mentions, err = s.GetMentions(ctx, "petya", 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, mentions)
+
+	comments, err := s.GetComments(ctx, post.ID, nil, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, comments, 4)
+	assert.Equal(t, []string{"masha", "vasya"}, comments[0].Mentions)
+	assert.Empty(t, comments[3].Mentions)
+}
+
+func testMentionsOfUnpublishedPosts(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	post := createPost(t, s, "Пост", true)
+	comment, err := s.CreateComment(ctx, models.Comment{PostID: post.ID, Text: "@masha", Author: "Вася", Mentions: []string{"masha"}}, nil)
+	require.NoError(t, err)
+
+	_, err = s.SetPostStatus(ctx, post.ID, models.PostStatusDraft, nil)
+	require.NoError(t, err)
+	mentions, err := s.GetMentions(ctx, "masha", 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, mentions)
+
+	_, err = s.SetPostStatus(ctx, post.ID, models.PostStatusPublished, nil)
+	require.NoError(t, err)
+	mentions, err = s.GetMentions(ctx, "masha", 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{comment.ID}, commentIDs(mentions))
+}
+
+func testNotifications(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	post := createPost(t, s, "Тест", true)
+
+	var ids []int
+	for i := 0; i < 3; i++ {
+		n, err := s.CreateNotification(ctx, models.Notification{
+			Recipient: "@Masha",
+			Type:      models.NotificationTypeMention,
+			Actor:     "Уткин",
+			PostID:    post.ID,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "masha", n.Recipient)
+		assert.False(t, n.Read)
+		ids = append(ids, n.ID)
+	}
+	_, err := s.CreateNotification(ctx, models.Notification{Recipient: "vasya", Type: models.NotificationTypeReply, Actor: "Уткин", PostID: post.ID})
+	require.NoError(t, err)
+
+	notifications, err := s.GetNotifications(ctx, "masha", 2, 0, false)
+	require.NoError(t, err)
+	require.Len(t, notifications, 2)
+	// от новых к старым
+	assert.Equal(t, ids[2], notifications[0].ID)
+	assert.Equal(t, ids[1], notifications[1].ID)
+	assert.Equal(t, models.NotificationTypeMention, notifications[0].Type)
+	assert.Nil(t, notifications[0].CommentID)
+
+	notifications, err = s.GetNotifications(ctx, "masha", 2, ids[1], false)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, ids[0], notifications[0].ID)
+
+	// чужие уведомления не отмечаются
+	marked, err := s.MarkNotificationsRead(ctx, "vasya", ids)
+	require.NoError(t, err)
+	assert.Equal(t, 0, marked)
+
+	marked, err = s.MarkNotificationsRead(ctx, "masha", ids[:2])
+	require.NoError(t, err)
+	assert.Equal(t, 2, marked)
+
+	notifications, err = s.GetNotifications(ctx, "masha", 10, 0, true)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, ids[2], notifications[0].ID)
+
+	marked, err = s.MarkNotificationsRead(ctx, "masha", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, marked)
+
+	notifications, err = s.GetNotifications(ctx, "masha", 10, 0, true)
+	require.NoError(t, err)
+	assert.Empty(t, notifications)
+
+	notifications, err = s.GetNotifications(ctx, "masha", 10, 0, false)
+	require.NoError(t, err)
+	require.Len(t, notifications, 3)
+	assert.True(t, notifications[0].Read)
+
+	notifications, err = s.GetNotifications(ctx, "vasya", 10, 0, true)
+	require.NoError(t, err)
+	assert.Len(t, notifications, 1)
+}
+
+func testSearch(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+
+	post1, err := s.CreatePost(ctx, models.Post{Title: "Котики", Content: "Все о домашних животных", Author: "Автор", AllowComments: true})
+	require.NoError(t, err)
+	post2, err := s.CreatePost(ctx, models.Post{Title: "Собаки", Content: "Собаки тоже любят котики, но не всегда", Author: "Автор", AllowComments: true})
+	require.NoError(t, err)
+	comment := createComment(t, s, post2.ID, nil, "А у меня дома <b>два</b> кота и котики")
+
+	results, err := s.Search(ctx, models.SearchQuery{Text: "котики", Scope: models.SearchScopeAll, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	// совпадение в заголовке весит больше, чем в тексте
+	require.NotNil(t, results[0].Post)
+	assert.Equal(t, post1.ID, results[0].Post.ID)
+	for i := 1; i < len(results); i++ {
+		assert.GreaterOrEqual(t, results[i-1].Score, results[i].Score)
+	}
+
+	results, err = s.Search(ctx, models.SearchQuery{Text: "котики дома", Scope: models.SearchScopeComments, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.NotNil(t, results[0].Comment)
+	assert.Equal(t, comment.ID, results[0].Comment.ID)
+	assert.Contains(t, results[0].Snippet, "<mark>котики</mark>")
+	assert.NotContains(t, results[0].Snippet, "<b>")
+
+	results, err = s.Search(ctx, models.SearchQuery{Text: "котики", Scope: models.SearchScopePosts, PostID: &post2.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, post2.ID, results[0].Post.ID)
+
+	results, err = s.Search(ctx, models.SearchQuery{Text: "котики", Scope: models.SearchScopeAll, Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	// лимит отсекает менее релевантные посты, а не более старые
+	results, err = s.Search(ctx, models.SearchQuery{Text: "котики", Scope: models.SearchScopePosts, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, post1.ID, results[0].Post.ID)
+
+	results, err = s.Search(ctx, models.SearchQuery{Text: "жирафы", Scope: models.SearchScopeAll, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func testConcurrentWrites(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	post := createPost(t, s, "Тест", true)
+	root := createComment(t, s, post.ID, nil, "Корень")
+
+	const workers, perWorker = 4, 10
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				var parentID *int
+				if i%2 == 1 {
+					parentID = &root.ID
+				}
+				_, err := s.CreateComment(ctx, models.Comment{PostID: post.ID, Text: fmt.Sprintf("%d-%d", w, i), Author: "Поток"}, parentID)
+				assert.NoError(t, err)
+
+				// читатели работают одновременно с писателями
+				_, err = s.GetComments(ctx, post.ID, nil, 5, 0)
+				assert.NoError(t, err)
+				_, err = s.GetPosts(ctx, models.PostFilter{})
+				assert.NoError(t, err)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make(map[int]struct{})
+	collect := func(parentID *int) int {
+		count, afterID := 0, 0
+		for {
+			page, err := s.GetComments(ctx, post.ID, parentID, 7, afterID)
+			require.NoError(t, err)
+			if len(page) == 0 {
+				return count
+			}
+			for _, c := range page {
+				assert.Greater(t, c.ID, afterID)
+				seen[c.ID] = struct{}{}
+			}
+			count += len(page)
+			afterID = page[len(page)-1].ID
+		}
+	}
+
+	assert.Equal(t, 1+workers*perWorker/2, collect(nil))
+	assert.Equal(t, workers*perWorker/2, collect(&root.ID))
+	assert.Len(t, seen, 1+workers*perWorker)
+}
+
+func testPing(t *testing.T, s storage.Storager) {
+	assert.NoError(t, s.Ping(context.Background()))
+}
+
+func testImportPreservesIDs(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	created := time.Date(2021, 3, 14, 15, 9, 26, 0, time.UTC)
+
+	posts, err := s.ImportPosts(ctx, []models.Post{
+		{ID: 7, Title: "Старый", Content: "Текст", Author: "Автор", CreatedAt: created},
+		{ID: 3, Title: "Еще старее", Content: "Текст", Author: "Автор", AllowComments: true, CreatedAt: created.Add(-time.Hour)},
+	})
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	assert.Equal(t, 7, posts[0].ID)
+	assert.Equal(t, models.TextFormatPlain, posts[0].Format)
+
+	// комментарии под закрытым постом импортируются, ответ ссылается на родителя из той же пачки
+	parentID := 10
+	comments, err := s.ImportComments(ctx, []models.Comment{
+		{ID: 10, PostID: 7, Text: "Корень", Author: "Уткин", CreatedAt: created.Add(time.Minute)},
+		{ID: 12, PostID: 7, ParentID: &parentID, Text: "@masha ответ", Author: "Гусев", Mentions: []string{"masha"}, CreatedAt: created.Add(2 * time.Minute)},
+		{ID: 4, PostID: 3, Text: "Под другим постом", Author: "Уткин", CreatedAt: created},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{10, 12, 4}, []int{comments[0].ID, comments[1].ID, comments[2].ID})
+
+	post, err := s.GetPost(ctx, 7)
+	require.NoError(t, err)
+	assert.Equal(t, "Старый", post.Title)
+	assert.False(t, post.AllowComments)
+	assert.True(t, created.Equal(post.CreatedAt))
+
+	root, err := s.GetComment(ctx, 10)
+	require.NoError(t, err)
+	assert.True(t, root.HasReplies)
+	assert.True(t, created.Add(time.Minute).Equal(root.CreatedAt))
+
+	replies, err := s.GetComments(ctx, 7, &parentID, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{12}, commentIDs(replies))
+
+	mentions, err := s.GetMentions(ctx, "masha", 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{12}, commentIDs(mentions))
+
+	// обычная запись после импорта получает id больше импортированных
+	next := createPost(t, s, "Новый", true)
+	assert.Greater(t, next.ID, 7)
+	reply := createComment(t, s, 3, nil, "Новый коммент")
+	assert.Greater(t, reply.ID, 12)
+
+	// импортированный комментарий с меньшим id встает в ленту по порядку
+	_, err = s.ImportComments(ctx, []models.Comment{{ID: 2, PostID: 3, Text: "Самый первый", Author: "Уткин", CreatedAt: created}})
+	require.NoError(t, err)
+	top, err := s.GetComments(ctx, 3, nil, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 4, reply.ID}, commentIDs(top))
+}
+
+func testImportAssignsIDs(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	existing := createPost(t, s, "Уже есть", true)
+
+	posts, err := s.ImportPosts(ctx, []models.Post{
+		{Title: "Первый", Content: "Текст", Author: "Автор"},
+		{Title: "Второй", Content: "Текст", Author: "Автор"},
+	})
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	assert.Greater(t, posts[0].ID, existing.ID)
+	assert.Greater(t, posts[1].ID, posts[0].ID)
+	assert.False(t, posts[0].CreatedAt.IsZero())
+
+	comments, err := s.ImportComments(ctx, []models.Comment{{PostID: posts[0].ID, Text: "Корень", Author: "Уткин"}})
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.NotZero(t, comments[0].ID)
+
+	replies, err := s.ImportComments(ctx, []models.Comment{{PostID: posts[0].ID, ParentID: &comments[0].ID, Text: "Ответ", Author: "Гусев"}})
+	require.NoError(t, err)
+	assert.Greater(t, replies[0].ID, comments[0].ID)
+
+	got, err := s.GetComments(ctx, posts[0].ID, &comments[0].ID, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{replies[0].ID}, commentIDs(got))
+}
+
+func testImportErrors(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	post := createPost(t, s, "Тест", true)
+	other := createPost(t, s, "Другой", true)
+	comment := createComment(t, s, post.ID, nil, "Коммент")
+
+	_, err := s.ImportPosts(ctx, []models.Post{{ID: post.ID, Title: "Дубль", Content: "Текст", Author: "Автор"}})
+	assert.ErrorIs(t, err, models.ErrIDConflict)
+
+	_, err = s.ImportComments(ctx, []models.Comment{{ID: comment.ID, PostID: post.ID, Text: "Дубль", Author: "Уткин"}})
+	assert.ErrorIs(t, err, models.ErrIDConflict)
+
+	_, err = s.ImportComments(ctx, []models.Comment{{PostID: 1337, Text: "Нет поста", Author: "Уткин"}})
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+
+	_, err = s.ImportComments(ctx, []models.Comment{{PostID: other.ID, ParentID: &comment.ID, Text: "Чужой родитель", Author: "Уткин"}})
+	assert.ErrorIs(t, err, models.ErrParentCommentNotFound)
+
+	// упавшая пачка не оставляет записей
+	_, err = s.ImportPosts(ctx, []models.Post{
+		{ID: 500, Title: "Новый", Content: "Текст", Author: "Автор"},
+		{ID: post.ID, Title: "Дубль", Content: "Текст", Author: "Автор"},
+	})
+	assert.ErrorIs(t, err, models.ErrIDConflict)
+	_, err = s.GetPost(ctx, 500)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+}
+
+func testIdempotencyKeys(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	key := models.IdempotencyKey{
+		Scope:       models.IdempotencyScopeCreateComment,
+		Key:         "retry-1",
+		RequestHash: "hash-1",
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+
+	existing, err := s.ReserveIdempotencyKey(ctx, key)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	// пока запрос выполняется, у ключа нет результата
+	existing, err = s.ReserveIdempotencyKey(ctx, key)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, "hash-1", existing.RequestHash)
+	assert.Equal(t, 0, existing.ResultID)
+
+	// тот же ключ в другой мутации не занят
+	other := key
+	other.Scope = models.IdempotencyScopeCreatePost
+	existing, err = s.ReserveIdempotencyKey(ctx, other)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	require.NoError(t, s.CompleteIdempotencyKey(ctx, key.Scope, key.Key, 42))
+	existing, err = s.ReserveIdempotencyKey(ctx, key)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, 42, existing.ResultID)
+
+	// освобожденный ключ можно занять снова
+	require.NoError(t, s.ReleaseIdempotencyKey(ctx, other.Scope, other.Key))
+	existing, err = s.ReserveIdempotencyKey(ctx, other)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	// истекший ключ занимается заново с новым input
+	expired := models.IdempotencyKey{
+		Scope:       models.IdempotencyScopeCreateComment,
+		Key:         "expired",
+		RequestHash: "old",
+		ExpiresAt:   time.Now().Add(-time.Minute),
+	}
+	existing, err = s.ReserveIdempotencyKey(ctx, expired)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+	expired.RequestHash, expired.ExpiresAt = "new", time.Now().Add(time.Hour)
+	existing, err = s.ReserveIdempotencyKey(ctx, expired)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+	existing, err = s.ReserveIdempotencyKey(ctx, expired)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, "new", existing.RequestHash)
+}
+
+func testUpdatePost(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	post := createPost(t, s, "Тест", true)
+	other := createPost(t, s, "Другой", true)
+
+	edit := post
+	edit.Title, edit.Content, edit.AllowComments = "Правка", "уникальноеслово", false
+	updated, err := s.UpdatePost(ctx, edit, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+	assert.Equal(t, "Правка", updated.Title)
+	assert.Equal(t, "Автор", updated.Author)
+	assert.True(t, post.CreatedAt.Equal(updated.CreatedAt))
+
+	got, err := s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "уникальноеслово", got.Content)
+	assert.Equal(t, 2, got.Version)
+	assert.False(t, got.AllowComments)
+
+	edit.Content = "третья версия"
+	_, err = s.UpdatePost(ctx, edit, 2)
+	require.NoError(t, err)
+
+	revisions, err := s.GetPostRevisions(ctx, post.ID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 3)
+	for i, r := range revisions {
+		assert.Equal(t, post.ID, r.PostID)
+		assert.Equal(t, i+1, r.Version)
+	}
+	assert.Equal(t, "Тест", revisions[0].Title)
+	assert.True(t, revisions[0].AllowComments)
+	assert.Equal(t, "уникальноеслово", revisions[1].Content)
+	assert.Equal(t, "третья версия", revisions[2].Content)
+	assert.False(t, revisions[2].CreatedAt.Before(revisions[1].CreatedAt))
+
+	// у другого поста своя история
+	revisions, err = s.GetPostRevisions(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Len(t, revisions, 1)
+
+	// поиск видит только текущий текст
+	results, err := s.Search(ctx, models.SearchQuery{Text: "уникальноеслово", Scope: models.SearchScopePosts, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	results, err = s.Search(ctx, models.SearchQuery{Text: "третья", Scope: models.SearchScopePosts, Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+}
+
+func testUpdatePostConflict(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	post := createPost(t, s, "Тест", true)
+
+	first := post
+	first.Title = "Первый редактор"
+	_, err := s.UpdatePost(ctx, first, 1)
+	require.NoError(t, err)
+
+	// второй редактор начинал с той же версии и не должен затереть правку первого
+	second := post
+	second.Title = "Второй редактор"
+	current, err := s.UpdatePost(ctx, second, 1)
+	assert.ErrorIs(t, err, models.ErrVersionConflict)
+	assert.Equal(t, 2, current.Version)
+	assert.Equal(t, "Первый редактор", current.Title)
+
+	got, err := s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Первый редактор", got.Title)
+	revisions, err := s.GetPostRevisions(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Len(t, revisions, 2)
+
+	_, err = s.UpdatePost(ctx, models.Post{ID: 1337, Title: "Нет"}, 1)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = s.GetPostRevisions(ctx, 1337)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+}
+
+func testPostStatusVisibility(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	published := createPost(t, s, "Опубликован", true)
+	draft, err := s.CreatePost(ctx, models.Post{Title: "Черновик", Author: "Вася", AllowComments: true, Status: models.PostStatusDraft})
+	require.NoError(t, err)
+	assert.Nil(t, draft.PublishAt)
+	later := time.Now().Add(time.Hour)
+	scheduled, err := s.CreatePost(ctx, models.Post{Title: "Позже", Author: "Петя", AllowComments: true, Status: models.PostStatusScheduled, PublishAt: &later})
+	require.NoError(t, err)
+
+	postIDs := func(filter models.PostFilter) []int {
+		posts, err := s.GetPosts(ctx, filter)
+		require.NoError(t, err)
+		ids := make([]int, 0, len(posts))
+		for _, p := range posts {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []int{published.ID}, postIDs(models.PostFilter{}))
+	assert.Equal(t, []int{draft.ID, published.ID}, postIDs(models.PostFilter{Viewer: "Вася"}))
+	assert.Equal(t, []int{scheduled.ID, published.ID}, postIDs(models.PostFilter{Viewer: "Петя"}))
+	assert.Equal(t, []int{scheduled.ID, draft.ID, published.ID}, postIDs(models.PostFilter{Unpublished: true}))
+
+	got, err := s.GetPost(ctx, scheduled.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.PostStatusScheduled, got.Status)
+	if assert.NotNil(t, got.PublishAt) {
+		assert.WithinDuration(t, later, *got.PublishAt, time.Second)
+	}
+
+	// неопубликованные посты нельзя комментировать и их не находит поиск
+	_, err = s.CreateComment(ctx, models.Comment{PostID: draft.ID, Text: "Рано", Author: "Гость"}, nil)
+	assert.ErrorIs(t, err, models.ErrCommentsAreNotAllowed)
+	results, err := s.Search(ctx, models.SearchQuery{Text: "Черновик", Scope: models.SearchScopeAll, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func testSetPostStatus(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	post := createPost(t, s, "Тест", true)
+	comment := createComment(t, s, post.ID, nil, "Уникальноеслово")
+
+	draft, err := s.SetPostStatus(ctx, post.ID, models.PostStatusDraft, nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.PostStatusDraft, draft.Status)
+	assert.Nil(t, draft.PublishAt)
+	assert.Equal(t, "Тест", draft.Title)
+
+	// комментарии снятого с публикации поста тоже пропадают из поиска
+	results, err := s.Search(ctx, models.SearchQuery{Text: "Уникальноеслово", Scope: models.SearchScopeComments, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	at := time.Now().Add(-time.Minute)
+	republished, err := s.SetPostStatus(ctx, post.ID, models.PostStatusPublished, &at)
+	require.NoError(t, err)
+	assert.Equal(t, models.PostStatusPublished, republished.Status)
+	if assert.NotNil(t, republished.PublishAt) {
+		assert.WithinDuration(t, at, *republished.PublishAt, time.Second)
+	}
+	results, err = s.Search(ctx, models.SearchQuery{Text: "Уникальноеслово", Scope: models.SearchScopeComments, Limit: 10})
+	require.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, comment.ID, results[0].Comment.ID)
+	}
+
+	got, err := s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.PostStatusPublished, got.Status)
+
+	_, err = s.SetPostStatus(ctx, 1337, models.PostStatusDraft, nil)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+}
+
+func testPublishDuePosts(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	now := time.Now()
+	soon, later := now.Add(time.Minute), now.Add(time.Hour)
+	first, err := s.CreatePost(ctx, models.Post{Title: "Скоро", AllowComments: true, Status: models.PostStatusScheduled, PublishAt: &soon})
+	require.NoError(t, err)
+	_, err = s.CreatePost(ctx, models.Post{Title: "Позже", AllowComments: true, Status: models.PostStatusScheduled, PublishAt: &later})
+	require.NoError(t, err)
+	_, err = s.CreatePost(ctx, models.Post{Title: "Черновик", AllowComments: true, Status: models.PostStatusDraft})
+	require.NoError(t, err)
+
+	published, err := s.PublishDuePosts(ctx, now)
+	require.NoError(t, err)
+	assert.Empty(t, published)
+
+	published, err = s.PublishDuePosts(ctx, soon.Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, published, 1)
+	assert.Equal(t, first.ID, published[0].ID)
+	assert.Equal(t, models.PostStatusPublished, published[0].Status)
+
+	posts, err := s.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, first.ID, posts[0].ID)
+
+	// опубликованный планировщиком пост можно комментировать
+	createComment(t, s, first.ID, nil, "Наконец-то")
+
+	published, err = s.PublishDuePosts(ctx, soon.Add(time.Second))
+	require.NoError(t, err)
+	assert.Empty(t, published)
+}
+
+func testPostTags(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+
+	_, err := s.CreatePost(ctx, models.Post{Title: "Плохой", Tags: []string{"a,b"}})
+	assert.ErrorIs(t, err, models.ErrInvalidTag)
+
+	first, err := s.CreatePost(ctx, models.Post{Title: "Первый", AllowComments: true, Tags: []string{"SQL", " go ", "go"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "sql"}, first.Tags)
+	second, err := s.CreatePost(ctx, models.Post{Title: "Второй", AllowComments: true, Tags: []string{"go"}})
+	require.NoError(t, err)
+	_, err = s.CreatePost(ctx, models.Post{Title: "Черновик", Status: models.PostStatusDraft, Tags: []string{"go", "rust"}})
+	require.NoError(t, err)
+
+	got, err := s.GetPost(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "sql"}, got.Tags)
+
+	postIDs := func(tags ...string) []int {
+		posts, err := s.GetPosts(ctx, models.PostFilter{Tags: tags})
+		require.NoError(t, err)
+		ids := make([]int, 0, len(posts))
+		for _, p := range posts {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []int{second.ID, first.ID}, postIDs("go"))
+	assert.Equal(t, []int{first.ID}, postIDs("go", "sql"))
+	assert.Empty(t, postIDs("rust"))
+
+	// черновики в счетчики не попадают
+	tags, err := s.GetTags(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []models.TagCount{{Tag: "go", Count: 2}, {Tag: "sql", Count: 1}}, tags)
+
+	updated, err := s.UpdatePostTags(ctx, second.ID, []string{"sql", "api", "go"}, []string{"go", "rust"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api", "sql"}, updated.Tags)
+	assert.Equal(t, second.Version, updated.Version)
+	got, err = s.GetPost(ctx, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api", "sql"}, got.Tags)
+
+	tags, err = s.GetTags(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []models.TagCount{{Tag: "sql", Count: 2}, {Tag: "api", Count: 1}, {Tag: "go", Count: 1}}, tags)
+
+	updated, err = s.UpdatePostTags(ctx, second.ID, nil, []string{"api", "sql"})
+	require.NoError(t, err)
+	assert.Empty(t, updated.Tags)
+
+	_, err = s.UpdatePostTags(ctx, 1337, []string{"go"}, nil)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+}
+
+func testPostCategory(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	news, err := s.CreatePost(ctx, models.Post{Title: "Новость", Category: " Новости "})
+	require.NoError(t, err)
+	assert.Equal(t, "новости", news.Category)
+	other := createPost(t, s, "Без категории", true)
+	assert.Empty(t, other.Category)
+
+	posts, err := s.GetPosts(ctx, models.PostFilter{Category: "новости"})
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, news.ID, posts[0].ID)
+
+	updated, err := s.SetPostCategory(ctx, other.ID, "новости")
+	require.NoError(t, err)
+	assert.Equal(t, "новости", updated.Category)
+	updated, err = s.SetPostCategory(ctx, news.ID, "")
+	require.NoError(t, err)
+	assert.Empty(t, updated.Category)
+
+	posts, err = s.GetPosts(ctx, models.PostFilter{Category: "новости"})
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, other.ID, posts[0].ID)
+
+	_, err = s.SetPostCategory(ctx, 1337, "новости")
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+}
+
+func testExternalThreads(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	key := models.ThreadKey{Namespace: "blog", Key: "https://example.com/posts/1"}
+
+	_, err := s.GetThread(ctx, key)
+	assert.ErrorIs(t, err, models.ErrThreadNotFound)
+
+	thread, err := s.GetOrCreateThread(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, &key, thread.Thread)
+	assert.True(t, thread.AllowComments)
+	assert.Equal(t, models.PostStatusPublished, thread.Status)
+
+	again, err := s.GetOrCreateThread(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, thread.ID, again.ID)
+	got, err := s.GetThread(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, thread.ID, got.ID)
+	assert.Equal(t, &key, got.Thread)
+
+	// тред комментируется как обычный пост
+	root, err := s.CreateComment(ctx, models.Comment{PostID: thread.ID, Text: "первый", Author: "a"}, nil)
+	require.NoError(t, err)
+	_, err = s.CreateComment(ctx, models.Comment{PostID: thread.ID, Text: "ответ", Author: "b"}, &root.ID)
+	require.NoError(t, err)
+	comments, err := s.GetComments(ctx, thread.ID, nil, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.True(t, comments[0].HasReplies)
+
+	// тот же ключ в другом пространстве это другой ресурс
+	other, err := s.GetOrCreateThread(ctx, models.ThreadKey{Namespace: "docs", Key: key.Key})
+	require.NoError(t, err)
+	assert.NotEqual(t, thread.ID, other.ID)
+
+	// в ленту треды не попадают, в полную выборку попадают
+	post := createPost(t, s, "Обычный", true)
+	posts, err := s.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, post.ID, posts[0].ID)
+	assert.Nil(t, posts[0].Thread)
+	posts, err = s.GetPosts(ctx, models.PostFilter{Unpublished: true})
+	require.NoError(t, err)
+	assert.Len(t, posts, 3)
+}
+
+func testConcurrentThreadCreation(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	key := models.ThreadKey{Namespace: "blog", Key: "popular"}
+
+	const writers = 8
+	ids := make([]int, writers)
+	errs := make([]error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			thread, err := s.GetOrCreateThread(ctx, key)
+			ids[i], errs[i] = thread.ID, err
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range ids {
+		require.NoError(t, errs[i])
+		assert.Equal(t, ids[0], ids[i])
+	}
+	posts, err := s.GetPosts(ctx, models.PostFilter{Unpublished: true})
+	require.NoError(t, err)
+	assert.Len(t, posts, 1)
+}
+
+func testImportThreads(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	key := models.ThreadKey{Namespace: "blog", Key: "imported"}
+
+	imported, err := s.ImportPosts(ctx, []models.Post{{ID: 5, AllowComments: true, Thread: &models.ThreadKey{Namespace: "Blog", Key: "imported"}}})
+	require.NoError(t, err)
+	require.Len(t, imported, 1)
+
+	thread, err := s.GetThread(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, 5, thread.ID)
+	created, err := s.GetOrCreateThread(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, 5, created.ID)
+
+	// у ресурса может быть только один тред
+	_, err = s.ImportPosts(ctx, []models.Post{{AllowComments: true, Thread: &key}})
+	assert.ErrorIs(t, err, models.ErrIDConflict)
+	_, err = s.ImportPosts(ctx, []models.Post{{Thread: &models.ThreadKey{Namespace: "blog"}}})
+	assert.ErrorIs(t, err, models.ErrInvalidThreadKey)
+}
+
+func testTenantIsolation(t *testing.T, s storage.Storager) {
+	blog := models.WithTenant(context.Background(), "blog")
+	shop := models.WithTenant(context.Background(), "shop")
+
+	post, err := s.CreatePost(blog, models.Post{Title: "Пост блога", Content: "общее слово", Author: "alice", AllowComments: true, Tags: []string{"go"}})
+	require.NoError(t, err)
+	assert.Equal(t, "blog", post.TenantID)
+	comment, err := s.CreateComment(blog, models.Comment{PostID: post.ID, Text: "общее слово", Author: "bob", Mentions: []string{"masha"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "blog", comment.TenantID)
+	_, err = s.CreateNotification(blog, models.Notification{Recipient: "masha", Type: models.NotificationTypeMention, PostID: post.ID})
+	require.NoError(t, err)
+
+	// записи другого сайта выглядят несуществующими
+	_, err = s.GetPost(shop, post.ID)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = s.GetComment(shop, comment.ID)
+	assert.ErrorIs(t, err, models.ErrCommentNotFound)
+	_, err = s.GetComments(shop, post.ID, nil, 10, 0)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = s.GetPostRevisions(shop, post.ID)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = s.CreateComment(shop, models.Comment{PostID: post.ID, Text: "чужой", Author: "eve"}, nil)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = s.UpdatePost(shop, models.Post{ID: post.ID, Title: "взлом"}, post.Version)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = s.SetPostStatus(shop, post.ID, models.PostStatusDraft, nil)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = s.UpdatePostTags(shop, post.ID, []string{"spam"}, nil)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = s.SetPostCategory(shop, post.ID, "spam")
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+
+	posts, err := s.GetPosts(shop, models.PostFilter{Unpublished: true})
+	require.NoError(t, err)
+	assert.Empty(t, posts)
+	tags, err := s.GetTags(shop)
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+	mentions, err := s.GetMentions(shop, "masha", 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, mentions)
+	notifications, err := s.GetNotifications(shop, "masha", 10, 0, false)
+	require.NoError(t, err)
+	assert.Empty(t, notifications)
+	marked, err := s.MarkNotificationsRead(shop, "masha", nil)
+	require.NoError(t, err)
+	assert.Zero(t, marked)
+	results, err := s.Search(shop, models.SearchQuery{Text: "общее", Scope: models.SearchScopeAll, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	// свой сайт видит все
+	posts, err = s.GetPosts(blog, models.PostFilter{})
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, "blog", posts[0].TenantID)
+	mentions, err = s.GetMentions(blog, "masha", 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{comment.ID}, commentIDs(mentions))
+	notifications, err = s.GetNotifications(blog, "masha", 10, 0, false)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, "blog", notifications[0].TenantID)
+	results, err = s.Search(blog, models.SearchQuery{Text: "общее", Scope: models.SearchScopeAll, Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	// без сайта в контексте запросы идут к сайту по умолчанию
+	_, err = s.GetPost(context.Background(), post.ID)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+}
+
+func testTenantThreadsAndKeys(t *testing.T, s storage.Storager) {
+	blog := models.WithTenant(context.Background(), "blog")
+	shop := models.WithTenant(context.Background(), "shop")
+	key := models.ThreadKey{Namespace: "page", Key: "/about"}
+
+	// один и тот же ресурс на разных сайтах это разные треды
+	blogThread, err := s.GetOrCreateThread(blog, key)
+	require.NoError(t, err)
+	shopThread, err := s.GetOrCreateThread(shop, key)
+	require.NoError(t, err)
+	assert.NotEqual(t, blogThread.ID, shopThread.ID)
+	assert.Equal(t, "shop", shopThread.TenantID)
+	_, err = s.GetThread(context.Background(), key)
+	assert.ErrorIs(t, err, models.ErrThreadNotFound)
+
+	// ключи идемпотентности не пересекаются между сайтами
+	ik := models.IdempotencyKey{Scope: models.IdempotencyScopeCreatePost, Key: "k", RequestHash: "h", ExpiresAt: time.Now().Add(time.Hour)}
+	existing, err := s.ReserveIdempotencyKey(blog, ik)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+	require.NoError(t, s.CompleteIdempotencyKey(blog, ik.Scope, ik.Key, blogThread.ID))
+	existing, err = s.ReserveIdempotencyKey(shop, ik)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+	existing, err = s.ReserveIdempotencyKey(blog, ik)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, blogThread.ID, existing.ResultID)
+
+	// импорт пишет в сайт из контекста
+	imported, err := s.ImportPosts(shop, []models.Post{{Title: "импорт", AllowComments: true}})
+	require.NoError(t, err)
+	_, err = s.GetPost(blog, imported[0].ID)
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	_, err = s.ImportComments(blog, []models.Comment{{PostID: imported[0].ID, Text: "чужой"}})
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+	comments, err := s.ImportComments(shop, []models.Comment{{PostID: imported[0].ID, Text: "свой"}})
+	require.NoError(t, err)
+	got, err := s.GetComment(shop, comments[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "shop", got.TenantID)
+}
@@ -0,0 +1,84 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/rs/zerolog"
+)
+
+// поле payload сообщения connection_init с API ключом: браузер не может задать заголовок при открытии websocket
+const APIKeyInitField = "apiKey"
+
+// Оборачивает обработчик HTTP: определяет сайт запроса и кладет его в контекст,
+// запрос с незнакомым API ключом или хостом отклоняется до GraphQL.
+// CORS preflight и открытие websocket не несут API ключа, поэтому с незнакомым хостом они проходят
+// без сайта: preflight проверяется по источникам всех сайтов, а websocket получает сайт в connection_init
+func Middleware(reg *Registry, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, err := reg.Resolve(r)
+		if err == ErrUnknownTenant && (r.Method == http.MethodOptions || isWebsocketUpgrade(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			status := http.StatusNotFound
+			if err == ErrUnknownAPIKey {
+				status = http.StatusUnauthorized
+			}
+			writeError(w, status, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withLoggedTenant(r.Context(), t)))
+	})
+}
+
+// Определяет сайт websocket соединения по API ключу из connection_init. Ключ важнее сайта,
+// найденного по хосту, а соединение без ключа и без сайта закрывается
+func WebsocketInit(reg *Registry) transport.WebsocketInitFunc {
+	return func(ctx context.Context, payload transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+		key := payload.GetString(APIKeyInitField)
+		if key == "" {
+			if FromContext(ctx) == nil {
+				return ctx, nil, ErrUnknownTenant
+			}
+			return ctx, nil, nil
+		}
+
+		t, err := reg.ResolveAPIKey(key)
+		if err != nil {
+			return ctx, nil, err
+		}
+		return withLoggedTenant(ctx, t), nil, nil
+	}
+}
+
+// кладет сайт в контекст и добавляет его в логгер запроса
+func withLoggedTenant(ctx context.Context, t *Tenant) context.Context {
+	ctx = WithTenant(ctx, t)
+	logger := zerolog.Ctx(ctx).With().Str("tenant", t.ID).Logger()
+	return logger.WithContext(ctx)
+}
+
+func isWebsocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+type errorMessage struct {
+	Message string `json:"message"`
+}
+
+// ошибка в формате ответа GraphQL, чтобы клиенту не нужно было разбирать второй формат
+func writeError(w http.ResponseWriter, status int, err error) {
+	body := struct {
+		Errors []errorMessage `json:"errors"`
+	}{Errors: []errorMessage{{Message: err.Error()}}}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
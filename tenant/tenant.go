@@ -0,0 +1,194 @@
+// Пакет tenant определяет сайт, к которому относится запрос, по API ключу или заголовку Host
+// и хранит настройки сайтов: разрешенные источники и лимиты
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"graphql-comments/models"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// заголовок с API ключом сайта, он важнее заголовка Host
+const APIKeyHeader = "X-API-Key"
+
+var (
+	ErrUnknownAPIKey  = errors.New("unknown api key")
+	ErrUnknownTenant  = errors.New("unknown tenant")
+	ErrCommentTooLong = errors.New("comment is too long")
+)
+
+// Настройки одного сайта. Нулевые лимиты не ограничивают
+type Tenant struct {
+	ID               string   `json:"id"`
+	Hosts            []string `json:"hosts"`
+	APIKeys          []string `json:"apiKeys"`
+	AllowedOrigins   []string `json:"allowedOrigins"` // пустой список берет AllowedOrigins из конфигурации
+	MaxCommentLength int      `json:"maxCommentLength"`
+	MaxPageSize      int      `json:"maxPageSize"`
+}
+
+// Проверяет длину текста комментария в символах
+func (t *Tenant) CheckCommentLength(text string) error {
+	if t != nil && t.MaxCommentLength > 0 && utf8.RuneCountInString(text) > t.MaxCommentLength {
+		return fmt.Errorf("%w: at most %d characters allowed", ErrCommentTooLong, t.MaxCommentLength)
+	}
+	return nil
+}
+
+// Урезает размер страницы до лимита сайта
+func (t *Tenant) PageSize(limit int) int {
+	if t != nil && t.MaxPageSize > 0 && limit > t.MaxPageSize {
+		return t.MaxPageSize
+	}
+	return limit
+}
+
+// Реестр сайтов с поиском по API ключу и хосту
+type Registry struct {
+	tenants  []*Tenant
+	byKey    map[string]*Tenant
+	byHost   map[string]*Tenant
+	fallback *Tenant
+}
+
+// формат файла TENANTS_PATH
+type registryFile struct {
+	Tenants  []Tenant `json:"tenants"`
+	Fallback string   `json:"fallback"` // сайт для запросов с незнакомым хостом, пустой отклоняет такие запросы
+}
+
+// Собирает реестр. Сайты без своего списка источников получают defaultOrigins
+func NewRegistry(tenants []Tenant, fallback string, defaultOrigins []string) (*Registry, error) {
+	r := &Registry{
+		byKey:  make(map[string]*Tenant),
+		byHost: make(map[string]*Tenant),
+	}
+	ids := make(map[string]*Tenant, len(tenants))
+	for i := range tenants {
+		t := tenants[i]
+		if err := models.ValidateTenant(t.ID); err != nil {
+			return nil, fmt.Errorf("tenant %q: %w", t.ID, err)
+		}
+		if _, dup := ids[t.ID]; dup {
+			return nil, fmt.Errorf("duplicate tenant %q", t.ID)
+		}
+		if len(t.AllowedOrigins) == 0 {
+			t.AllowedOrigins = defaultOrigins
+		}
+		ids[t.ID] = &t
+		r.tenants = append(r.tenants, &t)
+
+		for _, key := range t.APIKeys {
+			if _, dup := r.byKey[key]; dup || key == "" {
+				return nil, fmt.Errorf("tenant %q: empty or duplicate api key", t.ID)
+			}
+			r.byKey[key] = &t
+		}
+		for _, host := range t.Hosts {
+			host = normalizeHost(host)
+			if _, dup := r.byHost[host]; dup || host == "" {
+				return nil, fmt.Errorf("tenant %q: empty or duplicate host %q", t.ID, host)
+			}
+			r.byHost[host] = &t
+		}
+	}
+
+	if fallback != "" {
+		r.fallback = ids[fallback]
+		if r.fallback == nil {
+			return nil, fmt.Errorf("fallback tenant %q is not defined", fallback)
+		}
+	}
+	return r, nil
+}
+
+// Загружает реестр из JSON файла. Без файла все запросы относятся к единственному сайту default
+func Load(path string, defaultOrigins []string) (*Registry, error) {
+	if path == "" {
+		return NewRegistry([]Tenant{{ID: models.DefaultTenant}}, models.DefaultTenant, defaultOrigins)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file registryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return NewRegistry(file.Tenants, file.Fallback, defaultOrigins)
+}
+
+// Все сайты реестра в порядке объявления
+func (r *Registry) Tenants() []*Tenant {
+	return r.tenants
+}
+
+// Определяет сайт запроса. Заданный API ключ должен быть известен, иначе сайт ищется по хосту,
+// а незнакомый хост получает запасной сайт
+func (r *Registry) Resolve(req *http.Request) (*Tenant, error) {
+	if key := req.Header.Get(APIKeyHeader); key != "" {
+		return r.ResolveAPIKey(key)
+	}
+	if t, ok := r.byHost[normalizeHost(req.Host)]; ok {
+		return t, nil
+	}
+	if r.fallback != nil {
+		return r.fallback, nil
+	}
+	return nil, ErrUnknownTenant
+}
+
+// Находит сайт по API ключу
+func (r *Registry) ResolveAPIKey(key string) (*Tenant, error) {
+	if t, ok := r.byKey[key]; ok {
+		return t, nil
+	}
+	return nil, ErrUnknownAPIKey
+}
+
+// Источники, разрешенные хотя бы одному сайту. По ним проверяются запросы, сайт которых
+// еще не известен: CORS preflight и открытие websocket без API ключа
+func (r *Registry) AllowedOrigins() []string {
+	seen := make(map[string]struct{})
+	var origins []string
+	for _, t := range r.tenants {
+		for _, origin := range t.AllowedOrigins {
+			if _, ok := seen[origin]; !ok {
+				seen[origin] = struct{}{}
+				origins = append(origins, origin)
+			}
+		}
+	}
+	return origins
+}
+
+// хост без порта в нижнем регистре
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+type tenantKey struct{}
+
+// Кладет сайт в контекст вместе с его идентификатором для хранилища
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	ctx = context.WithValue(ctx, tenantKey{}, t)
+	return models.WithTenant(ctx, t.ID)
+}
+
+// Возвращает сайт из контекста или nil. Методы лимитов у nil ничего не ограничивают
+func FromContext(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(tenantKey{}).(*Tenant)
+	return t
+}
@@ -0,0 +1,162 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"graphql-comments/models"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRegistry(t *testing.T, fallback string) *Registry {
+	reg, err := NewRegistry([]Tenant{
+		{ID: "blog", Hosts: []string{"Blog.Example"}, APIKeys: []string{"blog-key"}},
+		{ID: "shop", Hosts: []string{"shop.example"}, APIKeys: []string{"shop-key"}, MaxPageSize: 10, MaxCommentLength: 5},
+	}, fallback, []string{"*"})
+	assert.NoError(t, err)
+	return reg
+}
+
+func request(host, apiKey string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/query", nil)
+	r.Host = host
+	if apiKey != "" {
+		r.Header.Set(APIKeyHeader, apiKey)
+	}
+	return r
+}
+
+func TestResolve(t *testing.T) {
+	reg := testRegistry(t, "")
+
+	found, err := reg.Resolve(request("blog.example:8080", ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "blog", found.ID)
+	assert.Equal(t, []string{"*"}, found.AllowedOrigins)
+
+	// ключ важнее хоста
+	found, err = reg.Resolve(request("blog.example", "shop-key"))
+	assert.NoError(t, err)
+	assert.Equal(t, "shop", found.ID)
+
+	_, err = reg.Resolve(request("blog.example", "wrong"))
+	assert.ErrorIs(t, err, ErrUnknownAPIKey)
+	_, err = reg.Resolve(request("other.example", ""))
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+
+	found, err = testRegistry(t, "blog").Resolve(request("other.example", ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "blog", found.ID)
+	assert.Equal(t, []string{"*"}, reg.AllowedOrigins())
+}
+
+func TestNewRegistryRejectsInvalidConfig(t *testing.T) {
+	_, err := NewRegistry([]Tenant{{ID: "Blog"}}, "", nil)
+	assert.ErrorIs(t, err, models.ErrInvalidTenant)
+
+	_, err = NewRegistry([]Tenant{{ID: "a", Hosts: []string{"x.example"}}, {ID: "b", Hosts: []string{"X.example:80"}}}, "", nil)
+	assert.Error(t, err)
+
+	_, err = NewRegistry([]Tenant{{ID: "a", APIKeys: []string{"k"}}, {ID: "b", APIKeys: []string{"k"}}}, "", nil)
+	assert.Error(t, err)
+
+	_, err = NewRegistry([]Tenant{{ID: "a"}}, "b", nil)
+	assert.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	reg, err := Load("", []string{"https://example.com"})
+	assert.NoError(t, err)
+	found, err := reg.Resolve(request("any.example", ""))
+	assert.NoError(t, err)
+	assert.Equal(t, models.DefaultTenant, found.ID)
+	assert.Equal(t, []string{"https://example.com"}, found.AllowedOrigins)
+
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	data, _ := json.Marshal(registryFile{Tenants: []Tenant{{ID: "blog", Hosts: []string{"blog.example"}}}})
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+	reg, err = Load(path, nil)
+	assert.NoError(t, err)
+	assert.Len(t, reg.Tenants(), 1)
+	_, err = reg.Resolve(request("any.example", ""))
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+}
+
+func TestLimits(t *testing.T) {
+	shop := testRegistry(t, "").Tenants()[1]
+	assert.Equal(t, 10, shop.PageSize(50))
+	assert.Equal(t, 3, shop.PageSize(3))
+	assert.NoError(t, shop.CheckCommentLength("пятьб"))
+	assert.ErrorIs(t, shop.CheckCommentLength("шесть!"), ErrCommentTooLong)
+
+	// без сайта в контексте лимитов нет
+	var none *Tenant
+	assert.Equal(t, 50, none.PageSize(50))
+	assert.NoError(t, none.CheckCommentLength("любой текст"))
+}
+
+func TestMiddleware(t *testing.T) {
+	var got *Tenant
+	var storageTenant string
+	h := Middleware(testRegistry(t, ""), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context())
+		storageTenant = models.TenantFromContext(r.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, request("shop.example", ""))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "shop", got.ID)
+	assert.Equal(t, "shop", storageTenant)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, request("shop.example", "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.JSONEq(t, `{"errors":[{"message":"unknown api key"}]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, request("other.example", ""))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	assert.Nil(t, FromContext(context.Background()))
+
+	// preflight и открытие websocket с незнакомого хоста проходят без сайта
+	preflight := httptest.NewRequest(http.MethodOptions, "/query", nil)
+	preflight.Host = "other.example"
+	upgrade := httptest.NewRequest(http.MethodGet, "/query", nil)
+	upgrade.Host = "other.example"
+	upgrade.Header.Set("Upgrade", "websocket")
+	for _, r := range []*http.Request{preflight, upgrade} {
+		got = &Tenant{}
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Nil(t, got)
+	}
+}
+
+func TestWebsocketInit(t *testing.T) {
+	init := WebsocketInit(testRegistry(t, ""))
+
+	ctx, _, err := init(context.Background(), transport.InitPayload{APIKeyInitField: "shop-key"})
+	assert.NoError(t, err)
+	assert.Equal(t, "shop", FromContext(ctx).ID)
+	assert.Equal(t, "shop", models.TenantFromContext(ctx))
+
+	_, _, err = init(context.Background(), transport.InitPayload{APIKeyInitField: "wrong"})
+	assert.ErrorIs(t, err, ErrUnknownAPIKey)
+	_, _, err = init(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+
+	// без ключа остается сайт, найденный по хосту
+	blog := testRegistry(t, "").Tenants()[0]
+	ctx, _, err = init(WithTenant(context.Background(), blog), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "blog", FromContext(ctx).ID)
+}
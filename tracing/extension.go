@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Extension это расширение gqlgen, которое создает спан на каждую операцию
+// и дочерние спаны на поля, у которых есть собственный резольвер
+type Extension struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+	graphql.FieldInterceptor
+} = Extension{}
+
+func (Extension) ExtensionName() string {
+	return "Tracing"
+}
+
+func (Extension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (Extension) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	oc := graphql.GetOperationContext(ctx)
+
+	operationType, operationName := "unknown", oc.OperationName
+	if oc.Operation != nil {
+		operationType = string(oc.Operation.Operation)
+		if operationName == "" {
+			operationName = oc.Operation.Name
+		}
+	}
+	name := operationType
+	if operationName != "" {
+		name += " " + operationName
+	}
+
+	ctx, span := Tracer().Start(ctx, name,
+		trace.WithTimestamp(oc.Stats.OperationStart),
+		trace.WithAttributes(
+			attribute.String("graphql.operation.type", operationType),
+			attribute.String("graphql.operation.name", operationName),
+		))
+
+	handler := next(ctx)
+
+	// запрос и мутация отвечают один раз, подписка живет до последнего пустого ответа
+	var once sync.Once
+	end := func() { once.Do(func() { span.End() }) }
+	return func(ctx context.Context) *graphql.Response {
+		resp := handler(ctx)
+		if resp == nil {
+			end()
+			return nil
+		}
+		if len(resp.Errors) > 0 {
+			span.SetStatus(codes.Error, resp.Errors.Error())
+		}
+		if operationType != string(ast.Subscription) {
+			end()
+		}
+		return resp
+	}
+}
+
+func (Extension) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	// поля, которые просто читают свойство структуры, не стоят отдельного спана
+	if fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+
+	ctx, span := Tracer().Start(ctx, fc.Object+"."+fc.Field.Name, trace.WithAttributes(
+		attribute.String("graphql.field.path", fc.Path().String()),
+	))
+	defer span.End()
+
+	res, err := next(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return res, err
+}
@@ -0,0 +1,87 @@
+// Пакет tracing настраивает OpenTelemetry: экспорт спанов в OTLP или stdout,
+// W3C Trace Context для входящих запросов и спаны GraphQL операций и резольверов
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"graphql-comments/config"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// экспортеры, которые можно выбрать через TRACING_EXPORTER
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+const instrumentationName = "graphql-comments"
+
+// Tracer для спанов сервиса, до вызова Setup он ничего не записывает
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Настраивает глобальные TracerProvider и пропагатор W3C Trace Context.
+// Возвращенную функцию нужно вызвать при остановке, чтобы выгрузить накопленные спаны
+func Setup(ctx context.Context, cfg *config.Config) (shutdown func(context.Context) error, err error) {
+	// пропагатор нужен даже без экспорта, чтобы пробрасывать чужой trace context дальше
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.TracingExporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		// без адреса экспортер берет его из стандартных OTEL_EXPORTER_OTLP_* переменных
+		if cfg.OTLPEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.OTLPEndpoint))
+		}
+		if cfg.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.TracingExporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracingSampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Оборачивает обработчик HTTP: создает серверный спан и продолжает трейс из заголовков traceparent/tracestate
+func Handler(next http.Handler, operation string) http.Handler {
+	return otelhttp.NewHandler(next, operation)
+}
@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"graphql-comments/config"
+	"graphql-comments/graph"
+	"graphql-comments/storage/inmemory"
+)
+
+// подменяет глобальный провайдер на записывающий спаны в память
+func record(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	return recorder
+}
+
+func post(h http.Handler, body string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestExtension(t *testing.T) {
+	recorder := record(t)
+
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: graph.NewResolver(store)}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(Extension{})
+
+	// внешний trace context должен продолжиться в спанах сервиса
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	w := post(Handler(srv, "/query"), `{"query":"query Named { Post(id: \"999\") { title } }"}`, header)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	spans := recorder.Ended()
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		byName[s.Name()] = s
+	}
+
+	httpSpan, ok := byName["/query"]
+	require.True(t, ok)
+	operation, ok := byName["query Named"]
+	require.True(t, ok)
+	field, ok := byName["Query.Post"]
+	require.True(t, ok)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", httpSpan.SpanContext().TraceID().String())
+	assert.Equal(t, httpSpan.SpanContext().SpanID(), operation.Parent().SpanID())
+	assert.Equal(t, operation.SpanContext().SpanID(), field.Parent().SpanID())
+
+	// поста нет, ошибка резольвера попадает и в спан поля, и в спан операции
+	assert.Equal(t, codes.Error, field.Status().Code)
+	assert.Equal(t, codes.Error, operation.Status().Code)
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), &config.Config{TracingExporter: ExporterNone})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	shutdown, err = Setup(context.Background(), &config.Config{
+		TracingExporter:    ExporterStdout,
+		ServiceName:        "graphql-comments",
+		TracingSampleRatio: 1,
+	})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = Setup(context.Background(), &config.Config{TracingExporter: "zipkin"})
+	assert.Error(t, err)
+}
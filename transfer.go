@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"graphql-comments/config"
+	"graphql-comments/models"
+	"graphql-comments/transfer"
+	"io"
+	"os"
+)
+
+// Выгружает все посты и комментарии или один пост в stdout или файл
+func runExport(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := fs.String("o", "-", "output file, - writes to stdout")
+	postID := fs.Int("post", 0, "export only this post with its comments")
+	tenantID := fs.String("tenant", models.DefaultTenant, "site to export")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	ctx, err := tenantContext(*tenantID)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	w, path := os.Stdout, "stdout"
+	if *output != "-" {
+		if w, err = os.Create(*output); err != nil {
+			return err
+		}
+		path = *output
+	}
+
+	stats, err := transfer.Export(ctx, store, w, transfer.ExportOptions{PostID: *postID})
+	if w != os.Stdout {
+		if err == nil {
+			err = w.Sync()
+		}
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// stdout может быть занят выгрузкой, поэтому итог печатается в stderr
+	fmt.Fprintf(os.Stderr, "exported %d posts and %d comments to %s\n", stats.Posts, stats.Comments, path)
+	return nil
+}
+
+// форматы, которые понимает import
+const (
+	importFormatJSONL     = "jsonl"
+	importFormatDisqus    = "disqus"
+	importFormatWordPress = "wordpress"
+)
+
+// Загружает выгрузку из файла или stdin: свою в JSON Lines или архив Disqus и WordPress
+func runImport(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	remap := fs.Bool("remap", false, "assign new ids even if the storage is empty")
+	format := fs.String("format", importFormatJSONL, "input format: jsonl, disqus or wordpress")
+	tenantID := fs.String("tenant", models.DefaultTenant, "site to import into")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	ctx, err := tenantContext(*tenantID)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("%w: import takes at most one file", errUsage)
+	}
+	switch *format {
+	case importFormatJSONL, importFormatDisqus, importFormatWordPress:
+	default:
+		return fmt.Errorf("%w: unknown import format %q", errUsage, *format)
+	}
+
+	var r io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+
+	var report transfer.Report
+	switch *format {
+	case importFormatDisqus:
+		report, err = transfer.ImportDisqus(ctx, store, r)
+	case importFormatWordPress:
+		report, err = transfer.ImportWordPress(ctx, store, r)
+	default:
+		report.Stats, err = transfer.Import(ctx, store, r, transfer.ImportOptions{Remap: *remap})
+	}
+	if closeErr := store.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// пропущенные записи идут в stderr, чтобы итог в stdout оставался одной строкой
+	for _, s := range report.Skipped {
+		fmt.Fprintf(os.Stderr, "skipped %s %s: %s\n", s.Kind, s.ID, s.Reason)
+	}
+	fmt.Printf("imported %d posts and %d comments", report.Posts, report.Comments)
+	if len(report.Skipped) > 0 {
+		fmt.Printf(", skipped %d entries", len(report.Skipped))
+	}
+	fmt.Println()
+	return nil
+}
+
+// контекст служебной команды, ограниченный одним сайтом
+func tenantContext(id string) (context.Context, error) {
+	if err := models.ValidateTenant(id); err != nil {
+		return nil, fmt.Errorf("%w: %v", errUsage, err)
+	}
+	return models.WithTenant(context.Background(), id), nil
+}
@@ -0,0 +1,216 @@
+package transfer
+
+import (
+	"context"
+	"graphql-comments/storage"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ограничения схемы бд, записи длиннее не поместятся в таблицы
+const (
+	maxTitleLength   = 255
+	maxAuthorLength  = 255
+	maxCommentLength = 2000
+)
+
+// Запись архива другой системы, которая не попала в хранилище
+type Skipped struct {
+	Kind   string // recordPost или recordComment
+	ID     string // id записи в архиве
+	Reason string
+}
+
+// Итог загрузки архива другой системы
+type Report struct {
+	Stats
+	Skipped []Skipped
+}
+
+// Тред из архива: будущий пост и его комментарии в порядке архива
+type archiveThread struct {
+	id       string
+	post     Post
+	skip     string // причина пропуска, пустая у загружаемых
+	comments []*archiveComment
+}
+
+type archiveComment struct {
+	id       string
+	parentID string // пустой у комментария верхнего уровня
+	comment  Comment
+	skip     string
+
+	// заполняются в resolveParent
+	resolved bool
+	visiting bool
+	broken   bool            // родитель не найден в треде
+	parent   *archiveComment // ближайший загружаемый предок
+	depth    int
+}
+
+// Загружает треды архива с новыми id. Ответы на пропущенные комментарии поднимаются к ближайшему
+// загружаемому предку, чтобы удаленный или спамный комментарий не уносил с собой всю ветку.
+// dropEmpty пропускает треды без комментариев: в Disqus тред заводится на каждую открытую страницу
+func importArchive(ctx context.Context, store storage.Storager, threads []*archiveThread, dropEmpty bool) (Report, error) {
+	var report Report
+	skip := func(kind, id, reason string) {
+		report.Skipped = append(report.Skipped, Skipped{Kind: kind, ID: id, Reason: reason})
+	}
+
+	sort.SliceStable(threads, func(i, j int) bool {
+		return threads[i].post.CreatedAt.Before(threads[j].post.CreatedAt)
+	})
+
+	imp := newImporter(store, true)
+	postID, commentID := 0, 0
+	for _, thread := range threads {
+		if thread.skip == "" {
+			thread.skip = validatePost(&thread.post)
+		}
+		if thread.skip != "" {
+			skip(recordPost, thread.id, thread.skip)
+			for _, c := range thread.comments {
+				skip(recordComment, c.id, "thread skipped")
+			}
+			continue
+		}
+
+		byID := make(map[string]*archiveComment, len(thread.comments))
+		for _, c := range thread.comments {
+			if c.skip == "" {
+				c.skip = validateComment(&c.comment)
+			}
+			byID[c.id] = c
+		}
+		var kept []*archiveComment
+		for _, c := range thread.comments {
+			resolveParent(c, byID)
+			if c.broken && c.skip == "" {
+				c.skip = "parent comment not found"
+			}
+			if c.skip != "" {
+				skip(recordComment, c.id, c.skip)
+				continue
+			}
+			kept = append(kept, c)
+		}
+
+		if dropEmpty && len(kept) == 0 {
+			skip(recordPost, thread.id, "thread has no comments")
+			continue
+		}
+
+		// родители раньше ответов, внутри уровня по времени, так новые id растут вместе со временем создания
+		sort.SliceStable(kept, func(i, j int) bool {
+			if kept[i].depth != kept[j].depth {
+				return kept[i].depth < kept[j].depth
+			}
+			return kept[i].comment.CreatedAt.Before(kept[j].comment.CreatedAt)
+		})
+
+		postID++
+		thread.post.ID = postID
+		if err := imp.addPost(ctx, &thread.post); err != nil {
+			return report, err
+		}
+		for _, c := range kept {
+			commentID++
+			c.comment.ID = commentID
+			c.comment.PostID = postID
+			if c.parent != nil {
+				c.comment.ParentID = &c.parent.comment.ID
+			}
+			if err := imp.addComment(ctx, &c.comment); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	err := imp.finish(ctx)
+	report.Stats = imp.stats
+	return report, err
+}
+
+// Находит ближайшего загружаемого предка и глубину комментария в дереве. Комментарий, цепочка
+// родителей которого обрывается или зацикливается, помечается broken
+func resolveParent(c *archiveComment, byID map[string]*archiveComment) {
+	if c.resolved {
+		return
+	}
+	if c.visiting {
+		c.broken = true
+		return
+	}
+	c.visiting = true
+	defer func() { c.visiting, c.resolved = false, true }()
+
+	if c.parentID == "" {
+		return
+	}
+	parent, ok := byID[c.parentID]
+	if !ok {
+		c.broken = true
+		return
+	}
+	resolveParent(parent, byID)
+
+	switch {
+	case parent.broken:
+		c.broken = true
+	case parent.skip == "":
+		c.parent, c.depth = parent, parent.depth+1
+	default:
+		c.parent, c.depth = parent.parent, parent.depth
+	}
+}
+
+func validatePost(p *Post) string {
+	p.Title, p.Author = strings.TrimSpace(p.Title), authorOrAnonymous(p.Author)
+	switch {
+	case p.Title == "":
+		return "empty title"
+	case utf8.RuneCountInString(p.Title) > maxTitleLength:
+		return "title is too long"
+	case utf8.RuneCountInString(p.Author) > maxAuthorLength:
+		return "author name is too long"
+	case p.CreatedAt.IsZero():
+		return "invalid date"
+	}
+	return ""
+}
+
+func validateComment(c *Comment) string {
+	c.Text, c.Author = strings.TrimSpace(c.Text), authorOrAnonymous(c.Author)
+	switch {
+	case c.Text == "":
+		return "empty text"
+	case utf8.RuneCountInString(c.Text) > maxCommentLength:
+		return "text is too long"
+	case utf8.RuneCountInString(c.Author) > maxAuthorLength:
+		return "author name is too long"
+	case c.CreatedAt.IsZero():
+		return "invalid date"
+	}
+	return ""
+}
+
+func authorOrAnonymous(name string) string {
+	if name = strings.TrimSpace(name); name != "" {
+		return name
+	}
+	return "anonymous"
+}
+
+// Разбирает дату архива в одном из форматов, нулевое время означает ошибку
+func parseArchiveTime(value string, layouts ...string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,265 @@
+package transfer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"graphql-comments/models"
+)
+
+const disqusExport = `<?xml version="1.0" encoding="utf-8"?>
+<disqus xmlns="http://disqus.com" xmlns:dsq="http://disqus.com/disqus-internals">
+  <category dsq:id="1"><forum>blog</forum><title>General</title></category>
+  <post dsq:id="104">
+    <message><![CDATA[<p>Ответ на <b>удаленный</b></p>]]></message>
+    <createdAt>2019-05-01T12:30:00Z</createdAt>
+    <author><name>Гусев</name><username>gusev</username></author>
+    <isDeleted>false</isDeleted><isSpam>false</isSpam>
+    <thread dsq:id="10"/>
+    <parent dsq:id="103"/>
+  </post>
+  <thread dsq:id="10">
+    <id>hello-world</id>
+    <link>https://blog.example.com/hello</link>
+    <title>Hello</title>
+    <message></message>
+    <createdAt>2019-05-01T10:00:00Z</createdAt>
+    <author><name>Админ</name></author>
+    <isClosed>true</isClosed>
+    <isDeleted>false</isDeleted>
+  </thread>
+  <thread dsq:id="11">
+    <link>https://blog.example.com/empty</link>
+    <title>Пустой</title>
+    <createdAt>2019-06-01T10:00:00Z</createdAt>
+  </thread>
+  <post dsq:id="101">
+    <message><![CDATA[<p>Первый &amp; лучший</p>]]></message>
+    <createdAt>2019-05-01T11:00:00Z</createdAt>
+    <author><name></name><username>utkin</username></author>
+    <thread dsq:id="10"/>
+  </post>
+  <post dsq:id="103">
+    <message><![CDATA[<p>удален</p>]]></message>
+    <createdAt>2019-05-01T12:00:00Z</createdAt>
+    <author><name>Уткин</name></author>
+    <isDeleted>true</isDeleted>
+    <thread dsq:id="10"/>
+    <parent dsq:id="101"/>
+  </post>
+  <post dsq:id="105">
+    <message>купите</message>
+    <createdAt>2019-05-01T13:00:00Z</createdAt>
+    <isSpam>true</isSpam>
+    <thread dsq:id="10"/>
+  </post>
+  <post dsq:id="106">
+    <message>без треда</message>
+    <createdAt>2019-05-01T13:00:00Z</createdAt>
+    <thread dsq:id="99"/>
+  </post>
+  <post dsq:id="107">
+    <message>без даты</message>
+    <createdAt>вчера</createdAt>
+    <thread dsq:id="10"/>
+  </post>
+</disqus>`
+
+const wordpressExport = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"
+  xmlns:excerpt="http://wordpress.org/export/1.2/excerpt/"
+  xmlns:content="http://purl.org/rss/1.0/modules/content/"
+  xmlns:dc="http://purl.org/dc/elements/1.1/"
+  xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+  <title>Блог</title>
+  <item>
+    <title>Первая запись</title>
+    <link>https://blog.example.com/first</link>
+    <dc:creator><![CDATA[admin]]></dc:creator>
+    <content:encoded><![CDATA[<p>Текст <a href="https://go.dev">ссылка</a></p>]]></content:encoded>
+    <excerpt:encoded><![CDATA[анонс]]></excerpt:encoded>
+    <wp:post_id>5</wp:post_id>
+    <wp:post_date>2020-01-02 13:00:00</wp:post_date>
+    <wp:post_date_gmt>2020-01-02 10:00:00</wp:post_date_gmt>
+    <wp:comment_status>open</wp:comment_status>
+    <wp:status>publish</wp:status>
+    <wp:post_type>post</wp:post_type>
+    <wp:comment>
+      <wp:comment_id>3</wp:comment_id>
+      <wp:comment_author><![CDATA[Мария]]></wp:comment_author>
+      <wp:comment_date_gmt>2020-01-02 11:00:00</wp:comment_date_gmt>
+      <wp:comment_content><![CDATA[Ответ @ivan]]></wp:comment_content>
+      <wp:comment_approved>1</wp:comment_approved>
+      <wp:comment_type>comment</wp:comment_type>
+      <wp:comment_parent>2</wp:comment_parent>
+    </wp:comment>
+    <wp:comment>
+      <wp:comment_id>2</wp:comment_id>
+      <wp:comment_author><![CDATA[Иван]]></wp:comment_author>
+      <wp:comment_date_gmt>2020-01-02 10:30:00</wp:comment_date_gmt>
+      <wp:comment_content><![CDATA[Отличная запись]]></wp:comment_content>
+      <wp:comment_approved>1</wp:comment_approved>
+      <wp:comment_type></wp:comment_type>
+      <wp:comment_parent>0</wp:comment_parent>
+    </wp:comment>
+    <wp:comment>
+      <wp:comment_id>4</wp:comment_id>
+      <wp:comment_author><![CDATA[Бот]]></wp:comment_author>
+      <wp:comment_date_gmt>2020-01-02 12:00:00</wp:comment_date_gmt>
+      <wp:comment_content><![CDATA[дешево]]></wp:comment_content>
+      <wp:comment_approved>spam</wp:comment_approved>
+      <wp:comment_parent>0</wp:comment_parent>
+    </wp:comment>
+    <wp:comment>
+      <wp:comment_id>6</wp:comment_id>
+      <wp:comment_author><![CDATA[Другой блог]]></wp:comment_author>
+      <wp:comment_date_gmt>2020-01-02 12:00:00</wp:comment_date_gmt>
+      <wp:comment_content><![CDATA[упомянули]]></wp:comment_content>
+      <wp:comment_approved>1</wp:comment_approved>
+      <wp:comment_type>pingback</wp:comment_type>
+      <wp:comment_parent>0</wp:comment_parent>
+    </wp:comment>
+    <wp:comment>
+      <wp:comment_id>7</wp:comment_id>
+      <wp:comment_author><![CDATA[Кто-то]]></wp:comment_author>
+      <wp:comment_date_gmt>2020-01-02 12:00:00</wp:comment_date_gmt>
+      <wp:comment_content><![CDATA[ответ в пустоту]]></wp:comment_content>
+      <wp:comment_approved>1</wp:comment_approved>
+      <wp:comment_parent>42</wp:comment_parent>
+    </wp:comment>
+  </item>
+  <item>
+    <title>Черновик</title>
+    <wp:post_id>6</wp:post_id>
+    <wp:post_date>2020-02-01 10:00:00</wp:post_date>
+    <wp:post_date_gmt>0000-00-00 00:00:00</wp:post_date_gmt>
+    <wp:status>draft</wp:status>
+    <wp:post_type>post</wp:post_type>
+  </item>
+  <item>
+    <title>logo.png</title>
+    <wp:post_id>7</wp:post_id>
+    <wp:status>inherit</wp:status>
+    <wp:post_type>attachment</wp:post_type>
+  </item>
+  <item>
+    <title>О блоге</title>
+    <dc:creator><![CDATA[admin]]></dc:creator>
+    <content:encoded><![CDATA[Страница без комментариев]]></content:encoded>
+    <wp:post_id>8</wp:post_id>
+    <wp:post_date_gmt>2019-12-01 09:00:00</wp:post_date_gmt>
+    <wp:comment_status>closed</wp:comment_status>
+    <wp:status>publish</wp:status>
+    <wp:post_type>page</wp:post_type>
+  </item>
+</channel>
+</rss>`
+
+// причины пропуска по id записей архива
+func skippedReasons(report Report) map[string]string {
+	reasons := make(map[string]string)
+	for _, s := range report.Skipped {
+		reasons[s.Kind+" "+s.ID] = s.Reason
+	}
+	return reasons
+}
+
+func TestImportDisqus(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+
+	report, err := ImportDisqus(ctx, store, strings.NewReader(disqusExport))
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Posts: 1, Comments: 2}, report.Stats)
+	assert.Equal(t, map[string]string{
+		"post 11":     "thread has no comments",
+		"comment 103": "deleted",
+		"comment 105": "spam",
+		"comment 106": "thread not found",
+		"comment 107": "invalid date",
+	}, skippedReasons(report))
+
+	posts, err := store.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	post := posts[0]
+	assert.Equal(t, "Hello", post.Title)
+	assert.Equal(t, "Админ", post.Author)
+	assert.Equal(t, "https://blog.example.com/hello", post.Content)
+	assert.False(t, post.AllowComments)
+	assert.True(t, time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC).Equal(post.CreatedAt))
+
+	// ответ на удаленный комментарий поднимается к его родителю
+	assert.Equal(t, []string{"Первый & лучший by utkin", "Первый & лучший/Ответ на удаленный by Гусев"}, tree(t, store, post.ID, nil, ""))
+
+	comments, err := store.GetComments(ctx, post.ID, nil, 10, 0)
+	require.NoError(t, err)
+	assert.True(t, time.Date(2019, 5, 1, 11, 0, 0, 0, time.UTC).Equal(comments[0].CreatedAt))
+}
+
+func TestImportWordPress(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	_, err := store.CreatePost(ctx, models.Post{Title: "уже был"})
+	require.NoError(t, err)
+
+	report, err := ImportWordPress(ctx, store, strings.NewReader(wordpressExport))
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Posts: 2, Comments: 2}, report.Stats)
+	assert.Equal(t, map[string]string{
+		"post 6":    "status draft",
+		"post 7":    "unsupported post type attachment",
+		"comment 4": "spam",
+		"comment 6": "pingback",
+		"comment 7": "parent comment not found",
+	}, skippedReasons(report))
+
+	posts, err := store.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	require.Len(t, posts, 3)
+	byTitle := map[string]*models.Post{}
+	for _, p := range posts {
+		byTitle[p.Title] = p
+	}
+
+	first := byTitle["Первая запись"]
+	require.NotNil(t, first)
+	assert.Equal(t, "admin", first.Author)
+	assert.Equal(t, "Текст ссылка (https://go.dev)", first.Content)
+	assert.True(t, first.AllowComments)
+	assert.True(t, time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC).Equal(first.CreatedAt))
+	assert.False(t, byTitle["О блоге"].AllowComments)
+
+	// ответ идет в файле раньше родителя, но загружается под него
+	assert.Equal(t, []string{"Отличная запись by Иван", "Отличная запись/Ответ @ivan by Мария"}, tree(t, store, first.ID, nil, ""))
+	mentions, err := store.GetMentions(ctx, "ivan", 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, mentions, 1)
+}
+
+func TestImportArchiveErrors(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := ImportDisqus(ctx, newStore(t), strings.NewReader("<disqus><thread>"))
+	assert.Error(t, err)
+	_, err = ImportWordPress(ctx, newStore(t), strings.NewReader("<rss><channel><item><title>x</item>"))
+	assert.Error(t, err)
+}
+
+func TestResolveParentCycle(t *testing.T) {
+	a := &archiveComment{id: "a", parentID: "b"}
+	b := &archiveComment{id: "b", parentID: "a"}
+	c := &archiveComment{id: "c", parentID: "b"}
+	byID := map[string]*archiveComment{"a": a, "b": b, "c": c}
+
+	for _, comment := range []*archiveComment{c, a, b} {
+		resolveParent(comment, byID)
+		assert.True(t, comment.broken, comment.id)
+	}
+}
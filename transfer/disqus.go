@@ -0,0 +1,163 @@
+package transfer
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"graphql-comments/markup"
+	"graphql-comments/models"
+	"graphql-comments/storage"
+	"io"
+	"time"
+)
+
+// Элементы выгрузки Disqus. Атрибут dsq:id у тредов и комментариев это внутренний id Disqus,
+// по нему комментарии ссылаются на тред и на родителя
+type disqusAuthor struct {
+	Name     string `xml:"name"`
+	Username string `xml:"username"`
+}
+
+type disqusRef struct {
+	ID string `xml:"id,attr"`
+}
+
+type disqusThread struct {
+	ID        string       `xml:"id,attr"`
+	Link      string       `xml:"link"`
+	Title     string       `xml:"title"`
+	Message   string       `xml:"message"`
+	CreatedAt string       `xml:"createdAt"`
+	Author    disqusAuthor `xml:"author"`
+	IsClosed  bool         `xml:"isClosed"`
+	IsDeleted bool         `xml:"isDeleted"`
+}
+
+type disqusPost struct {
+	ID        string       `xml:"id,attr"`
+	Message   string       `xml:"message"`
+	CreatedAt string       `xml:"createdAt"`
+	Author    disqusAuthor `xml:"author"`
+	IsDeleted bool         `xml:"isDeleted"`
+	IsSpam    bool         `xml:"isSpam"`
+	Thread    disqusRef    `xml:"thread"`
+	Parent    *disqusRef   `xml:"parent"`
+}
+
+// Загружает выгрузку Disqus: треды становятся постами, комментарии с родителем ответами на него.
+// Удаленные и спамные записи и треды без комментариев пропускаются и попадают в отчет
+func ImportDisqus(ctx context.Context, store storage.Storager, r io.Reader) (Report, error) {
+	var (
+		threads  []*archiveThread
+		byID     = make(map[string]*archiveThread)
+		comments []*archiveComment
+		threadOf []string // dsq:id треда для каждого элемента comments
+	)
+
+	// выгрузки бывают большими, поэтому документ читается поэлементно
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Report{}, fmt.Errorf("failed to parse Disqus export: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "thread":
+			var t disqusThread
+			if err := dec.DecodeElement(&t, &start); err != nil {
+				return Report{}, fmt.Errorf("failed to parse Disqus thread: %w", err)
+			}
+			thread := disqusToThread(&t)
+			threads = append(threads, thread)
+			byID[t.ID] = thread
+
+		case "post":
+			var p disqusPost
+			if err := dec.DecodeElement(&p, &start); err != nil {
+				return Report{}, fmt.Errorf("failed to parse Disqus comment: %w", err)
+			}
+			comments = append(comments, disqusToComment(&p))
+			threadOf = append(threadOf, p.Thread.ID)
+		}
+	}
+
+	// комментарии могут идти в файле раньше своих тредов
+	var report Report
+	for i, c := range comments {
+		thread, ok := byID[threadOf[i]]
+		if !ok {
+			report.Skipped = append(report.Skipped, Skipped{Kind: recordComment, ID: c.id, Reason: "thread not found"})
+			continue
+		}
+		thread.comments = append(thread.comments, c)
+	}
+
+	imported, err := importArchive(ctx, store, threads, true)
+	report.Stats = imported.Stats
+	report.Skipped = append(report.Skipped, imported.Skipped...)
+	return report, err
+}
+
+func disqusToThread(t *disqusThread) *archiveThread {
+	content := markup.PlainText(t.Message)
+	if content == "" {
+		content = t.Link
+	}
+	title := t.Title
+	if title == "" {
+		title = t.Link
+	}
+
+	thread := &archiveThread{
+		id: t.ID,
+		post: Post{
+			Title:         title,
+			Author:        disqusAuthorName(t.Author),
+			Content:       content,
+			Format:        models.TextFormatPlain,
+			AllowComments: !t.IsClosed,
+			CreatedAt:     parseArchiveTime(t.CreatedAt, time.RFC3339),
+		},
+	}
+	if t.IsDeleted {
+		thread.skip = "deleted"
+	}
+	return thread
+}
+
+func disqusToComment(p *disqusPost) *archiveComment {
+	c := &archiveComment{
+		id: p.ID,
+		comment: Comment{
+			Author:    disqusAuthorName(p.Author),
+			Text:      markup.PlainText(p.Message),
+			Format:    models.TextFormatPlain,
+			CreatedAt: parseArchiveTime(p.CreatedAt, time.RFC3339),
+		},
+	}
+	if p.Parent != nil {
+		c.parentID = p.Parent.ID
+	}
+	switch {
+	case p.IsSpam:
+		c.skip = "spam"
+	case p.IsDeleted:
+		c.skip = "deleted"
+	}
+	return c
+}
+
+func disqusAuthorName(a disqusAuthor) string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return a.Username
+}
@@ -0,0 +1,435 @@
+// Пакет transfer выгружает посты с деревьями комментариев в JSON Lines и загружает их обратно.
+// Первая строка файла это заголовок с версией формата, дальше каждый пост идет перед своими комментариями,
+// а каждый комментарий перед ответами на него. В файле сохраняются id, время создания и связи между записями
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"graphql-comments/markup"
+	"graphql-comments/models"
+	"graphql-comments/storage"
+	"io"
+	"time"
+)
+
+// версия формата, увеличивается при несовместимых изменениях
+const FormatVersion = 1
+
+// сколько комментариев читать из хранилища за раз
+const pageSize = 100
+
+// сколько записей загружать в хранилище одной пачкой
+const batchSize = 500
+
+var ErrUnsupportedVersion = errors.New("unsupported export format version")
+
+// типы строк файла
+const (
+	recordHeader  = "header"
+	recordPost    = "post"
+	recordComment = "comment"
+)
+
+type Header struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+}
+
+// HTML и упоминания в файл не попадают, при загрузке они вычисляются заново
+type Post struct {
+	ID            int               `json:"id"`
+	Title         string            `json:"title"`
+	Author        string            `json:"author"`
+	Content       string            `json:"content"`
+	Format        models.TextFormat `json:"format"`
+	AllowComments bool              `json:"allowComments"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	// в файлах, выгруженных до появления черновиков, статуса нет, такие посты считаются опубликованными
+	Status    models.PostStatus `json:"status,omitempty"`
+	PublishAt *time.Time        `json:"publishAt,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+	Category  string            `json:"category,omitempty"`
+	// тред внешнего ресурса, такой пост при загрузке в хранилище с тем же тредом дает конфликт
+	Thread *models.ThreadKey `json:"thread,omitempty"`
+}
+
+type Comment struct {
+	ID        int               `json:"id"`
+	PostID    int               `json:"postId"`
+	ParentID  *int              `json:"parentId,omitempty"`
+	Author    string            `json:"author"`
+	Text      string            `json:"text"`
+	Format    models.TextFormat `json:"format"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// одна строка файла, заполнено ровно одно поле по Type
+type record struct {
+	Type    string   `json:"type"`
+	Header  *Header  `json:"header,omitempty"`
+	Post    *Post    `json:"post,omitempty"`
+	Comment *Comment `json:"comment,omitempty"`
+}
+
+// Сколько записей выгружено или загружено
+type Stats struct {
+	Posts    int
+	Comments int
+}
+
+type ExportOptions struct {
+	PostID int // выгрузить только этот пост с его комментариями, 0 выгружает все
+}
+
+type ImportOptions struct {
+	// Выдавать записям новые id, даже если хранилище пустое. В непустое хранилище записи
+	// всегда загружаются с новыми id, иначе они бы столкнулись с существующими
+	Remap bool
+}
+
+// Выгружает посты от старых к новым вместе с комментариями
+func Export(ctx context.Context, store storage.Storager, w io.Writer, opts ExportOptions) (Stats, error) {
+	var stats Stats
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	if err := enc.Encode(record{Type: recordHeader, Header: &Header{Version: FormatVersion, ExportedAt: time.Now().UTC()}}); err != nil {
+		return stats, err
+	}
+
+	var posts []*models.Post
+	if opts.PostID != 0 {
+		post, err := store.GetPost(ctx, opts.PostID)
+		if err != nil {
+			return stats, err
+		}
+		posts = []*models.Post{post}
+	} else {
+		var err error
+		if posts, err = store.GetPosts(ctx, models.PostFilter{Unpublished: true}); err != nil {
+			return stats, err
+		}
+	}
+
+	// GetPosts отдает новые посты первыми, а при загрузке удобнее сохранить исходный порядок создания
+	for i := len(posts) - 1; i >= 0; i-- {
+		p := posts[i]
+		err := enc.Encode(record{Type: recordPost, Post: &Post{
+			ID:            p.ID,
+			Title:         p.Title,
+			Author:        p.Author,
+			Content:       p.Content,
+			Format:        p.Format,
+			AllowComments: p.AllowComments,
+			CreatedAt:     p.CreatedAt,
+			Status:        p.Status,
+			PublishAt:     p.PublishAt,
+			Tags:          p.Tags,
+			Category:      p.Category,
+			Thread:        p.Thread,
+		}})
+		if err != nil {
+			return stats, err
+		}
+		stats.Posts++
+
+		n, err := exportThread(ctx, store, enc, p.ID)
+		stats.Comments += n
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, bw.Flush()
+}
+
+// Выгружает комментарии поста по уровням: сначала верхний уровень, затем все ответы на него и так далее.
+// Так при загрузке с новыми id пачку приходится сбрасывать только на границе уровней
+func exportThread(ctx context.Context, store storage.Storager, enc *json.Encoder, postID int) (int, error) {
+	count := 0
+	level := []*int{nil}
+	for len(level) > 0 {
+		var next []*int
+		for _, parentID := range level {
+			afterID := 0
+			for {
+				comments, err := store.GetComments(ctx, postID, parentID, pageSize, afterID)
+				if err != nil {
+					return count, err
+				}
+
+				for _, c := range comments {
+					err := enc.Encode(record{Type: recordComment, Comment: &Comment{
+						ID:        c.ID,
+						PostID:    c.PostID,
+						ParentID:  parentID,
+						Author:    c.Author,
+						Text:      c.Text,
+						Format:    c.Format,
+						CreatedAt: c.CreatedAt,
+					}})
+					if err != nil {
+						return count, err
+					}
+					count++
+
+					if c.HasReplies {
+						id := c.ID
+						next = append(next, &id)
+					}
+				}
+
+				if len(comments) < pageSize {
+					break
+				}
+				afterID = comments[len(comments)-1].ID
+			}
+		}
+		level = next
+	}
+	return count, nil
+}
+
+// Загружает файл, созданный Export, пачками через ImportPosts и ImportComments.
+// В пустое хранилище записи попадают с исходными id, иначе хранилище выдает новые id,
+// а ссылки комментариев на посты и родителей переводятся на них
+func Import(ctx context.Context, store storage.Storager, r io.Reader, opts ImportOptions) (Stats, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	var header record
+	if err := dec.Decode(&header); err != nil {
+		return Stats{}, fmt.Errorf("failed to read header: %w", err)
+	}
+	if header.Type != recordHeader || header.Header == nil {
+		return Stats{}, errors.New("export file must start with a header")
+	}
+	if header.Header.Version != FormatVersion {
+		return Stats{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, header.Header.Version)
+	}
+
+	// пустым считается только сайт из контекста, а id общие для всех сайтов, поэтому занятый
+	// другим сайтом id вернет ErrIDConflict и подскажет загрузить файл с Remap
+	remap := opts.Remap
+	if !remap {
+		existing, err := store.GetPosts(ctx, models.PostFilter{Unpublished: true})
+		if err != nil {
+			return Stats{}, err
+		}
+		remap = len(existing) > 0
+	}
+
+	imp := newImporter(store, remap)
+
+	for line := 2; ; line++ {
+		var rec record
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imp.stats, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		switch {
+		case rec.Type == recordPost && rec.Post != nil:
+			err = imp.addPost(ctx, rec.Post)
+			if err != nil {
+				err = fmt.Errorf("line %d: post %d: %w", line, rec.Post.ID, err)
+			}
+		case rec.Type == recordComment && rec.Comment != nil:
+			err = imp.addComment(ctx, rec.Comment)
+			if err != nil {
+				err = fmt.Errorf("line %d: comment %d: %w", line, rec.Comment.ID, err)
+			}
+		default:
+			err = fmt.Errorf("line %d: unexpected record %q", line, rec.Type)
+		}
+		if err != nil {
+			return imp.stats, err
+		}
+	}
+
+	return imp.stats, imp.finish(ctx)
+}
+
+// Копит записи в пачки и помнит, какой id из файла какому id в хранилище соответствует
+type importer struct {
+	store storage.Storager
+	remap bool
+	stats Stats
+
+	postIDs    map[int]int // id поста в файле -> id в хранилище, только для загруженных
+	commentIDs map[int]int
+
+	posts           []models.Post
+	postSources     []int // id из файла для записей пачки posts
+	pendingPosts    map[int]struct{}
+	comments        []models.Comment
+	commentSources  []int
+	pendingComments map[int]struct{}
+}
+
+func newImporter(store storage.Storager, remap bool) *importer {
+	return &importer{
+		store:           store,
+		remap:           remap,
+		postIDs:         make(map[int]int),
+		commentIDs:      make(map[int]int),
+		pendingPosts:    make(map[int]struct{}),
+		pendingComments: make(map[int]struct{}),
+	}
+}
+
+func (imp *importer) addPost(ctx context.Context, p *Post) error {
+	if _, dup := imp.postIDs[p.ID]; dup {
+		return errors.New("duplicate post")
+	}
+	if _, dup := imp.pendingPosts[p.ID]; dup {
+		return errors.New("duplicate post")
+	}
+
+	post := models.Post{
+		Title:         p.Title,
+		Author:        p.Author,
+		Content:       p.Content,
+		Format:        p.Format,
+		AllowComments: p.AllowComments,
+		CreatedAt:     p.CreatedAt,
+		Status:        p.Status,
+		PublishAt:     p.PublishAt,
+		Tags:          p.Tags,
+		Category:      p.Category,
+		Thread:        p.Thread,
+	}
+	if post.Status != "" && !post.Status.IsValid() {
+		return fmt.Errorf("invalid post status %q", post.Status)
+	}
+	if !imp.remap {
+		post.ID = p.ID
+	}
+	html, err := markup.Render(post.Content, post.Format)
+	if err != nil {
+		return err
+	}
+	post.ContentHTML = html
+
+	imp.posts = append(imp.posts, post)
+	imp.postSources = append(imp.postSources, p.ID)
+	imp.pendingPosts[p.ID] = struct{}{}
+	if len(imp.posts) >= batchSize {
+		return imp.flushPosts(ctx)
+	}
+	return nil
+}
+
+func (imp *importer) addComment(ctx context.Context, c *Comment) error {
+	// комментарию нужен id поста в хранилище, поэтому пост загружается раньше
+	if _, ok := imp.pendingPosts[c.PostID]; ok {
+		if err := imp.flushPosts(ctx); err != nil {
+			return err
+		}
+	}
+	postID, ok := imp.postIDs[c.PostID]
+	if !ok {
+		return fmt.Errorf("unknown post %d", c.PostID)
+	}
+
+	var parentID *int
+	if c.ParentID != nil {
+		// новый id родителя известен только после загрузки его пачки
+		if _, ok := imp.pendingComments[*c.ParentID]; ok && imp.remap {
+			if err := imp.flushComments(ctx); err != nil {
+				return err
+			}
+		}
+		id, ok := imp.commentIDs[*c.ParentID]
+		if _, pending := imp.pendingComments[*c.ParentID]; pending {
+			// без перевода родитель из пачки загрузится со своим id из файла
+			id, ok = *c.ParentID, true
+		}
+		if !ok {
+			return fmt.Errorf("unknown parent comment %d", *c.ParentID)
+		}
+		parentID = &id
+	}
+	if _, dup := imp.commentIDs[c.ID]; dup {
+		return errors.New("duplicate comment")
+	}
+	if _, dup := imp.pendingComments[c.ID]; dup {
+		return errors.New("duplicate comment")
+	}
+
+	comment := models.Comment{
+		PostID:    postID,
+		ParentID:  parentID,
+		Author:    c.Author,
+		Text:      c.Text,
+		Format:    c.Format,
+		Mentions:  models.ParseMentions(c.Text),
+		CreatedAt: c.CreatedAt,
+	}
+	if !imp.remap {
+		comment.ID = c.ID
+	}
+	html, err := markup.Render(comment.Text, comment.Format)
+	if err != nil {
+		return err
+	}
+	comment.HTML = html
+
+	imp.comments = append(imp.comments, comment)
+	imp.commentSources = append(imp.commentSources, c.ID)
+	imp.pendingComments[c.ID] = struct{}{}
+	if len(imp.comments) >= batchSize {
+		return imp.flushComments(ctx)
+	}
+	return nil
+}
+
+// Загружает остатки пачек
+func (imp *importer) finish(ctx context.Context) error {
+	if err := imp.flushPosts(ctx); err != nil {
+		return err
+	}
+	return imp.flushComments(ctx)
+}
+
+func (imp *importer) flushPosts(ctx context.Context) error {
+	if len(imp.posts) == 0 {
+		return nil
+	}
+	created, err := imp.store.ImportPosts(ctx, imp.posts)
+	if err != nil {
+		return fmt.Errorf("failed to import %d posts: %w", len(imp.posts), err)
+	}
+	for i, p := range created {
+		imp.postIDs[imp.postSources[i]] = p.ID
+	}
+	imp.stats.Posts += len(created)
+
+	imp.posts, imp.postSources = imp.posts[:0], imp.postSources[:0]
+	imp.pendingPosts = make(map[int]struct{})
+	return nil
+}
+
+func (imp *importer) flushComments(ctx context.Context) error {
+	if len(imp.comments) == 0 {
+		return nil
+	}
+	created, err := imp.store.ImportComments(ctx, imp.comments)
+	if err != nil {
+		return fmt.Errorf("failed to import %d comments: %w", len(imp.comments), err)
+	}
+	for i, c := range created {
+		imp.commentIDs[imp.commentSources[i]] = c.ID
+	}
+	imp.stats.Comments += len(created)
+
+	imp.comments, imp.commentSources = imp.comments[:0], imp.commentSources[:0]
+	imp.pendingComments = make(map[int]struct{})
+	return nil
+}
@@ -0,0 +1,281 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"graphql-comments/models"
+	"graphql-comments/storage"
+	"graphql-comments/storage/inmemory"
+)
+
+func newStore(t *testing.T) storage.Storager {
+	store, err := inmemory.NewMemoryStorage(nil)
+	require.NoError(t, err)
+	return store
+}
+
+// дерево комментариев поста в виде строк "родитель/текст" в порядке обхода
+func tree(t *testing.T, store storage.Storager, postID int, parentID *int, prefix string) []string {
+	comments, err := store.GetComments(context.Background(), postID, parentID, 100, 0)
+	require.NoError(t, err)
+
+	var lines []string
+	for _, c := range comments {
+		lines = append(lines, prefix+c.Text+" by "+c.Author)
+		id := c.ID
+		lines = append(lines, tree(t, store, postID, &id, prefix+c.Text+"/")...)
+	}
+	return lines
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	src := newStore(t)
+
+	// пост в приемнике уже есть, поэтому id загруженных записей сдвинутся
+	dst := newStore(t)
+	_, err := dst.CreatePost(ctx, models.Post{Title: "существующий", AllowComments: true})
+	require.NoError(t, err)
+
+	first, err := src.CreatePost(ctx, models.Post{Title: "первый", Content: "**жирный**", Format: models.TextFormatMarkdown, AllowComments: true})
+	require.NoError(t, err)
+	second, err := src.CreatePost(ctx, models.Post{Title: "второй", AllowComments: true})
+	require.NoError(t, err)
+
+	root, err := src.CreateComment(ctx, models.Comment{PostID: first.ID, Text: "корень", Author: "a"}, nil)
+	require.NoError(t, err)
+	reply, err := src.CreateComment(ctx, models.Comment{PostID: first.ID, Text: "ответ", Author: "b"}, &root.ID)
+	require.NoError(t, err)
+	_, err = src.CreateComment(ctx, models.Comment{PostID: first.ID, Text: "@a глубже", Author: "c"}, &reply.ID)
+	require.NoError(t, err)
+	_, err = src.CreateComment(ctx, models.Comment{PostID: second.ID, Text: "другой пост", Author: "d"}, nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	stats, err := Export(ctx, src, &buf, ExportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Posts: 2, Comments: 4}, stats)
+	assert.True(t, strings.HasPrefix(buf.String(), `{"type":"header","header":{"version":1,`))
+
+	stats, err = Import(ctx, dst, &buf, ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Posts: 2, Comments: 4}, stats)
+
+	posts, err := dst.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	require.Len(t, posts, 3)
+	imported := map[string]*models.Post{}
+	for _, p := range posts {
+		imported[p.Title] = p
+	}
+
+	assert.Equal(t, "<p><strong>жирный</strong></p>", imported["первый"].ContentHTML)
+	assert.Equal(t, tree(t, src, first.ID, nil, ""), tree(t, dst, imported["первый"].ID, nil, ""))
+	assert.Equal(t, tree(t, src, second.ID, nil, ""), tree(t, dst, imported["второй"].ID, nil, ""))
+
+	// упоминания вычисляются заново
+	mentions, err := dst.GetMentions(ctx, "a", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, mentions, 1)
+	assert.Equal(t, imported["первый"].ID, mentions[0].PostID)
+}
+
+func TestImportPreservesIDs(t *testing.T) {
+	ctx := context.Background()
+	src := newStore(t)
+
+	// в источнике есть пропуски в id, чтобы было видно, что они не пересчитываются
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	posts, err := src.ImportPosts(ctx, []models.Post{
+		{ID: 4, Title: "закрытый", CreatedAt: created},
+		{ID: 9, Title: "открытый", AllowComments: true, CreatedAt: created.Add(time.Hour)},
+	})
+	require.NoError(t, err)
+	parent := 20
+	_, err = src.ImportComments(ctx, []models.Comment{
+		{ID: 20, PostID: 4, Text: "до закрытия", Author: "a", CreatedAt: created.Add(time.Minute)},
+		{ID: 31, PostID: 4, ParentID: &parent, Text: "ответ", Author: "b", CreatedAt: created.Add(2 * time.Minute)},
+		{ID: 25, PostID: 9, Text: "второй пост", Author: "c", CreatedAt: created.Add(2 * time.Hour)},
+	})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = Export(ctx, src, &buf, ExportOptions{})
+	require.NoError(t, err)
+
+	dst := newStore(t)
+	stats, err := Import(ctx, dst, &buf, ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Posts: 2, Comments: 3}, stats)
+
+	for _, p := range posts {
+		got, err := dst.GetPost(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, p.Title, got.Title)
+		assert.True(t, p.CreatedAt.Equal(got.CreatedAt))
+	}
+	reply, err := dst.GetComment(ctx, 31)
+	require.NoError(t, err)
+	require.NotNil(t, reply.ParentID)
+	assert.Equal(t, 20, *reply.ParentID)
+	assert.True(t, created.Add(2*time.Minute).Equal(reply.CreatedAt))
+	assert.Equal(t, tree(t, src, 4, nil, ""), tree(t, dst, 4, nil, ""))
+
+	// после загрузки новые записи получают id больше загруженных
+	next, err := dst.CreatePost(ctx, models.Post{Title: "новый"})
+	require.NoError(t, err)
+	assert.Equal(t, 10, next.ID)
+}
+
+func TestExportSinglePost(t *testing.T) {
+	ctx := context.Background()
+	src := newStore(t)
+
+	_, err := src.CreatePost(ctx, models.Post{Title: "лишний", AllowComments: true})
+	require.NoError(t, err)
+	post, err := src.CreatePost(ctx, models.Post{Title: "нужный", AllowComments: true})
+	require.NoError(t, err)
+
+	// длинная ветка и много ответов на одном уровне, чтобы загрузка шла несколькими пачками
+	parent := (*int)(nil)
+	for i := 0; i < 5; i++ {
+		c, err := src.CreateComment(ctx, models.Comment{PostID: post.ID, Text: fmt.Sprintf("уровень %d", i), Author: "a"}, parent)
+		require.NoError(t, err)
+		parent = &c.ID
+	}
+	for i := 0; i < batchSize+10; i++ {
+		_, err := src.CreateComment(ctx, models.Comment{PostID: post.ID, Text: fmt.Sprintf("ответ %d", i), Author: "b"}, parent)
+		require.NoError(t, err)
+	}
+
+	var buf bytes.Buffer
+	stats, err := Export(ctx, src, &buf, ExportOptions{PostID: post.ID})
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Posts: 1, Comments: batchSize + 15}, stats)
+	dump := buf.String()
+
+	// загрузка обратно в источник переводит id, исходный пост остается нетронутым
+	stats, err = Import(ctx, src, strings.NewReader(dump), ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Posts: 1, Comments: batchSize + 15}, stats)
+
+	posts, err := src.GetPosts(ctx, models.PostFilter{})
+	require.NoError(t, err)
+	require.Len(t, posts, 3)
+	assert.Equal(t, "нужный", posts[0].Title)
+	assert.NotEqual(t, post.ID, posts[0].ID)
+	assert.Equal(t, tree(t, src, post.ID, nil, ""), tree(t, src, posts[0].ID, nil, ""))
+
+	// в пустое хранилище с -remap пост тоже получает новый id
+	dst := newStore(t)
+	_, err = Import(ctx, dst, strings.NewReader(dump), ImportOptions{Remap: true})
+	require.NoError(t, err)
+	_, err = dst.GetPost(ctx, 1)
+	require.NoError(t, err)
+
+	_, err = Export(ctx, src, &buf, ExportOptions{PostID: 1337})
+	assert.ErrorIs(t, err, models.ErrPostNotFound)
+}
+
+func TestImportErrors(t *testing.T) {
+	ctx := context.Background()
+	tests := map[string]string{
+		"no header":      `{"type":"post","post":{"id":1,"title":"x"}}`,
+		"future version": `{"type":"header","header":{"version":99}}`,
+		"unknown post": `{"type":"header","header":{"version":1}}
+{"type":"comment","comment":{"id":1,"postId":5,"text":"x"}}`,
+		"unknown parent": `{"type":"header","header":{"version":1}}
+{"type":"post","post":{"id":1,"title":"x","allowComments":true}}
+{"type":"comment","comment":{"id":2,"postId":1,"parentId":7,"text":"x"}}`,
+		"duplicate comment": `{"type":"header","header":{"version":1}}
+{"type":"post","post":{"id":1,"title":"x"}}
+{"type":"comment","comment":{"id":2,"postId":1,"text":"x"}}
+{"type":"comment","comment":{"id":2,"postId":1,"text":"y"}}`,
+		"unknown record": `{"type":"header","header":{"version":1}}
+{"type":"vote"}`,
+		"broken json": `{"type":"header","header":{"version":1}}
+{"type":`,
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Import(ctx, newStore(t), strings.NewReader(input), ImportOptions{})
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := Import(ctx, newStore(t), strings.NewReader(tests["future version"]), ImportOptions{})
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+}
+
+func TestExportImportKeepsStatusAndTags(t *testing.T) {
+	ctx := context.Background()
+	src := newStore(t)
+
+	later := time.Now().Add(time.Hour).UTC()
+	_, err := src.CreatePost(ctx, models.Post{Title: "черновик", Status: models.PostStatusDraft, Tags: []string{"go", "sql"}, Category: "разработка"})
+	require.NoError(t, err)
+	_, err = src.CreatePost(ctx, models.Post{Title: "позже", Status: models.PostStatusScheduled, PublishAt: &later})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	stats, err := Export(ctx, src, &buf, ExportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Posts)
+
+	dst := newStore(t)
+	_, err = Import(ctx, dst, &buf, ImportOptions{})
+	require.NoError(t, err)
+
+	posts, err := dst.GetPosts(ctx, models.PostFilter{Unpublished: true})
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	imported := map[string]*models.Post{}
+	for _, p := range posts {
+		imported[p.Title] = p
+	}
+	assert.Equal(t, models.PostStatusDraft, imported["черновик"].Status)
+	assert.Nil(t, imported["черновик"].PublishAt)
+	assert.Equal(t, []string{"go", "sql"}, imported["черновик"].Tags)
+	assert.Equal(t, "разработка", imported["черновик"].Category)
+	assert.Equal(t, models.PostStatusScheduled, imported["позже"].Status)
+	if assert.NotNil(t, imported["позже"].PublishAt) {
+		assert.True(t, later.Equal(*imported["позже"].PublishAt))
+	}
+}
+
+func TestExportImportKeepsThreads(t *testing.T) {
+	ctx := context.Background()
+	src := newStore(t)
+
+	key := models.ThreadKey{Namespace: "blog", Key: "https://example.com/a"}
+	thread, err := src.GetOrCreateThread(ctx, key)
+	require.NoError(t, err)
+	_, err = src.CreateComment(ctx, models.Comment{PostID: thread.ID, Text: "к странице", Author: "a"}, nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	stats, err := Export(ctx, src, &buf, ExportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Posts: 1, Comments: 1}, stats)
+	dump := buf.String()
+
+	dst := newStore(t)
+	_, err = Import(ctx, dst, strings.NewReader(dump), ImportOptions{Remap: true})
+	require.NoError(t, err)
+	imported, err := dst.GetThread(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, tree(t, src, thread.ID, nil, ""), tree(t, dst, imported.ID, nil, ""))
+
+	// второй тред того же ресурса не появляется даже с новыми id
+	_, err = Import(ctx, dst, strings.NewReader(dump), ImportOptions{Remap: true})
+	assert.ErrorIs(t, err, models.ErrIDConflict)
+}
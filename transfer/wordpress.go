@@ -0,0 +1,132 @@
+package transfer
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"graphql-comments/markup"
+	"graphql-comments/models"
+	"graphql-comments/storage"
+	"io"
+	"strings"
+	"time"
+)
+
+// формат дат в WXR, время *_gmt в UTC
+const wordpressTimeLayout = "2006-01-02 15:04:05"
+
+// Элемент item из WXR. Пространство имен wp меняется от версии к версии формата,
+// поэтому поля wp:* объявлены без него, а content:encoded с ним, иначе его не отличить от excerpt:encoded
+type wordpressItem struct {
+	Title         string             `xml:"title"`
+	Link          string             `xml:"link"`
+	Creator       string             `xml:"creator"`
+	Content       string             `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PostID        string             `xml:"post_id"`
+	PostDate      string             `xml:"post_date"`
+	PostDateGMT   string             `xml:"post_date_gmt"`
+	CommentStatus string             `xml:"comment_status"`
+	Status        string             `xml:"status"`
+	PostType      string             `xml:"post_type"`
+	Comments      []wordpressComment `xml:"comment"`
+}
+
+type wordpressComment struct {
+	ID       string `xml:"comment_id"`
+	Author   string `xml:"comment_author"`
+	Date     string `xml:"comment_date"`
+	DateGMT  string `xml:"comment_date_gmt"`
+	Content  string `xml:"comment_content"`
+	Approved string `xml:"comment_approved"`
+	Type     string `xml:"comment_type"`
+	ParentID string `xml:"comment_parent"`
+}
+
+// Загружает выгрузку WordPress (WXR): опубликованные записи и страницы становятся постами,
+// одобренные комментарии комментариями к ним. Черновики, вложения, неодобренные комментарии,
+// спам и пингбэки пропускаются и попадают в отчет
+func ImportWordPress(ctx context.Context, store storage.Storager, r io.Reader) (Report, error) {
+	var threads []*archiveThread
+
+	// выгрузки бывают большими, поэтому документ читается поэлементно
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Report{}, fmt.Errorf("failed to parse WordPress export: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "item" {
+			continue
+		}
+
+		var item wordpressItem
+		if err := dec.DecodeElement(&item, &start); err != nil {
+			return Report{}, fmt.Errorf("failed to parse WordPress item: %w", err)
+		}
+		threads = append(threads, wordpressToThread(&item))
+	}
+
+	return importArchive(ctx, store, threads, false)
+}
+
+func wordpressToThread(item *wordpressItem) *archiveThread {
+	title := item.Title
+	if title == "" {
+		title = item.Link
+	}
+	thread := &archiveThread{
+		id: item.PostID,
+		post: Post{
+			Title:         title,
+			Author:        item.Creator,
+			Content:       markup.PlainText(item.Content),
+			Format:        models.TextFormatPlain,
+			AllowComments: item.CommentStatus == "open",
+			CreatedAt:     wordpressTime(item.PostDateGMT, item.PostDate),
+		},
+	}
+	switch {
+	case item.PostType != "post" && item.PostType != "page":
+		thread.skip = "unsupported post type " + item.PostType
+	case item.Status != "publish":
+		thread.skip = "status " + item.Status
+	}
+
+	for i := range item.Comments {
+		c := &item.Comments[i]
+		comment := &archiveComment{
+			id: c.ID,
+			comment: Comment{
+				Author:    c.Author,
+				Text:      markup.PlainText(c.Content),
+				Format:    models.TextFormatPlain,
+				CreatedAt: wordpressTime(c.DateGMT, c.Date),
+			},
+		}
+		if parent := strings.TrimSpace(c.ParentID); parent != "" && parent != "0" {
+			comment.parentID = parent
+		}
+		switch {
+		case c.Type == "pingback" || c.Type == "trackback":
+			comment.skip = c.Type
+		case c.Approved == "spam" || c.Approved == "trash":
+			comment.skip = c.Approved
+		case c.Approved != "1":
+			comment.skip = "not approved"
+		}
+		thread.comments = append(thread.comments, comment)
+	}
+	return thread
+}
+
+// У черновиков и старых записей время в GMT бывает нулевым, тогда берется местное время сайта
+func wordpressTime(gmt, local string) time.Time {
+	if t := parseArchiveTime(gmt, wordpressTimeLayout); !t.IsZero() {
+		return t
+	}
+	return parseArchiveTime(local, wordpressTimeLayout)
+}